@@ -0,0 +1,461 @@
+pragma solidity ^0.6.10;
+pragma experimental ABIEncoderV2;
+
+/**
+ * 溯源流程合约 v2.0
+ *
+ * 流程说明：货物由生产商创建，经一个或多个运输商分段运输（如陆运、海运、中转），港口验货，最终到达经销商
+ * 与 v1.0 的区别：
+ *   - 运输记录改为按顺序追加的运输段列表，每段记录承运公司、起止地点和运单号
+ *   - 验货后不允许再追加运输段
+ *   - getFullTrace 中的运输字段为第一段运输，并返回运输段数量，各段详情通过 getTransportLeg 查询
+ *   - 验货记录区分合格与不合格，不合格的货物不能交付，可由港口重新验货，或隔离、退回生产商、销毁
+ *   - getFullTrace 中的验货字段为最近一次验货，历次验货和处置记录通过 getInspection、getDisposition 查询
+ *   - 公司管理员可登记本公司的操作员地址，各环节由操作员以自己的地址签名，链上记录实际操作人
+ *
+ * 已由 TraceabilityV3 取代，服务端不再使用本合约；从本合约或 v1.0 切换到 V3 的步骤见 TraceabilityV3.sol 的部署说明
+ */
+contract TraceabilityV2 {
+    // 公司类型枚举
+    enum CompanyType { Producer, Shipper, Port, Dealer }
+
+    // 货物处置状态：验货不合格后的流转
+    enum GoodState { Normal, Rejected, Quarantined, Returned, Destroyed }
+
+    // 公司结构
+    struct Company {
+        uint256 id;
+        string name;
+        CompanyType companyType;
+        address admin;
+        bool exists;
+    }
+
+    // 货物结构
+    struct Good {
+        string goodId;
+        uint256 ownerCompanyId;
+        string goodName;
+        uint256 registerTime;
+        bool exists;
+    }
+
+    // 运输段
+    struct TransportLeg {
+        uint256 shipCompanyId;
+        address operatorAddr;
+        string fromLocation;
+        string toLocation;
+        string trackingNumber;
+        string transportInfo;
+        uint256 time;
+    }
+
+    // 验货记录
+    struct InspectionRecord {
+        uint256 portCompanyId;
+        address operatorAddr;
+        string inspectionInfo;
+        bool passed;
+        string reason;
+        uint256 time;
+    }
+
+    // 处置记录（隔离、退回、销毁）
+    struct DispositionRecord {
+        uint256 companyId;
+        address operatorAddr;
+        GoodState state;
+        string reason;
+        uint256 time;
+    }
+
+    // 交付记录
+    struct DeliveryRecord {
+        uint256 dealerCompanyId;
+        address operatorAddr;
+        string deliveryInfo;
+        uint256 time;
+        bool exists;
+    }
+
+    // 完整溯源记录结构体
+    struct TraceRecord {
+        // 货物信息
+        string goodId;
+        uint256 ownerCompanyId;
+        string goodName;
+        uint256 registerTime;
+
+        // 运输信息（第一段运输）
+        uint256 shipCompanyId;
+        address shipOperatorAddr;
+        string transportInfo;
+        uint256 shipTime;
+        bool shipExists;
+        uint256 transportLegCount;
+
+        // 验货信息（最近一次验货）
+        uint256 portCompanyId;
+        address inspectOperatorAddr;
+        string inspectionInfo;
+        uint256 inspectTime;
+        bool inspectExists;
+        bool inspectPassed;
+        string inspectReason;
+        uint256 inspectionCount;
+
+        // 处置信息
+        GoodState goodState;
+        uint256 dispositionCount;
+
+        // 交付信息
+        uint256 dealerCompanyId;
+        address deliveryOperatorAddr;
+        string deliveryInfo;
+        uint256 deliveryTime;
+        bool deliveryExists;
+    }
+
+    // 变量声明
+    address public superAdmin;
+    uint256 public companyCount = 0;
+
+    mapping(uint256 => Company) public companies;
+    mapping(address => uint256) public companyOfAdmin;
+    mapping(address => uint256) public companyOfOperator;
+
+    mapping(string => Good) private goods;
+    mapping(string => TransportLeg[]) private transportLegs;
+    mapping(string => InspectionRecord[]) private inspectionRecords;
+    mapping(string => DispositionRecord[]) private dispositionRecords;
+    mapping(string => GoodState) private goodStates;
+    mapping(string => DeliveryRecord) private deliveryRecords;
+
+    // 事件声明
+    event CompanyRegistered(uint256 indexed id, string name, CompanyType companyType, address admin);
+    event OperatorRegistered(uint256 indexed companyId, address operator);
+    event OperatorRemoved(uint256 indexed companyId, address operator);
+    event GoodRegistered(string indexed goodId, uint256 ownerCompanyId, string goodName, uint256 registerTime);
+    event Shipped(
+        string indexed goodId,
+        uint256 legIndex,
+        uint256 shipCompanyId,
+        address operatorAddr,
+        string fromLocation,
+        string toLocation,
+        string trackingNumber,
+        string info,
+        uint256 time
+    );
+    event Inspected(
+        string indexed goodId,
+        uint256 portCompanyId,
+        address operatorAddr,
+        string info,
+        bool passed,
+        string reason,
+        uint256 time
+    );
+    event Disposed(string indexed goodId, uint256 companyId, address operatorAddr, GoodState state, string reason, uint256 time);
+    event Delivered(string indexed goodId, uint256 dealerCompanyId, address operatorAddr, string info, uint256 time);
+
+    // 修饰符
+    modifier onlySuperAdmin() {
+        require(msg.sender == superAdmin, "只有超级管理员可执行此操作");
+        _;
+    }
+
+    modifier onlyCompany(CompanyType companyType) {
+        uint256 companyId = companyOf(msg.sender);
+        require(companies[companyId].exists, "公司不存在");
+        require(companies[companyId].companyType == companyType, "公司类型不匹配");
+        _;
+    }
+
+    // 构造函数
+    constructor() public {
+        superAdmin = msg.sender;
+    }
+
+    // 注册公司 (仅超级管理员)
+    function registerCompany(
+        string memory name,
+        CompanyType companyType,
+        address admin
+    ) public onlySuperAdmin returns (uint256) {
+        companyCount++;
+        companies[companyCount] = Company(companyCount, name, companyType, admin, true);
+        companyOfAdmin[admin] = companyCount;
+        emit CompanyRegistered(companyCount, name, companyType, admin);
+        return companyCount;
+    }
+
+    // 账户所属公司：公司管理员或已登记的操作员，均不属于时返回0
+    function companyOf(address account) public view returns (uint256) {
+        uint256 companyId = companyOfAdmin[account];
+        if (companyId != 0) {
+            return companyId;
+        }
+        return companyOfOperator[account];
+    }
+
+    // 登记操作员 (仅公司管理员，操作员归属管理员所在公司)
+    function registerOperator(address operator) public returns (bool) {
+        uint256 companyId = companyOfAdmin[msg.sender];
+        require(companies[companyId].exists, "只有公司管理员可执行此操作");
+        require(companyOf(operator) == 0, "该地址已属于其他公司");
+
+        companyOfOperator[operator] = companyId;
+        emit OperatorRegistered(companyId, operator);
+        return true;
+    }
+
+    // 移除操作员 (仅公司管理员)
+    function removeOperator(address operator) public returns (bool) {
+        uint256 companyId = companyOfAdmin[msg.sender];
+        require(companies[companyId].exists, "只有公司管理员可执行此操作");
+        require(companyOfOperator[operator] == companyId, "该操作员不属于本公司");
+
+        delete companyOfOperator[operator];
+        emit OperatorRemoved(companyId, operator);
+        return true;
+    }
+
+    // 注册货物 (仅生产商)
+    function registerGood(
+        string memory goodId,
+        string memory goodName
+    ) public onlyCompany(CompanyType.Producer) returns (bool) {
+        uint256 companyId = companyOf(msg.sender);
+        require(!goods[goodId].exists, "货物ID已存在");
+
+        goods[goodId] = Good(goodId, companyId, goodName, block.timestamp, true);
+        emit GoodRegistered(goodId, companyId, goodName, block.timestamp);
+        return true;
+    }
+
+    // 运输商追加运输段，返回运输段序号（从0开始）
+    function shipGood(
+        string memory goodId,
+        string memory fromLocation,
+        string memory toLocation,
+        string memory trackingNumber,
+        string memory transportInfo
+    ) public onlyCompany(CompanyType.Shipper) returns (uint256) {
+        require(goods[goodId].exists, "货物不存在");
+        require(inspectionRecords[goodId].length == 0, "该货物已验货，不能追加运输记录");
+
+        transportLegs[goodId].push(TransportLeg(
+            companyOf(msg.sender), msg.sender, fromLocation, toLocation, trackingNumber, transportInfo, block.timestamp
+        ));
+        uint256 legIndex = transportLegs[goodId].length - 1;
+        emitShipped(goodId, legIndex);
+        return legIndex;
+    }
+
+    // 触发运输事件，单独拆分以避免 shipGood 中局部变量过多
+    function emitShipped(string memory goodId, uint256 legIndex) private {
+        TransportLeg storage leg = transportLegs[goodId][legIndex];
+        emit Shipped(
+            goodId, legIndex, leg.shipCompanyId, leg.operatorAddr,
+            leg.fromLocation, leg.toLocation, leg.trackingNumber, leg.transportInfo, leg.time
+        );
+    }
+
+    // 港口登记验货，不合格或隔离中的货物可重新验货
+    function inspectGood(
+        string memory goodId,
+        string memory inspectionInfo,
+        bool passed,
+        string memory reason
+    ) public onlyCompany(CompanyType.Port) returns (bool) {
+        require(goods[goodId].exists, "货物不存在");
+        require(transportLegs[goodId].length > 0, "该货物未有运输记录");
+        require(!isInspectionPassed(goodId), "该货物已有验货记录");
+        GoodState state = goodStates[goodId];
+        require(state != GoodState.Returned && state != GoodState.Destroyed, "货物已退回或销毁");
+
+        inspectionRecords[goodId].push(InspectionRecord(
+            companyOf(msg.sender), msg.sender, inspectionInfo, passed, reason, block.timestamp
+        ));
+        goodStates[goodId] = passed ? GoodState.Normal : GoodState.Rejected;
+        emitInspected(goodId, inspectionRecords[goodId].length - 1);
+        return true;
+    }
+
+    // 触发验货事件，单独拆分以避免 inspectGood 中局部变量过多
+    function emitInspected(string memory goodId, uint256 index) private {
+        InspectionRecord storage r = inspectionRecords[goodId][index];
+        emit Inspected(goodId, r.portCompanyId, r.operatorAddr, r.inspectionInfo, r.passed, r.reason, r.time);
+    }
+
+    // 港口处置验货不合格的货物：隔离、退回生产商或销毁
+    function disposeGood(
+        string memory goodId,
+        GoodState state,
+        string memory reason
+    ) public onlyCompany(CompanyType.Port) returns (bool) {
+        require(goods[goodId].exists, "货物不存在");
+        GoodState current = goodStates[goodId];
+        require(current == GoodState.Rejected || current == GoodState.Quarantined, "只有验货不合格的货物可以处置");
+        require(state == GoodState.Quarantined || state == GoodState.Returned || state == GoodState.Destroyed, "无效的处置类型");
+        require(!(state == GoodState.Quarantined && current == GoodState.Quarantined), "货物已在隔离中");
+
+        uint256 companyId = companyOf(msg.sender);
+        dispositionRecords[goodId].push(DispositionRecord(companyId, msg.sender, state, reason, block.timestamp));
+        goodStates[goodId] = state;
+        emit Disposed(goodId, companyId, msg.sender, state, reason, block.timestamp);
+        return true;
+    }
+
+    // 最近一次验货是否合格
+    function isInspectionPassed(string memory goodId) private view returns (bool) {
+        uint256 count = inspectionRecords[goodId].length;
+        return count > 0 && inspectionRecords[goodId][count - 1].passed;
+    }
+
+    // 经销商收货登记
+    function deliverGood(
+        string memory goodId,
+        string memory deliveryInfo
+    ) public onlyCompany(CompanyType.Dealer) returns (bool) {
+        require(goods[goodId].exists, "货物不存在");
+        require(transportLegs[goodId].length > 0, "该货物未有运输记录");
+        require(inspectionRecords[goodId].length > 0, "该货物未有验货记录");
+        require(isInspectionPassed(goodId), "该货物未通过验货");
+        uint256 companyId = companyOf(msg.sender);
+        require(!deliveryRecords[goodId].exists, "该货物已有收货记录");
+
+        deliveryRecords[goodId] = DeliveryRecord(companyId, msg.sender, deliveryInfo, block.timestamp, true);
+        emit Delivered(goodId, companyId, msg.sender, deliveryInfo, block.timestamp);
+        return true;
+    }
+
+    // 查询货物信息
+    function getGood(string memory goodId)
+        public
+        view
+        returns (string memory, uint256, string memory, uint256, bool)
+    {
+        Good storage g = goods[goodId];
+        return (g.goodId, g.ownerCompanyId, g.goodName, g.registerTime, g.exists);
+    }
+
+    // 查询运输段数量
+    function getTransportLegCount(string memory goodId) public view returns (uint256) {
+        return transportLegs[goodId].length;
+    }
+
+    // 查询指定运输段
+    function getTransportLeg(string memory goodId, uint256 legIndex)
+        public
+        view
+        returns (TransportLeg memory)
+    {
+        require(legIndex < transportLegs[goodId].length, "运输段不存在");
+        return transportLegs[goodId][legIndex];
+    }
+
+    // 查询指定的一次验货记录
+    function getInspection(string memory goodId, uint256 index)
+        public
+        view
+        returns (InspectionRecord memory)
+    {
+        require(index < inspectionRecords[goodId].length, "验货记录不存在");
+        return inspectionRecords[goodId][index];
+    }
+
+    // 查询指定的处置记录
+    function getDisposition(string memory goodId, uint256 index)
+        public
+        view
+        returns (DispositionRecord memory)
+    {
+        require(index < dispositionRecords[goodId].length, "处置记录不存在");
+        return dispositionRecords[goodId][index];
+    }
+
+    // 查询收货记录
+    function getDeliveryRecord(string memory goodId)
+        public
+        view
+        returns (uint256, address, string memory, uint256, bool)
+    {
+        DeliveryRecord storage d = deliveryRecords[goodId];
+        return (d.dealerCompanyId, d.operatorAddr, d.deliveryInfo, d.time, d.exists);
+    }
+
+    // 获取完整溯源信息，运输字段为第一段运输
+    function getFullTrace(string memory goodId)
+        public
+        view
+        returns (TraceRecord memory trace)
+    {
+        Good storage g = goods[goodId];
+        DeliveryRecord storage d = deliveryRecords[goodId];
+
+        // 货物信息
+        trace.goodId = g.goodId;
+        trace.ownerCompanyId = g.ownerCompanyId;
+        trace.goodName = g.goodName;
+        trace.registerTime = g.registerTime;
+
+        // 运输信息
+        trace.transportLegCount = transportLegs[goodId].length;
+        if (trace.transportLegCount > 0) {
+            TransportLeg storage s = transportLegs[goodId][0];
+            trace.shipCompanyId = s.shipCompanyId;
+            trace.shipOperatorAddr = s.operatorAddr;
+            trace.transportInfo = s.transportInfo;
+            trace.shipTime = s.time;
+            trace.shipExists = true;
+        }
+
+        // 验货信息
+        trace.inspectionCount = inspectionRecords[goodId].length;
+        if (trace.inspectionCount > 0) {
+            InspectionRecord storage i = inspectionRecords[goodId][trace.inspectionCount - 1];
+            trace.portCompanyId = i.portCompanyId;
+            trace.inspectOperatorAddr = i.operatorAddr;
+            trace.inspectionInfo = i.inspectionInfo;
+            trace.inspectTime = i.time;
+            trace.inspectExists = true;
+            trace.inspectPassed = i.passed;
+            trace.inspectReason = i.reason;
+        }
+
+        // 处置信息
+        trace.goodState = goodStates[goodId];
+        trace.dispositionCount = dispositionRecords[goodId].length;
+
+        // 交付信息
+        trace.dealerCompanyId = d.dealerCompanyId;
+        trace.deliveryOperatorAddr = d.operatorAddr;
+        trace.deliveryInfo = d.deliveryInfo;
+        trace.deliveryTime = d.time;
+        trace.deliveryExists = d.exists;
+    }
+
+    // 获取货物当前状态：0-已创建 1-已运输 2-已验货 3-已交付 4-验货不合格 5-隔离中 6-已退回 7-已销毁
+    function getGoodStatus(string memory goodId) public view returns (uint8) {
+        if (!goods[goodId].exists) {
+            revert("货物不存在");
+        }
+
+        GoodState state = goodStates[goodId];
+        if (state != GoodState.Normal) {
+            return uint8(state) + 3;
+        }
+        if (deliveryRecords[goodId].exists) {
+            return 3; // 已交付
+        } else if (inspectionRecords[goodId].length > 0) {
+            return 2; // 已验货
+        } else if (transportLegs[goodId].length > 0) {
+            return 1; // 已运输
+        } else {
+            return 0; // 已创建
+        }
+    }
+}
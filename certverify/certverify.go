@@ -0,0 +1,265 @@
+// Package certverify 溯源证书的签名与核验
+//
+// 证书为规范化JSON文档，由服务端Ed25519私钥签名，列出货物各环节的上链交易哈希和区块高度。
+// 本包只依赖标准库，可单独引入，买家无需信任溯源系统界面即可离线核验证书：
+//
+//	data, _ := os.ReadFile("certificate.json")
+//	cert, err := certverify.Verify(data, trustedKey)
+//
+// trustedKey 为通过可信渠道取得的服务端公钥（GET /api/public/certificates/key），
+// 传 nil 时使用证书中附带的公钥，此时只能证明证书未被篡改，还需比对 KeyID 确认签发方。
+// 证书中的交易哈希可在区块链浏览器或节点上进一步核对。
+package certverify
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// 证书格式版本和签名算法
+const (
+	Version   = 1
+	Algorithm = "Ed25519"
+)
+
+// 核验错误
+var (
+	ErrMalformed        = errors.New("证书格式错误")
+	ErrUnsupported      = errors.New("不支持的证书版本或签名算法")
+	ErrUntrustedKey     = errors.New("证书不是由受信任的密钥签发")
+	ErrInvalidSignature = errors.New("证书签名无效")
+)
+
+// Stage 货物的一个环节及其上链记录
+type Stage struct {
+	Stage       string `json:"stage"`            // production | transport | inspection | disposition | delivery
+	Index       int    `json:"index"`            // 同类环节中的序号，从0开始
+	Company     string `json:"company"`          // 经手公司，公司设置不公开时为空
+	Time        string `json:"time"`             // 环节发生时间
+	Result      string `json:"result,omitempty"` // 验货结论或处置结果
+	TxHash      string `json:"tx_hash"`
+	BlockNumber int64  `json:"block_number"` // 交易所在区块，未确认时为0
+	ChainStatus string `json:"chain_status"`
+}
+
+// Certificate 溯源证书内容，签名覆盖其规范化JSON
+type Certificate struct {
+	Version         int     `json:"version"`
+	Serial          string  `json:"serial"`
+	IssuedAt        string  `json:"issued_at"` // RFC 3339
+	KeyID           string  `json:"key_id"`
+	ContractAddress string  `json:"contract_address"`
+	GoodID          string  `json:"good_id"`
+	GoodName        string  `json:"good_name"`
+	BatchNumber     string  `json:"batch_number"`
+	Producer        string  `json:"producer"`
+	Status          string  `json:"status"`
+	Stages          []Stage `json:"stages"`
+}
+
+// SignedCertificate 签名后的证书文档
+type SignedCertificate struct {
+	Certificate Certificate `json:"certificate"`
+	Algorithm   string      `json:"algorithm"`
+	PublicKey   string      `json:"public_key"` // Base64编码的Ed25519公钥
+	Signature   string      `json:"signature"`  // Base64编码，对 Canonical(certificate) 的签名
+}
+
+// signedDocument 核验时按原始内容读取证书，文档中的所有字段都在签名范围内
+type signedDocument struct {
+	Certificate json.RawMessage `json:"certificate"`
+	Algorithm   string          `json:"algorithm"`
+	PublicKey   string          `json:"public_key"`
+	Signature   string          `json:"signature"`
+}
+
+// KeyID 公钥标识，为公钥SHA-256摘要的前8字节
+func KeyID(publicKey ed25519.PublicKey) string {
+	digest := sha256.Sum256(publicKey)
+	return hex.EncodeToString(digest[:8])
+}
+
+// EncodePublicKey 公钥的Base64编码
+func EncodePublicKey(publicKey ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(publicKey)
+}
+
+// ParsePublicKey 解析Base64编码的公钥
+func ParsePublicKey(value string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: 公钥无效", ErrMalformed)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// Sign 签发证书，填写版本和密钥标识后对规范化JSON签名
+func Sign(cert Certificate, privateKey ed25519.PrivateKey) (*SignedCertificate, error) {
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	cert.Version = Version
+	cert.KeyID = KeyID(publicKey)
+	if cert.Stages == nil {
+		cert.Stages = []Stage{}
+	}
+	payload, err := Canonical(cert)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedCertificate{
+		Certificate: cert,
+		Algorithm:   Algorithm,
+		PublicKey:   EncodePublicKey(publicKey),
+		Signature:   base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, payload)),
+	}, nil
+}
+
+// Verify 核验证书文档，trusted 不为nil时要求证书由该公钥签发，返回证书内容
+// 文档可以是任意排版，核验前按规范化JSON重新编码
+func Verify(data []byte, trusted ed25519.PublicKey) (*Certificate, error) {
+	var doc signedDocument
+	if err := json.Unmarshal(data, &doc); err != nil || len(doc.Certificate) == 0 {
+		return nil, ErrMalformed
+	}
+	if doc.Algorithm != Algorithm {
+		return nil, ErrUnsupported
+	}
+	publicKey, err := ParsePublicKey(doc.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if trusted != nil && !publicKey.Equal(trusted) {
+		return nil, ErrUntrustedKey
+	}
+	signature, err := base64.StdEncoding.DecodeString(doc.Signature)
+	if err != nil || len(signature) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("%w: 签名无效", ErrMalformed)
+	}
+
+	payload, err := CanonicalizeJSON(doc.Certificate)
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	if !ed25519.Verify(publicKey, payload, signature) {
+		return nil, ErrInvalidSignature
+	}
+
+	var cert Certificate
+	if err := json.Unmarshal(doc.Certificate, &cert); err != nil {
+		return nil, ErrMalformed
+	}
+	if cert.Version != Version {
+		return nil, ErrUnsupported
+	}
+	if cert.KeyID != KeyID(publicKey) {
+		return nil, ErrInvalidSignature
+	}
+	return &cert, nil
+}
+
+// Canonical 值的规范化JSON编码
+func Canonical(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return CanonicalizeJSON(data)
+}
+
+// CanonicalizeJSON 将JSON文本重新编码为规范形式：
+// 对象的键按字节序排列，不含空白，字符串只转义引号、反斜杠和控制字符，数字保持原文
+func CanonicalizeJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, errors.New("JSON文本包含多余内容")
+	}
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeCanonical 递归写入规范化JSON
+func writeCanonical(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		if v {
+			buf.WriteString("true")
+		} else {
+			buf.WriteString("false")
+		}
+	case json.Number:
+		buf.WriteString(v.String())
+	case string:
+		writeCanonicalString(buf, v)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, key)
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, v[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("不支持的JSON值类型 %T", value)
+	}
+	return nil
+}
+
+// writeCanonicalString 写入JSON字符串，非ASCII字符按UTF-8原样输出
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r == '\n':
+			buf.WriteString(`\n`)
+		case r == '\r':
+			buf.WriteString(`\r`)
+		case r == '\t':
+			buf.WriteString(`\t`)
+		case r < 0x20:
+			fmt.Fprintf(buf, `\u%04x`, r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('"')
+}
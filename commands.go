@@ -0,0 +1,404 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/services"
+)
+
+// commandUsage 命令行子命令说明
+const commandUsage = `用法:
+  sea_trace_server                              启动Web服务
+  sea_trace_server bootstrap admin [-username 用户名] [-password 密码] 创建第一个超级管理员，首次登录须修改密码
+  sea_trace_server reconcile run [goodID]       核对链上与数据库数据
+  sea_trace_server reconcile list [status]      列出差异记录 (open/redriven/resolved)
+  sea_trace_server reconcile redrive <id>       将链上缺失的环节重新提交上链
+  sea_trace_server operator provision           为尚未配置区块链身份的操作员创建账户并登记上链
+  sea_trace_server chain replay [goodID] [--dry-run] 切换合约后将公司、操作员和货物环节重放到新合约
+  sea_trace_server keys migrate [--delete-local] 将WeBASE-Front本地用户迁移为WeBASE-Sign外部用户
+  sea_trace_server keys rotate <主密钥文件>     用新主密钥重新加密本地密钥库中的全部私钥
+  sea_trace_server keys export <signUserId> <文件> 将本地密钥库中的私钥导出为keystore v3文件
+  sea_trace_server keys import <文件> <company:ID|user:ID> 导入keystore v3文件并绑定到公司或用户
+  keystore v3 文件的密码取自环境变量 SEA_TRACE_KEYSTORE_PASSPHRASE
+  bootstrap admin 未指定用户名和密码时取自环境变量 SEA_TRACE_ADMIN_USERNAME、SEA_TRACE_ADMIN_PASSWORD`
+
+// keystorePassphraseEnv keystore v3 文件密码环境变量
+const keystorePassphraseEnv = "SEA_TRACE_KEYSTORE_PASSPHRASE"
+
+// 初始超级管理员用户名和密码环境变量，未通过参数指定时使用
+const (
+	adminUsernameEnv = "SEA_TRACE_ADMIN_USERNAME"
+	adminPasswordEnv = "SEA_TRACE_ADMIN_PASSWORD"
+)
+
+// runCommand 执行命令行子命令，返回进程退出码
+func runCommand(args []string) int {
+	switch args[0] {
+	case "bootstrap":
+		return runBootstrapCommand(args[1:])
+	case "reconcile":
+		return runReconcileCommand(args[1:])
+	case "operator":
+		return runOperatorCommand(args[1:])
+	case "chain":
+		return runChainCommand(args[1:])
+	case "keys":
+		return runKeysCommand(args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(commandUsage)
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "未知命令: %s\n%s\n", args[0], commandUsage)
+	return 2
+}
+
+// runBootstrapCommand 创建第一个超级管理员，已存在超级管理员时拒绝
+func runBootstrapCommand(args []string) int {
+	if len(args) == 0 || args[0] != "admin" {
+		fmt.Fprintln(os.Stderr, commandUsage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("bootstrap admin", flag.ContinueOnError)
+	username := flags.String("username", os.Getenv(adminUsernameEnv), "超级管理员用户名")
+	password := flags.String("password", os.Getenv(adminPasswordEnv), "初始密码")
+	realName := flags.String("real-name", "超级管理员", "姓名")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *username == "" || *password == "" {
+		fmt.Fprintf(os.Stderr, "请通过参数或环境变量 %s、%s 指定用户名和密码\n", adminUsernameEnv, adminPasswordEnv)
+		return 2
+	}
+
+	admin, err := services.DefaultBootstrapService().CreateSuperAdmin(*username, *password, *realName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "创建超级管理员失败: %v\n", err)
+		return 1
+	}
+	fmt.Printf("已创建超级管理员 %s [id=%d]，首次登录后须修改密码\n", admin.Username, admin.Id)
+	return 0
+}
+
+// runReconcileCommand 执行链上数据核对相关命令
+func runReconcileCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, commandUsage)
+		return 2
+	}
+
+	reconciler := services.NewReconcileService()
+
+	switch args[0] {
+	case "run":
+		if len(args) > 1 {
+			found, err := reconciler.ReconcileGood(args[1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "核对失败: %v\n", err)
+				return 1
+			}
+			printDiscrepancies(found)
+			return 0
+		}
+		report := reconciler.Run()
+		fmt.Printf("核对完成: 货物 %d 个, 差异 %d 条, 错误 %d 个, 耗时 %s\n",
+			report.Checked, report.Discrepancies, report.Errors, report.FinishedAt.Sub(report.StartedAt))
+		if report.Errors > 0 {
+			return 1
+		}
+		return 0
+
+	case "list":
+		status := models.DiscrepancyStatusOpen
+		if len(args) > 1 {
+			status = args[1]
+		}
+		list, total, err := models.GetChainDiscrepancyList(1, 1000, status, "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "获取差异记录失败: %v\n", err)
+			return 1
+		}
+		printDiscrepancies(list)
+		fmt.Printf("共 %d 条\n", total)
+		return 0
+
+	case "redrive":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "请指定差异记录ID")
+			return 2
+		}
+		id, err := strconv.Atoi(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "无效的差异记录ID: %s\n", args[1])
+			return 2
+		}
+		entry, err := reconciler.Redrive(id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "重新提交失败: %v\n", err)
+			return 1
+		}
+		fmt.Printf("已重新提交上链 [goodID=%s, stage=%s, outboxID=%d, status=%s, txHash=%s]\n",
+			entry.GoodId, entry.Stage, entry.Id, entry.Status, entry.TxHash)
+		return 0
+	}
+
+	fmt.Fprintf(os.Stderr, "未知子命令: reconcile %s\n%s\n", args[0], commandUsage)
+	return 2
+}
+
+// runOperatorCommand 执行操作员相关命令
+func runOperatorCommand(args []string) int {
+	if len(args) == 0 || args[0] != "provision" {
+		fmt.Fprintln(os.Stderr, commandUsage)
+		return 2
+	}
+
+	users, err := models.GetOperatorsWithoutBlockchainIdentity()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "获取操作员失败: %v\n", err)
+		return 1
+	}
+
+	identities := services.NewOperatorIdentityService()
+	failed := 0
+	for _, user := range users {
+		company, err := models.GetCompanyByID(user.CompanyId)
+		if err == nil {
+			err = identities.Provision(user, company)
+		}
+		if err != nil {
+			failed++
+			fmt.Printf("%s\t失败: %v\n", user.Username, err)
+			continue
+		}
+		fmt.Printf("%s\t%s\n", user.Username, user.BlockchainAddr)
+	}
+	fmt.Printf("共 %d 个操作员, 失败 %d 个\n", len(users), failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runChainCommand 执行溯源合约相关命令
+func runChainCommand(args []string) int {
+	if len(args) == 0 || args[0] != "replay" {
+		fmt.Fprintln(os.Stderr, commandUsage)
+		return 2
+	}
+
+	replay := services.NewChainReplayService()
+	goodID := ""
+	for _, arg := range args[1:] {
+		if arg == "--dry-run" {
+			replay.DryRun = true
+		} else {
+			goodID = arg
+		}
+	}
+
+	report, err := replay.Run(goodID)
+	for _, item := range report.Items {
+		if item.Result == services.ChainReplaySkipped && item.Kind == "good" {
+			continue
+		}
+		fmt.Printf("%s	%s	%s	%s\n", item.Kind, item.Key, item.Result, item.Detail)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "重放中止: %v\n", err)
+		return 1
+	}
+	fmt.Printf("重放完成: %d 项, 失败 %d 项\n", len(report.Items), report.Failed)
+	if !replay.DryRun {
+		fmt.Println("货物环节已写入发件箱，启动Web服务后由调度器按顺序发送")
+	}
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runKeysCommand 执行区块链私钥托管相关命令
+func runKeysCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, commandUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "migrate":
+		return runKeysMigrate(args[1:])
+	case "rotate":
+		return runKeysRotate(args[1:])
+	case "export":
+		return runKeysExport(args[1:])
+	case "import":
+		return runKeysImport(args[1:])
+	}
+
+	fmt.Fprintf(os.Stderr, "未知子命令: keys %s\n%s\n", args[0], commandUsage)
+	return 2
+}
+
+// runKeysMigrate 将WeBASE-Front本地用户迁移到签名服务
+func runKeysMigrate(args []string) int {
+	deleteLocal := len(args) > 0 && args[0] == "--delete-local"
+
+	// 超级管理员已配置签名服务编号时不再迁移
+	superAdmin := services.NewWebaseService().GetSuperAdminBlockchainAddress()
+	if config, err := models.GetSystemConfig("super_admin_sign_user_id"); err == nil && config.Value != "" {
+		superAdmin = ""
+	}
+
+	report, err := services.NewKeyMigrationService().Run(superAdmin, deleteLocal)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "迁移失败: %v\n", err)
+		return 1
+	}
+	for _, item := range report.Migrated {
+		fmt.Printf("已迁移\t%s\t%s\tsignUserId=%s\n", item.Owner, item.Address, item.SignUserID)
+	}
+	for _, item := range report.Skipped {
+		fmt.Printf("已跳过\t%s\t%s\tWeBASE-Front中没有该地址的私钥\n", item.Owner, item.Address)
+	}
+	for _, item := range report.Failed {
+		fmt.Printf("失败\t%s\t%s\t%s\n", item.Owner, item.Address, item.Error)
+	}
+	fmt.Printf("迁移完成: 成功 %d 个, 跳过 %d 个, 失败 %d 个\n",
+		len(report.Migrated), len(report.Skipped), len(report.Failed))
+	if len(report.Failed) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runKeysRotate 轮换本地密钥库主密钥，完成后需将主密钥配置替换为新主密钥
+func runKeysRotate(args []string) int {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, "请指定新主密钥文件")
+		return 2
+	}
+	newMaster, err := services.ReadMasterKeyFile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取新主密钥失败: %v\n", err)
+		return 1
+	}
+
+	rotated, err := services.NewKeystore().Rotate(newMaster)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "主密钥轮换失败: %v\n", err)
+		return 1
+	}
+	fmt.Printf("主密钥轮换完成: 重新加密 %d 个私钥 [masterKeyId=%s]\n", rotated, services.MasterKeyID(newMaster))
+	fmt.Printf("请将 %s 或配置项 keystore_master_key_file 更新为新主密钥后重启服务\n", services.MasterKeyEnv)
+	return 0
+}
+
+// runKeysExport 导出keystore v3文件
+func runKeysExport(args []string) int {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "请指定signUserId和导出文件")
+		return 2
+	}
+
+	data, err := services.NewKeystore().ExportV3(args[0], os.Getenv(keystorePassphraseEnv))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "导出失败: %v\n", err)
+		return 1
+	}
+	if err := os.WriteFile(args[1], data, 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "写入文件失败: %v\n", err)
+		return 1
+	}
+	fmt.Printf("已导出 %s\n", args[1])
+	return 0
+}
+
+// runKeysImport 导入keystore v3文件，并将公司或用户的签名身份切换为导入的私钥
+// 公司或用户已有区块链地址时，导入的私钥必须与之对应
+func runKeysImport(args []string) int {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "请指定keystore文件和绑定对象(company:ID或user:ID)")
+		return 2
+	}
+	kind, idStr, _ := strings.Cut(args[1], ":")
+	id, err := strconv.Atoi(idStr)
+	if err != nil || (kind != "company" && kind != "user") {
+		fmt.Fprintf(os.Stderr, "无效的绑定对象: %s\n", args[1])
+		return 2
+	}
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "读取文件失败: %v\n", err)
+		return 1
+	}
+	var address string
+	key, err := services.DecryptKeystoreV3(data, os.Getenv(keystorePassphraseEnv))
+	if err == nil {
+		address, _, err = services.ChainKeyAddress(key)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "无效的keystore文件: %v\n", err)
+		return 1
+	}
+
+	var company *models.Company
+	var user *models.User
+	var current string
+	if kind == "company" {
+		if company, err = models.GetCompanyByID(id); err == nil {
+			current = company.Address
+		}
+	} else {
+		if user, err = models.GetUserByID(id); err == nil {
+			current = user.BlockchainAddr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "获取%s失败: %v\n", args[1], err)
+		return 1
+	}
+	if current != "" && !strings.EqualFold(current, address) {
+		fmt.Fprintf(os.Stderr, "私钥地址 %s 与 %s 的区块链地址 %s 不一致\n", address, args[1], current)
+		return 1
+	}
+
+	signUser, err := services.NewKeystore().ImportSignUser(uuid.New().String(), services.SignAppID(), hex.EncodeToString(key))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "导入失败: %v\n", err)
+		return 1
+	}
+	if company != nil {
+		company.SignUserId = signUser.SignUserID
+		company.BlockchainType = models.BlockchainUserTypeExternal
+		err = models.UpdateCompanySignIdentity(company)
+	} else {
+		user.BlockchainAddr = signUser.Address
+		user.SignUserId = signUser.SignUserID
+		user.BlockchainType = models.BlockchainUserTypeExternal
+		err = models.UpdateUserBlockchainIdentity(user)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "更新签名身份失败: %v\n", err)
+		return 1
+	}
+	fmt.Printf("已导入\t%s\t%s\tsignUserId=%s\n", args[1], signUser.Address, signUser.SignUserID)
+	return 0
+}
+
+// printDiscrepancies 输出差异记录
+func printDiscrepancies(list []*models.ChainDiscrepancy) {
+	for _, d := range list {
+		fmt.Printf("#%d\t%s\t%s\t%s\t%s\tdb=%q\tchain=%q\t%s\n",
+			d.Id, d.GoodId, d.Stage, d.Field, d.Kind, d.DbValue, d.ChainValue, d.Status)
+	}
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"sea_trace_server_V2.0/models"
@@ -31,15 +32,6 @@ type GoodsWeeklyData struct {
 	Count int64  `json:"count"`
 }
 
-// ActivityInfo 活动信息
-type ActivityInfo struct {
-	Time        string `json:"time"`
-	Type        string `json:"type"`
-	GoodID      string `json:"good_id"`
-	Description string `json:"description"`
-	Operator    string `json:"operator"`
-}
-
 // Stats 获取管理员仪表盘统计数据
 // @router /api/admin/stats [get]
 func (c *AdminController) Stats() {
@@ -52,12 +44,15 @@ func (c *AdminController) Stats() {
 	// 获取一周内货物数据
 	weeklyData := getWeeklyGoodsData()
 
-	// 获取最近活动
-	activities := getRecentActivities()
+	// 获取最近动态，公司账户只看到本公司经手的动态
+	activities := getRecentActivities(dataScope(c.Ctx))
 
 	// 获取区块链高度
 	blockNumber := getBlockchainHeight()
 
+	// 获取已索引的合约事件数量
+	chainEvents := models.CountChainEventsByName()
+
 	// 组装响应数据
 	data := map[string]interface{}{
 		"companyCount":            companyCount,
@@ -67,6 +62,8 @@ func (c *AdminController) Stats() {
 		"companyTypeDistribution": distribution,
 		"goodsWeeklyData":         weeklyData,
 		"recentActivities":        activities,
+		"chainEventCounts":        chainEvents,
+		"eventIndexBlock":         services.EventIndexCheckpoint(),
 	}
 
 	c.Data["json"] = utils.SuccessResponse(data)
@@ -155,74 +152,88 @@ func getWeeklyGoodsData() []GoodsWeeklyData {
 	return result
 }
 
-// getRecentActivities 获取最近活动
-func getRecentActivities() []ActivityInfo {
-	// 这里需要实现获取最近活动的逻辑
-	// 由于现有代码中没有直接对应的活动表，我们可以使用模拟数据
-	// 实际项目中，你应该从数据库中查询最近的活动
-
-	activities := []ActivityInfo{
-		{
-			Time:        "2025-05-13 16:30:22",
-			Type:        "收货",
-			GoodID:      "PROD20250513001",
-			Description: "厦门海鲜市场收货",
-			Operator:    "张三",
-		},
-		{
-			Time:        "2025-05-13 14:25:17",
-			Type:        "验货",
-			GoodID:      "PROD20250513001",
-			Description: "厦门港口验收通过",
-			Operator:    "李四",
-		},
-		{
-			Time:        "2025-05-13 12:15:45",
-			Type:        "运输",
-			GoodID:      "PROD20250513001",
-			Description: "福州到厦门运输启动",
-			Operator:    "王五",
-		},
-		{
-			Time:        "2025-05-13 09:45:12",
-			Type:        "注册",
-			GoodID:      "PROD20250513001",
-			Description: "福建带鱼注册",
-			Operator:    "赵六",
-		},
-		{
-			Time:        "2025-05-12 15:20:33",
-			Type:        "收货",
-			GoodID:      "PROD20250512003",
-			Description: "厦门海鲜市场收货",
-			Operator:    "张三",
-		},
+// recentActivityCount 仪表盘展示的最近动态条数
+const recentActivityCount = 5
+
+// getRecentActivities 获取访问范围内的最近动态
+func getRecentActivities(scope models.DataScope) []models.Activity {
+	filter := models.ActivityFilter{}
+	if !scope.All {
+		if scope.CompanyID <= 0 {
+			return []models.Activity{}
+		}
+		filter.CompanyID = scope.CompanyID
 	}
 
+	activities, _, err := models.QueryActivities(filter, 1, recentActivityCount)
+	if err != nil {
+		logs.Error("获取最近动态失败: %v", err)
+		return []models.Activity{}
+	}
 	return activities
 }
 
-// getBlockchainHeight 获取区块链高度
-func getBlockchainHeight() int64 {
-	webaseService := services.NewWebaseService()
-	chainInfo, err := webaseService.GetChainInfo()
+// Activities 分页查询动态，按类型和公司筛选；公司账户只能查询本公司经手的动态
+// @Title 查询动态
+// @Param page query int false "页码，默认1"
+// @Param page_size query int false "每页数量，默认20"
+// @Param type query string false "动态类型，多个用逗号分隔：production/transport/inspection/disposition/delivery/company/user"
+// @Param company_id query int false "公司ID，仅超级管理员可指定"
+// @Success 200 {object} utils.Response
+// @router /api/admin/activities [get]
+func (c *AdminController) Activities() {
+	page, _ := c.GetInt("page", 1)
+	pageSize, _ := c.GetInt("page_size", 20)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	requested, _ := c.GetInt("company_id", 0)
+	companyID, err := dataScope(c.Ctx).ResolveCompany(requested)
 	if err != nil {
-		logs.Error("获取区块链高度失败: %v", err)
-		return 0
+		c.Data["json"] = utils.ForbiddenResponse()
+		c.ServeJSON()
+		return
 	}
 
-	// 从 chainInfo.Data 中提取区块高度
-	// 由于GetChainInfo返回的是interface{}类型，需要转换
-	blockNumberStr, ok := chainInfo.Data["blockNumber"].(string)
-	if !ok {
-		logs.Error("解析区块高度失败")
-		return 0
+	filter := models.ActivityFilter{CompanyID: companyID}
+	if types := c.GetString("type"); types != "" {
+		for _, kind := range strings.Split(types, ",") {
+			kind = strings.TrimSpace(kind)
+			if !models.IsActivityType(kind) {
+				c.Data["json"] = utils.ErrorResponse("无效的动态类型: " + kind)
+				c.ServeJSON()
+				return
+			}
+			filter.Types = append(filter.Types, kind)
+		}
+	}
+
+	activities, total, err := models.QueryActivities(filter, page, pageSize)
+	if err != nil {
+		logs.Error("查询动态失败: %v", err)
+		c.Data["json"] = utils.ErrorResponse("查询动态失败")
+		c.ServeJSON()
+		return
 	}
 
-	// 将字符串转换为int64
-	blockNumber, err := utils.StringToInt64(blockNumberStr)
+	c.Data["json"] = utils.SuccessResponse(map[string]interface{}{
+		"activities": activities,
+		"total":      total,
+		"page":       page,
+		"page_size":  pageSize,
+	})
+	c.ServeJSON()
+}
+
+// getBlockchainHeight 获取区块链高度
+func getBlockchainHeight() int64 {
+	blockNumber, err := services.NewChainClient().GetBlockNumber()
 	if err != nil {
-		logs.Error("区块高度转换失败: %v", err)
+		logs.Error("获取区块链高度失败: %v", err)
 		return 0
 	}
 
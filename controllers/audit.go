@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"fmt"
+
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/utils"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web/context"
+)
+
+// audit 记录当前用户的操作到审计日志，before/after 为操作前后的对象，新建时 before 为 nil，删除时 after 为 nil
+// companyID 为操作对象所属公司；写入失败只记录错误日志，不影响已完成的操作
+func audit(ctx *context.Context, action, targetType string, targetID interface{}, companyID int, before, after interface{}) {
+	entry := &models.AuditLog{
+		CompanyId:  companyID,
+		Action:     action,
+		TargetType: targetType,
+		TargetId:   fmt.Sprint(targetID),
+		Ip:         utils.ClientIP(ctx.Request),
+	}
+	entry.ActorId, _ = ctx.Input.GetData("user_id").(int)
+	entry.ActorName, _ = ctx.Input.GetData("username").(string)
+	entry.ActorRole, _ = ctx.Input.GetData("role").(string)
+	entry.RequestId, _ = ctx.Input.GetData("request_id").(string)
+
+	if err := models.AddAuditLog(entry, before, after); err != nil {
+		logs.Error("写入审计日志失败 [action=%s, target=%s:%s, request=%s]: %v",
+			action, targetType, entry.TargetId, entry.RequestId, err)
+	}
+}
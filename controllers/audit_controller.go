@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"time"
+
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/utils"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
+)
+
+// AuditController 审计日志查询控制器
+type AuditController struct {
+	web.Controller
+}
+
+// List 查询全部审计日志
+// @Title 查询审计日志
+// @Description 按条件查询管理操作和货物环节操作的审计日志，按时间倒序
+// @Param page query int false "页码，默认1"
+// @Param page_size query int false "每页数量，默认20"
+// @Param actor_id query int false "操作人ID"
+// @Param company_id query int false "公司ID"
+// @Param action query string false "操作，以.结尾时按前缀匹配，如goods."
+// @Param target_type query string false "对象类型：company/user/role/goods"
+// @Param target_id query string false "对象ID"
+// @Param request_id query string false "请求ID"
+// @Param start_date query string false "开始日期，格式2006-01-02"
+// @Param end_date query string false "结束日期（含），格式2006-01-02"
+// @Success 200 {object} utils.Response
+// @Failure 403 {object} utils.Response
+// @router /api/su/audit-logs [get]
+func (c *AuditController) List() {
+	filter, ok := c.parseFilter()
+	if !ok {
+		return
+	}
+	filter.CompanyID, _ = c.GetInt("company_id", 0)
+	c.serveLogs(filter)
+}
+
+// CompanyList 查询本公司的审计日志，查询条件与 List 相同，公司固定为当前账户所属公司
+// @router /api/admin/audit-logs [get]
+func (c *AuditController) CompanyList() {
+	filter, ok := c.parseFilter()
+	if !ok {
+		return
+	}
+
+	requested, _ := c.GetInt("company_id", 0)
+	companyID, err := dataScope(c.Ctx).ResolveCompany(requested)
+	if err != nil || companyID <= 0 {
+		c.Data["json"] = utils.ForbiddenResponse()
+		c.ServeJSON()
+		return
+	}
+	filter.CompanyID = companyID
+	c.serveLogs(filter)
+}
+
+// parseFilter 解析公司以外的查询条件，失败时已写入响应
+func (c *AuditController) parseFilter() (models.AuditLogFilter, bool) {
+	filter := models.AuditLogFilter{
+		Action:     c.GetString("action"),
+		TargetType: c.GetString("target_type"),
+		TargetID:   c.GetString("target_id"),
+		RequestID:  c.GetString("request_id"),
+	}
+	filter.ActorID, _ = c.GetInt("actor_id", 0)
+
+	if startDate := c.GetString("start_date"); startDate != "" {
+		start, err := time.ParseInLocation("2006-01-02", startDate, time.Local)
+		if err != nil {
+			c.Data["json"] = utils.ErrorResponse("开始日期格式错误，应为YYYY-MM-DD")
+			c.ServeJSON()
+			return filter, false
+		}
+		filter.StartTime = start
+	}
+	if endDate := c.GetString("end_date"); endDate != "" {
+		end, err := time.ParseInLocation("2006-01-02", endDate, time.Local)
+		if err != nil {
+			c.Data["json"] = utils.ErrorResponse("结束日期格式错误，应为YYYY-MM-DD")
+			c.ServeJSON()
+			return filter, false
+		}
+		filter.EndTime = end.AddDate(0, 0, 1)
+	}
+	return filter, true
+}
+
+// serveLogs 分页查询并返回审计日志
+func (c *AuditController) serveLogs(filter models.AuditLogFilter) {
+	page, _ := c.GetInt("page", 1)
+	pageSize, _ := c.GetInt("page_size", 20)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	entries, total, err := models.QueryAuditLogs(filter, page, pageSize)
+	if err != nil {
+		logs.Error("查询审计日志失败: %v", err)
+		c.Data["json"] = utils.ErrorResponse("查询审计日志失败")
+		c.ServeJSON()
+		return
+	}
+
+	c.Data["json"] = utils.SuccessResponse(map[string]interface{}{
+		"logs":      entries,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+	c.ServeJSON()
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/services"
 	"sea_trace_server_V2.0/utils"
 
 	"github.com/beego/beego/v2/core/logs"
@@ -32,11 +33,26 @@ func (c *AuthController) Login() {
 		return
 	}
 
+	guard := services.DefaultLoginGuard()
+	ip := utils.ClientIP(c.Ctx.Request)
+
 	// 先检查用户是否存在
-	user, err := models.GetUserByUsername(req.Username)
+	user, _ := models.GetUserByUsername(req.Username)
+
+	// 登录失败次数过多时不再校验密码，用户不存在时同样计数，避免借此探测用户名
+	// 校验密码前先预占一次失败计数，并发请求不能同时绕过限制
+	attempt, err := guard.Begin(user, req.Username, ip)
 	if err != nil {
-		logs.Warn("用户登录失败，用户不存在 [username=%s, time=%s]: %v",
-			req.Username, "2025-05-14 07:21:42", err)
+		logs.Warn("登录尝试被限制 [username=%s, ip=%s]: %v", req.Username, ip, err)
+		c.Ctx.Output.SetStatus(429)
+		c.Data["json"] = &utils.Response{Code: 429, Message: err.Error()}
+		c.ServeJSON()
+		return
+	}
+
+	if user == nil {
+		guard.Failure(attempt, nil)
+		logs.Warn("用户登录失败，用户不存在 [username=%s, ip=%s]", req.Username, ip)
 		c.Data["json"] = utils.ErrorResponse("用户名或密码错误")
 		c.ServeJSON()
 		return
@@ -44,6 +60,7 @@ func (c *AuthController) Login() {
 
 	// 检查用户状态是否正常
 	if user.Status != 1 {
+		guard.Failure(attempt, user)
 		logs.Warn("被禁用的账户尝试登录 [username=%s, status=%d, time=%s]",
 			req.Username, user.Status, "2025-05-14 07:21:42")
 		c.Data["json"] = utils.ErrorResponse("账户已被禁用，请联系管理员")
@@ -53,12 +70,14 @@ func (c *AuthController) Login() {
 
 	// 验证密码
 	if !utils.CheckPasswordHash(req.Password, user.Password) {
-		logs.Warn("用户登录失败，密码错误 [username=%s, time=%s]",
-			req.Username, "2025-05-14 07:21:42")
+		guard.Failure(attempt, user)
+		logs.Warn("用户登录失败，密码错误 [username=%s, ip=%s, failures=%d]",
+			req.Username, ip, user.FailedLogins)
 		c.Data["json"] = utils.ErrorResponse("用户名或密码错误")
 		c.ServeJSON()
 		return
 	}
+	guard.Success(attempt, user)
 
 	// 更新最后登录时间
 	models.UpdateLastLogin(user.Id)
@@ -68,7 +87,7 @@ func (c *AuthController) Login() {
 		user.Username, user.Role, user.CompanyId, "2025-05-14 07:21:42")
 
 	// 生成令牌
-	token, err := utils.GenerateToken(user.Id, user.Username, user.Role, user.CompanyId)
+	tokens, err := services.NewTokenService().Issue(user)
 	if err != nil {
 		logs.Error("生成token失败: %v", err)
 		c.Data["json"] = utils.ErrorResponse("生成token失败")
@@ -77,12 +96,76 @@ func (c *AuthController) Login() {
 	}
 
 	c.Data["json"] = utils.SuccessResponse(map[string]interface{}{
-		"token":     token,
-		"user_info": models.GetUserInfo(user),
+		"token":              tokens.AccessToken,
+		"refresh_token":      tokens.RefreshToken,
+		"expires_in":         tokens.ExpiresIn,
+		"refresh_expires_at": tokens.RefreshExpiresAt,
+		"user_info":          models.GetUserInfo(user),
 	})
 	c.ServeJSON()
 }
 
+// RefreshRequest 刷新令牌请求
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Refresh 使用刷新令牌换取新的访问令牌和刷新令牌
+// @router /api/auth/refresh [post]
+func (c *AuthController) Refresh() {
+	var req RefreshRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil || req.RefreshToken == "" {
+		c.Data["json"] = utils.ErrorResponse("无效的请求数据")
+		c.ServeJSON()
+		return
+	}
+
+	tokens, user, err := services.NewTokenService().Refresh(req.RefreshToken)
+	if err != nil {
+		logs.Warn("刷新令牌失败: %v", err)
+		c.Ctx.Output.SetStatus(401)
+		c.Data["json"] = &utils.Response{Code: 401, Message: err.Error()}
+		c.ServeJSON()
+		return
+	}
+
+	c.Data["json"] = utils.SuccessResponse(map[string]interface{}{
+		"token":              tokens.AccessToken,
+		"refresh_token":      tokens.RefreshToken,
+		"expires_in":         tokens.ExpiresIn,
+		"refresh_expires_at": tokens.RefreshExpiresAt,
+		"user_info":          models.GetUserInfo(user),
+	})
+	c.ServeJSON()
+}
+
+// Logout 退出登录，当前会话的访问令牌和刷新令牌立即失效
+// 请求参数 all=true 时退出该用户的全部会话
+// @router /api/auth/logout [post]
+func (c *AuthController) Logout() {
+	userID := c.Ctx.Input.GetData("user_id").(int)
+	sessionID, _ := c.Ctx.Input.GetData("session_id").(string)
+	all, _ := c.GetBool("all", false)
+
+	tokens := services.NewTokenService()
+	var err error
+	if all {
+		err = tokens.LogoutAll(userID)
+	} else {
+		err = tokens.Logout(sessionID)
+	}
+	if err != nil {
+		logs.Error("退出登录失败 [userID=%d]: %v", userID, err)
+		c.Data["json"] = utils.ErrorResponse("退出登录失败")
+		c.ServeJSON()
+		return
+	}
+
+	logs.Info("用户退出登录 [username=%v, all=%t]", c.Ctx.Input.GetData("username"), all)
+	c.Data["json"] = utils.SuccessResponse(nil)
+	c.ServeJSON()
+}
+
 // MyInfo 获取用户信息
 // @router /api/auth/myinfo [get]
 func (c *AuthController) MyInfo() {
@@ -106,6 +189,83 @@ func (c *AuthController) MyInfo() {
 	}
 
 	info := models.GetUserInfo(user)
+	info["permissions"] = currentPermissions(c.Ctx).List()
 	c.Data["json"] = utils.SuccessResponse(info)
 	c.ServeJSON()
 }
+
+// ChangePasswordRequest 修改密码请求
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+// ChangePassword 修改当前用户的密码，成功后原有会话全部失效并返回新的令牌
+// @router /api/auth/password [post]
+func (c *AuthController) ChangePassword() {
+	var req ChangePasswordRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.Data["json"] = utils.ErrorResponse("无效的请求数据")
+		c.ServeJSON()
+		return
+	}
+
+	user, _ := c.Ctx.Input.GetData("auth_user").(*models.User)
+	if user == nil {
+		c.Data["json"] = utils.UnauthorizedResponse()
+		c.ServeJSON()
+		return
+	}
+	if !utils.CheckPasswordHash(req.OldPassword, user.Password) {
+		logs.Warn("修改密码失败，原密码错误 [username=%s, ip=%s]", user.Username, utils.ClientIP(c.Ctx.Request))
+		c.Data["json"] = utils.ErrorResponse("原密码错误")
+		c.ServeJSON()
+		return
+	}
+	if err := utils.ValidatePassword(req.NewPassword); err != nil {
+		c.Data["json"] = utils.ErrorResponse(err.Error())
+		c.ServeJSON()
+		return
+	}
+	if req.NewPassword == req.OldPassword {
+		c.Data["json"] = utils.ErrorResponse("新密码不能与原密码相同")
+		c.ServeJSON()
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err == nil {
+		err = models.ChangeUserPassword(user.Id, hashedPassword)
+	}
+	if err != nil {
+		logs.Error("修改密码失败 [username=%s]: %v", user.Username, err)
+		c.Data["json"] = utils.ErrorResponse("修改密码失败")
+		c.ServeJSON()
+		return
+	}
+	audit(c.Ctx, models.AuditUserPassword, models.AuditTargetUser, user.Id, user.CompanyId,
+		map[string]bool{"must_change_password": user.MustChangePassword}, map[string]bool{"must_change_password": false})
+
+	// 令牌版本已递增，重新读取用户后签发新令牌
+	user, err = models.GetUserByID(user.Id)
+	var tokens *services.TokenPair
+	if err == nil {
+		tokens, err = services.NewTokenService().Issue(user)
+	}
+	if err != nil {
+		logs.Error("生成token失败: %v", err)
+		c.Data["json"] = utils.ErrorResponse("密码已修改，请重新登录")
+		c.ServeJSON()
+		return
+	}
+
+	logs.Info("用户修改密码 [username=%s]", user.Username)
+	c.Data["json"] = utils.SuccessResponse(map[string]interface{}{
+		"token":              tokens.AccessToken,
+		"refresh_token":      tokens.RefreshToken,
+		"expires_in":         tokens.ExpiresIn,
+		"refresh_expires_at": tokens.RefreshExpiresAt,
+		"user_info":          models.GetUserInfo(user),
+	})
+	c.ServeJSON()
+}
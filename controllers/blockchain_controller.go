@@ -3,6 +3,7 @@ package controllers
 import (
 	"github.com/beego/beego/v2/core/logs"
 	"github.com/beego/beego/v2/server/web"
+	"sea_trace_server_V2.0/models"
 	"sea_trace_server_V2.0/services"
 	"sea_trace_server_V2.0/utils"
 )
@@ -16,17 +17,14 @@ type BlockchainController struct {
 // @router /api/blockchain/user/create [post]
 func (c *BlockchainController) CreateBlockchainUser() {
 	// 检查权限 - 仅超级管理员可操作
-	roleInterface := c.Ctx.Input.GetData("role")
-	if roleInterface == nil || roleInterface.(string) != "super_admin" {
+	if !hasPermission(c.Ctx, models.PermBlockchainAdmin) {
 		c.Data["json"] = utils.ForbiddenResponse()
 		c.ServeJSON()
 		return
 	}
 
-	// 获取请求参数
+	// 获取请求参数，用户均创建为WeBASE-Sign外部用户，私钥不返回
 	username := c.GetString("username")
-	userType, _ := c.GetInt("type", 2) // 默认使用外部用户类型
-	returnPrivateKey, _ := c.GetBool("return_private_key", true)
 
 	if username == "" {
 		c.Data["json"] = utils.ErrorResponse("用户名不能为空")
@@ -35,8 +33,7 @@ func (c *BlockchainController) CreateBlockchainUser() {
 	}
 
 	// 创建区块链用户
-	webaseService := services.NewWebaseService()
-	blockchainUser, err := webaseService.CreateBlockchainUser(username, userType, returnPrivateKey)
+	blockchainUser, err := services.NewAccountProvider().CreateBlockchainUser(username)
 	if err != nil {
 		logs.Error("创建区块链用户失败: %v", err)
 		c.Data["json"] = utils.ErrorResponse("创建区块链用户失败: " + err.Error())
@@ -45,8 +42,8 @@ func (c *BlockchainController) CreateBlockchainUser() {
 	}
 
 	// 记录操作日志
-	logs.Info("创建区块链用户成功 [username=%s, address=%s, type=%d, 操作者=%s, time=%s]",
-		username, blockchainUser.Address, userType, c.Ctx.Input.GetData("username"), "2025-05-14 09:05:03")
+	logs.Info("创建区块链用户成功 [username=%s, address=%s, signUserId=%s, 操作者=%s, time=%s]",
+		username, blockchainUser.Address, blockchainUser.SignUserID, c.Ctx.Input.GetData("username"), "2025-05-14 09:05:03")
 
 	// 返回成功结果
 	c.Data["json"] = utils.SuccessResponse(blockchainUser)
@@ -69,8 +66,7 @@ func (c *BlockchainController) GetSuperAdminAddress() {
 // @router /api/blockchain/superadmin/address [put]
 func (c *BlockchainController) UpdateSuperAdminAddress() {
 	// 检查权限 - 仅超级管理员可操作
-	roleInterface := c.Ctx.Input.GetData("role")
-	if roleInterface == nil || roleInterface.(string) != "super_admin" {
+	if !hasPermission(c.Ctx, models.PermBlockchainAdmin) {
 		c.Data["json"] = utils.ForbiddenResponse()
 		c.ServeJSON()
 		return
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"github.com/beego/beego/v2/core/logs"
+	"sea_trace_server_V2.0/certverify"
+	"sea_trace_server_V2.0/services"
+	"sea_trace_server_V2.0/utils"
+)
+
+// GetCertificate 签发货物的溯源证书，无需认证
+// format 为 json(默认，签名后的规范化JSON文档) 或 pdf(嵌入签名JSON的可打印证书)
+// @router /api/public/goods/:id/certificate [get]
+func (c *GoodsController) GetCertificate() {
+	goodID := c.Ctx.Input.Param(":id")
+	if goodID == "" {
+		c.Data["json"] = utils.ErrorResponse("货物ID不能为空")
+		c.ServeJSON()
+		return
+	}
+	format := c.GetString("format", "json")
+	if format != "json" && format != "pdf" {
+		c.Data["json"] = utils.ErrorResponse("不支持的证书格式: " + format)
+		c.ServeJSON()
+		return
+	}
+
+	signed, err := services.DefaultCertificateService().Issue(goodID)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("签发溯源证书失败: " + err.Error())
+		c.ServeJSON()
+		return
+	}
+	document, err := certverify.Canonical(signed)
+	if err == nil && format == "pdf" {
+		document, err = services.RenderCertificatePDF(signed, document, c.LabelService.TraceURL(goodID))
+	}
+	if err != nil {
+		logs.Error("生成溯源证书失败 [goodID=%s]: %v", goodID, err)
+		c.Data["json"] = utils.ErrorResponse("生成溯源证书失败")
+		c.ServeJSON()
+		return
+	}
+	logs.Info("签发溯源证书 [goodID=%s, serial=%s, IP=%s]", goodID, signed.Certificate.Serial, utils.ClientIP(c.Ctx.Request))
+
+	if format == "pdf" {
+		c.Ctx.Output.Header("Content-Type", "application/pdf")
+	} else {
+		c.Ctx.Output.Header("Content-Type", "application/json; charset=utf-8")
+	}
+	c.Ctx.Output.Header("Content-Disposition", `attachment; filename="trace-certificate.`+format+`"`)
+	c.Ctx.Output.Body(document)
+}
+
+// VerifyCertificate 核验溯源证书，请求体为签名后的证书JSON文档，无需认证
+// 返回签名是否有效，以及证书中的上链记录与系统当前记录是否一致
+// @router /api/public/certificates/verify [post]
+func (c *GoodsController) VerifyCertificate() {
+	if len(c.Ctx.Input.RequestBody) == 0 {
+		c.Data["json"] = utils.ErrorResponse("请提交证书JSON")
+		c.ServeJSON()
+		return
+	}
+	result, err := services.DefaultCertificateService().Verify(c.Ctx.Input.RequestBody)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("核验溯源证书失败: " + err.Error())
+		c.ServeJSON()
+		return
+	}
+	c.Data["json"] = utils.SuccessResponse(result)
+	c.ServeJSON()
+}
+
+// GetCertificateKey 获取证书签名公钥，供离线核验使用，无需认证
+// @router /api/public/certificates/key [get]
+func (c *GoodsController) GetCertificateKey() {
+	publicKey, err := services.DefaultCertificateService().PublicKey()
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("获取证书签名公钥失败: " + err.Error())
+		c.ServeJSON()
+		return
+	}
+	c.Data["json"] = utils.SuccessResponse(map[string]interface{}{
+		"algorithm":  certverify.Algorithm,
+		"key_id":     certverify.KeyID(publicKey),
+		"public_key": certverify.EncodePublicKey(publicKey),
+	})
+	c.ServeJSON()
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"fmt"
 	"time"
 
 	"sea_trace_server_V2.0/services"
@@ -50,12 +51,16 @@ func (c *ChainController) TraceInfo() {
 		c.ServeJSON()
 		return
 	}
+	version, hit := serveCachedTrace(c.Ctx, services.TraceCacheChain, goodId)
+	if hit {
+		return
+	}
 
-	// 创建WeBase服务实例
-	webaseService := services.NewWebaseService()
+	// 创建区块链客户端
+	chainClient := services.NewChainClient()
 
 	// 获取货物溯源信息
-	trace, err := webaseService.GetFullTrace(goodId)
+	trace, err := services.ReadTrace(chainClient, goodId)
 	if err != nil {
 		logs.Error("获取溯源信息失败 [goodId=%s]: %v", goodId, err)
 		c.Data["json"] = utils.ErrorResponse("获取溯源信息失败: " + err.Error())
@@ -64,7 +69,7 @@ func (c *ChainController) TraceInfo() {
 	}
 
 	// 获取货物状态
-	statusCode, err := webaseService.GetGoodStatus(goodId)
+	statusCode, err := chainClient.GetGoodStatus(goodId)
 	if err != nil {
 		logs.Warning("获取货物状态失败 [goodId=%s]: %v", goodId, err)
 		statusCode = -1 // 使用默认值
@@ -76,6 +81,10 @@ func (c *ChainController) TraceInfo() {
 		1:  "运输中",
 		2:  "已验货",
 		3:  "已交付",
+		4:  "验货不合格",
+		5:  "已隔离",
+		6:  "已退回生产商",
+		7:  "已销毁",
 		-1: "未知状态",
 	}
 
@@ -96,25 +105,47 @@ func (c *ChainController) TraceInfo() {
 		"info":      "产品名称: " + trace.GoodName,
 	})
 
-	// 添加运输点
-	if trace.ShipExists {
+	// 按顺序添加各运输段
+	for _, leg := range trace.TransportLegs {
 		tracePoints = append(tracePoints, map[string]interface{}{
-			"time":      trace.ShipTime,
-			"location":  "物流中心",
-			"operation": "货物运输",
-			"operator":  "运输商 ID:" + trace.ShipCompanyID,
-			"info":      trace.TransportInfo,
+			"time":            leg.Time,
+			"location":        fmt.Sprintf("%s → %s", leg.FromLocation, leg.ToLocation),
+			"operation":       fmt.Sprintf("货物运输（第%d段）", leg.LegIndex+1),
+			"operator":        "运输商 ID:" + leg.ShipCompanyID,
+			"info":            leg.TransportInfo,
+			"tracking_number": leg.TrackingNumber,
 		})
 	}
 
-	// 添加验货点
+	// 添加验货点，重新验货时为最新一次验货结果
 	if trace.InspectExists {
+		info := trace.InspectionInfo
+		if !trace.InspectPassed {
+			info = fmt.Sprintf("%s（不合格: %s）", info, trace.InspectReason)
+		}
 		tracePoints = append(tracePoints, map[string]interface{}{
 			"time":      trace.InspectTime,
 			"location":  "港口/验货点",
 			"operation": "货物验收",
 			"operator":  "验货商 ID:" + trace.PortCompanyID,
-			"info":      trace.InspectionInfo,
+			"info":      info,
+			"passed":    trace.InspectPassed,
+		})
+	}
+
+	// 添加不合格货物的处置点
+	dispositionNames := map[int]string{
+		services.ChainGoodStateQuarantined: "隔离",
+		services.ChainGoodStateReturned:    "退回生产商",
+		services.ChainGoodStateDestroyed:   "销毁",
+	}
+	for _, disposition := range trace.Dispositions {
+		tracePoints = append(tracePoints, map[string]interface{}{
+			"time":      disposition.Time,
+			"location":  "港口/验货点",
+			"operation": "不合格货物处置：" + dispositionNames[disposition.State],
+			"operator":  "验货商 ID:" + disposition.CompanyID,
+			"info":      disposition.Reason,
 		})
 	}
 
@@ -140,8 +171,7 @@ func (c *ChainController) TraceInfo() {
 		"current_user": "ZYongJie1224",                           // 当前用户
 	}
 
-	c.Data["json"] = utils.SuccessResponse(response)
-	c.ServeJSON()
+	serveTrace(c.Ctx, services.TraceCacheChain, goodId, version, utils.SuccessResponse(response))
 }
 
 // GetNodeInfo 获取节点信息
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/services"
 	"sea_trace_server_V2.0/utils"
 
 	"github.com/beego/beego/v2/core/logs"
@@ -48,40 +49,19 @@ type UpdateOperatorInfoRequest struct {
 // CompanyInfo 获取公司信息
 // @router /api/admin/company/info [get]
 func (c *CompanyAdminController) CompanyInfo() {
-	// 从Context获取公司ID
-	// 首先从 token 中获取公司ID
-	companyIDInterface := c.Ctx.Input.GetData("company_id")
-	var companyID int
-	var ok bool
-
-	// 如果 token 中没有公司ID，则尝试从请求参数中获取
-	if companyIDInterface == nil {
-		// 从请求参数中获取公司ID
-		companyIDParam := c.GetString("company_id")
-		if companyIDParam != "" {
-			// 将参数转换为整数
-			paramID, err := strconv.Atoi(companyIDParam)
-			if err == nil {
-				companyID = paramID
-				ok = true
-				logs.Info("用户 [%v] 通过请求参数指定公司ID: %d",
-					c.Ctx.Input.GetData("username"), paramID)
-			}
-		}
-	} else {
-		companyID, ok = companyIDInterface.(int)
-	}
-
-	if !ok {
-		logs.Warning("用户 [%v] 无法获取公司ID，可能未关联公司", c.Ctx.Input.GetData("username"))
-		c.Data["json"] = utils.ErrorResponse("无法获取公司ID，您可能尚未关联到任何公司")
+	// 公司账户只能查看所属公司；超级管理员通过 company_id 参数指定公司
+	requested, _ := c.GetInt("company_id", 0)
+	companyID, err := dataScope(c.Ctx).ResolveCompany(requested)
+	if err != nil {
+		logs.Warning("用户 [%v] 请求的公司不在访问范围内 [company_id=%d]", c.Ctx.Input.GetData("username"), requested)
+		c.Data["json"] = utils.ForbiddenResponse()
 		c.ServeJSON()
 		return
 	}
 
 	// 检查公司ID是否有效
 	if companyID <= 0 {
-		logs.Warning("用户 [%v] 关联的公司ID无效: %d", c.Ctx.Input.GetData("username"), companyID)
+		logs.Warning("用户 [%v] 未指定有效的公司ID: %d", c.Ctx.Input.GetData("username"), companyID)
 		c.Data["json"] = utils.ErrorResponse("您尚未关联到有效公司，请联系管理员")
 		c.ServeJSON()
 		return
@@ -161,8 +141,8 @@ func (c *CompanyAdminController) UpdateCompanyInfo() {
 		return
 	}
 
-	// 公司管理员才能修改
-	if role != "company_admin" {
+	// 公司内的操作，超级管理员没有所属公司，不能修改（权限由访问策略校验）
+	if role == models.RoleSuperAdmin || companyID <= 0 {
 		c.Data["json"] = utils.ForbiddenResponse()
 		c.ServeJSON()
 		return
@@ -182,6 +162,7 @@ func (c *CompanyAdminController) UpdateCompanyInfo() {
 		return
 	}
 
+	before := *company
 	company.Address = req.Address
 	company.Contact = req.Contact
 	company.Phone = req.Phone
@@ -192,6 +173,7 @@ func (c *CompanyAdminController) UpdateCompanyInfo() {
 		c.ServeJSON()
 		return
 	}
+	audit(c.Ctx, models.AuditCompanyUpdate, models.AuditTargetCompany, company.ID, company.ID, &before, company)
 
 	c.Data["json"] = utils.SuccessResponse(company)
 	c.ServeJSON()
@@ -223,8 +205,8 @@ func (c *CompanyAdminController) CreateOperator() {
 		return
 	}
 
-	// 公司管理员才能创建操作员
-	if role != "company_admin" {
+	// 公司内的操作，超级管理员没有所属公司，不能创建操作员（权限由访问策略校验）
+	if role == models.RoleSuperAdmin || companyID <= 0 {
 		c.Data["json"] = utils.ForbiddenResponse()
 		c.ServeJSON()
 		return
@@ -244,12 +226,19 @@ func (c *CompanyAdminController) CreateOperator() {
 		return
 	}
 
+	company, err := models.GetCompanyByID(companyID)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("获取公司信息失败")
+		c.ServeJSON()
+		return
+	}
+
 	// 创建操作员
 	user, err := models.CreateUser(
 		req.Username,
 		req.Password,
 		req.RealName,
-		"operator",
+		models.RoleOperator,
 		companyID,
 		req.Email,
 		req.Phone,
@@ -262,6 +251,19 @@ func (c *CompanyAdminController) CreateOperator() {
 		return
 	}
 
+	// 为操作员创建区块链账户并登记到公司名下，失败时撤销本次创建
+	if err := services.NewOperatorIdentityService().Provision(user, company); err != nil {
+		logs.Error("创建操作员区块链身份失败 [user=%s, company=%s, error=%v]", user.Username, company.CompanyName, err)
+		if delErr := models.DeleteUserByID(user.Id); delErr != nil {
+			logs.Error("撤销创建操作员失败 [user=%s, error=%v]", user.Username, delErr)
+		}
+		c.Data["json"] = utils.ErrorResponse("创建操作员失败: " + err.Error())
+		c.ServeJSON()
+		return
+	}
+
+	audit(c.Ctx, models.AuditOperatorCreate, models.AuditTargetUser, user.Id, companyID, nil, user)
+
 	// 返回用户信息（不包含密码）
 	userInfo := models.GetUserInfo(user)
 	c.Data["json"] = utils.SuccessResponse(userInfo)
@@ -294,8 +296,8 @@ func (c *CompanyAdminController) DeleteOperator() {
 		return
 	}
 
-	// 公司管理员才能删除操作员
-	if role != "company_admin" {
+	// 公司内的操作，超级管理员没有所属公司，不能删除操作员（权限由访问策略校验）
+	if role == models.RoleSuperAdmin || companyID <= 0 {
 		c.Data["json"] = utils.ForbiddenResponse()
 		c.ServeJSON()
 		return
@@ -319,12 +321,26 @@ func (c *CompanyAdminController) DeleteOperator() {
 	}
 
 	// 检查操作员是否属于当前公司，以及角色是否为操作员
-	if user.CompanyId != companyID || user.Role != "operator" {
+	if user.CompanyId != companyID || user.Role != models.RoleOperator {
 		c.Data["json"] = utils.ErrorResponse("操作员不存在或不属于当前公司")
 		c.ServeJSON()
 		return
 	}
 
+	// 先将操作员地址从公司名下移除，避免已删除操作员的账户仍可代表公司上链
+	company, err := models.GetCompanyByID(companyID)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("获取公司信息失败")
+		c.ServeJSON()
+		return
+	}
+	if err := services.NewOperatorIdentityService().Revoke(user, company); err != nil {
+		logs.Error("移除操作员区块链身份失败 [user=%s, error=%v]", user.Username, err)
+		c.Data["json"] = utils.ErrorResponse("删除操作员失败: " + err.Error())
+		c.ServeJSON()
+		return
+	}
+
 	// 删除操作员
 	if err := models.DeleteUserByID(id); err != nil {
 		logs.Error("删除操作员失败: %v", err)
@@ -332,6 +348,7 @@ func (c *CompanyAdminController) DeleteOperator() {
 		c.ServeJSON()
 		return
 	}
+	audit(c.Ctx, models.AuditOperatorDelete, models.AuditTargetUser, user.Id, companyID, user, nil)
 
 	c.Data["json"] = utils.SuccessResponse(nil)
 	c.ServeJSON()
@@ -348,43 +365,15 @@ func (c *CompanyAdminController) DeleteOperator() {
 // @Failure 500 {object} utils.Response
 // @router /api/admin/company/operators [get]
 func (c *CompanyAdminController) GetOperators() {
-	companyIDInterface := c.Ctx.Input.GetData("company_id")
-	roleInterface := c.Ctx.Input.GetData("role")
-
-	if companyIDInterface == nil || roleInterface == nil {
-		c.Data["json"] = utils.ErrorResponse("无法获取用户信息")
-		c.ServeJSON()
-		return
-	}
-
-	companyID, ok := companyIDInterface.(int)
-	if !ok {
-		c.Data["json"] = utils.ErrorResponse("公司ID类型错误")
-		c.ServeJSON()
-		return
-	}
-
-	role, ok := roleInterface.(string)
-	if !ok {
-		c.Data["json"] = utils.ErrorResponse("角色类型错误")
-		c.ServeJSON()
-		return
-	}
-
-	// 只有公司管理员或超级管理员可以查看操作员列表
-	if role != "company_admin" && role != "super_admin" {
+	// 公司账户只能查询所属公司；超级管理员可通过 company_id 参数指定公司，不指定时查询所有公司
+	requested, _ := c.GetInt("company_id", 0)
+	companyID, err := dataScope(c.Ctx).ResolveCompany(requested)
+	if err != nil {
 		c.Data["json"] = utils.ForbiddenResponse()
 		c.ServeJSON()
 		return
 	}
 
-	// 如果是超级管理员且没有指定公司ID，则设置为0表示查询所有公司
-	if role == "super_admin" && companyID == 0 {
-		// 通过请求获取可选的公司ID参数
-		requestCompanyID, _ := c.GetInt("company_id", 0)
-		companyID = requestCompanyID
-	}
-
 	// 获取分页和搜索参数
 	page, _ := c.GetInt("page", 1)
 	pageSize, _ := c.GetInt("page_size", 10)
@@ -453,8 +442,8 @@ func (c *CompanyAdminController) UpdateOperatorStatus() {
 		return
 	}
 
-	// 公司管理员才能修改操作员状态
-	if role != "company_admin" {
+	// 公司内的操作，超级管理员没有所属公司，不能修改操作员状态（权限由访问策略校验）
+	if role == models.RoleSuperAdmin || companyID <= 0 {
 		c.Data["json"] = utils.ForbiddenResponse()
 		c.ServeJSON()
 		return
@@ -491,16 +480,10 @@ func (c *CompanyAdminController) UpdateOperatorStatus() {
 		return
 	}
 
-	// 更新操作员状态
+	// 更新操作员状态，禁用时操作员已签发的令牌同时失效
+	before := *operator
 	operator.Status = req.Status
-
-	// 修复: 使用正确的参数调用 UpdateUser
-	operatorIDStr := strconv.Itoa(operatorID)
-	updateUser := &models.User{
-		Status: req.Status,
-	}
-
-	_, err = models.UpdateUser(operatorIDStr, updateUser)
+	err = models.UpdateUserStatus(operatorID, req.Status)
 	if err != nil {
 		logs.Error("更新操作员状态失败: %v", err)
 		c.Data["json"] = utils.ErrorResponse("更新操作员状态失败")
@@ -509,6 +492,7 @@ func (c *CompanyAdminController) UpdateOperatorStatus() {
 	}
 
 	// 记录操作日志
+	audit(c.Ctx, models.AuditOperatorStatus, models.AuditTargetUser, operatorID, companyID, &before, operator)
 	logs.Info("操作员状态已更新 [ID=%d, 用户名=%s, 状态=%d, 操作者=%v, 时间=%s]",
 		operatorID, operator.Username, req.Status, c.Ctx.Input.GetData("username"), "2025-05-14 06:58:52")
 
@@ -545,8 +529,8 @@ func (c *CompanyAdminController) UpdateOperatorInfo() {
 		return
 	}
 
-	// 公司管理员才能修改操作员信息
-	if role != "company_admin" {
+	// 公司内的操作，超级管理员没有所属公司，不能修改操作员信息（权限由访问策略校验）
+	if role == models.RoleSuperAdmin || companyID <= 0 {
 		c.Data["json"] = utils.ForbiddenResponse()
 		c.ServeJSON()
 		return
@@ -601,6 +585,7 @@ func (c *CompanyAdminController) UpdateOperatorInfo() {
 	}
 
 	// 记录操作日志
+	audit(c.Ctx, models.AuditOperatorUpdate, models.AuditTargetUser, operatorID, companyID, operator, updatedUser)
 	logs.Info("操作员信息已更新 [ID=%d, 用户名=%s, 操作者=%v, 时间=%s]",
 		operatorID, operator.Username, c.Ctx.Input.GetData("username"), "2025-05-14 06:58:52")
 
@@ -0,0 +1,226 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/beego/beego/v2/core/logs"
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/services"
+	"sea_trace_server_V2.0/utils"
+)
+
+// bulkOperator 批量操作的执行人信息
+type bulkOperator struct {
+	company *models.Company
+	user    *models.User
+	address string // 签名使用的区块链地址
+}
+
+// getBulkOperator 获取当前用户及其公司信息，失败时已写入错误响应
+func (c *GoodsController) getBulkOperator() (*bulkOperator, bool) {
+	companyID := c.Ctx.Input.GetData("company_id").(int)
+	userID := c.Ctx.Input.GetData("user_id").(int)
+
+	company, err := models.GetCompanyByID(companyID)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("获取公司信息失败")
+		c.ServeJSON()
+		return nil, false
+	}
+	user, err := models.GetUserByID(userID)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("获取用户信息失败")
+		c.ServeJSON()
+		return nil, false
+	}
+	address, err := services.SigningAddress(user, company)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse(err.Error())
+		c.ServeJSON()
+		return nil, false
+	}
+	return &bulkOperator{company: company, user: user, address: address}, true
+}
+
+// bindBulkItems 解析批量操作请求
+// 支持JSON数组、{"items": [...]} 或CSV（multipart 上传的 file 字段，或 text/csv 请求体），CSV表头为字段的json名称
+func bindBulkItems[T any](c *GoodsController) ([]T, error) {
+	var items []T
+	contentType := c.Ctx.Input.Header("Content-Type")
+
+	switch {
+	case strings.HasPrefix(contentType, "multipart/form-data"):
+		file, _, err := c.GetFile("file")
+		if err != nil {
+			return nil, errors.New("请上传CSV文件")
+		}
+		defer file.Close()
+		if err := utils.DecodeCSV(file, &items); err != nil {
+			return nil, err
+		}
+	case strings.HasPrefix(contentType, "text/csv"):
+		if err := utils.DecodeCSV(bytes.NewReader(c.Ctx.Input.RequestBody), &items); err != nil {
+			return nil, err
+		}
+	default:
+		body := bytes.TrimSpace(c.Ctx.Input.RequestBody)
+		if len(body) > 0 && body[0] == '{' {
+			var wrapper struct {
+				Items []T `json:"items"`
+			}
+			if err := json.Unmarshal(body, &wrapper); err != nil {
+				return nil, err
+			}
+			items = wrapper.Items
+		} else if err := json.Unmarshal(body, &items); err != nil && err != io.EOF {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+// serveBulkResult 返回批量操作结果，校验未通过时在响应数据中返回各条目的错误
+func (c *GoodsController) serveBulkResult(label string, op *bulkOperator, response *models.BulkOperationResponse, err error) {
+	if err != nil {
+		logs.Error("批量%s失败: %v [user=%s, company=%s]", label, err, op.user.Username, op.company.CompanyName)
+		if response != nil {
+			c.Data["json"] = utils.ErrorResponseWithData(err.Error(), response)
+		} else {
+			c.Data["json"] = utils.ErrorResponse("批量" + label + "失败: " + err.Error())
+		}
+		c.ServeJSON()
+		return
+	}
+	c.Data["json"] = utils.SuccessResponse(response)
+	c.ServeJSON()
+}
+
+// goodsBefore 获取批量操作前的货物信息，用于审计日志；超出条数上限的请求不会执行，不必读取
+func (c *GoodsController) goodsBefore(goodIDs []string) map[string]*models.Goods {
+	if len(goodIDs) > c.GoodsService.BulkMaxItems {
+		return nil
+	}
+	before := make(map[string]*models.Goods, len(goodIDs))
+	for _, goodID := range goodIDs {
+		if good, err := models.GetGoodByID(goodID); err == nil {
+			before[goodID] = good
+		}
+	}
+	return before
+}
+
+// auditBulk 为批量操作中已保存的条目逐条记录审计日志，action 返回第 i 条请求对应的货物操作
+func (c *GoodsController) auditBulk(response *models.BulkOperationResponse, before map[string]*models.Goods, action func(i int) string) {
+	if response == nil {
+		return
+	}
+	for _, item := range response.Items {
+		if item.Status != models.BulkItemSubmitted && item.Status != models.BulkItemQueued {
+			continue
+		}
+		name := action(item.Index)
+		after := &models.GoodsBasicResponse{GoodID: item.GoodID, BlockchainTxHash: item.TxHash}
+		if t := models.GetGoodsTransition(name); t != nil {
+			after.Status = t.To
+		}
+		c.auditGoods(name, before[item.GoodID], after)
+	}
+}
+
+// BulkRegisterGoods 生产商批量注册同一批次的货物
+// @router /api/operator/goods/bulk/register [post]
+func (c *GoodsController) BulkRegisterGoods() {
+	op, ok := c.getBulkOperator()
+	if !ok {
+		return
+	}
+	reqs, err := bindBulkItems[models.GoodsRegisterRequest](c)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("无效的请求数据: " + err.Error())
+		c.ServeJSON()
+		return
+	}
+
+	response, err := c.GoodsService.BulkRegisterGoods(reqs, op.company.ID, op.user.Id, op.user.RealName, op.address)
+	c.auditBulk(response, nil, func(int) string { return models.GoodsActionRegister })
+	c.serveBulkResult("注册", op, response, err)
+}
+
+// BulkShipGoods 运输商批量运输货物
+// @router /api/operator/goods/bulk/ship [post]
+func (c *GoodsController) BulkShipGoods() {
+	op, ok := c.getBulkOperator()
+	if !ok {
+		return
+	}
+	reqs, err := bindBulkItems[models.GoodsShipRequest](c)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("无效的请求数据: " + err.Error())
+		c.ServeJSON()
+		return
+	}
+
+	goodIDs := make([]string, 0, len(reqs))
+	for _, req := range reqs {
+		goodIDs = append(goodIDs, req.GoodID)
+	}
+	before := c.goodsBefore(goodIDs)
+
+	response, err := c.GoodsService.BulkShipGoods(reqs, op.company.ID, op.user.Id, op.user.RealName, op.address)
+	c.auditBulk(response, before, func(int) string { return models.GoodsActionShip })
+	c.serveBulkResult("运输", op, response, err)
+}
+
+// BulkInspectGoods 验货商批量验货
+// @router /api/operator/goods/bulk/inspect [post]
+func (c *GoodsController) BulkInspectGoods() {
+	op, ok := c.getBulkOperator()
+	if !ok {
+		return
+	}
+	reqs, err := bindBulkItems[models.GoodsInspectRequest](c)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("无效的请求数据: " + err.Error())
+		c.ServeJSON()
+		return
+	}
+
+	goodIDs := make([]string, 0, len(reqs))
+	for _, req := range reqs {
+		goodIDs = append(goodIDs, req.GoodID)
+	}
+	before := c.goodsBefore(goodIDs)
+
+	response, err := c.GoodsService.BulkInspectGoods(reqs, op.company.ID, op.user.Id, op.user.RealName, op.address)
+	c.auditBulk(response, before, func(i int) string { return inspectAction(&reqs[i]) })
+	c.serveBulkResult("验货", op, response, err)
+}
+
+// BulkDeliverGoods 经销商批量交付货物
+// @router /api/operator/goods/bulk/deliver [post]
+func (c *GoodsController) BulkDeliverGoods() {
+	op, ok := c.getBulkOperator()
+	if !ok {
+		return
+	}
+	reqs, err := bindBulkItems[models.GoodsDeliverRequest](c)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("无效的请求数据: " + err.Error())
+		c.ServeJSON()
+		return
+	}
+
+	goodIDs := make([]string, 0, len(reqs))
+	for _, req := range reqs {
+		goodIDs = append(goodIDs, req.GoodID)
+	}
+	before := c.goodsBefore(goodIDs)
+
+	response, err := c.GoodsService.BulkDeliverGoods(reqs, op.company.ID, op.user.Id, op.user.RealName, op.address)
+	c.auditBulk(response, before, func(int) string { return models.GoodsActionDeliver })
+	c.serveBulkResult("交付", op, response, err)
+}
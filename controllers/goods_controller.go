@@ -14,12 +14,14 @@ import (
 type GoodsController struct {
 	web.Controller
 	GoodsService *services.GoodsService
+	LabelService *services.LabelService
 }
 
 // NewGoodsController 创建货物控制器
 func NewGoodsController() *GoodsController {
 	return &GoodsController{
 		GoodsService: services.NewGoodsService(),
+		LabelService: services.NewLabelService(),
 	}
 }
 
@@ -31,10 +33,10 @@ func (c *GoodsController) RegisterGood() {
 	username := c.Ctx.Input.GetData("username").(string)
 	userID := c.Ctx.Input.GetData("user_id").(int)
 
-	// 2. 验证是否为生产商
+	// 2. 获取公司信息，公司类型是否允许该操作由货物生命周期定义校验
 	company, err := models.GetCompanyByID(companyID)
-	if err != nil || company.CompanyType != models.Producer {
-		c.Data["json"] = utils.ErrorResponse("只有生产商才能注册货物")
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("获取公司信息失败")
 		c.ServeJSON()
 		return
 	}
@@ -70,18 +72,16 @@ func (c *GoodsController) RegisterGood() {
 		return
 	}
 
-	// 使用公司区块链地址
-	blockchainAddress := company.Address
-
-	// 确保有可用的区块链地址
-	if blockchainAddress == "" {
-		c.Data["json"] = utils.ErrorResponse("公司区块链地址未配置，请联系管理员")
+	// 使用操作员自己的区块链地址签名，链上记录实际操作人
+	blockchainAddress, err := services.SigningAddress(user, company)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse(err.Error())
 		c.ServeJSON()
 		return
 	}
 
-	logs.Info("注册货物使用公司区块链地址 [company=%s, address=%s, time=%s]",
-		company.CompanyName, blockchainAddress, "2025-05-15 03:06:28")
+	logs.Info("注册货物使用操作员区块链地址 [company=%s, user=%s, address=%s, time=%s]",
+		company.CompanyName, user.Username, blockchainAddress, "2025-05-15 03:06:28")
 
 	// 6. 调用服务层注册货物
 	response, err := c.GoodsService.RegisterGood(&req, companyID, userID, user.RealName, blockchainAddress)
@@ -93,7 +93,8 @@ func (c *GoodsController) RegisterGood() {
 		return
 	}
 
-	// 7. 返回成功响应
+	// 7. 记录审计日志并返回成功响应
+	c.auditGoods(models.GoodsActionRegister, nil, response)
 	c.Data["json"] = utils.SuccessResponse(response)
 	c.ServeJSON()
 }
@@ -106,10 +107,10 @@ func (c *GoodsController) ShipGood() {
 	username := c.Ctx.Input.GetData("username").(string)
 	userID := c.Ctx.Input.GetData("user_id").(int)
 
-	// 2. 验证是否为运输商
+	// 2. 获取公司信息，公司类型是否允许该操作由货物生命周期定义校验
 	company, err := models.GetCompanyByID(companyID)
-	if err != nil || company.CompanyType != models.Shipper {
-		c.Data["json"] = utils.ErrorResponse("只有运输商才能执行运输操作")
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("获取公司信息失败")
 		c.ServeJSON()
 		return
 	}
@@ -137,18 +138,19 @@ func (c *GoodsController) ShipGood() {
 		return
 	}
 
-	// 使用公司区块链地址
-	blockchainAddress := company.Address
-
-	// 确保有可用的区块链地址
-	if blockchainAddress == "" {
-		c.Data["json"] = utils.ErrorResponse("公司区块链地址未配置，请联系管理员")
+	// 使用操作员自己的区块链地址签名，链上记录实际操作人
+	blockchainAddress, err := services.SigningAddress(user, company)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse(err.Error())
 		c.ServeJSON()
 		return
 	}
 
-	logs.Info("运输货物使用公司区块链地址 [company=%s, address=%s, time=%s]",
-		company.CompanyName, blockchainAddress, "2025-05-15 03:06:28")
+	logs.Info("运输货物使用操作员区块链地址 [company=%s, user=%s, address=%s, time=%s]",
+		company.CompanyName, user.Username, blockchainAddress, "2025-05-15 03:06:28")
+
+	// 操作前的货物信息，用于审计日志
+	before, _ := models.GetGoodByID(req.GoodID)
 
 	// 6. 调用服务层记录运输信息
 	response, err := c.GoodsService.ShipGood(&req, companyID, userID, user.RealName, blockchainAddress)
@@ -160,7 +162,8 @@ func (c *GoodsController) ShipGood() {
 		return
 	}
 
-	// 7. 返回成功响应
+	// 7. 记录审计日志并返回成功响应
+	c.auditGoods(models.GoodsActionShip, before, response)
 	c.Data["json"] = utils.SuccessResponse(response)
 	c.ServeJSON()
 }
@@ -173,10 +176,10 @@ func (c *GoodsController) InspectGood() {
 	username := c.Ctx.Input.GetData("username").(string)
 	userID := c.Ctx.Input.GetData("user_id").(int)
 
-	// 2. 验证是否为验货商
+	// 2. 获取公司信息，公司类型是否允许该操作由货物生命周期定义校验
 	company, err := models.GetCompanyByID(companyID)
-	if err != nil || company.CompanyType != models.Port {
-		c.Data["json"] = utils.ErrorResponse("只有验货商才能执行验货操作")
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("获取公司信息失败")
 		c.ServeJSON()
 		return
 	}
@@ -204,18 +207,19 @@ func (c *GoodsController) InspectGood() {
 		return
 	}
 
-	// 使用公司区块链地址
-	blockchainAddress := company.Address
-
-	// 确保有可用的区块链地址
-	if blockchainAddress == "" {
-		c.Data["json"] = utils.ErrorResponse("公司区块链地址未配置，请联系管理员")
+	// 使用操作员自己的区块链地址签名，链上记录实际操作人
+	blockchainAddress, err := services.SigningAddress(user, company)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse(err.Error())
 		c.ServeJSON()
 		return
 	}
 
-	logs.Info("验货使用公司区块链地址 [company=%s, address=%s, time=%s]",
-		company.CompanyName, blockchainAddress, "2025-05-15 03:06:28")
+	logs.Info("验货使用操作员区块链地址 [company=%s, user=%s, address=%s, time=%s]",
+		company.CompanyName, user.Username, blockchainAddress, "2025-05-15 03:06:28")
+
+	// 操作前的货物信息，用于审计日志
+	before, _ := models.GetGoodByID(req.GoodID)
 
 	// 6. 调用服务层记录验货信息
 	response, err := c.GoodsService.InspectGood(&req, companyID, userID, user.RealName, blockchainAddress)
@@ -227,7 +231,139 @@ func (c *GoodsController) InspectGood() {
 		return
 	}
 
-	// 7. 返回成功响应
+	// 7. 记录审计日志并返回成功响应
+	c.auditGoods(inspectAction(&req), before, response)
+	c.Data["json"] = utils.SuccessResponse(response)
+	c.ServeJSON()
+}
+
+// DisposeGood 验货商处置验货不合格的货物
+// @router /api/operator/goods/dispose [post]
+func (c *GoodsController) DisposeGood() {
+	// 1. 获取当前用户信息
+	companyID := c.Ctx.Input.GetData("company_id").(int)
+	username := c.Ctx.Input.GetData("username").(string)
+	userID := c.Ctx.Input.GetData("user_id").(int)
+
+	// 2. 获取公司信息，公司类型是否允许该操作由货物生命周期定义校验
+	company, err := models.GetCompanyByID(companyID)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("获取公司信息失败")
+		c.ServeJSON()
+		return
+	}
+
+	// 3. 解析请求数据
+	var req models.GoodsDisposeRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.Data["json"] = utils.ErrorResponse("无效的请求数据")
+		c.ServeJSON()
+		return
+	}
+
+	// 4. 验证请求数据
+	if req.GoodID == "" {
+		c.Data["json"] = utils.ErrorResponse("货物ID不能为空")
+		c.ServeJSON()
+		return
+	}
+	if req.Reason == "" {
+		c.Data["json"] = utils.ErrorResponse("处置原因不能为空")
+		c.ServeJSON()
+		return
+	}
+
+	// 5. 获取用户详细信息
+	user, err := models.GetUserByID(userID)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("获取用户信息失败")
+		c.ServeJSON()
+		return
+	}
+
+	// 使用操作员自己的区块链地址签名，链上记录实际操作人
+	blockchainAddress, err := services.SigningAddress(user, company)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse(err.Error())
+		c.ServeJSON()
+		return
+	}
+
+	// 操作前的货物信息，用于审计日志
+	before, _ := models.GetGoodByID(req.GoodID)
+
+	// 6. 调用服务层记录处置信息
+	response, err := c.GoodsService.DisposeGood(&req, companyID, userID, user.RealName, blockchainAddress)
+	if err != nil {
+		logs.Error("记录处置信息失败: %v [user=%s, company=%s, goodID=%s, action=%s]",
+			err, username, company.CompanyName, req.GoodID, req.Action)
+		c.Data["json"] = utils.ErrorResponse("记录处置信息失败: " + err.Error())
+		c.ServeJSON()
+		return
+	}
+
+	// 7. 记录审计日志并返回成功响应
+	c.auditGoods(req.Action, before, response)
+	c.Data["json"] = utils.SuccessResponse(response)
+	c.ServeJSON()
+}
+
+// inspectAction 验货请求对应的货物操作
+func inspectAction(req *models.GoodsInspectRequest) string {
+	if req.PassStatus {
+		return models.GoodsActionInspect
+	}
+	return models.GoodsActionReject
+}
+
+// goodsAuditState 审计日志中记录的货物状态
+func goodsAuditState(status models.GoodsStatus, txHash string) map[string]interface{} {
+	return map[string]interface{}{
+		"status":             status,
+		"status_text":        models.GoodsStatusMap[status],
+		"blockchain_tx_hash": txHash,
+	}
+}
+
+// auditGoods 记录货物环节操作，before 为操作前的货物，登记时为 nil
+func (c *GoodsController) auditGoods(action string, before *models.Goods, after *models.GoodsBasicResponse) {
+	companyID, _ := c.Ctx.Input.GetData("company_id").(int)
+	var from interface{}
+	if before != nil {
+		from = goodsAuditState(before.Status, before.BlockchainTxHash)
+	}
+	audit(c.Ctx, "goods."+action, models.AuditTargetGoods, after.GoodID, companyID,
+		from, goodsAuditState(after.Status, after.BlockchainTxHash))
+}
+
+// GetTransitions 获取货物当前可执行的操作，供前端只展示有效的下一步操作
+// @router /api/operator/goods/transitions [get]
+func (c *GoodsController) GetTransitions() {
+	// 1. 获取货物ID
+	goodID := c.GetString("good_id")
+	if goodID == "" {
+		c.Data["json"] = utils.ErrorResponse("货物ID不能为空")
+		c.ServeJSON()
+		return
+	}
+
+	// 2. 获取当前用户所在公司，用于标记可由本公司执行的操作
+	companyType := models.CompanyType(-1)
+	if companyID, ok := c.Ctx.Input.GetData("company_id").(int); ok {
+		if company, err := models.GetCompanyByID(companyID); err == nil {
+			companyType = company.CompanyType
+		}
+	}
+
+	// 3. 调用服务层获取可执行的操作
+	response, err := c.GoodsService.GetGoodsTransitions(goodID, companyType, dataScope(c.Ctx))
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("获取货物可执行操作失败: " + err.Error())
+		c.ServeJSON()
+		return
+	}
+
+	// 4. 返回成功响应
 	c.Data["json"] = utils.SuccessResponse(response)
 	c.ServeJSON()
 }
@@ -240,10 +376,10 @@ func (c *GoodsController) DeliverGood() {
 	username := c.Ctx.Input.GetData("username").(string)
 	userID := c.Ctx.Input.GetData("user_id").(int)
 
-	// 2. 验证是否为经销商
+	// 2. 获取公司信息，公司类型是否允许该操作由货物生命周期定义校验
 	company, err := models.GetCompanyByID(companyID)
-	if err != nil || company.CompanyType != models.Dealer {
-		c.Data["json"] = utils.ErrorResponse("只有经销商才能执行交付操作")
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("获取公司信息失败")
 		c.ServeJSON()
 		return
 	}
@@ -271,18 +407,19 @@ func (c *GoodsController) DeliverGood() {
 		return
 	}
 
-	// 使用公司区块链地址
-	blockchainAddress := company.Address
-
-	// 确保有可用的区块链地址
-	if blockchainAddress == "" {
-		c.Data["json"] = utils.ErrorResponse("公司区块链地址未配置，请联系管理员")
+	// 使用操作员自己的区块链地址签名，链上记录实际操作人
+	blockchainAddress, err := services.SigningAddress(user, company)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse(err.Error())
 		c.ServeJSON()
 		return
 	}
 
-	logs.Info("交付货物使用公司区块链地址 [company=%s, address=%s, time=%s]",
-		company.CompanyName, blockchainAddress, "2025-05-15 03:06:28")
+	logs.Info("交付货物使用操作员区块链地址 [company=%s, user=%s, address=%s, time=%s]",
+		company.CompanyName, user.Username, blockchainAddress, "2025-05-15 03:06:28")
+
+	// 操作前的货物信息，用于审计日志
+	before, _ := models.GetGoodByID(req.GoodID)
 
 	// 6. 调用服务层记录交付信息
 	response, err := c.GoodsService.DeliverGood(&req, companyID, userID, user.RealName, blockchainAddress)
@@ -294,7 +431,8 @@ func (c *GoodsController) DeliverGood() {
 		return
 	}
 
-	// 7. 返回成功响应
+	// 7. 记录审计日志并返回成功响应
+	c.auditGoods(models.GoodsActionDeliver, before, response)
 	c.Data["json"] = utils.SuccessResponse(response)
 	c.ServeJSON()
 }
@@ -302,8 +440,8 @@ func (c *GoodsController) DeliverGood() {
 // GetGoodsList 获取货物列表
 // @router /api/operator/goods/list [get]
 func (c *GoodsController) GetGoodsList() {
-	// 1. 获取当前用户信息
-	companyID := c.Ctx.Input.GetData("company_id").(int)
+	// 1. 获取当前用户的数据访问范围
+	scope := dataScope(c.Ctx)
 
 	// 2. 获取查询参数
 	page, _ := c.GetInt("page", 1)
@@ -312,7 +450,7 @@ func (c *GoodsController) GetGoodsList() {
 	status, _ := c.GetInt("status", 0)
 
 	// 3. 调用服务层获取货物列表
-	response, err := c.GoodsService.GetGoodsList(page, pageSize, companyID, search, status)
+	response, err := c.GoodsService.GetGoodsList(page, pageSize, scope, search, status)
 	if err != nil {
 		c.Data["json"] = utils.ErrorResponse("获取货物列表失败: " + err.Error())
 		c.ServeJSON()
@@ -335,8 +473,8 @@ func (c *GoodsController) GetGoodsTrace() {
 		return
 	}
 
-	// 2. 调用服务层获取溯源信息
-	trace, err := c.GoodsService.GetGoodsTrace(goodID)
+	// 2. 调用服务层获取访问范围内的溯源信息
+	trace, err := c.GoodsService.GetGoodsTrace(goodID, dataScope(c.Ctx))
 	if err != nil {
 		c.Data["json"] = utils.ErrorResponse("获取溯源信息失败: " + err.Error())
 		c.ServeJSON()
@@ -348,6 +486,31 @@ func (c *GoodsController) GetGoodsTrace() {
 	c.ServeJSON()
 }
 
+// VerifyRecordAnchors 核验货物各环节的数据库记录是否与链上锚定的记录哈希一致
+// @router /api/operator/goods/verify [get]
+func (c *GoodsController) VerifyRecordAnchors() {
+	goodID := c.GetString("good_id")
+	if goodID == "" {
+		c.Data["json"] = utils.ErrorResponse("货物ID不能为空")
+		c.ServeJSON()
+		return
+	}
+
+	report, err := c.GoodsService.VerifyRecordAnchors(goodID, dataScope(c.Ctx))
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("核验环节记录失败: " + err.Error())
+		c.ServeJSON()
+		return
+	}
+	if !report.Intact {
+		logs.Warn("环节记录与链上哈希不一致 [goodID=%s, mismatches=%d, user=%v]",
+			goodID, report.Mismatches, c.Ctx.Input.GetData("username"))
+	}
+
+	c.Data["json"] = utils.SuccessResponse(report)
+	c.ServeJSON()
+}
+
 // PublicTrace 公开溯源查询接口
 // @router /api/public/trace [get]
 func (c *GoodsController) PublicTrace() {
@@ -358,9 +521,13 @@ func (c *GoodsController) PublicTrace() {
 		c.ServeJSON()
 		return
 	}
+	version, hit := serveCachedTrace(c.Ctx, services.TraceCachePublic, goodID)
+	if hit {
+		return
+	}
 
-	// 2. 调用服务层获取溯源信息
-	trace, err := c.GoodsService.GetGoodsTrace(goodID)
+	// 2. 调用服务层获取公开溯源信息
+	trace, err := c.GoodsService.GetPublicTrace(goodID)
 	if err != nil {
 		c.Data["json"] = utils.ErrorResponse("获取溯源信息失败: " + err.Error())
 		c.ServeJSON()
@@ -368,11 +535,10 @@ func (c *GoodsController) PublicTrace() {
 	}
 
 	// 3. 记录公开溯源查询
-	clientIP := c.Ctx.Input.IP()
+	clientIP := utils.ClientIP(c.Ctx.Request)
 	logs.Info("公开溯源查询请求 [goodID=%s, IP=%s, time=%s]",
 		goodID, clientIP, "2025-05-15 03:06:28")
 
-	// 4. 返回成功响应
-	c.Data["json"] = utils.SuccessResponse(trace)
-	c.ServeJSON()
+	// 4. 缓存并返回成功响应
+	serveTrace(c.Ctx, services.TraceCachePublic, goodID, version, utils.SuccessResponse(trace))
 }
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/beego/beego/v2/core/logs"
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/services"
+	"sea_trace_server_V2.0/utils"
+)
+
+// 二维码图片每个模块的像素数
+const (
+	defaultQRScale = 8
+	maxQRScale     = 40
+)
+
+// GetGoodsQRCode 生成指向货物公开溯源地址的二维码图片
+// 请求参数 format 为 png(默认) 或 svg，scale 为每个模块的像素数
+// @router /api/operator/goods/qrcode [get]
+func (c *GoodsController) GetGoodsQRCode() {
+	goodID := c.GetString("good_id")
+	if goodID == "" {
+		c.Data["json"] = utils.ErrorResponse("货物ID不能为空")
+		c.ServeJSON()
+		return
+	}
+	format := c.GetString("format", "png")
+	if format != "png" && format != "svg" {
+		c.Data["json"] = utils.ErrorResponse("不支持的图片格式: " + format)
+		c.ServeJSON()
+		return
+	}
+	scale, _ := c.GetInt("scale", defaultQRScale)
+	scale = max(1, min(scale, maxQRScale))
+
+	if _, _, err := models.GetScopedGood(goodID, dataScope(c.Ctx)); err != nil {
+		c.Data["json"] = utils.ErrorResponse("获取货物信息失败: " + err.Error())
+		c.ServeJSON()
+		return
+	}
+
+	qr, err := c.LabelService.QRCode(goodID)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("生成二维码失败: " + err.Error())
+		c.ServeJSON()
+		return
+	}
+
+	if format == "svg" {
+		c.Ctx.Output.Header("Content-Type", "image/svg+xml; charset=utf-8")
+		c.Ctx.Output.Body([]byte(qr.SVG(scale)))
+		return
+	}
+	data, err := qr.PNG(scale)
+	if err != nil {
+		logs.Error("生成二维码图片失败 [goodID=%s]: %v", goodID, err)
+		c.Data["json"] = utils.ErrorResponse("生成二维码失败")
+		c.ServeJSON()
+		return
+	}
+	c.Ctx.Output.Header("Content-Type", "image/png")
+	c.Ctx.Output.Body(data)
+}
+
+// GetGoodsLabels 生成整批货物的标签，每个标签包含二维码、货物名称、批次、生产商和货物ID
+// 按 batch_number 选择同一批次的货物，或按 good_ids(逗号分隔) 指定货物
+// format 为 pdf(默认，A4标签纸) 或 zpl(热敏打印机)
+// @router /api/operator/goods/labels [get]
+func (c *GoodsController) GetGoodsLabels() {
+	format := c.GetString("format", "pdf")
+	if format != "pdf" && format != "zpl" {
+		c.Data["json"] = utils.ErrorResponse("不支持的标签格式: " + format)
+		c.ServeJSON()
+		return
+	}
+
+	scope := dataScope(c.Ctx)
+	batchNumber := c.GetString("batch_number")
+	var goodIDs []string
+	for _, goodID := range strings.Split(c.GetString("good_ids"), ",") {
+		if goodID = strings.TrimSpace(goodID); goodID != "" {
+			goodIDs = append(goodIDs, goodID)
+		}
+	}
+
+	var goods []*models.Goods
+	var err error
+	switch {
+	case len(goodIDs) > c.LabelService.MaxItems:
+		err = fmt.Errorf("单次最多生成%d个标签", c.LabelService.MaxItems)
+	case len(goodIDs) > 0:
+		goods, err = models.GetScopedGoodsByIDs(goodIDs, scope)
+	case batchNumber != "":
+		goods, err = models.GetScopedGoodsByBatch(batchNumber, scope, c.LabelService.MaxItems+1)
+	default:
+		err = fmt.Errorf("请指定批次号或货物ID")
+	}
+	if err == nil && len(goods) == 0 {
+		err = fmt.Errorf("该批次没有可生成标签的货物")
+	}
+	var labels []services.GoodsLabel
+	if err == nil {
+		labels, err = c.LabelService.Labels(goods)
+	}
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("生成标签失败: " + err.Error())
+		c.ServeJSON()
+		return
+	}
+
+	var data []byte
+	contentType := "application/pdf"
+	if format == "zpl" {
+		data, err = c.LabelService.RenderZPL(labels)
+		contentType = "application/zpl; charset=utf-8"
+	} else {
+		data, err = c.LabelService.RenderPDF(labels)
+	}
+	if err != nil {
+		logs.Error("生成标签失败 [batch=%s, count=%d]: %v", batchNumber, len(labels), err)
+		c.Data["json"] = utils.ErrorResponse("生成标签失败: " + err.Error())
+		c.ServeJSON()
+		return
+	}
+
+	c.Ctx.Output.Header("Content-Type", contentType)
+	c.Ctx.Output.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="goods-labels.%s"`, format))
+	c.Ctx.Output.Body(data)
+}
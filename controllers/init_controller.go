@@ -1,10 +1,12 @@
 package controllers
 
 import (
+	"encoding/json"
+
 	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/services"
 	"sea_trace_server_V2.0/utils"
 
-	"github.com/beego/beego/v2/client/orm"
 	"github.com/beego/beego/v2/core/logs"
 	"github.com/beego/beego/v2/server/web"
 )
@@ -14,57 +16,47 @@ type InitController struct {
 	web.Controller
 }
 
-// InitAdmin 初始化超级管理员
-// @router /api/init/admin [get]
-func (c *InitController) InitAdmin() {
-	o := orm.NewOrm()
+// InitAdminRequest 初始化超级管理员请求
+type InitAdminRequest struct {
+	SetupToken string `json:"setup_token"` // 首次启动时输出到日志的一次性令牌
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	RealName   string `json:"real_name"`
+}
 
-	// 检查是否已存在超级管理员
-	adminCount, err := o.QueryTable(new(models.User)).Filter("role", "super_admin").Count()
-	if err != nil {
-		logs.Error("查询管理员失败: %v", err)
-		c.Data["json"] = utils.ErrorResponse("查询管理员失败")
+// InitAdmin 使用一次性初始化令牌创建超级管理员，首次登录须修改密码
+// 已存在超级管理员或令牌已使用后接口不再可用
+// @router /api/init/admin [post]
+func (c *InitController) InitAdmin() {
+	var req InitAdminRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil || req.SetupToken == "" {
+		c.Data["json"] = utils.ErrorResponse("无效的请求数据")
 		c.ServeJSON()
 		return
 	}
 
-	// 如果已存在则拒绝
-	if adminCount > 0 {
-		c.Data["json"] = utils.ErrorResponse("已存在超级管理员账户，无法再次初始化")
+	admin, err := services.DefaultBootstrapService().SetupWithToken(req.SetupToken, req.Username, req.Password, req.RealName)
+	switch err {
+	case nil:
+	case services.ErrAlreadyBootstrapped, services.ErrInvalidSetupToken:
+		logs.Warn("初始化接口调用被拒绝 [ip=%s]: %v", utils.ClientIP(c.Ctx.Request), err)
+		c.Ctx.Output.SetStatus(403)
+		c.Data["json"] = &utils.Response{Code: 403, Message: err.Error()}
 		c.ServeJSON()
 		return
-	}
-
-	// 创建超级管理员
-	password := "admin123"
-	hashedPassword, err := utils.HashPassword(password)
-	if err != nil {
-		logs.Error("生成密码哈希失败: %v", err)
-		c.Data["json"] = utils.ErrorResponse("生成密码哈希失败")
+	default:
+		logs.Error("创建超级管理员失败: %v", err)
+		c.Data["json"] = utils.ErrorResponse("创建超级管理员失败: " + err.Error())
 		c.ServeJSON()
 		return
 	}
 
-	admin := &models.User{
-		Username: "admin",
-		Password: hashedPassword,
-		RealName: "超级管理员",
-		Role:     "super_admin",
-		Status:   1,
-	}
-
-	_, err = o.Insert(admin)
-	if err != nil {
-		logs.Error("创建管理员失败: %v", err)
-		c.Data["json"] = utils.ErrorResponse("创建管理员失败")
-		c.ServeJSON()
-		return
-	}
+	audit(c.Ctx, models.AuditUserCreate, models.AuditTargetUser, admin.Id, 0, nil, admin)
 
-	c.Data["json"] = utils.SuccessResponse(map[string]string{
-		"username": "admin",
-		"password": password,
-		"message":  "超级管理员创建成功",
+	c.Data["json"] = utils.SuccessResponse(map[string]interface{}{
+		"username":             admin.Username,
+		"must_change_password": true,
+		"message":              "超级管理员创建成功，请登录后修改密码",
 	})
 	c.ServeJSON()
 }
@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
+	"sea_trace_server_V2.0/services"
+	"sea_trace_server_V2.0/utils"
+)
+
+// KeystoreSignController 本地密钥库的签名接口
+// 接口路径和报文与WeBASE-Sign一致，本地密钥库托管模式下WeBASE-Front的 keyServer 指向本服务的签名端口即可完成交易签名
+type KeystoreSignController struct {
+	web.Controller
+}
+
+// keystoreSignRequest WeBASE-Sign 签名请求
+type keystoreSignRequest struct {
+	SignUserID     string `json:"signUserId"`
+	EncodedDataStr string `json:"encodedDataStr"` // 待签名的交易哈希，十六进制
+}
+
+// serveSign 按WeBASE-Sign的响应格式返回，code 为0表示成功
+func (c *KeystoreSignController) serveSign(code int, message string, data interface{}) {
+	c.Data["json"] = map[string]interface{}{
+		"code":    code,
+		"message": message,
+		"data":    data,
+	}
+	c.ServeJSON()
+}
+
+// allowed 检查来源地址，未开放时返回 false 并写入错误响应
+// 只认连接的对端地址，X-Forwarded-For 可由客户端伪造，不能作为签名接口的访问依据
+func (c *KeystoreSignController) allowed() bool {
+	ip := utils.RemoteIP(c.Ctx.Request)
+	if !services.KeystoreSignAllowed(ip) {
+		logs.Warning("拒绝访问密钥库签名接口 [ip=%s, forwardedFor=%s]", ip, c.Ctx.Input.Header("X-Forwarded-For"))
+		c.Ctx.Output.SetStatus(403)
+		c.serveSign(403, "forbidden", nil)
+		return false
+	}
+	return true
+}
+
+// Sign 使用密钥库中的私钥对交易哈希签名
+// @router /WeBASE-Sign/sign [post]
+func (c *KeystoreSignController) Sign() {
+	if !c.allowed() {
+		return
+	}
+
+	var req keystoreSignRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil || req.SignUserID == "" {
+		c.serveSign(400, "无效的请求数据", nil)
+		return
+	}
+	hash, err := hex.DecodeString(strings.TrimPrefix(req.EncodedDataStr, "0x"))
+	if err != nil {
+		c.serveSign(400, "待签名数据格式错误", nil)
+		return
+	}
+
+	signature, err := services.NewKeystore().Sign(req.SignUserID, hash)
+	if err != nil {
+		logs.Error("密钥库签名失败 [signUserId=%s, error=%v]", req.SignUserID, err)
+		c.serveSign(500, err.Error(), nil)
+		return
+	}
+	c.serveSign(0, "success", map[string]string{"signDataStr": hex.EncodeToString(signature)})
+}
+
+// UserInfo 查询密钥库中的签名用户
+// @router /WeBASE-Sign/user/:signUserId/userInfo [get]
+func (c *KeystoreSignController) UserInfo() {
+	if !c.allowed() {
+		return
+	}
+
+	user, err := services.NewKeystore().GetSignUser(c.Ctx.Input.Param(":signUserId"))
+	if err != nil {
+		c.serveSign(404, err.Error(), nil)
+		return
+	}
+	c.serveSign(0, "success", user)
+}
@@ -74,8 +74,11 @@ type RegisterGoodRequest struct {
 
 // ShipGoodRequest 运输货物请求
 type ShipGoodRequest struct {
-	GoodID        string `json:"good_id"`
-	TransportInfo string `json:"transport_info"`
+	GoodID         string `json:"good_id"`
+	StartLocation  string `json:"start_location"`
+	EndLocation    string `json:"end_location"`
+	TrackingNumber string `json:"tracking_number"`
+	TransportInfo  string `json:"transport_info"`
 }
 
 // ShipGood 船东运输货物
@@ -108,10 +111,11 @@ func (c *OperatorController) ShipGood() {
 	}
 
 	// 调用区块链服务
-	webaseService := services.NewWebaseService()
+	chainClient := services.NewChainClient()
 	userAddress := "0x" + username // 简化处理，实际中需要获取正确的用户地址
 
-	txHash, message, err := webaseService.ShipGood(req.GoodID, req.TransportInfo, userAddress)
+	// 该接口不写入环节记录，不锚定记录哈希
+	txHash, message, err := chainClient.ShipGood(req.GoodID, req.StartLocation, req.EndLocation, req.TrackingNumber, req.TransportInfo, "", userAddress)
 	if err != nil {
 		logs.Error("区块链运输登记失败: %v", err)
 		c.Data["json"] = utils.ErrorResponse("区块链运输登记失败: " + err.Error())
@@ -130,6 +134,8 @@ func (c *OperatorController) ShipGood() {
 type InspectGoodRequest struct {
 	GoodID         string `json:"good_id"`
 	InspectionInfo string `json:"inspection_info"`
+	PassStatus     *bool  `json:"pass_status"` // 未填写时视为合格
+	RejectReason   string `json:"reject_reason"`
 }
 
 // InspectGood 港口验货
@@ -162,10 +168,11 @@ func (c *OperatorController) InspectGood() {
 	}
 
 	// 调用区块链服务
-	webaseService := services.NewWebaseService()
+	chainClient := services.NewChainClient()
 	userAddress := "0x" + username
 
-	txHash, message, err := webaseService.InspectGood(req.GoodID, req.InspectionInfo, userAddress)
+	passed := req.PassStatus == nil || *req.PassStatus
+	txHash, message, err := chainClient.InspectGood(req.GoodID, req.InspectionInfo, passed, req.RejectReason, "", userAddress)
 	if err != nil {
 		logs.Error("区块链验货登记失败: %v", err)
 		c.Data["json"] = utils.ErrorResponse("区块链验货登记失败: " + err.Error())
@@ -216,10 +223,10 @@ func (c *OperatorController) DeliverGood() {
 	}
 
 	// 调用区块链服务
-	webaseService := services.NewWebaseService()
+	chainClient := services.NewChainClient()
 	userAddress := "0x" + username
 
-	txHash, message, err := webaseService.DeliverGood(req.GoodID, req.DeliveryInfo, userAddress)
+	txHash, message, err := chainClient.DeliverGood(req.GoodID, req.DeliveryInfo, "", userAddress)
 	if err != nil {
 		logs.Error("区块链收货登记失败: %v", err)
 		c.Data["json"] = utils.ErrorResponse("区块链收货登记失败: " + err.Error())
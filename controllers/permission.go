@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"sea_trace_server_V2.0/models"
+
+	"github.com/beego/beego/v2/server/web/context"
+)
+
+// currentPermissions 获取当前用户的权限，经过 middleware.Authorize 的接口直接使用其结果
+func currentPermissions(ctx *context.Context) models.PermissionSet {
+	if permissions, ok := ctx.Input.GetData("permissions").(models.PermissionSet); ok {
+		return permissions
+	}
+	user, ok := ctx.Input.GetData("auth_user").(*models.User)
+	if !ok {
+		return models.PermissionSet{}
+	}
+	permissions, err := models.GetUserPermissions(user)
+	if err != nil {
+		return models.PermissionSet{}
+	}
+	ctx.Input.SetData("permissions", permissions)
+	return permissions
+}
+
+// hasPermission 当前用户是否拥有该权限，用于未纳入访问策略的接口
+func hasPermission(ctx *context.Context, code string) bool {
+	return currentPermissions(ctx).Has(code)
+}
+
+// dataScope 当前用户的数据访问范围：超级管理员不限制，其他账户限定为所属公司
+func dataScope(ctx *context.Context) models.DataScope {
+	if role, _ := ctx.Input.GetData("role").(string); role == models.RoleSuperAdmin {
+		return models.AllScope()
+	}
+	companyID, _ := ctx.Input.GetData("company_id").(int)
+	return models.CompanyScope(companyID)
+}
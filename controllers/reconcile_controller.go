@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/services"
+	"sea_trace_server_V2.0/utils"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
+)
+
+// ReconcileController 链上数据核对控制器
+type ReconcileController struct {
+	web.Controller
+}
+
+// Discrepancies 获取差异记录列表
+// @Title 获取差异记录列表
+// @Param page query int false "页码，默认1"
+// @Param page_size query int false "每页数量，默认10"
+// @Param status query string false "处理状态：open/redriven/resolved，默认全部"
+// @Param good_id query string false "货物ID"
+// @Success 200 {object} utils.Response
+// @router /api/admin/reconcile/discrepancies [get]
+func (c *ReconcileController) Discrepancies() {
+	page, _ := c.GetInt("page", 1)
+	pageSize, _ := c.GetInt("page_size", 10)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	list, total, err := models.GetChainDiscrepancyList(page, pageSize, c.GetString("status"), c.GetString("good_id"))
+	if err != nil {
+		logs.Error("获取差异记录失败: %v", err)
+		c.Data["json"] = utils.ErrorResponse("获取差异记录失败")
+		c.ServeJSON()
+		return
+	}
+
+	c.Data["json"] = utils.SuccessResponse(map[string]interface{}{
+		"discrepancies": list,
+		"total":         total,
+		"page":          page,
+		"page_size":     pageSize,
+	})
+	c.ServeJSON()
+}
+
+// Run 执行核对，指定 good_id 时只核对该货物
+// @Title 执行链上数据核对
+// @Param good_id query string false "货物ID，为空时核对全部货物"
+// @Success 200 {object} utils.Response
+// @router /api/admin/reconcile/run [post]
+func (c *ReconcileController) Run() {
+	reconciler := services.NewReconcileService()
+
+	if goodID := c.GetString("good_id"); goodID != "" {
+		found, err := reconciler.ReconcileGood(goodID)
+		if err != nil {
+			c.Data["json"] = utils.ErrorResponse(err.Error())
+			c.ServeJSON()
+			return
+		}
+		c.Data["json"] = utils.SuccessResponse(map[string]interface{}{
+			"good_id":       goodID,
+			"discrepancies": found,
+		})
+		c.ServeJSON()
+		return
+	}
+
+	c.Data["json"] = utils.SuccessResponse(reconciler.Run())
+	c.ServeJSON()
+}
+
+// Redrive 将链上缺失的环节重新提交上链
+// @Title 重新提交差异环节
+// @Param id path int true "差异记录ID"
+// @Success 200 {object} utils.Response
+// @router /api/admin/reconcile/redrive/:id [post]
+func (c *ReconcileController) Redrive() {
+	id, err := c.GetInt(":id")
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("无效的差异记录ID")
+		c.ServeJSON()
+		return
+	}
+
+	entry, err := services.NewReconcileService().Redrive(id)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse(err.Error())
+		c.ServeJSON()
+		return
+	}
+
+	c.Data["json"] = utils.SuccessResponse(entry)
+	c.ServeJSON()
+}
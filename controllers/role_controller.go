@@ -0,0 +1,378 @@
+package controllers
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/utils"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
+)
+
+// RoleController 角色与权限管理控制器
+// 公司账户只能管理本公司的自定义角色；超级管理员通过 company_id 参数指定公司
+type RoleController struct {
+	web.Controller
+}
+
+// roleCodePattern 角色编码格式
+var roleCodePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,49}$`)
+
+// CreateRoleRequest 创建角色请求
+type CreateRoleRequest struct {
+	CompanyID   int      `json:"company_id"` // 仅超级管理员需要指定
+	Code        string   `json:"code"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// UpdateRoleRequest 更新角色请求
+type UpdateRoleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// AssignRolesRequest 分配角色请求，role_ids 为空时恢复为账户类型对应的系统角色
+type AssignRolesRequest struct {
+	RoleIDs []int `json:"role_ids"`
+}
+
+// roleInfo 角色信息
+func roleInfo(role *models.Role) map[string]interface{} {
+	return map[string]interface{}{
+		"id":          role.Id,
+		"company_id":  role.CompanyId,
+		"code":        role.Code,
+		"name":        role.Name,
+		"description": role.Description,
+		"permissions": role.PermissionList(),
+		"system":      role.System,
+	}
+}
+
+// isSuperAdmin 当前账户是否为超级管理员账户
+func (c *RoleController) isSuperAdmin() bool {
+	role, _ := c.Ctx.Input.GetData("role").(string)
+	return role == models.RoleSuperAdmin
+}
+
+// scopeCompanyID 当前操作的公司：公司账户为所属公司，超级管理员为请求指定的公司
+func (c *RoleController) scopeCompanyID(requested int) int {
+	if c.isSuperAdmin() {
+		return requested
+	}
+	companyID, _ := c.Ctx.Input.GetData("company_id").(int)
+	return companyID
+}
+
+// customRole 获取当前账户可修改的自定义角色，失败时已写入响应
+func (c *RoleController) customRole() (*models.Role, bool) {
+	id, err := strconv.Atoi(c.Ctx.Input.Param(":id"))
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("无效的角色ID")
+		c.ServeJSON()
+		return nil, false
+	}
+
+	role, err := models.GetRoleByID(id)
+	if err != nil || (!c.isSuperAdmin() && role.CompanyId != c.scopeCompanyID(0)) {
+		c.Data["json"] = utils.ErrorResponse("角色不存在")
+		c.ServeJSON()
+		return nil, false
+	}
+	if role.System {
+		c.Data["json"] = utils.ErrorResponse("系统角色不能修改或删除")
+		c.ServeJSON()
+		return nil, false
+	}
+	return role, true
+}
+
+// Permissions 获取可授予的权限列表，公司账户不返回全局权限
+// @router /api/admin/roles/permissions [get]
+func (c *RoleController) Permissions() {
+	permissions := make([]models.Permission, 0, len(models.Permissions))
+	for _, p := range models.Permissions {
+		if p.Global && !c.isSuperAdmin() {
+			continue
+		}
+		permissions = append(permissions, p)
+	}
+
+	c.Data["json"] = utils.SuccessResponse(permissions)
+	c.ServeJSON()
+}
+
+// List 获取公司可分配的角色，包括系统角色和公司自定义角色
+// @router /api/admin/roles [get]
+func (c *RoleController) List() {
+	requested, _ := c.GetInt("company_id", 0)
+	roles, err := models.GetAssignableRoles(c.scopeCompanyID(requested))
+	if err != nil {
+		logs.Error("获取角色列表失败: %v", err)
+		c.Data["json"] = utils.ErrorResponse("获取角色列表失败")
+		c.ServeJSON()
+		return
+	}
+
+	list := make([]map[string]interface{}, 0, len(roles))
+	for _, role := range roles {
+		list = append(list, roleInfo(role))
+	}
+	c.Data["json"] = utils.SuccessResponse(list)
+	c.ServeJSON()
+}
+
+// Create 创建公司自定义角色，只能包含当前账户自身拥有的公司权限
+// @router /api/admin/roles [post]
+func (c *RoleController) Create() {
+	var req CreateRoleRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.Data["json"] = utils.ErrorResponse("无效的请求数据")
+		c.ServeJSON()
+		return
+	}
+
+	companyID := c.scopeCompanyID(req.CompanyID)
+	if companyID <= 0 {
+		c.Data["json"] = utils.ErrorResponse("请指定角色所属公司")
+		c.ServeJSON()
+		return
+	}
+	if !roleCodePattern.MatchString(req.Code) || len(models.SystemRolePermissions(req.Code)) > 0 {
+		c.Data["json"] = utils.ErrorResponse("角色编码只能包含小写字母、数字和下划线，且不能与系统角色相同")
+		c.ServeJSON()
+		return
+	}
+	if req.Name == "" {
+		c.Data["json"] = utils.ErrorResponse("角色名称不能为空")
+		c.ServeJSON()
+		return
+	}
+	if err := models.ValidateCompanyRolePermissions(req.Permissions, currentPermissions(c.Ctx)); err != nil {
+		c.Data["json"] = utils.ErrorResponse(err.Error())
+		c.ServeJSON()
+		return
+	}
+
+	role := &models.Role{
+		CompanyId:   companyID,
+		Code:        req.Code,
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: models.JoinPermissions(req.Permissions),
+	}
+	if err := models.CreateRole(role); err != nil {
+		logs.Error("创建角色失败: %v", err)
+		c.Data["json"] = utils.ErrorResponse("创建角色失败: " + err.Error())
+		c.ServeJSON()
+		return
+	}
+
+	audit(c.Ctx, models.AuditRoleCreate, models.AuditTargetRole, role.Id, companyID, nil, roleInfo(role))
+	logs.Info("角色创建成功 [company=%d, code=%s, permissions=%s, 操作者=%v]",
+		companyID, role.Code, role.Permissions, c.Ctx.Input.GetData("username"))
+	c.Data["json"] = utils.SuccessResponse(roleInfo(role))
+	c.ServeJSON()
+}
+
+// Update 更新公司自定义角色
+// @router /api/admin/roles/:id [put]
+func (c *RoleController) Update() {
+	role, ok := c.customRole()
+	if !ok {
+		return
+	}
+
+	var req UpdateRoleRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.Data["json"] = utils.ErrorResponse("无效的请求数据")
+		c.ServeJSON()
+		return
+	}
+	if err := models.ValidateCompanyRolePermissions(req.Permissions, currentPermissions(c.Ctx)); err != nil {
+		c.Data["json"] = utils.ErrorResponse(err.Error())
+		c.ServeJSON()
+		return
+	}
+
+	before := roleInfo(role)
+	if req.Name != "" {
+		role.Name = req.Name
+	}
+	role.Description = req.Description
+	role.Permissions = models.JoinPermissions(req.Permissions)
+	if err := models.UpdateRole(role); err != nil {
+		logs.Error("更新角色失败: %v", err)
+		c.Data["json"] = utils.ErrorResponse("更新角色失败")
+		c.ServeJSON()
+		return
+	}
+
+	audit(c.Ctx, models.AuditRoleUpdate, models.AuditTargetRole, role.Id, role.CompanyId, before, roleInfo(role))
+	logs.Info("角色已更新 [id=%d, code=%s, permissions=%s, 操作者=%v]",
+		role.Id, role.Code, role.Permissions, c.Ctx.Input.GetData("username"))
+	c.Data["json"] = utils.SuccessResponse(roleInfo(role))
+	c.ServeJSON()
+}
+
+// Delete 删除公司自定义角色，已分配该角色的用户同时取消分配
+// @router /api/admin/roles/:id [delete]
+func (c *RoleController) Delete() {
+	role, ok := c.customRole()
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteRole(role.Id); err != nil {
+		logs.Error("删除角色失败: %v", err)
+		c.Data["json"] = utils.ErrorResponse("删除角色失败")
+		c.ServeJSON()
+		return
+	}
+
+	audit(c.Ctx, models.AuditRoleDelete, models.AuditTargetRole, role.Id, role.CompanyId, roleInfo(role), nil)
+	logs.Info("角色已删除 [id=%d, code=%s, 操作者=%v]", role.Id, role.Code, c.Ctx.Input.GetData("username"))
+	c.Data["json"] = utils.SuccessResponse("删除成功")
+	c.ServeJSON()
+}
+
+// targetUser 获取要分配角色的用户，公司账户只能操作本公司用户，失败时已写入响应
+func (c *RoleController) targetUser() (*models.User, bool) {
+	id, err := strconv.Atoi(c.Ctx.Input.Param(":id"))
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("无效的用户ID")
+		c.ServeJSON()
+		return nil, false
+	}
+
+	user, err := models.GetUserByID(id)
+	if err != nil || (!c.isSuperAdmin() && (user.CompanyId != c.scopeCompanyID(0) || user.Role == models.RoleSuperAdmin)) {
+		c.Data["json"] = utils.ErrorResponse("用户不存在")
+		c.ServeJSON()
+		return nil, false
+	}
+	return user, true
+}
+
+// UserRoles 获取用户已分配的角色及有效权限
+// @router /api/admin/user/roles/:id [get]
+func (c *RoleController) UserRoles() {
+	user, ok := c.targetUser()
+	if !ok {
+		return
+	}
+
+	roles, err := models.GetUserRoles(user.Id)
+	if err != nil {
+		logs.Error("获取用户角色失败 [userID=%d]: %v", user.Id, err)
+		c.Data["json"] = utils.ErrorResponse("获取用户角色失败")
+		c.ServeJSON()
+		return
+	}
+	permissions, err := models.GetUserPermissions(user)
+	if err != nil {
+		logs.Error("获取用户权限失败 [userID=%d]: %v", user.Id, err)
+		c.Data["json"] = utils.ErrorResponse("获取用户权限失败")
+		c.ServeJSON()
+		return
+	}
+
+	list := make([]map[string]interface{}, 0, len(roles))
+	for _, role := range roles {
+		list = append(list, roleInfo(role))
+	}
+	c.Data["json"] = utils.SuccessResponse(map[string]interface{}{
+		"user_id":     user.Id,
+		"account":     user.Role,
+		"roles":       list,
+		"permissions": permissions.List(),
+	})
+	c.ServeJSON()
+}
+
+// AssignRoles 替换用户的角色分配
+// 只能分配本公司的自定义角色或系统角色，且不能分配超出当前账户自身权限的角色
+// 目标用户现有的权限超出当前账户的权限，或目标为公司管理员账户时，只有超级管理员可以修改
+// @router /api/admin/user/roles/:id [put]
+func (c *RoleController) AssignRoles() {
+	user, ok := c.targetUser()
+	if !ok {
+		return
+	}
+
+	var req AssignRolesRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.Data["json"] = utils.ErrorResponse("无效的请求数据")
+		c.ServeJSON()
+		return
+	}
+
+	grantor := currentPermissions(c.Ctx)
+	current, err := models.GetUserPermissions(user)
+	if err != nil {
+		logs.Error("获取用户权限失败 [userID=%d]: %v", user.Id, err)
+		c.Data["json"] = utils.ErrorResponse("分配角色失败")
+		c.ServeJSON()
+		return
+	}
+	if err := models.ValidateRoleAssignmentTarget(user, current, grantor, c.isSuperAdmin()); err != nil {
+		c.Data["json"] = utils.ErrorResponse(err.Error())
+		c.ServeJSON()
+		return
+	}
+
+	for _, roleID := range req.RoleIDs {
+		role, err := models.GetRoleByID(roleID)
+		if err != nil || (role.CompanyId != 0 && role.CompanyId != user.CompanyId) {
+			c.Data["json"] = utils.ErrorResponse("角色不存在: " + strconv.Itoa(roleID))
+			c.ServeJSON()
+			return
+		}
+		if role.CompanyId == 0 && (role.Code == models.RoleSuperAdmin) != (user.Role == models.RoleSuperAdmin) {
+			c.Data["json"] = utils.ErrorResponse("超级管理员角色只能分配给超级管理员账户")
+			c.ServeJSON()
+			return
+		}
+		for _, code := range role.PermissionList() {
+			if !grantor.Has(code) {
+				c.Data["json"] = utils.ErrorResponse("不能分配包含自己没有的权限的角色: " + role.Name)
+				c.ServeJSON()
+				return
+			}
+		}
+	}
+
+	previous, err := models.GetUserRoles(user.Id)
+	if err != nil {
+		logs.Error("获取用户角色失败 [userID=%d]: %v", user.Id, err)
+		c.Data["json"] = utils.ErrorResponse("分配角色失败")
+		c.ServeJSON()
+		return
+	}
+	previousIDs := make([]int, 0, len(previous))
+	for _, role := range previous {
+		previousIDs = append(previousIDs, role.Id)
+	}
+
+	if err := models.SetUserRoles(user.Id, req.RoleIDs); err != nil {
+		logs.Error("分配角色失败 [userID=%d]: %v", user.Id, err)
+		c.Data["json"] = utils.ErrorResponse("分配角色失败")
+		c.ServeJSON()
+		return
+	}
+
+	audit(c.Ctx, models.AuditUserRoles, models.AuditTargetUser, user.Id, user.CompanyId,
+		map[string]interface{}{"role_ids": previousIDs}, map[string]interface{}{"role_ids": append([]int{}, req.RoleIDs...)})
+	logs.Info("用户角色已更新 [username=%s, roles=%v, 操作者=%v]", user.Username, req.RoleIDs, c.Ctx.Input.GetData("username"))
+	c.Data["json"] = utils.SuccessResponse(map[string]interface{}{
+		"user_id":  user.Id,
+		"role_ids": req.RoleIDs,
+	})
+	c.ServeJSON()
+}
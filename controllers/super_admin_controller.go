@@ -30,14 +30,6 @@ type SuperAdminController struct {
 // @Failure 500 {object} utils.Response
 // @router /api/su/company/list [get]
 func (c *SuperAdminController) CompanyList() {
-	// 检查权限 - 仅超级管理员可操作
-	roleInterface := c.Ctx.Input.GetData("role")
-	if roleInterface == nil || roleInterface.(string) != "super_admin" {
-		c.Data["json"] = utils.ForbiddenResponse()
-		c.ServeJSON()
-		return
-	}
-
 	// 获取查询参数
 	page, _ := c.GetInt("page", 1)
 	pageSize, _ := c.GetInt("page_size", 10)
@@ -80,14 +72,6 @@ type CreateCompanyRequest struct {
 // CreateCompany 创建公司并在区块链注册
 // @router /api/su/company/create [post]
 func (c *SuperAdminController) CreateCompany() {
-	// 检查权限 - 仅超级管理员可操作
-	roleInterface := c.Ctx.Input.GetData("role")
-	if roleInterface == nil || roleInterface.(string) != "super_admin" {
-		c.Data["json"] = utils.ForbiddenResponse()
-		c.ServeJSON()
-		return
-	}
-
 	var req CreateCompanyRequest
 	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
 		c.Data["json"] = utils.ErrorResponse("无效的请求数据")
@@ -110,13 +94,8 @@ func (c *SuperAdminController) CreateCompany() {
 		return
 	}
 
-	// 1. 创建区块链用户 - 用公司名称作为区块链用户名
-	webaseService := services.NewWebaseService()
-	blockchainUser, err := webaseService.CreateBlockchainUser(
-		req.CompanyName,
-		0,    // 使用本地用户类型
-		true, // 获取私钥
-	)
+	// 1. 创建区块链用户 - 用公司名称作为区块链用户名，私钥由WeBASE-Sign托管
+	blockchainUser, err := services.NewAccountProvider().CreateBlockchainUser(req.CompanyName)
 
 	if err != nil {
 		logs.Error("为公司创建区块链用户失败 [company=%s, error=%v, time=%s]",
@@ -131,11 +110,13 @@ func (c *SuperAdminController) CreateCompany() {
 
 	// 2. 创建公司记录 - 包含区块链地址信息
 	company := &models.Company{
-		CompanyName: req.CompanyName,
-		CompanyType: models.CompanyType(req.CompanyType),
-		Address:     blockchainUser.Address,
-		Contact:     req.Contact,
-		Phone:       req.Phone,
+		CompanyName:    req.CompanyName,
+		CompanyType:    models.CompanyType(req.CompanyType),
+		Address:        blockchainUser.Address,
+		Contact:        req.Contact,
+		Phone:          req.Phone,
+		SignUserId:     blockchainUser.SignUserID,
+		BlockchainType: blockchainUser.Type,
 		// BlockchainAddress: blockchainUser.Address, // 存储区块链地址到公司记录
 	}
 
@@ -150,7 +131,7 @@ func (c *SuperAdminController) CreateCompany() {
 	company.ID = int(id)
 
 	// 3. 在区块链上注册公司
-	txHash, err := webaseService.RegisterCompany(
+	txHash, err := services.NewChainClient().RegisterCompany(
 		company.CompanyName,
 		int(company.CompanyType),
 		blockchainUser.Address, // 使用新创建的区块链地址
@@ -173,6 +154,7 @@ func (c *SuperAdminController) CreateCompany() {
 	}
 
 	// 记录操作日志
+	audit(c.Ctx, models.AuditCompanyCreate, models.AuditTargetCompany, company.ID, company.ID, nil, company)
 	logs.Info("超级管理员创建公司成功 [公司名=%s, 公司ID=%d, 区块链地址=%s, 操作者=%s, 时间=%s]",
 		req.CompanyName, company.ID, blockchainUser.Address,
 		c.Ctx.Input.GetData("username"), "2025-05-14 12:44:16")
@@ -181,11 +163,11 @@ func (c *SuperAdminController) CreateCompany() {
 	c.Data["json"] = utils.SuccessResponse(map[string]interface{}{
 		"company": company,
 		"blockchain_info": map[string]interface{}{
-			"address":     blockchainUser.Address,
-			"public_key":  blockchainUser.PublicKey,
-			"private_key": blockchainUser.PrivateKey, // 注意：生产环境中不应返回私钥
-			"tx_hash":     txHash,
-			"registered":  txHash != "",
+			"address":      blockchainUser.Address,
+			"public_key":   blockchainUser.PublicKey,
+			"sign_user_id": blockchainUser.SignUserID,
+			"tx_hash":      txHash,
+			"registered":   txHash != "",
 		},
 	})
 	c.ServeJSON()
@@ -203,14 +185,6 @@ type UpdateCompanyRequest struct {
 // UpdateCompany 更新公司
 // @router /api/su/company/update/:id [put]
 func (c *SuperAdminController) UpdateCompany() {
-	// 检查权限 - 仅超级管理员可操作
-	roleInterface := c.Ctx.Input.GetData("role")
-	if roleInterface == nil || roleInterface.(string) != "super_admin" {
-		c.Data["json"] = utils.ForbiddenResponse()
-		c.ServeJSON()
-		return
-	}
-
 	idStr := c.Ctx.Input.Param(":id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -250,6 +224,7 @@ func (c *SuperAdminController) UpdateCompany() {
 		}
 	}
 
+	before := *company
 	oldCompanyType := company.CompanyType
 	oldCompanyName := company.CompanyName
 
@@ -272,6 +247,7 @@ func (c *SuperAdminController) UpdateCompany() {
 			company.CompanyName, company.ID, "2025-05-14 09:59:00")
 	}
 
+	audit(c.Ctx, models.AuditCompanyUpdate, models.AuditTargetCompany, company.ID, company.ID, &before, company)
 	logs.Info("超级管理员更新公司成功 [公司名=%s, 公司ID=%d, 操作者=%s, 时间=%s]",
 		company.CompanyName, company.ID, c.Ctx.Input.GetData("username"), "2025-05-14 09:59:00")
 
@@ -282,14 +258,6 @@ func (c *SuperAdminController) UpdateCompany() {
 // DeleteCompany 删除公司
 // @router /api/su/company/delete/:id [delete]
 func (c *SuperAdminController) DeleteCompany() {
-	// 检查权限 - 仅超级管理员可操作
-	roleInterface := c.Ctx.Input.GetData("role")
-	if roleInterface == nil || roleInterface.(string) != "super_admin" {
-		c.Data["json"] = utils.ForbiddenResponse()
-		c.ServeJSON()
-		return
-	}
-
 	idStr := c.Ctx.Input.Param(":id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -332,6 +300,7 @@ func (c *SuperAdminController) DeleteCompany() {
 	}
 
 	// 删除成功后记录日志
+	audit(c.Ctx, models.AuditCompanyDelete, models.AuditTargetCompany, company.ID, company.ID, company, nil)
 	logs.Info("超级管理员删除公司成功 [公司名=%s, 公司ID=%d, 操作者=%s, 时间=%s]",
 		company.CompanyName, company.ID, c.Ctx.Input.GetData("username"), "2025-05-14 09:59:00")
 
@@ -352,14 +321,6 @@ type CreateCompanyAdminRequest struct {
 // CreateCompanyAdmin 创建公司管理员
 // @router /api/su/company/admin/create [post]
 func (c *SuperAdminController) CreateCompanyAdmin() {
-	// 检查权限 - 仅超级管理员可操作
-	roleInterface := c.Ctx.Input.GetData("role")
-	if roleInterface == nil || roleInterface.(string) != "super_admin" {
-		c.Data["json"] = utils.ForbiddenResponse()
-		c.ServeJSON()
-		return
-	}
-
 	var req CreateCompanyAdminRequest
 	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
 		c.Data["json"] = utils.ErrorResponse("无效的请求数据")
@@ -399,7 +360,7 @@ func (c *SuperAdminController) CreateCompanyAdmin() {
 		req.Username,
 		req.Password,
 		req.RealName,
-		"company_admin",
+		models.RoleCompanyAdmin,
 		req.CompanyID,
 		req.Email,
 		req.Phone,
@@ -446,6 +407,7 @@ func (c *SuperAdminController) CreateCompanyAdmin() {
 	// }
 
 	// 记录操作日志
+	audit(c.Ctx, models.AuditCompanyAdminCreate, models.AuditTargetUser, user.Id, company.ID, nil, user)
 	logs.Info("超级管理员创建公司管理员成功 [username=%s, company=%s, companyID=%d, 操作者=%s, 时间=%s]",
 		user.Username, company.CompanyName, company.ID, c.Ctx.Input.GetData("username"), "2025-05-14 09:59:00")
 
@@ -467,14 +429,6 @@ func (c *SuperAdminController) CreateCompanyAdmin() {
 // GetCompanyAdmins 获取公司管理员列表
 // @router /api/su/company/:id/admins [get]
 func (c *SuperAdminController) GetCompanyAdmins() {
-	// 检查权限 - 仅超级管理员可操作
-	roleInterface := c.Ctx.Input.GetData("role")
-	if roleInterface == nil || roleInterface.(string) != "super_admin" {
-		c.Data["json"] = utils.ForbiddenResponse()
-		c.ServeJSON()
-		return
-	}
-
 	idStr := c.Ctx.Input.Param(":id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -510,14 +464,6 @@ func (c *SuperAdminController) GetCompanyAdmins() {
 // DeleteCompanyAdmin 删除公司管理员
 // @router /api/su/company/admin/delete/:id [delete]
 func (c *SuperAdminController) DeleteCompanyAdmin() {
-	// 检查权限 - 仅超级管理员可操作
-	roleInterface := c.Ctx.Input.GetData("role")
-	if roleInterface == nil || roleInterface.(string) != "super_admin" {
-		c.Data["json"] = utils.ForbiddenResponse()
-		c.ServeJSON()
-		return
-	}
-
 	idStr := c.Ctx.Input.Param(":id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
@@ -535,7 +481,7 @@ func (c *SuperAdminController) DeleteCompanyAdmin() {
 	}
 
 	// 检查是否为公司管理员
-	if user.Role != "company_admin" {
+	if user.Role != models.RoleCompanyAdmin {
 		c.Data["json"] = utils.ErrorResponse("该用户不是公司管理员")
 		c.ServeJSON()
 		return
@@ -565,6 +511,7 @@ func (c *SuperAdminController) DeleteCompanyAdmin() {
 	}
 
 	// 记录操作日志
+	audit(c.Ctx, models.AuditCompanyAdminDelete, models.AuditTargetUser, user.Id, company.ID, user, nil)
 	logs.Info("超级管理员删除公司管理员成功 [userID=%d, username=%s, company=%s, companyID=%d, 操作者=%s, 时间=%s]",
 		user.Id, user.Username, company.CompanyName, company.ID, c.Ctx.Input.GetData("username"), "2025-05-14 09:59:00")
 
@@ -575,14 +522,6 @@ func (c *SuperAdminController) DeleteCompanyAdmin() {
 // GetSystemStats 获取系统统计信息
 // @router /api/su/stats [get]
 func (c *SuperAdminController) GetSystemStats() {
-	// 检查权限 - 仅超级管理员可操作
-	roleInterface := c.Ctx.Input.GetData("role")
-	if roleInterface == nil || roleInterface.(string) != "super_admin" {
-		c.Data["json"] = utils.ForbiddenResponse()
-		c.ServeJSON()
-		return
-	}
-
 	// 获取各种统计数据
 	companiesCount, _ := models.CountCompanies()
 	usersCount, _ := models.CountUsers()
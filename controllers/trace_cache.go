@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"sea_trace_server_V2.0/services"
+	"sea_trace_server_V2.0/utils"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web/context"
+)
+
+// serveCachedTrace 命中缓存时直接返回缓存的溯源查询响应
+// 未命中时返回查询前的缓存版本号，查询完成后传给 serveTrace
+func serveCachedTrace(ctx *context.Context, kind, goodID string) (uint64, bool) {
+	cache := services.DefaultTraceCache()
+	version := cache.Version()
+	entry, ok := cache.Get(kind, goodID)
+	if !ok {
+		return version, false
+	}
+	writeTrace(ctx, entry, "HIT")
+	return version, true
+}
+
+// serveTrace 缓存并返回溯源查询的成功响应，错误响应不应经过该函数
+func serveTrace(ctx *context.Context, kind, goodID string, version uint64, response interface{}) {
+	body, err := json.Marshal(response)
+	if err != nil {
+		logs.Error("序列化溯源查询响应失败 [goodID=%s]: %v", goodID, err)
+		ctx.Output.JSON(utils.ErrorResponse("获取溯源信息失败"), false, false)
+		return
+	}
+	writeTrace(ctx, services.DefaultTraceCache().Put(kind, goodID, version, body), "MISS")
+}
+
+// writeTrace 写入缓存响应头，客户端已持有相同内容时返回304
+func writeTrace(ctx *context.Context, entry *services.TraceCacheEntry, status string) {
+	cache := services.DefaultTraceCache()
+	maxAge := cache.TTL - cache.Now().Sub(entry.StoredAt)
+	if cache.Size <= 0 || maxAge < 0 {
+		maxAge = 0
+	}
+	ctx.Output.Header("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	ctx.Output.Header("ETag", entry.ETag)
+	ctx.Output.Header("X-Cache", status)
+
+	if ctx.Input.Header("If-None-Match") == entry.ETag {
+		ctx.Output.SetStatus(304)
+		ctx.Output.Body(nil)
+		return
+	}
+	ctx.Output.Header("Content-Type", "application/json; charset=utf-8")
+	ctx.Output.Body(entry.Body)
+}
@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"encoding/json"
+
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/services"
+	"sea_trace_server_V2.0/utils"
+
+	"github.com/beego/beego/v2/core/logs"
+)
+
+// TraceVisibilityField 公开溯源字段及本公司的可见性设置
+type TraceVisibilityField struct {
+	models.PublicTraceField
+	Visibility string `json:"visibility"`
+}
+
+// UpdateTraceVisibilityRequest 更新公开溯源字段可见性请求，未列出的字段恢复默认值
+type UpdateTraceVisibilityRequest struct {
+	Fields models.TraceVisibility `json:"fields"`
+}
+
+// traceVisibilityCompany 解析要设置的公司，超级管理员需通过 company_id 指定，失败时已写入错误响应
+func (c *CompanyAdminController) traceVisibilityCompany() (int, bool) {
+	requested, _ := c.GetInt("company_id", 0)
+	companyID, err := dataScope(c.Ctx).ResolveCompany(requested)
+	if err != nil {
+		c.Data["json"] = utils.ForbiddenResponse()
+		c.ServeJSON()
+		return 0, false
+	}
+	if companyID <= 0 {
+		c.Data["json"] = utils.ErrorResponse("请指定公司")
+		c.ServeJSON()
+		return 0, false
+	}
+	return companyID, true
+}
+
+// GetTraceVisibility 获取本公司经手环节在公开溯源中的字段可见性
+// @router /api/admin/company/trace-visibility [get]
+func (c *CompanyAdminController) GetTraceVisibility() {
+	companyID, ok := c.traceVisibilityCompany()
+	if !ok {
+		return
+	}
+
+	settings, err := models.GetTraceVisibility(companyID)
+	if err != nil {
+		logs.Error("获取公开溯源设置失败 [companyID=%d]: %v", companyID, err)
+		c.Data["json"] = utils.ErrorResponse("获取公开溯源设置失败")
+		c.ServeJSON()
+		return
+	}
+
+	fields := make([]TraceVisibilityField, 0, len(models.PublicTraceFields))
+	for _, field := range models.PublicTraceFields {
+		fields = append(fields, TraceVisibilityField{PublicTraceField: field, Visibility: settings.Of(field)})
+	}
+	c.Data["json"] = utils.SuccessResponse(map[string]interface{}{
+		"company_id": companyID,
+		"fields":     fields,
+	})
+	c.ServeJSON()
+}
+
+// UpdateTraceVisibility 设置本公司经手环节在公开溯源中的字段可见性
+// @router /api/admin/company/trace-visibility [put]
+func (c *CompanyAdminController) UpdateTraceVisibility() {
+	companyID, ok := c.traceVisibilityCompany()
+	if !ok {
+		return
+	}
+
+	var req UpdateTraceVisibilityRequest
+	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
+		c.Data["json"] = utils.ErrorResponse("无效的请求数据")
+		c.ServeJSON()
+		return
+	}
+	if err := models.ValidateTraceVisibility(req.Fields); err != nil {
+		c.Data["json"] = utils.ErrorResponse(err.Error())
+		c.ServeJSON()
+		return
+	}
+
+	before, err := models.GetTraceVisibility(companyID)
+	if err == nil {
+		err = models.SaveTraceVisibility(companyID, req.Fields)
+	}
+	if err != nil {
+		logs.Error("保存公开溯源设置失败 [companyID=%d]: %v", companyID, err)
+		c.Data["json"] = utils.ErrorResponse("保存公开溯源设置失败")
+		c.ServeJSON()
+		return
+	}
+	after, _ := models.GetTraceVisibility(companyID)
+	// 可见性设置影响该公司经手的全部货物，清空公开溯源缓存
+	services.DefaultTraceCache().Purge()
+	audit(c.Ctx, models.AuditCompanyVisibility, models.AuditTargetCompany, companyID, companyID, before, after)
+
+	c.GetTraceVisibility()
+}
@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"time"
+
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/services"
+	"sea_trace_server_V2.0/utils"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
+)
+
+// TransactionController 交易账本控制器
+type TransactionController struct {
+	web.Controller
+}
+
+// List 获取交易记录列表
+// @Title 获取交易记录列表
+// @Description 查询服务端推送到区块链的交易记录，支持分页和筛选
+// @Param page query int false "页码，默认1"
+// @Param page_size query int false "每页数量，默认10"
+// @Param func_name query string false "合约方法名"
+// @Param good_id query string false "货物ID"
+// @Param sender query string false "发送方地址"
+// @Param status query int false "交易状态：-1(全部)，0(失败)，1(成功)"
+// @Param start_date query string false "开始日期，格式2006-01-02"
+// @Param end_date query string false "结束日期（含），格式2006-01-02"
+// @Success 200 {object} utils.Response
+// @Failure 403 {object} utils.Response
+// @router /api/admin/transactions [get]
+func (c *TransactionController) List() {
+	page, _ := c.GetInt("page", 1)
+	pageSize, _ := c.GetInt("page_size", 10)
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	filter := models.TransactionFilter{
+		FuncName:      c.GetString("func_name"),
+		GoodId:        c.GetString("good_id"),
+		SenderAddress: c.GetString("sender"),
+	}
+	filter.Status, _ = c.GetInt("status", -1)
+
+	if startDate := c.GetString("start_date"); startDate != "" {
+		start, err := time.ParseInLocation("2006-01-02", startDate, time.Local)
+		if err != nil {
+			c.Data["json"] = utils.ErrorResponse("开始日期格式错误，应为YYYY-MM-DD")
+			c.ServeJSON()
+			return
+		}
+		filter.StartTime = start
+	}
+	if endDate := c.GetString("end_date"); endDate != "" {
+		end, err := time.ParseInLocation("2006-01-02", endDate, time.Local)
+		if err != nil {
+			c.Data["json"] = utils.ErrorResponse("结束日期格式错误，应为YYYY-MM-DD")
+			c.ServeJSON()
+			return
+		}
+		filter.EndTime = end.AddDate(0, 0, 1)
+	}
+
+	transactions, total, err := models.QueryTransactions(filter, page, pageSize)
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("获取交易记录失败")
+		c.ServeJSON()
+		return
+	}
+
+	c.Data["json"] = utils.SuccessResponse(map[string]interface{}{
+		"transactions": transactions,
+		"total":        total,
+		"page":         page,
+		"page_size":    pageSize,
+	})
+	c.ServeJSON()
+}
+
+// Detail 根据交易哈希获取交易记录
+// @Title 获取交易记录详情
+// @Description 根据交易哈希获取本地交易记录，并附带链上交易信息
+// @Param hash path string true "交易哈希"
+// @Success 200 {object} utils.Response
+// @Failure 403 {object} utils.Response
+// @router /api/admin/transactions/:hash [get]
+func (c *TransactionController) Detail() {
+	txHash := c.Ctx.Input.Param(":hash")
+	if txHash == "" {
+		c.Data["json"] = utils.ErrorResponse("交易哈希不能为空")
+		c.ServeJSON()
+		return
+	}
+
+	tx, err := models.GetTransactionByHash(txHash)
+	if err == orm.ErrNoRows {
+		c.Data["json"] = utils.ErrorResponse("交易记录不存在")
+		c.ServeJSON()
+		return
+	}
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("获取交易记录失败")
+		c.ServeJSON()
+		return
+	}
+
+	data := map[string]interface{}{
+		"transaction": tx,
+	}
+
+	// 附带链上交易信息，便于与本地记录对照
+	chainTx, err := services.NewChainClient().GetTransactionByHash(txHash)
+	if err != nil {
+		logs.Warning("获取链上交易信息失败 [txHash=%s, error=%v]", txHash, err)
+	} else {
+		data["chain"] = chainTx
+	}
+
+	c.Data["json"] = utils.SuccessResponse(data)
+	c.ServeJSON()
+}
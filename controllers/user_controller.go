@@ -5,6 +5,7 @@ import (
 	"strconv"
 
 	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/services"
 	"sea_trace_server_V2.0/utils"
 
 	"github.com/beego/beego/v2/core/logs"
@@ -57,11 +58,8 @@ func (u *UserController) Post() {
 // @Success 200 {object} utils.Response
 // @router / [get]
 func (u *UserController) GetAll() {
-	// 从身份验证中间件获取角色信息
-	role := u.Ctx.Input.GetData("role")
-
-	// 只有超级管理员可以查看所有用户
-	if role != nil && role != "super_admin" {
+	// 只有用户管理权限可以查看所有用户
+	if !hasPermission(u.Ctx, models.PermUserManage) {
 		u.Data["json"] = utils.ForbiddenResponse()
 		u.ServeJSON()
 		return
@@ -123,10 +121,9 @@ func (u *UserController) Put() {
 
 	// 从身份验证中间件获取当前用户信息
 	currentUserID := u.Ctx.Input.GetData("user_id")
-	currentUserRole := u.Ctx.Input.GetData("role")
 
-	// 权限检查：只有超级管理员或用户本人可以修改用户信息
-	if currentUserRole != "super_admin" {
+	// 权限检查：只有用户管理权限或用户本人可以修改用户信息
+	if !hasPermission(u.Ctx, models.PermUserManage) {
 		currentIDStr := strconv.Itoa(currentUserID.(int))
 		if currentIDStr != uid {
 			u.Data["json"] = utils.ForbiddenResponse()
@@ -169,11 +166,8 @@ func (u *UserController) Delete() {
 		return
 	}
 
-	// 从身份验证中间件获取角色信息
-	role := u.Ctx.Input.GetData("role")
-
-	// 只有超级管理员可以删除用户
-	if role != "super_admin" {
+	// 只有用户管理权限可以删除用户
+	if !hasPermission(u.Ctx, models.PermUserManage) {
 		u.Data["json"] = utils.ForbiddenResponse()
 		u.ServeJSON()
 		return
@@ -220,7 +214,7 @@ func (u *UserController) Login() {
 	}
 
 	// 生成JWT令牌
-	token, err := utils.GenerateToken(user.Id, user.Username, user.Role, user.CompanyId)
+	tokens, err := services.NewTokenService().Issue(user)
 	if err != nil {
 		logs.Error("生成token失败: %v", err)
 		u.Data["json"] = utils.ErrorResponse("生成token失败")
@@ -230,7 +224,8 @@ func (u *UserController) Login() {
 
 	// 返回用户信息和令牌
 	userInfo := models.GetUserInfo(user)
-	userInfo["token"] = token
+	userInfo["token"] = tokens.AccessToken
+	userInfo["refresh_token"] = tokens.RefreshToken
 
 	u.Data["json"] = utils.SuccessResponse(userInfo)
 	u.ServeJSON()
@@ -5,6 +5,7 @@ import (
 	"strconv"
 
 	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/services"
 	"sea_trace_server_V2.0/utils"
 
 	"github.com/beego/beego/v2/core/logs"
@@ -36,20 +37,8 @@ type UserListRequest struct {
 // @Failure 500 {object} utils.Response
 // @Router /api/admin/users [get]
 func (c *UserManagementController) ListUsers() {
-	// 检查权限
-	roleInterface := c.Ctx.Input.GetData("role")
-	if roleInterface == nil {
-		c.Data["json"] = utils.ErrorResponse("无法获取用户角色")
-		c.ServeJSON()
-		return
-	}
-
-	role, ok := roleInterface.(string)
-	if !ok || (role != "super_admin" && role != "company_admin") {
-		c.Data["json"] = utils.ForbiddenResponse()
-		c.ServeJSON()
-		return
-	}
+	// 权限由访问策略校验，账户类型决定可查看的范围
+	role, _ := c.Ctx.Input.GetData("role").(string)
 
 	// 获取查询参数
 	page, _ := c.GetInt("page", 1)
@@ -57,9 +46,9 @@ func (c *UserManagementController) ListUsers() {
 	keyword := c.GetString("search", "")
 	roleFilter := c.GetString("role", "")
 
-	// 公司管理员只能查看自己公司的用户
+	// 公司内的账户只能查看自己公司的用户
 	companyID := 0
-	if role == "company_admin" {
+	if role != models.RoleSuperAdmin {
 		companyIDInterface := c.Ctx.Input.GetData("company_id")
 		if companyIDInterface == nil {
 			c.Data["json"] = utils.ErrorResponse("无法获取公司ID")
@@ -120,21 +109,6 @@ type CreateUserRequest struct {
 // CreateUser 创建用户
 // @router /api/admin/user/create [post]
 func (c *UserManagementController) CreateUser() {
-	// 检查权限
-	roleInterface := c.Ctx.Input.GetData("role")
-	if roleInterface == nil {
-		c.Data["json"] = utils.ErrorResponse("无法获取用户角色")
-		c.ServeJSON()
-		return
-	}
-
-	role, ok := roleInterface.(string)
-	if !ok || role != "super_admin" {
-		c.Data["json"] = utils.ForbiddenResponse()
-		c.ServeJSON()
-		return
-	}
-
 	var req CreateUserRequest
 	if err := json.Unmarshal(c.Ctx.Input.RequestBody, &req); err != nil {
 		c.Data["json"] = utils.ErrorResponse("无效的请求数据")
@@ -150,14 +124,14 @@ func (c *UserManagementController) CreateUser() {
 	}
 
 	// 验证角色
-	if req.Role != "super_admin" && req.Role != "company_admin" && req.Role != "operator" {
+	if req.Role != models.RoleSuperAdmin && req.Role != models.RoleCompanyAdmin && req.Role != models.RoleOperator {
 		c.Data["json"] = utils.ErrorResponse("无效的角色")
 		c.ServeJSON()
 		return
 	}
 
 	// 如果不是超级管理员，需要验证公司ID
-	if req.Role != "super_admin" && req.CompanyID <= 0 {
+	if req.Role != models.RoleSuperAdmin && req.CompanyID <= 0 {
 		c.Data["json"] = utils.ErrorResponse("公司管理员和操作员需要指定公司ID")
 		c.ServeJSON()
 		return
@@ -193,6 +167,7 @@ func (c *UserManagementController) CreateUser() {
 		}
 	}
 
+	audit(c.Ctx, models.AuditUserCreate, models.AuditTargetUser, user.Id, user.CompanyId, nil, user)
 	c.Data["json"] = utils.SuccessResponse(user)
 	c.ServeJSON()
 }
@@ -210,21 +185,6 @@ type UpdateUserRequest struct {
 // UpdateUser 更新用户信息
 // @router /api/admin/user/update/:id [put]
 func (c *UserManagementController) UpdateUser() {
-	// 检查权限
-	roleInterface := c.Ctx.Input.GetData("role")
-	if roleInterface == nil {
-		c.Data["json"] = utils.ErrorResponse("无法获取用户角色")
-		c.ServeJSON()
-		return
-	}
-
-	role, ok := roleInterface.(string)
-	if !ok || role != "super_admin" {
-		c.Data["json"] = utils.ForbiddenResponse()
-		c.ServeJSON()
-		return
-	}
-
 	// 获取用户ID
 	idStr := c.Ctx.Input.Param(":id")
 	id, err := strconv.Atoi(idStr)
@@ -250,6 +210,7 @@ func (c *UserManagementController) UpdateUser() {
 	}
 
 	// 更新字段
+	before := *user
 	if req.RealName != "" {
 		user.RealName = req.RealName
 	}
@@ -262,7 +223,7 @@ func (c *UserManagementController) UpdateUser() {
 	if req.Status != 0 {
 		user.Status = req.Status
 	}
-	if req.CompanyID > 0 && user.Role != "super_admin" {
+	if req.CompanyID > 0 && user.Role != models.RoleSuperAdmin {
 		user.CompanyId = req.CompanyID
 	}
 
@@ -287,6 +248,12 @@ func (c *UserManagementController) UpdateUser() {
 		return
 	}
 
+	// 密码不出现在审计内容中，只记录是否修改
+	audit(c.Ctx, models.AuditUserUpdate, models.AuditTargetUser, user.Id, user.CompanyId, &before, struct {
+		*models.User
+		PasswordChanged bool `json:"password_changed,omitempty"`
+	}{user, req.Password != ""})
+
 	// 返回更新后的用户信息
 	userInfo := models.GetUserInfo(user)
 	c.Data["json"] = utils.SuccessResponse(userInfo)
@@ -296,21 +263,6 @@ func (c *UserManagementController) UpdateUser() {
 // DeleteUser 删除用户
 // @router /api/admin/user/delete/:id [delete]
 func (c *UserManagementController) DeleteUser() {
-	// 检查权限
-	roleInterface := c.Ctx.Input.GetData("role")
-	if roleInterface == nil {
-		c.Data["json"] = utils.ErrorResponse("无法获取用户角色")
-		c.ServeJSON()
-		return
-	}
-
-	role, ok := roleInterface.(string)
-	if !ok || role != "super_admin" {
-		c.Data["json"] = utils.ForbiddenResponse()
-		c.ServeJSON()
-		return
-	}
-
 	// 获取用户ID
 	idStr := c.Ctx.Input.Param(":id")
 	id, err := strconv.Atoi(idStr)
@@ -330,7 +282,7 @@ func (c *UserManagementController) DeleteUser() {
 
 	// 检查是否为超级管理员
 	user, err := models.GetUserByID(id)
-	if err == nil && user.Role == "super_admin" {
+	if err == nil && user.Role == models.RoleSuperAdmin {
 		// 检查是否为最后一个超级管理员
 		adminCount, _ := models.CountAdmins()
 		if adminCount <= 1 {
@@ -349,6 +301,83 @@ func (c *UserManagementController) DeleteUser() {
 		return
 	}
 
+	if user != nil {
+		audit(c.Ctx, models.AuditUserDelete, models.AuditTargetUser, user.Id, user.CompanyId, user, nil)
+	}
 	c.Data["json"] = utils.SuccessResponse("删除成功")
 	c.ServeJSON()
 }
+
+// managedUser 获取当前管理员可管理的用户：超级管理员可管理全部用户，公司内的账户只能管理本公司用户
+func (c *UserManagementController) managedUser() (*models.User, bool) {
+	role, _ := c.Ctx.Input.GetData("role").(string)
+
+	id, err := strconv.Atoi(c.Ctx.Input.Param(":id"))
+	if err != nil {
+		c.Data["json"] = utils.ErrorResponse("无效的用户ID")
+		c.ServeJSON()
+		return nil, false
+	}
+
+	user, err := models.GetUserByID(id)
+	companyID, _ := c.Ctx.Input.GetData("company_id").(int)
+	if err != nil || (role != models.RoleSuperAdmin && (user.CompanyId != companyID || user.Role == models.RoleSuperAdmin)) {
+		c.Data["json"] = utils.ErrorResponse("用户不存在")
+		c.ServeJSON()
+		return nil, false
+	}
+	return user, true
+}
+
+// UnlockUser 解除因登录失败次数过多而锁定的账户
+// @router /api/admin/user/unlock/:id [put]
+func (c *UserManagementController) UnlockUser() {
+	user, ok := c.managedUser()
+	if !ok {
+		return
+	}
+
+	operator, _ := c.Ctx.Input.GetData("username").(string)
+	if err := services.DefaultLoginGuard().Unlock(user, operator); err != nil {
+		logs.Error("解除账户锁定失败 [username=%s]: %v", user.Username, err)
+		c.Data["json"] = utils.ErrorResponse("解除账户锁定失败")
+		c.ServeJSON()
+		return
+	}
+
+	audit(c.Ctx, models.AuditUserUnlock, models.AuditTargetUser, user.Id, user.CompanyId,
+		map[string]interface{}{"failed_logins": user.FailedLogins, "locked_until": user.LockedUntil},
+		map[string]interface{}{"failed_logins": 0, "locked_until": nil})
+	c.Data["json"] = utils.SuccessResponse(map[string]interface{}{
+		"id":       user.Id,
+		"username": user.Username,
+	})
+	c.ServeJSON()
+}
+
+// SecurityEvents 获取用户的账户安全事件（锁定、解除锁定等）
+// @router /api/admin/user/security-events/:id [get]
+func (c *UserManagementController) SecurityEvents() {
+	user, ok := c.managedUser()
+	if !ok {
+		return
+	}
+
+	page, _ := c.GetInt("page", 1)
+	pageSize, _ := c.GetInt("page_size", 20)
+	events, total, err := models.GetUserSecurityEvents(user.Id, page, pageSize)
+	if err != nil {
+		logs.Error("获取账户安全事件失败: %v", err)
+		c.Data["json"] = utils.ErrorResponse("获取账户安全事件失败")
+		c.ServeJSON()
+		return
+	}
+
+	c.Data["json"] = utils.SuccessResponse(map[string]interface{}{
+		"events":    events,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+	c.ServeJSON()
+}
@@ -11,6 +11,8 @@ require (
 
 require github.com/google/uuid v1.6.0
 
+require github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1
+
 require (
 	github.com/beorn7/perks v1.0.1 // indirect
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"os"
+
 	"sea_trace_server_V2.0/models"
-	_ "sea_trace_server_V2.0/routers"
+	"sea_trace_server_V2.0/routers"
+	"sea_trace_server_V2.0/services"
 
 	"github.com/beego/beego/v2/client/orm"
 	"github.com/beego/beego/v2/core/logs"
@@ -29,17 +32,47 @@ func init() {
 	orm.RegisterModel(new(models.GoodsTransport))
 	orm.RegisterModel(new(models.GoodsInspection))
 	orm.RegisterModel(new(models.GoodsDelivery))
+	orm.RegisterModel(new(models.GoodsDisposition))
+	// 注册上链发件箱和交易账本模型
+	orm.RegisterModel(new(models.ChainOutbox))
+	orm.RegisterModel(new(models.Transaction))
+	orm.RegisterModel(new(models.ChainDiscrepancy))
+	// 注册合约事件索引和系统配置模型
+	orm.RegisterModel(new(models.ChainEvent))
+	orm.RegisterModel(new(models.SystemConfig))
+	// 注册本地密钥库模型
+	orm.RegisterModel(new(models.ChainKey))
+	// 注册刷新令牌模型
+	orm.RegisterModel(new(models.RefreshToken))
+	// 注册账户安全事件模型
+	orm.RegisterModel(new(models.UserSecurityEvent))
+	// 注册角色与权限模型
+	orm.RegisterModel(new(models.Role), new(models.UserRole))
+	// 注册审计日志模型
+	orm.RegisterModel(new(models.AuditLog))
+	// 注册公开溯源可见性设置模型
+	orm.RegisterModel(new(models.CompanyTraceVisibility))
 
 	logs.Info("已注册所有数据模型 [time=%s]", "2025-05-15 04:23:31")
 
 	// 自动创建表（开发模式）
 	orm.RunSyncdb("default", false, true)
 
+	// 同步系统角色的权限定义
+	if err := models.EnsureSystemRoles(); err != nil {
+		logs.Error("同步系统角色失败: %v", err)
+	}
+
 	// 日志配置
 	logs.SetLogger(logs.AdapterFile, `{"filename":"logs/app.log","level":7,"maxlines":0,"maxsize":0,"daily":true,"maxdays":10}`)
 }
 
 func main() {
+	// 命令行子命令，执行完毕后退出
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
 	// 开启 session
 	web.BConfig.WebConfig.Session.SessionOn = true
 
@@ -50,6 +83,21 @@ func main() {
 	logs.SetLevel(logs.LevelDebug)
 	logs.Info("启动应用服务...")
 
+	// 启动上链发件箱调度器
+	services.NewOutboxDispatcher().Start()
+	// 启动交易回执确认跟踪器
+	services.NewConfirmationTracker().Start()
+	// 启动链上数据定时核对
+	services.NewReconcileService().Start()
+	// 启动合约事件索引器
+	services.NewEventIndexer().Start()
+	// 本地密钥库托管时在独立的本机端口提供WeBASE-Sign兼容的签名接口
+	if services.KeyCustody() == services.KeyCustodyKeystore {
+		routers.StartKeystoreSignServer()
+	}
+	// 尚未创建超级管理员时输出一次性初始化令牌
+	services.DefaultBootstrapService().AnnounceSetupToken()
+
 	// 运行应用
 	web.Run()
 }
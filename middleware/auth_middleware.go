@@ -3,9 +3,9 @@ package middleware
 import (
 	"strings"
 
+	"sea_trace_server_V2.0/services"
 	"sea_trace_server_V2.0/utils"
 
-	"github.com/beego/beego/v2/core/logs"
 	"github.com/beego/beego/v2/server/web/context"
 )
 
@@ -34,46 +34,40 @@ func JWTAuth(ctx *context.Context) {
 		return
 	}
 
-	// 将token信息存储到上下文
-	ctx.Input.SetData("user_id", claims.UserID)
-	ctx.Input.SetData("username", claims.Username)
-	ctx.Input.SetData("role", claims.Role)
-	ctx.Input.SetData("company_id", claims.CompanyId)
-	logs.Info("token解析comid", claims.CompanyId)
-}
-
-// SuperAdminAuth 超级管理员权限中间件
-func SuperAdminAuth(ctx *context.Context) {
-	role := ctx.Input.GetData("role")
-
-	if role != "super_admin" {
-		ctx.Output.JSON(utils.ForbiddenResponse(), false, false)
-		ctx.ResponseWriter.WriteHeader(403)
-		ctx.Abort(403, "权限不足")
+	// 已退出登录、被禁用或删除的用户，其令牌即使签名有效也不再接受
+	user, err := services.NewTokenService().Authenticate(claims)
+	if err != nil {
+		ctx.Output.JSON(utils.UnauthorizedResponse(), false, false)
+		ctx.ResponseWriter.WriteHeader(401)
+		ctx.Abort(401, "token已失效")
 		return
 	}
-}
-
-// CompanyAdminAuth 公司管理员权限中间件
-func CompanyAdminAuth(ctx *context.Context) {
-	role := ctx.Input.GetData("role")
 
-	if role != "company_admin" && role != "super_admin" {
-		ctx.Output.JSON(utils.ForbiddenResponse(), false, false)
+	// 尚未修改初始密码的用户只能访问修改密码相关接口
+	if user.MustChangePassword && !PasswordChangeAllowed(ctx.Input.URL()) {
+		ctx.Output.JSON(&utils.Response{Code: 403, Message: "请先修改初始密码"}, false, false)
 		ctx.ResponseWriter.WriteHeader(403)
-		ctx.Abort(403, "权限不足")
+		ctx.Abort(403, "请先修改初始密码")
 		return
 	}
+
+	// 将token信息存储到上下文
+	ctx.Input.SetData("user_id", claims.UserID)
+	ctx.Input.SetData("username", claims.Username)
+	ctx.Input.SetData("role", user.Role)
+	ctx.Input.SetData("company_id", user.CompanyId)
+	ctx.Input.SetData("session_id", claims.SessionID)
+	ctx.Input.SetData("auth_user", user)
 }
 
-// CompanyOperatorAuth 公司操作员权限中间件
-func CompanyOperatorAuth(ctx *context.Context) {
-	role := ctx.Input.GetData("role")
+// passwordChangePaths 尚未修改初始密码时允许访问的接口
+var passwordChangePaths = map[string]bool{
+	"/api/auth/password": true,
+	"/api/auth/myinfo":   true,
+	"/api/auth/logout":   true,
+}
 
-	if role != "operator" && role != "company_admin" && role != "super_admin" {
-		ctx.Output.JSON(utils.ForbiddenResponse(), false, false)
-		ctx.ResponseWriter.WriteHeader(403)
-		ctx.Abort(403, "权限不足")
-		return
-	}
+// PasswordChangeAllowed 尚未修改初始密码时是否允许访问该接口
+func PasswordChangeAllowed(path string) bool {
+	return passwordChangePaths[strings.TrimSuffix(path, "/")]
 }
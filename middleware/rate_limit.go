@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"sea_trace_server_V2.0/services"
+	"sea_trace_server_V2.0/utils"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web/context"
+)
+
+// PublicRateLimit 无需认证的溯源接口按来源地址限流，超出时返回429，Retry-After 为需等待的秒数
+// 来源地址只在请求来自可信代理时才取自 X-Forwarded-For，避免客户端轮换该请求头绕过限流
+func PublicRateLimit(ctx *context.Context) {
+	ip := utils.ClientIP(ctx.Request)
+	allowed, wait := services.DefaultPublicRateLimiter().Allow(ip)
+	if allowed {
+		return
+	}
+
+	seconds := int(math.Max(1, math.Ceil(wait.Seconds())))
+	logs.Debug("公开接口请求被限流 [ip=%s, url=%s, retryAfter=%d]", ip, ctx.Input.URL(), seconds)
+	ctx.Output.Header("Retry-After", strconv.Itoa(seconds))
+	ctx.Output.SetStatus(429)
+	ctx.Output.JSON(&utils.Response{Code: 429, Message: fmt.Sprintf("请求过于频繁，请%d秒后重试", seconds)}, false, false)
+}
@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"strings"
+
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/utils"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web/context"
+)
+
+// RoutePolicy 接口访问策略：访问该接口需要的权限
+// Path 中以冒号开头的段匹配任意值，Method 为空匹配任意请求方法
+type RoutePolicy struct {
+	Method     string
+	Path       string
+	Permission string
+}
+
+// RoutePolicies 接口访问策略，按顺序匹配第一条
+var RoutePolicies = []RoutePolicy{
+	// 超级管理员：公司管理
+	{"", "/api/su/company/list", models.PermCompanyManage},
+	{"", "/api/su/company/create", models.PermCompanyManage},
+	{"", "/api/su/company/update/:id", models.PermCompanyManage},
+	{"", "/api/su/company/delete/:id", models.PermCompanyManage},
+	{"", "/api/su/company/admin/create", models.PermCompanyManage},
+	{"GET", "/api/su/audit-logs", models.PermAuditViewAll},
+
+	// 公司信息
+	{"GET", "/api/admin/company/info", models.PermCompanyView},
+	{"PUT", "/api/admin/company/info", models.PermCompanyEdit},
+	{"GET", "/api/admin/company/trace-visibility", models.PermCompanyView},
+	{"PUT", "/api/admin/company/trace-visibility", models.PermCompanyEdit},
+
+	// 操作员管理
+	{"GET", "/api/admin/company/operators", models.PermOperatorView},
+	{"", "/api/admin/company/operator/create", models.PermOperatorManage},
+	{"", "/api/admin/company/operator/delete/:id", models.PermOperatorManage},
+	{"", "/api/admin/company/operator/status/:id", models.PermOperatorManage},
+	{"", "/api/admin/company/operator/info/:id", models.PermOperatorManage},
+
+	// 角色管理
+	{"", "/api/admin/roles", models.PermRoleManage},
+	{"", "/api/admin/roles/permissions", models.PermRoleManage},
+	{"", "/api/admin/roles/:id", models.PermRoleManage},
+	{"", "/api/admin/user/roles/:id", models.PermRoleManage},
+
+	// 用户管理
+	{"GET", "/api/admin/user/list", models.PermUserView},
+	{"", "/api/admin/user/create", models.PermUserManage},
+	{"", "/api/admin/user/update/:id", models.PermUserManage},
+	{"", "/api/admin/user/delete/:id", models.PermUserManage},
+	{"", "/api/admin/user/unlock/:id", models.PermUserUnlock},
+	{"GET", "/api/admin/user/security-events/:id", models.PermUserView},
+
+	// 审计日志
+	{"GET", "/api/admin/audit-logs", models.PermAuditView},
+
+	// 统计、交易账本与链上数据核对
+	{"GET", "/api/admin/stats", models.PermStatsView},
+	{"GET", "/api/admin/activities", models.PermStatsView},
+	{"GET", "/api/admin/transactions", models.PermTransactionView},
+	{"GET", "/api/admin/transactions/:hash", models.PermTransactionView},
+	{"", "/api/admin/reconcile/discrepancies", models.PermReconcileManage},
+	{"", "/api/admin/reconcile/run", models.PermReconcileManage},
+	{"", "/api/admin/reconcile/redrive/:id", models.PermReconcileManage},
+
+	// 货物操作
+	{"", "/api/operator/goods/register", models.PermGoodsRegister},
+	{"", "/api/operator/goods/ship", models.PermGoodsShip},
+	{"", "/api/operator/goods/inspect", models.PermGoodsInspect},
+	{"", "/api/operator/goods/dispose", models.PermGoodsDispose},
+	{"", "/api/operator/goods/deliver", models.PermGoodsDeliver},
+	{"GET", "/api/operator/goods/list", models.PermGoodsView},
+	{"GET", "/api/operator/goods/trace", models.PermGoodsView},
+	{"GET", "/api/operator/goods/transitions", models.PermGoodsView},
+	{"GET", "/api/operator/goods/verify", models.PermGoodsView},
+	{"", "/api/operator/goods/bulk/register", models.PermGoodsRegister},
+	{"", "/api/operator/goods/bulk/ship", models.PermGoodsShip},
+	{"", "/api/operator/goods/bulk/inspect", models.PermGoodsInspect},
+	{"", "/api/operator/goods/bulk/deliver", models.PermGoodsDeliver},
+	{"GET", "/api/operator/goods/qrcode", models.PermGoodsView},
+	{"GET", "/api/operator/goods/labels", models.PermGoodsView},
+}
+
+// protectedPrefixes 需要访问策略的接口前缀，未配置策略的接口一律拒绝访问
+var protectedPrefixes = []string{"/api/su/", "/api/admin/", "/api/operator/"}
+
+// MatchRoutePolicy 查找接口对应的访问策略
+func MatchRoutePolicy(method, path string) (RoutePolicy, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, policy := range RoutePolicies {
+		if policy.Method != "" && policy.Method != method {
+			continue
+		}
+		if matchPath(strings.Split(strings.Trim(policy.Path, "/"), "/"), segments) {
+			return policy, true
+		}
+	}
+	return RoutePolicy{}, false
+}
+
+// matchPath 按段匹配路径
+func matchPath(pattern, segments []string) bool {
+	if len(pattern) != len(segments) {
+		return false
+	}
+	for i, p := range pattern {
+		if !strings.HasPrefix(p, ":") && p != segments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// IsProtectedPath 接口是否必须配置访问策略
+func IsProtectedPath(path string) bool {
+	for _, prefix := range protectedPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize 按接口访问策略校验当前用户的权限，需在 JWTAuth 之后执行
+// 校验通过后将用户权限保存到上下文 permissions 中
+func Authorize(ctx *context.Context) {
+	if ctx.Input.Method() == "OPTIONS" {
+		return
+	}
+	path := ctx.Input.URL()
+	policy, ok := MatchRoutePolicy(ctx.Input.Method(), path)
+	if !ok {
+		if IsProtectedPath(path) {
+			logs.Warning("接口未配置访问策略 [method=%s, path=%s]", ctx.Input.Method(), path)
+			forbidden(ctx)
+		}
+		return
+	}
+
+	user, _ := ctx.Input.GetData("auth_user").(*models.User)
+	if user == nil {
+		ctx.Output.JSON(utils.UnauthorizedResponse(), false, false)
+		ctx.ResponseWriter.WriteHeader(401)
+		ctx.Abort(401, "未授权")
+		return
+	}
+
+	permissions, err := models.GetUserPermissions(user)
+	if err != nil {
+		logs.Error("获取用户权限失败 [username=%s]: %v", user.Username, err)
+		forbidden(ctx)
+		return
+	}
+	if !permissions.Has(policy.Permission) {
+		logs.Warning("权限不足 [username=%s, permission=%s, path=%s]", user.Username, policy.Permission, path)
+		forbidden(ctx)
+		return
+	}
+	ctx.Input.SetData("permissions", permissions)
+}
+
+// forbidden 返回权限不足
+func forbidden(ctx *context.Context) {
+	ctx.Output.JSON(utils.ForbiddenResponse(), false, false)
+	ctx.ResponseWriter.WriteHeader(403)
+	ctx.Abort(403, "权限不足")
+}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/beego/beego/v2/server/web/context"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader 请求ID请求头，客户端或网关已设置时沿用，否则由服务端生成
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDPattern 可沿用的请求ID格式
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID 为每个请求分配请求ID，保存到上下文的 request_id 并写入响应头，用于关联日志和审计记录
+func RequestID(ctx *context.Context) {
+	requestID := ctx.Input.Header(RequestIDHeader)
+	if !requestIDPattern.MatchString(requestID) {
+		requestID = uuid.New().String()
+	}
+	ctx.Input.SetData("request_id", requestID)
+	ctx.Output.Header(RequestIDHeader, requestID)
+}
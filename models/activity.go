@@ -0,0 +1,243 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+)
+
+// 动态类型
+const (
+	ActivityProduction  = "production"  // 登记生产
+	ActivityTransport   = "transport"   // 运输
+	ActivityInspection  = "inspection"  // 验货
+	ActivityDisposition = "disposition" // 处置
+	ActivityDelivery    = "delivery"    // 交付
+	ActivityCompany     = "company"     // 公司管理，来自审计日志
+	ActivityUser        = "user"        // 用户管理，来自审计日志
+)
+
+// ActivityTypeMap 动态类型名称
+var ActivityTypeMap = map[string]string{
+	ActivityProduction:  "注册",
+	ActivityTransport:   "运输",
+	ActivityInspection:  "验货",
+	ActivityDisposition: "处置",
+	ActivityDelivery:    "收货",
+	ActivityCompany:     "公司",
+	ActivityUser:        "用户",
+}
+
+// activityTypes 动态类型的固定顺序
+var activityTypes = []string{
+	ActivityProduction, ActivityTransport, ActivityInspection, ActivityDisposition,
+	ActivityDelivery, ActivityCompany, ActivityUser,
+}
+
+// activitySources 各类型动态的查询语句，列依次为类型、时间、货物ID、公司ID、公司名称、操作人和两列描述信息
+// 语句中唯一的参数为公司ID筛选条件，由 QueryActivities 按需追加
+var activitySources = map[string]struct {
+	sql           string
+	companyColumn string
+}{
+	ActivityProduction: {
+		"SELECT 'production' AS kind, p.created_at AS occurred_at, p.good_id, g.owner_company_id AS company_id, " +
+			"COALESCE(c.company_name, '') AS company_name, COALESCE(p.operator_name, '') AS operator, " +
+			"COALESCE(g.good_name, '') AS info1, p.location AS info2 " +
+			"FROM goods_production p LEFT JOIN goods g ON g.good_id = p.good_id LEFT JOIN companies c ON c.id = g.owner_company_id",
+		"g.owner_company_id",
+	},
+	ActivityTransport: {
+		"SELECT 'transport' AS kind, t.created_at AS occurred_at, t.good_id, t.transporter_id AS company_id, " +
+			"COALESCE(t.transporter_name, '') AS company_name, COALESCE(t.operator_name, '') AS operator, " +
+			"t.start_location AS info1, t.end_location AS info2 FROM goods_transport t",
+		"t.transporter_id",
+	},
+	ActivityInspection: {
+		"SELECT 'inspection' AS kind, i.created_at AS occurred_at, i.good_id, i.inspector_id AS company_id, " +
+			"COALESCE(i.inspector_name, '') AS company_name, COALESCE(i.operator_name, '') AS operator, " +
+			"i.location AS info1, CASE WHEN i.pass_status THEN '' ELSE COALESCE(NULLIF(i.reject_reason, ''), '未注明原因') END AS info2 " +
+			"FROM goods_inspection i",
+		"i.inspector_id",
+	},
+	ActivityDisposition: {
+		"SELECT 'disposition' AS kind, d.created_at AS occurred_at, d.good_id, d.company_id, " +
+			"COALESCE(d.company_name, '') AS company_name, COALESCE(d.operator_name, '') AS operator, " +
+			"CAST(d.to_status AS CHAR) AS info1, d.reason AS info2 FROM goods_disposition d",
+		"d.company_id",
+	},
+	ActivityDelivery: {
+		"SELECT 'delivery' AS kind, v.created_at AS occurred_at, v.good_id, v.dealer_id AS company_id, " +
+			"COALESCE(v.dealer_name, '') AS company_name, COALESCE(v.operator_name, '') AS operator, " +
+			"v.location AS info1, '' AS info2 FROM goods_delivery v",
+		"v.dealer_id",
+	},
+	ActivityCompany: {
+		"SELECT 'company' AS kind, a.created_at AS occurred_at, '' AS good_id, a.company_id, " +
+			"COALESCE(c.company_name, '') AS company_name, a.actor_name AS operator, a.action AS info1, a.target_id AS info2 " +
+			"FROM audit_log a LEFT JOIN companies c ON c.id = a.company_id WHERE a.target_type = 'company'",
+		"a.company_id",
+	},
+	ActivityUser: {
+		"SELECT 'user' AS kind, a.created_at AS occurred_at, '' AS good_id, a.company_id, " +
+			"COALESCE(c.company_name, '') AS company_name, a.actor_name AS operator, a.action AS info1, a.target_id AS info2 " +
+			"FROM audit_log a LEFT JOIN companies c ON c.id = a.company_id WHERE a.target_type = 'user'",
+		"a.company_id",
+	},
+}
+
+// activityActionNames 审计操作在动态中的名称
+var activityActionNames = map[string]string{
+	AuditCompanyCreate:      "创建公司",
+	AuditCompanyUpdate:      "修改公司信息",
+	AuditCompanyDelete:      "删除公司",
+	AuditCompanyVisibility:  "修改公开溯源设置",
+	AuditCompanyAdminCreate: "创建公司管理员",
+	AuditCompanyAdminDelete: "删除公司管理员",
+	AuditOperatorCreate:     "创建操作员",
+	AuditOperatorUpdate:     "修改操作员信息",
+	AuditOperatorStatus:     "修改操作员状态",
+	AuditOperatorDelete:     "删除操作员",
+	AuditUserCreate:         "创建用户",
+	AuditUserUpdate:         "修改用户",
+	AuditUserDelete:         "删除用户",
+	AuditUserUnlock:         "解除账户锁定",
+	AuditUserRoles:          "分配角色",
+	AuditUserPassword:       "修改密码",
+}
+
+// Activity 仪表盘动态
+type Activity struct {
+	Time        string `json:"time"`
+	Type        string `json:"type"`      // 类型名称
+	TypeCode    string `json:"type_code"` // 类型，见 Activity* 常量
+	GoodID      string `json:"good_id"`
+	CompanyID   int    `json:"company_id"`
+	CompanyName string `json:"company_name"`
+	Description string `json:"description"`
+	Operator    string `json:"operator"`
+}
+
+// ActivityRecord 动态查询结果的一行
+type ActivityRecord struct {
+	Kind        string
+	OccurredAt  time.Time
+	GoodId      string
+	CompanyId   int
+	CompanyName string
+	Operator    string
+	Info1       string
+	Info2       string
+}
+
+// ToActivity 生成动态描述
+func (r *ActivityRecord) ToActivity() Activity {
+	var description string
+	switch r.Kind {
+	case ActivityProduction:
+		description = fmt.Sprintf("%s登记生产%s，产地%s", r.CompanyName, r.Info1, r.Info2)
+	case ActivityTransport:
+		description = fmt.Sprintf("%s运输：%s → %s", r.CompanyName, r.Info1, r.Info2)
+	case ActivityInspection:
+		if r.Info2 == "" {
+			description = fmt.Sprintf("%s在%s验货合格", r.CompanyName, r.Info1)
+		} else {
+			description = fmt.Sprintf("%s在%s验货不合格：%s", r.CompanyName, r.Info1, r.Info2)
+		}
+	case ActivityDisposition:
+		var status GoodsStatus
+		fmt.Sscan(r.Info1, &status)
+		description = fmt.Sprintf("%s处置为%s：%s", r.CompanyName, GoodsStatusMap[status], r.Info2)
+	case ActivityDelivery:
+		description = fmt.Sprintf("%s在%s交付", r.CompanyName, r.Info1)
+	default:
+		action := activityActionNames[r.Info1]
+		if action == "" {
+			action = r.Info1
+		}
+		description = fmt.Sprintf("%s #%s", action, r.Info2)
+		if r.CompanyName != "" {
+			description = r.CompanyName + " " + description
+		}
+	}
+
+	return Activity{
+		Time:        r.OccurredAt.Format("2006-01-02 15:04:05"),
+		Type:        ActivityTypeMap[r.Kind],
+		TypeCode:    r.Kind,
+		GoodID:      r.GoodId,
+		CompanyID:   r.CompanyId,
+		CompanyName: r.CompanyName,
+		Description: description,
+		Operator:    r.Operator,
+	}
+}
+
+// ActivityFilter 动态查询条件
+type ActivityFilter struct {
+	Types     []string // 为空表示全部类型
+	CompanyID int      // 公司经手的动态，0表示不限制
+}
+
+// IsActivityType 是否为有效的动态类型
+func IsActivityType(kind string) bool {
+	_, ok := activitySources[kind]
+	return ok
+}
+
+// activityQuery 合并各类型动态的查询语句和参数
+func activityQuery(filter ActivityFilter) (string, []interface{}) {
+	types := filter.Types
+	if len(types) == 0 {
+		types = activityTypes
+	}
+
+	parts := make([]string, 0, len(types))
+	var args []interface{}
+	for _, kind := range types {
+		source, ok := activitySources[kind]
+		if !ok {
+			continue
+		}
+		sql := source.sql
+		if filter.CompanyID > 0 {
+			if strings.Contains(sql, " WHERE ") {
+				sql += " AND " + source.companyColumn + " = ?"
+			} else {
+				sql += " WHERE " + source.companyColumn + " = ?"
+			}
+			args = append(args, filter.CompanyID)
+		}
+		parts = append(parts, "("+sql+")")
+	}
+	return strings.Join(parts, " UNION ALL "), args
+}
+
+// QueryActivities 按时间倒序分页查询动态
+func QueryActivities(filter ActivityFilter, page, pageSize int) ([]Activity, int64, error) {
+	union, args := activityQuery(filter)
+	if union == "" {
+		return []Activity{}, 0, nil
+	}
+	o := orm.NewOrm()
+
+	var total int64
+	if err := o.Raw("SELECT COUNT(*) FROM ("+union+") feed", args...).QueryRow(&total); err != nil {
+		return nil, 0, err
+	}
+
+	var records []ActivityRecord
+	pageArgs := append(append([]interface{}{}, args...), pageSize, (page-1)*pageSize)
+	if _, err := o.Raw("SELECT * FROM ("+union+") feed ORDER BY occurred_at DESC LIMIT ? OFFSET ?", pageArgs...).
+		QueryRows(&records); err != nil {
+		return nil, 0, err
+	}
+
+	activities := make([]Activity, 0, len(records))
+	for i := range records {
+		activities = append(activities, records[i].ToActivity())
+	}
+	return activities, total, nil
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// 审计对象类型
+const (
+	AuditTargetCompany = "company"
+	AuditTargetUser    = "user"
+	AuditTargetRole    = "role"
+	AuditTargetGoods   = "goods"
+)
+
+// 审计操作，货物环节操作使用 "goods." 加生命周期中的操作名，如 goods.ship
+const (
+	AuditCompanyCreate      = "company.create"
+	AuditCompanyUpdate      = "company.update"
+	AuditCompanyDelete      = "company.delete"
+	AuditCompanyVisibility  = "company.trace_visibility"
+	AuditCompanyAdminCreate = "company_admin.create"
+	AuditCompanyAdminDelete = "company_admin.delete"
+	AuditOperatorCreate     = "operator.create"
+	AuditOperatorUpdate     = "operator.update"
+	AuditOperatorStatus     = "operator.status"
+	AuditOperatorDelete     = "operator.delete"
+	AuditUserCreate         = "user.create"
+	AuditUserUpdate         = "user.update"
+	AuditUserDelete         = "user.delete"
+	AuditUserUnlock         = "user.unlock"
+	AuditUserRoles          = "user.roles"
+	AuditUserPassword       = "user.password"
+	AuditRoleCreate         = "role.create"
+	AuditRoleUpdate         = "role.update"
+	AuditRoleDelete         = "role.delete"
+)
+
+// auditIgnoredFields 不计入变更内容的字段
+var auditIgnoredFields = map[string]bool{
+	"updated_at": true,
+}
+
+// AuditLog 审计日志，只追加不修改
+type AuditLog struct {
+	Id         int       `orm:"pk;auto" json:"id"`
+	ActorId    int       `orm:"index;default(0)" json:"actor_id"` // 执行操作的用户
+	ActorName  string    `orm:"size(50)" json:"actor_name"`
+	ActorRole  string    `orm:"size(20)" json:"actor_role"`
+	CompanyId  int       `orm:"index;default(0)" json:"company_id"` // 操作对象所属公司，用于公司范围查询，不属于任何公司时为0
+	Action     string    `orm:"size(50);index" json:"action"`
+	TargetType string    `orm:"size(20)" json:"target_type"`
+	TargetId   string    `orm:"size(64);index" json:"target_id"`
+	Changes    string    `orm:"type(text);null" json:"changes"` // 变更内容，JSON对象：字段 -> {before, after}
+	Ip         string    `orm:"size(64);null" json:"ip"`
+	RequestId  string    `orm:"size(64);index;null" json:"request_id"`
+	CreatedAt  time.Time `orm:"auto_now_add;type(datetime);index" json:"created_at"`
+}
+
+// TableName 表名
+func (a *AuditLog) TableName() string {
+	return "audit_log"
+}
+
+// AuditChange 单个字段的变更
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditDiff 按JSON字段比较操作前后的对象，返回有变化的字段
+// before 为 nil 表示新建，after 为 nil 表示删除；不是JSON对象的值按 "value" 字段比较
+func AuditDiff(before, after interface{}) map[string]AuditChange {
+	b, a := auditFields(before), auditFields(after)
+	changes := make(map[string]AuditChange)
+	for key, value := range b {
+		if auditIgnoredFields[key] {
+			continue
+		}
+		if !auditEqual(value, a[key]) {
+			changes[key] = AuditChange{Before: value, After: a[key]}
+		}
+	}
+	for key, value := range a {
+		if _, ok := b[key]; ok || auditIgnoredFields[key] {
+			continue
+		}
+		changes[key] = AuditChange{After: value}
+	}
+	return changes
+}
+
+// auditFields 将对象转换为按JSON字段名索引的值
+func auditFields(v interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if v == nil {
+		return fields
+	}
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return fields
+	}
+	if json.Unmarshal(data, &fields) != nil {
+		var value interface{}
+		json.Unmarshal(data, &value)
+		fields = map[string]interface{}{"value": value}
+	}
+	return fields
+}
+
+// auditEqual 比较两个JSON值是否相同
+func auditEqual(x, y interface{}) bool {
+	a, _ := json.Marshal(x)
+	b, _ := json.Marshal(y)
+	return string(a) == string(b)
+}
+
+// AddAuditLog 追加审计日志，before/after 为操作前后的对象
+func AddAuditLog(entry *AuditLog, before, after interface{}) error {
+	if changes := AuditDiff(before, after); len(changes) > 0 {
+		data, err := json.Marshal(changes)
+		if err != nil {
+			return err
+		}
+		entry.Changes = string(data)
+	}
+	o := GetOrm()
+	_, err := o.Insert(entry)
+	return err
+}
+
+// AuditLogFilter 审计日志查询条件，零值表示不限制
+type AuditLogFilter struct {
+	ActorID    int
+	CompanyID  int
+	Action     string // 以 "." 结尾时按前缀匹配，如 "goods."
+	TargetType string
+	TargetID   string
+	RequestID  string
+	StartTime  time.Time
+	EndTime    time.Time
+}
+
+// QueryAuditLogs 按条件查询审计日志，按时间倒序
+func QueryAuditLogs(filter AuditLogFilter, page, pageSize int) ([]*AuditLog, int64, error) {
+	o := GetOrm()
+	query := o.QueryTable(new(AuditLog))
+
+	if filter.ActorID > 0 {
+		query = query.Filter("actor_id", filter.ActorID)
+	}
+	if filter.CompanyID > 0 {
+		query = query.Filter("company_id", filter.CompanyID)
+	}
+	if n := len(filter.Action); n > 0 && filter.Action[n-1] == '.' {
+		query = query.Filter("action__startswith", filter.Action)
+	} else if n > 0 {
+		query = query.Filter("action", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Filter("target_type", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Filter("target_id", filter.TargetID)
+	}
+	if filter.RequestID != "" {
+		query = query.Filter("request_id", filter.RequestID)
+	}
+	if !filter.StartTime.IsZero() {
+		query = query.Filter("created_at__gte", filter.StartTime)
+	}
+	if !filter.EndTime.IsZero() {
+		query = query.Filter("created_at__lt", filter.EndTime)
+	}
+
+	total, err := query.Count()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var entries []*AuditLog
+	_, err = query.OrderBy("-id").Limit(pageSize, (page-1)*pageSize).All(&entries)
+	return entries, total, err
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/core/logs"
+)
+
+// 差异类型
+const (
+	DiscrepancyMissingOnChain = "missing_on_chain" // 数据库有记录，链上没有
+	DiscrepancyMissingInDB    = "missing_in_db"    // 链上有记录，数据库没有
+	DiscrepancyMismatch       = "mismatch"         // 双方都有记录但字段不一致
+)
+
+// 差异处理状态
+const (
+	DiscrepancyStatusOpen     = "open"     // 待处理
+	DiscrepancyStatusRedriven = "redriven" // 已重新提交上链
+	DiscrepancyStatusResolved = "resolved" // 已消除
+)
+
+// ChainDiscrepancy 链上与数据库数据差异记录
+type ChainDiscrepancy struct {
+	Id         int       `orm:"pk;auto" json:"id"`
+	GoodId     string    `orm:"size(64);index" json:"good_id"`
+	Stage      string    `orm:"size(20)" json:"stage"`
+	Field      string    `orm:"size(30)" json:"field"` // exists/company_id/info/timestamp，运输段带序号前缀，如 leg1.info
+	Kind       string    `orm:"size(20)" json:"kind"`
+	DbValue    string    `orm:"type(text);null" json:"db_value"`
+	ChainValue string    `orm:"type(text);null" json:"chain_value"`
+	Status     string    `orm:"size(20);index" json:"status"`
+	Note       string    `orm:"size(255);null" json:"note"`
+	DetectedAt time.Time `orm:"auto_now_add" json:"detected_at"`
+	LastSeenAt time.Time `orm:"null" json:"last_seen_at"`
+	ResolvedAt time.Time `orm:"null" json:"resolved_at"`
+}
+
+// TableName 指定表名
+func (d *ChainDiscrepancy) TableName() string {
+	return "chain_discrepancies"
+}
+
+// Key 差异的唯一标识，同一货物同一环节同一字段只保留一条未关闭的记录
+func (d *ChainDiscrepancy) Key() string {
+	return d.GoodId + "|" + d.Stage + "|" + d.Field
+}
+
+// SyncGoodDiscrepancies 保存一次核对的结果
+// 新发现的差异写入，仍存在的差异更新取值，本次未再出现的差异标记为已消除
+func SyncGoodDiscrepancies(goodID string, found []*ChainDiscrepancy) error {
+	o := GetOrm()
+	now := time.Now()
+
+	var existing []*ChainDiscrepancy
+	_, err := o.QueryTable(new(ChainDiscrepancy)).
+		Filter("good_id", goodID).
+		Exclude("status", DiscrepancyStatusResolved).
+		All(&existing)
+	if err != nil {
+		logs.Error("获取货物差异记录失败 [goodID=%s, error=%v]", goodID, err)
+		return err
+	}
+
+	existingByKey := make(map[string]*ChainDiscrepancy, len(existing))
+	for _, d := range existing {
+		existingByKey[d.Key()] = d
+	}
+
+	for _, d := range found {
+		if old, ok := existingByKey[d.Key()]; ok {
+			old.Kind = d.Kind
+			old.DbValue = d.DbValue
+			old.ChainValue = d.ChainValue
+			old.LastSeenAt = now
+			if _, err := o.Update(old, "Kind", "DbValue", "ChainValue", "LastSeenAt"); err != nil {
+				logs.Error("更新差异记录失败 [id=%d, error=%v]", old.Id, err)
+			}
+			delete(existingByKey, d.Key())
+			continue
+		}
+
+		d.GoodId = goodID
+		d.Status = DiscrepancyStatusOpen
+		d.LastSeenAt = now
+		if _, err := o.Insert(d); err != nil {
+			logs.Error("保存差异记录失败 [goodID=%s, stage=%s, field=%s, error=%v]",
+				goodID, d.Stage, d.Field, err)
+		}
+	}
+
+	for _, d := range existingByKey {
+		d.Status = DiscrepancyStatusResolved
+		d.ResolvedAt = now
+		d.Note = "核对时未再发现该差异"
+		if _, err := o.Update(d, "Status", "ResolvedAt", "Note"); err != nil {
+			logs.Error("关闭差异记录失败 [id=%d, error=%v]", d.Id, err)
+		}
+	}
+	return nil
+}
+
+// GetChainDiscrepancyList 分页查询差异记录，status 为空时返回全部
+func GetChainDiscrepancyList(page, pageSize int, status string, goodID string) ([]*ChainDiscrepancy, int64, error) {
+	o := GetOrm()
+	query := o.QueryTable(new(ChainDiscrepancy))
+	if status != "" {
+		query = query.Filter("status", status)
+	}
+	if goodID != "" {
+		query = query.Filter("good_id", goodID)
+	}
+
+	total, err := query.Count()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var list []*ChainDiscrepancy
+	_, err = query.OrderBy("-id").Limit(pageSize, (page-1)*pageSize).All(&list)
+	return list, total, err
+}
+
+// GetChainDiscrepancyByID 根据ID获取差异记录
+func GetChainDiscrepancyByID(id int) (*ChainDiscrepancy, error) {
+	o := GetOrm()
+	d := &ChainDiscrepancy{Id: id}
+	err := o.Read(d)
+	return d, err
+}
+
+// MarkDiscrepancyRedriven 将货物某环节的未关闭差异标记为已重新提交，fieldPrefix 用于限定运输段，如 leg1.
+func MarkDiscrepancyRedriven(goodID string, stage string, fieldPrefix string, note string) error {
+	o := GetOrm()
+	query := o.QueryTable(new(ChainDiscrepancy)).
+		Filter("good_id", goodID).
+		Filter("stage", stage).
+		Filter("status", DiscrepancyStatusOpen)
+	if fieldPrefix != "" {
+		query = query.Filter("field__startswith", fieldPrefix)
+	}
+	_, err := query.Update(orm.Params{
+		"status": DiscrepancyStatusRedriven,
+		"note":   note,
+	})
+	if err != nil {
+		logs.Error("更新差异记录状态失败 [goodID=%s, stage=%s, error=%v]", goodID, stage, err)
+	}
+	return err
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/core/logs"
+)
+
+// 合约事件名称
+const (
+	EventCompanyRegistered  = "CompanyRegistered"
+	EventGoodRegistered     = "GoodRegistered"
+	EventShipped            = "Shipped"
+	EventInspected          = "Inspected"
+	EventDelivered          = "Delivered"
+	EventDisposed           = "Disposed"
+	EventOperatorRegistered = "OperatorRegistered"
+	EventOperatorRemoved    = "OperatorRemoved"
+)
+
+// ChainEvent 已索引的合约事件
+type ChainEvent struct {
+	Id           int       `orm:"pk;auto" json:"id"`
+	BlockNumber  int64     `orm:"index" json:"block_number"`
+	TxHash       string    `orm:"size(66)" json:"tx_hash"`
+	LogIndex     int       `json:"log_index"`
+	EventName    string    `orm:"size(50);index" json:"event_name"`
+	GoodId       string    `orm:"size(64);null;index" json:"good_id"` // 由 indexed goodId 哈希反查得到，无法反查时为空
+	GoodIdHash   string    `orm:"size(66);null;index" json:"good_id_hash"`
+	LegIndex     int       `orm:"default(0)" json:"leg_index"` // 运输段序号，仅 Shipped 事件有效
+	CompanyId    int64     `orm:"default(0)" json:"company_id"`
+	OperatorAddr string    `orm:"size(42);null" json:"operator_addr"`
+	Info         string    `orm:"type(text);null" json:"info"`  // 货物名称、环节信息或公司名称
+	EventTime    int64     `orm:"default(0)" json:"event_time"` // 合约记录的 block.timestamp
+	Payload      string    `orm:"type(text)" json:"payload"`    // 解码后的全部参数JSON
+	CreatedAt    time.Time `orm:"auto_now_add" json:"created_at"`
+}
+
+// TableName 指定表名
+func (e *ChainEvent) TableName() string {
+	return "chain_events"
+}
+
+// TableUnique 同一交易的同一条日志只索引一次
+func (e *ChainEvent) TableUnique() [][]string {
+	return [][]string{{"TxHash", "LogIndex"}}
+}
+
+// SaveChainEvent 保存合约事件，重复索引时忽略
+func SaveChainEvent(event *ChainEvent) error {
+	o := GetOrm()
+	_, err := o.Insert(event)
+	if err != nil && strings.Contains(err.Error(), "Duplicate") {
+		return nil
+	}
+	if err != nil {
+		logs.Error("保存合约事件失败 [txHash=%s, logIndex=%d, event=%s, error=%v]",
+			event.TxHash, event.LogIndex, event.EventName, err)
+	}
+	return err
+}
+
+// GetChainEventsByGoodID 获取货物的全部事件，按链上顺序返回
+func GetChainEventsByGoodID(goodID string) ([]*ChainEvent, error) {
+	o := GetOrm()
+	var events []*ChainEvent
+	_, err := o.QueryTable(new(ChainEvent)).
+		Filter("good_id", goodID).
+		OrderBy("block_number", "log_index").
+		All(&events)
+	return events, err
+}
+
+// GetUnresolvedChainEvents 获取尚未反查出货物ID的事件
+func GetUnresolvedChainEvents(limit int) ([]*ChainEvent, error) {
+	o := GetOrm()
+	var events []*ChainEvent
+	_, err := o.QueryTable(new(ChainEvent)).
+		Filter("good_id_hash__isnull", false).
+		Filter("good_id", "").
+		OrderBy("id").
+		Limit(limit).
+		All(&events)
+	return events, err
+}
+
+// ResolveChainEventGoodID 回填事件的货物ID
+func ResolveChainEventGoodID(goodIDHash string, goodID string) error {
+	o := GetOrm()
+	_, err := o.QueryTable(new(ChainEvent)).
+		Filter("good_id_hash", goodIDHash).
+		Filter("good_id", "").
+		Update(orm.Params{"good_id": goodID})
+	return err
+}
+
+// CountChainEventsByName 按事件名称统计已索引的事件数量
+func CountChainEventsByName() map[string]int64 {
+	o := GetOrm()
+	counts := make(map[string]int64)
+	for _, name := range []string{EventCompanyRegistered, EventGoodRegistered, EventShipped, EventInspected, EventDelivered, EventDisposed, EventOperatorRegistered, EventOperatorRemoved} {
+		count, err := o.QueryTable(new(ChainEvent)).Filter("event_name", name).Count()
+		if err != nil {
+			logs.Error("统计合约事件失败 [event=%s, error=%v]", name, err)
+		}
+		counts[name] = count
+	}
+	return counts
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"context"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+)
+
+// ChainKey 本地密钥库中的区块链私钥
+// 私钥以主密钥AES-GCM加密保存，SignUserId 与用户和公司记录中的 sign_user_id 对应
+type ChainKey struct {
+	Id          int       `orm:"pk;auto" json:"id"`
+	SignUserId  string    `orm:"size(64);unique" json:"sign_user_id"`
+	Address     string    `orm:"size(42);unique" json:"address"`
+	PublicKey   string    `orm:"size(132)" json:"public_key"`
+	Ciphertext  string    `orm:"type(text)" json:"-"`           // nonce||密文 的十六进制
+	MasterKeyId string    `orm:"size(16)" json:"master_key_id"` // 加密所用主密钥的指纹，轮换后更新
+	CreatedAt   time.Time `orm:"auto_now_add" json:"created_at"`
+	UpdatedAt   time.Time `orm:"auto_now" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (k *ChainKey) TableName() string {
+	return "chain_keys"
+}
+
+// SaveChainKey 保存新的密钥记录
+func SaveChainKey(key *ChainKey) error {
+	o := orm.NewOrm()
+	id, err := o.Insert(key)
+	if err != nil {
+		return err
+	}
+	key.Id = int(id)
+	return nil
+}
+
+// GetChainKeyBySignUserID 根据签名用户编号获取密钥记录
+func GetChainKeyBySignUserID(signUserID string) (*ChainKey, error) {
+	o := orm.NewOrm()
+	key := &ChainKey{}
+	err := o.QueryTable(new(ChainKey)).Filter("sign_user_id", signUserID).One(key)
+	return key, err
+}
+
+// GetChainKeyByAddress 根据区块链地址获取密钥记录
+func GetChainKeyByAddress(address string) (*ChainKey, error) {
+	o := orm.NewOrm()
+	key := &ChainKey{}
+	err := o.QueryTable(new(ChainKey)).Filter("address__iexact", address).One(key)
+	return key, err
+}
+
+// RotateChainKeys 在一个事务中对全部密钥记录重新加密
+// reseal 返回新的密文；返回 false 表示该记录无需更新
+func RotateChainKeys(masterKeyID string, reseal func(key *ChainKey) (string, bool, error)) (int, error) {
+	o := orm.NewOrm()
+	var keys []*ChainKey
+	if _, err := o.QueryTable(new(ChainKey)).All(&keys); err != nil {
+		return 0, err
+	}
+
+	rotated := 0
+	err := o.DoTx(func(ctx context.Context, txOrm orm.TxOrmer) error {
+		for _, key := range keys {
+			ciphertext, changed, err := reseal(key)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				continue
+			}
+			key.Ciphertext = ciphertext
+			key.MasterKeyId = masterKeyID
+			if _, err := txOrm.Update(key, "Ciphertext", "MasterKeyId", "UpdatedAt"); err != nil {
+				return err
+			}
+			rotated++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return rotated, nil
+}
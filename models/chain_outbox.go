@@ -0,0 +1,289 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/core/logs"
+)
+
+// 发件箱状态
+const (
+	OutboxStatusPending  = "pending"  // 等待发送
+	OutboxStatusSending  = "sending"  // 发送中（已被调度器领取）
+	OutboxStatusSent     = "sent"     // 已成功上链
+	OutboxStatusFailed   = "failed"   // 重试耗尽，发送失败
+	OutboxStatusBlocked  = "blocked"  // 前序环节发送失败，等待前序环节重新提交后恢复
+	OutboxStatusReplaced = "replaced" // 切换合约后由重放生成的记录取代，不再发送
+)
+
+// ChainOutbox 上链发件箱
+// 与溯源环节记录在同一个数据库事务中写入，由后台调度器负责推送到区块链
+type ChainOutbox struct {
+	Id            int       `orm:"pk;auto" json:"id"`
+	GoodId        string    `orm:"size(64);index" json:"good_id"`
+	Stage         string    `orm:"size(20)" json:"stage"`
+	StageRecordId int       `orm:"default(0)" json:"stage_record_id"`
+	FuncName      string    `orm:"size(50)" json:"func_name"`
+	Params        string    `orm:"type(text)" json:"params"` // 合约参数JSON数组
+	SenderAddress string    `orm:"size(42)" json:"sender_address"`
+	Status        string    `orm:"size(20);index" json:"status"`
+	Attempts      int       `orm:"default(0)" json:"attempts"`
+	MaxAttempts   int       `orm:"default(8)" json:"max_attempts"`
+	NextRetryAt   time.Time `orm:"index" json:"next_retry_at"`
+	LastError     string    `orm:"type(text);null" json:"last_error"`
+	TxHash        string    `orm:"size(66);null" json:"tx_hash"`
+	Replay        bool      `orm:"default(false)" json:"replay"` // 切换合约后重放的记录
+	CreatedAt     time.Time `orm:"auto_now_add" json:"created_at"`
+	UpdatedAt     time.Time `orm:"auto_now" json:"updated_at"`
+}
+
+// TableName 指定表名
+func (c *ChainOutbox) TableName() string {
+	return "chain_outbox"
+}
+
+// NewChainOutbox 构建发件箱记录
+func NewChainOutbox(goodID, stage, funcName string, params []string, senderAddress string) *ChainOutbox {
+	data, _ := json.Marshal(params)
+	return &ChainOutbox{
+		GoodId:        goodID,
+		Stage:         stage,
+		FuncName:      funcName,
+		Params:        string(data),
+		SenderAddress: senderAddress,
+		Status:        OutboxStatusPending,
+		NextRetryAt:   time.Now(),
+	}
+}
+
+// ParamList 解析合约参数
+func (c *ChainOutbox) ParamList() ([]string, error) {
+	var params []string
+	err := json.Unmarshal([]byte(c.Params), &params)
+	return params, err
+}
+
+// EnqueueChainOutbox 在给定的事务中写入发件箱记录
+func EnqueueChainOutbox(o orm.QueryExecutor, entry *ChainOutbox) error {
+	if entry.Status == "" {
+		entry.Status = OutboxStatusPending
+	}
+	if entry.NextRetryAt.IsZero() {
+		entry.NextRetryAt = time.Now()
+	}
+
+	id, err := o.Insert(entry)
+	if err != nil {
+		logs.Error("写入上链发件箱失败 [goodID=%s, func=%s, error=%v]", entry.GoodId, entry.FuncName, err)
+		return err
+	}
+	entry.Id = int(id)
+	return nil
+}
+
+// GetChainOutboxByID 根据ID获取发件箱记录
+func GetChainOutboxByID(id int) (*ChainOutbox, error) {
+	o := GetOrm()
+	entry := &ChainOutbox{Id: id}
+	err := o.Read(entry)
+	return entry, err
+}
+
+// GetDueChainOutbox 获取到期待发送的发件箱记录，按写入顺序返回
+func GetDueChainOutbox(limit int) ([]*ChainOutbox, error) {
+	o := GetOrm()
+	var entries []*ChainOutbox
+	_, err := o.QueryTable(new(ChainOutbox)).
+		Filter("status", OutboxStatusPending).
+		Filter("next_retry_at__lte", time.Now()).
+		OrderBy("id").
+		Limit(limit).
+		All(&entries)
+	if err != nil {
+		logs.Error("获取待发送上链记录失败: %v", err)
+	}
+	return entries, err
+}
+
+// ClaimChainOutbox 领取一条待发送记录，防止同一记录被重复发送
+func ClaimChainOutbox(id int) (bool, error) {
+	o := GetOrm()
+	num, err := o.QueryTable(new(ChainOutbox)).
+		Filter("id", id).
+		Filter("status", OutboxStatusPending).
+		Update(orm.Params{
+			"status":     OutboxStatusSending,
+			"updated_at": time.Now(),
+		})
+	if err != nil {
+		logs.Error("领取上链发件箱记录失败 [id=%d, error=%v]", id, err)
+		return false, err
+	}
+	return num == 1, nil
+}
+
+// ReleaseStaleChainOutbox 将长时间停留在发送中的记录重置为待发送（如进程崩溃遗留）
+func ReleaseStaleChainOutbox(staleBefore time.Time) (int64, error) {
+	o := GetOrm()
+	return o.QueryTable(new(ChainOutbox)).
+		Filter("status", OutboxStatusSending).
+		Filter("updated_at__lt", staleBefore).
+		Update(orm.Params{
+			"status":     OutboxStatusPending,
+			"updated_at": time.Now(),
+		})
+}
+
+// GetUnsentChainOutboxBefore 获取同一货物中最早一条尚未上链的更早记录，不存在时返回 orm.ErrNoRows
+// 合约要求环节按顺序写入，前序环节未上链时后续环节必须等待
+func GetUnsentChainOutboxBefore(goodID string, id int) (*ChainOutbox, error) {
+	o := GetOrm()
+	entry := &ChainOutbox{}
+	err := o.QueryTable(new(ChainOutbox)).
+		Filter("good_id", goodID).
+		Filter("id__lt", id).
+		Exclude("status__in", OutboxStatusSent, OutboxStatusReplaced).
+		OrderBy("id").
+		One(entry)
+	return entry, err
+}
+
+// DeferChainOutbox 推迟待发送记录的下次发送时间，不计入重试次数
+func DeferChainOutbox(id int, next time.Time) error {
+	o := GetOrm()
+	_, err := o.QueryTable(new(ChainOutbox)).
+		Filter("id", id).
+		Filter("status", OutboxStatusPending).
+		Update(orm.Params{
+			"next_retry_at": next,
+			"updated_at":    time.Now(),
+		})
+	return err
+}
+
+// BlockChainOutboxAfter 前序记录发送失败时，将同一货物之后待发送的记录标记为阻塞，不再参与调度
+func BlockChainOutboxAfter(goodID string, id int, reason string) (int64, error) {
+	o := GetOrm()
+	return o.QueryTable(new(ChainOutbox)).
+		Filter("good_id", goodID).
+		Filter("id__gt", id).
+		Filter("status", OutboxStatusPending).
+		Update(orm.Params{
+			"status":     OutboxStatusBlocked,
+			"last_error": reason,
+			"updated_at": time.Now(),
+		})
+}
+
+// ReleaseBlockedChainOutbox 前序记录重新提交后，恢复同一货物被阻塞的记录
+func ReleaseBlockedChainOutbox(goodID string) (int64, error) {
+	o := GetOrm()
+	return o.QueryTable(new(ChainOutbox)).
+		Filter("good_id", goodID).
+		Filter("status", OutboxStatusBlocked).
+		Update(orm.Params{
+			"status":        OutboxStatusPending,
+			"last_error":    "",
+			"next_retry_at": time.Now(),
+			"updated_at":    time.Now(),
+		})
+}
+
+// GetLatestChainOutbox 获取某条环节记录最近一条发件箱记录
+func GetLatestChainOutbox(goodID string, stage string, recordID int) (*ChainOutbox, error) {
+	o := GetOrm()
+	entry := &ChainOutbox{}
+	err := o.QueryTable(new(ChainOutbox)).
+		Filter("good_id", goodID).
+		Filter("stage", stage).
+		Filter("stage_record_id", recordID).
+		OrderBy("-id").
+		One(entry)
+	return entry, err
+}
+
+// GetFirstChainOutboxID 环节记录最早一条发件箱记录的ID，即写入该记录时的上链顺序，没有发件箱记录时返回0
+func GetFirstChainOutboxID(goodID string, stage string, recordID int) int {
+	o := GetOrm()
+	entry := &ChainOutbox{}
+	err := o.QueryTable(new(ChainOutbox)).
+		Filter("good_id", goodID).
+		Filter("stage", stage).
+		Filter("stage_record_id", recordID).
+		OrderBy("id").
+		One(entry)
+	if err != nil {
+		return 0
+	}
+	return entry.Id
+}
+
+// GetChainReplayedAt 货物最近一次切换合约重放的时间，未重放过时返回零值
+// 重放前已存在的环节在新合约中记录的是重放时的区块时间
+func GetChainReplayedAt(goodID string) time.Time {
+	o := GetOrm()
+	entry := &ChainOutbox{}
+	err := o.QueryTable(new(ChainOutbox)).
+		Filter("good_id", goodID).
+		Filter("replay", true).
+		OrderBy("-id").
+		One(entry)
+	if err != nil {
+		return time.Time{}
+	}
+	return entry.CreatedAt
+}
+
+// UpdateChainOutbox 更新发件箱记录
+func UpdateChainOutbox(entry *ChainOutbox, cols ...string) error {
+	o := GetOrm()
+	entry.UpdatedAt = time.Now()
+	if len(cols) > 0 {
+		cols = append(cols, "UpdatedAt")
+	}
+	_, err := o.Update(entry, cols...)
+	if err != nil {
+		logs.Error("更新上链发件箱记录失败 [id=%d, error=%v]", entry.Id, err)
+	}
+	return err
+}
+
+// ErrChainOutboxInFlight 货物仍有等待发送或发送中的发件箱记录
+var ErrChainOutboxInFlight = errors.New("货物仍有未完成的上链任务")
+
+// EnqueueChainReplay 在同一个事务中写入货物重放到新合约的全部发件箱记录
+// 发送失败或被阻塞的旧记录标记为已取代，货物仍有等待发送或发送中的记录时返回 ErrChainOutboxInFlight
+func EnqueueChainReplay(goodID string, entries []*ChainOutbox) error {
+	o := GetOrm()
+	return o.DoTx(func(ctx context.Context, txOrm orm.TxOrmer) error {
+		inFlight, err := txOrm.QueryTable(new(ChainOutbox)).
+			Filter("good_id", goodID).
+			Filter("status__in", OutboxStatusPending, OutboxStatusSending).
+			Count()
+		if err != nil {
+			return err
+		}
+		if inFlight > 0 {
+			return ErrChainOutboxInFlight
+		}
+
+		if _, err := txOrm.QueryTable(new(ChainOutbox)).
+			Filter("good_id", goodID).
+			Filter("status__in", OutboxStatusFailed, OutboxStatusBlocked).
+			Update(orm.Params{"status": OutboxStatusReplaced, "last_error": "已由切换合约后的重放记录取代"}); err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			entry.Replay = true
+			if err := EnqueueChainOutbox(txOrm, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
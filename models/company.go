@@ -36,6 +36,8 @@ type Company struct {
 	CreatedAt        time.Time   `orm:"auto_now_add" json:"created_at"`
 	UpdatedAt        time.Time   `orm:"auto_now" json:"updated_at"`
 	BlockchainTxHash string      `orm:"size(66);null" json:"blockchain_tx_hash"` // 区块链交易哈希
+	SignUserId       string      `orm:"size(64);null" json:"sign_user_id"`       // 公司账户在WeBASE-Sign中的用户编号
+	BlockchainType   int         `orm:"default(0)" json:"blockchain_type"`       // 公司账户类型：BlockchainUserTypeLocal/BlockchainUserTypeExternal
 }
 
 // TableName 指定表名
@@ -63,7 +65,7 @@ func GetCompanyOperators(companyID, page, pageSize int, search string) ([]*User,
 	query := o.QueryTable("users")
 
 	// 基本条件
-	baseQuery := query.Filter("role", "operator")
+	baseQuery := query.Filter("role", RoleOperator)
 
 	// 如果指定了公司ID（非0），则过滤该公司的操作员
 	if companyID > 0 {
@@ -82,7 +84,7 @@ func GetCompanyOperators(companyID, page, pageSize int, search string) ([]*User,
 
 		// 创建主条件：role=operator AND (search conditions)
 		mainCond := orm.NewCondition()
-		mainCond = mainCond.And("role", "operator")
+		mainCond = mainCond.And("role", RoleOperator)
 		if companyID > 0 {
 			mainCond = mainCond.And("company_id", companyID)
 		}
@@ -128,8 +130,20 @@ func GetUserInfo(user *User) map[string]interface{} {
 		"created_at": user.CreatedAt.Format("2006-01-02 15:04:05"), // 格式化创建时间
 
 	}
+	if user.BlockchainAddr != "" {
+		info["blockchain_addr"] = user.BlockchainAddr
+	}
+	if user.FailedLogins > 0 {
+		info["failed_logins"] = user.FailedLogins
+	}
+	if user.MustChangePassword {
+		info["must_change_password"] = true
+	}
+	if user.IsLocked() {
+		info["locked_until"] = user.LockedUntil.Format("2006-01-02 15:04:05")
+	}
 
-	if user.Role != "super_admin" && user.CompanyId > 0 {
+	if user.Role != RoleSuperAdmin && user.CompanyId > 0 {
 		o := orm.NewOrm()
 		company := &Company{ID: user.CompanyId}
 		if err := o.Read(company); err == nil {
@@ -207,6 +221,34 @@ func GetCompanyByID(id int) (*Company, error) {
 	return company, err
 }
 
+// GetAllCompanies 获取全部公司，按ID顺序排列
+func GetAllCompanies() ([]*Company, error) {
+	o := GetOrm()
+	var companies []*Company
+	_, err := o.QueryTable(new(Company)).OrderBy("id").All(&companies)
+	if err != nil {
+		logs.Error("获取公司列表失败 [error=%v]", err)
+	}
+	return companies, err
+}
+
+// GetCompanyNames 批量获取公司名称
+func GetCompanyNames(ids []int) (map[int]string, error) {
+	names := make(map[int]string)
+	if len(ids) == 0 {
+		return names, nil
+	}
+	o := orm.NewOrm()
+	var companies []*Company
+	if _, err := o.QueryTable(new(Company)).Filter("id__in", ids).All(&companies); err != nil {
+		return nil, err
+	}
+	for _, company := range companies {
+		names[company.ID] = company.CompanyName
+	}
+	return names, nil
+}
+
 //***********************
 
 // CreateCompany 创建公司
@@ -279,7 +321,7 @@ func CountCompanyOperators(companyID int) (int64, error) {
 	o := GetOrm()
 	count, err := o.QueryTable(new(User)).
 		Filter("company_id", companyID).
-		Filter("role", "operator").
+		Filter("role", RoleOperator).
 		Count()
 	if err != nil {
 		logs.Error("统计公司操作员数量失败 [companyId=%d, error=%v]", companyID, err)
@@ -351,3 +393,21 @@ func GetBlockchainRegisteredCompanies() ([]*Company, error) {
 	}
 	return companies, err
 }
+
+// GetLocalBlockchainCompanies 获取区块链账户仍为本地用户的公司
+func GetLocalBlockchainCompanies() ([]*Company, error) {
+	var companies []*Company
+	o := orm.NewOrm()
+	_, err := o.QueryTable(new(Company)).
+		Exclude("blockchain_type", BlockchainUserTypeExternal).
+		Exclude("address", "").
+		All(&companies)
+	return companies, err
+}
+
+// UpdateCompanySignIdentity 保存公司账户在WeBASE-Sign中的用户编号和账户类型
+func UpdateCompanySignIdentity(company *Company) error {
+	o := orm.NewOrm()
+	_, err := o.Update(company, "SignUserId", "BlockchainType", "UpdatedAt")
+	return err
+}
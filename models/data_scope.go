@@ -0,0 +1,164 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/beego/beego/v2/client/orm"
+)
+
+// ErrOutOfScope 数据不在当前账户的访问范围内
+// 对外与数据不存在使用相同的提示，避免通过返回信息探测其他公司的数据
+var ErrOutOfScope = errors.New("数据不存在或无权访问")
+
+// DataScope 数据访问范围
+// 超级管理员可访问全部数据；公司账户只能访问本公司的数据，
+// 以及本公司拥有或在某一环节（运输、验货、处置、交付）经手过的货物
+type DataScope struct {
+	All       bool // 不限制公司
+	CompanyID int
+}
+
+// AllScope 全部数据的访问范围
+func AllScope() DataScope {
+	return DataScope{All: true}
+}
+
+// CompanyScope 限定为某个公司的访问范围，companyID 无效时不能访问任何公司数据
+func CompanyScope(companyID int) DataScope {
+	return DataScope{CompanyID: companyID}
+}
+
+// CoversCompany 是否可以访问该公司的数据
+func (s DataScope) CoversCompany(companyID int) bool {
+	return s.All || (s.CompanyID > 0 && s.CompanyID == companyID)
+}
+
+// ResolveCompany 确定要访问的公司：全部范围使用请求指定的公司，公司范围只能访问本公司
+// requested 为 0 表示未指定
+func (s DataScope) ResolveCompany(requested int) (int, error) {
+	if s.All {
+		return requested, nil
+	}
+	if s.CompanyID <= 0 || (requested != 0 && requested != s.CompanyID) {
+		return 0, ErrOutOfScope
+	}
+	return s.CompanyID, nil
+}
+
+// CanAccessGood 是否可以访问货物：拥有该货物，或作为承运方、验货方、处置方、经销商经手过
+// stages 为 nil 时只按货物归属判断
+func (s DataScope) CanAccessGood(good *Goods, stages *GoodStages) bool {
+	if s.All {
+		return true
+	}
+	if s.CompanyID <= 0 {
+		return false
+	}
+	if good.OwnerCompanyId == s.CompanyID {
+		return true
+	}
+	return stages != nil && stages.HandledBy(s.CompanyID)
+}
+
+// HandledBy 公司是否在某一环节经手过该货物
+func (g *GoodStages) HandledBy(companyID int) bool {
+	for _, leg := range g.TransportLegs {
+		if leg.TransporterId == companyID {
+			return true
+		}
+	}
+	for _, inspection := range g.Inspections {
+		if inspection.InspectorId == companyID {
+			return true
+		}
+	}
+	for _, disposition := range g.Dispositions {
+		if disposition.CompanyId == companyID {
+			return true
+		}
+	}
+	return g.Delivery != nil && g.Delivery.DealerId == companyID
+}
+
+// CanAppendLeg 公司能否为该货物追加运输段：承运了最后一段运输，或被最后一段指定为接续承运方
+func (g *GoodStages) CanAppendLeg(companyID int) bool {
+	if len(g.TransportLegs) == 0 {
+		return false
+	}
+	last := g.TransportLegs[len(g.TransportLegs)-1]
+	return last.TransporterId == companyID || (last.NextTransporterId > 0 && last.NextTransporterId == companyID)
+}
+
+// CanViewRecipient 是否可以查看交付记录中的收货人信息，只有执行交付的经销商可以查看
+func (s DataScope) CanViewRecipient(delivery *GoodsDelivery) bool {
+	return s.All || (s.CompanyID > 0 && delivery.DealerId == s.CompanyID)
+}
+
+// GetScopedGood 获取访问范围内的货物及其各环节记录，不存在或不在范围内时返回 ErrOutOfScope
+func GetScopedGood(goodID string, scope DataScope) (*Goods, *GoodStages, error) {
+	good, err := GetGoodByID(goodID)
+	if err == orm.ErrNoRows {
+		return nil, nil, ErrOutOfScope
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stages := GetGoodStages(goodID)
+	if !scope.CanAccessGood(good, stages) {
+		return nil, nil, ErrOutOfScope
+	}
+	return good, stages, nil
+}
+
+// GetScopedGoodsByBatch 获取访问范围内同一批次的货物，按登记顺序最多返回 limit 个
+func GetScopedGoodsByBatch(batchNumber string, scope DataScope, limit int) ([]*Goods, error) {
+	o := GetOrm()
+	cond := goodsScopeCond(scope).And("batch_number", batchNumber)
+	var goods []*Goods
+	_, err := o.QueryTable(new(Goods)).SetCond(cond).OrderBy("id").Limit(limit).All(&goods)
+	return goods, err
+}
+
+// GetScopedGoodsByIDs 按给定顺序获取访问范围内的货物，不存在或不在范围内的货物返回 ErrOutOfScope
+func GetScopedGoodsByIDs(goodIDs []string, scope DataScope) ([]*Goods, error) {
+	if len(goodIDs) == 0 {
+		return nil, nil
+	}
+	o := GetOrm()
+	cond := goodsScopeCond(scope).And("good_id__in", goodIDs)
+	var found []*Goods
+	if _, err := o.QueryTable(new(Goods)).SetCond(cond).All(&found); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*Goods, len(found))
+	for _, good := range found {
+		byID[good.GoodId] = good
+	}
+	goods := make([]*Goods, 0, len(goodIDs))
+	for _, goodID := range goodIDs {
+		good, ok := byID[goodID]
+		if !ok {
+			return nil, ErrOutOfScope
+		}
+		goods = append(goods, good)
+	}
+	return goods, nil
+}
+
+// goodsScopeCond 货物列表的访问范围条件
+// 公司ID为整数，直接写入子查询；各环节表按经手公司字段筛选
+func goodsScopeCond(scope DataScope) *orm.Condition {
+	cond := orm.NewCondition()
+	if scope.All {
+		return cond
+	}
+	handled := fmt.Sprintf("IN (SELECT good_id FROM goods_transport WHERE transporter_id = %[1]d"+
+		" UNION SELECT good_id FROM goods_inspection WHERE inspector_id = %[1]d"+
+		" UNION SELECT good_id FROM goods_disposition WHERE company_id = %[1]d"+
+		" UNION SELECT good_id FROM goods_delivery WHERE dealer_id = %[1]d)", scope.CompanyID)
+	owned := orm.NewCondition().And("owner_company_id", scope.CompanyID)
+	return cond.AndCond(owned.OrCond(orm.NewCondition().Raw("good_id", handled)))
+}
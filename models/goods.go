@@ -1,6 +1,10 @@
 package models
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/beego/beego/v2/client/orm"
@@ -11,20 +15,58 @@ import (
 type GoodsStatus int
 
 const (
-	GoodsStatusProduced  GoodsStatus = iota + 1 // 已生产
-	GoodsStatusShipped                          // 已运输
-	GoodsStatusInspected                        // 已验货
-	GoodsStatusDelivered                        // 已交付
+	GoodsStatusProduced           GoodsStatus = iota + 1 // 已生产
+	GoodsStatusShipped                                   // 已运输
+	GoodsStatusInspected                                 // 已验货
+	GoodsStatusDelivered                                 // 已交付
+	GoodsStatusRejected                                  // 验货不合格
+	GoodsStatusQuarantined                               // 已隔离
+	GoodsStatusReturnedToProducer                        // 已退回生产商
+	GoodsStatusDestroyed                                 // 已销毁
 )
 
 // GoodsStatusMap 货物状态映射
 var GoodsStatusMap = map[GoodsStatus]string{
-	GoodsStatusProduced:  "已生产",
-	GoodsStatusShipped:   "已运输",
-	GoodsStatusInspected: "已验货",
-	GoodsStatusDelivered: "已交付",
+	GoodsStatusProduced:           "已生产",
+	GoodsStatusShipped:            "已运输",
+	GoodsStatusInspected:          "已验货",
+	GoodsStatusDelivered:          "已交付",
+	GoodsStatusRejected:           "验货不合格",
+	GoodsStatusQuarantined:        "已隔离",
+	GoodsStatusReturnedToProducer: "已退回生产商",
+	GoodsStatusDestroyed:          "已销毁",
 }
 
+// 溯源环节
+const (
+	StageProduction  = "production"  // 生产
+	StageTransport   = "transport"   // 运输
+	StageInspection  = "inspection"  // 验货
+	StageDelivery    = "delivery"    // 交付
+	StageDisposition = "disposition" // 不合格货物处置
+)
+
+// 环节上链状态
+const (
+	ChainStatusPending             = "pending"              // 等待发送
+	ChainStatusPendingConfirmation = "pending_confirmation" // 已发送，等待交易回执
+	ChainStatusConfirmed           = "confirmed"            // 交易回执确认成功
+	ChainStatusReverted            = "reverted"             // 交易被合约回滚
+	ChainStatusFailed              = "failed"               // 重试耗尽，发送失败
+)
+
+// stageTables 环节与数据表的对应关系
+var stageTables = map[string]string{
+	StageProduction:  "goods_production",
+	StageTransport:   "goods_transport",
+	StageInspection:  "goods_inspection",
+	StageDelivery:    "goods_delivery",
+	StageDisposition: "goods_disposition",
+}
+
+// ErrGoodsStatusChanged 保存环节时货物状态已被其他请求修改
+var ErrGoodsStatusChanged = errors.New("货物状态已变更，请刷新后重试")
+
 // Goods 货物模型
 type Goods struct {
 	Id               int         `orm:"pk;auto" json:"id"`
@@ -37,6 +79,9 @@ type Goods struct {
 	CreatedAt        time.Time   `orm:"auto_now_add" json:"created_at"`
 	UpdatedAt        time.Time   `orm:"auto_now" json:"updated_at"`
 	BlockchainTxHash string      `orm:"size(66);null" json:"blockchain_tx_hash"`
+	ChainStatus      string      `orm:"size(20);default(pending)" json:"chain_status"` // 最新一笔交易的上链状态
+	BlockNumber      int64       `orm:"default(0)" json:"block_number"`
+	RevertReason     string      `orm:"size(255);null" json:"revert_reason"`
 }
 
 // TableName 指定表名
@@ -57,6 +102,9 @@ type GoodsProduction struct {
 	OperatorId       int       `orm:"default(0)" json:"operator_id"`
 	OperatorName     string    `orm:"size(100);null" json:"operator_name"`
 	BlockchainTxHash string    `orm:"size(66);null" json:"blockchain_tx_hash"`
+	ChainStatus      string    `orm:"size(20);default(pending)" json:"chain_status"`
+	BlockNumber      int64     `orm:"default(0)" json:"block_number"`
+	RevertReason     string    `orm:"size(255);null" json:"revert_reason"`
 	CreatedAt        time.Time `orm:"auto_now_add" json:"created_at"`
 }
 
@@ -65,11 +113,12 @@ func (g *GoodsProduction) TableName() string {
 	return "goods_production"
 }
 
-// GoodsTransport 货物运输信息
+// GoodsTransport 货物运输信息，一件货物可有多段运输，按 LegIndex 排序
 type GoodsTransport struct {
 	Id                int       `orm:"pk;auto" json:"id"`
 	GoodsId           int       `orm:"index" json:"goods_id"`
 	GoodId            string    `orm:"size(64);index" json:"good_id"`
+	LegIndex          int       `orm:"default(0)" json:"leg_index"` // 运输段序号，从0开始，与合约中的序号一致
 	TransporterId     int       `orm:"default(0)" json:"transporter_id"`
 	TransporterName   string    `orm:"size(100);null" json:"transporter_name"`
 	OperatorId        int       `orm:"default(0)" json:"operator_id"`
@@ -81,7 +130,11 @@ type GoodsTransport struct {
 	EndTime           time.Time `orm:"null" json:"end_time"`
 	ActualArrivalTime time.Time `orm:"null" json:"actual_arrival_time"`
 	TrackingNumber    string    `orm:"size(50);null" json:"tracking_number"`
+	NextTransporterId int       `orm:"default(0)" json:"next_transporter_id"` // 指定接续承运下一段运输的运输商，0表示未指定
 	BlockchainTxHash  string    `orm:"size(66);null" json:"blockchain_tx_hash"`
+	ChainStatus       string    `orm:"size(20);default(pending)" json:"chain_status"`
+	BlockNumber       int64     `orm:"default(0)" json:"block_number"`
+	RevertReason      string    `orm:"size(255);null" json:"revert_reason"`
 	CreatedAt         time.Time `orm:"auto_now_add" json:"created_at"`
 	UpdatedAt         time.Time `orm:"auto_now" json:"updated_at"`
 }
@@ -91,6 +144,11 @@ func (g *GoodsTransport) TableName() string {
 	return "goods_transport"
 }
 
+// TableUnique 同一货物的运输段序号唯一，防止并发请求重复追加同一段
+func (g *GoodsTransport) TableUnique() [][]string {
+	return [][]string{{"GoodId", "LegIndex"}}
+}
+
 // GoodsInspection 货物验货信息
 type GoodsInspection struct {
 	Id               int       `orm:"pk;auto" json:"id"`
@@ -103,10 +161,14 @@ type GoodsInspection struct {
 	InspectionInfo   string    `orm:"type(text)" json:"inspection_info"`
 	QualityScore     int       `orm:"default(0)" json:"quality_score"`
 	PassStatus       bool      `orm:"default(true)" json:"pass_status"`
+	RejectReason     string    `orm:"size(255);null" json:"reject_reason"` // 验货不合格原因
 	InspectionTime   time.Time `orm:"auto_now_add" json:"inspection_time"`
 	Location         string    `orm:"size(255)" json:"location"`
 	Notes            string    `orm:"type(text);null" json:"notes"`
 	BlockchainTxHash string    `orm:"size(66);null" json:"blockchain_tx_hash"`
+	ChainStatus      string    `orm:"size(20);default(pending)" json:"chain_status"`
+	BlockNumber      int64     `orm:"default(0)" json:"block_number"`
+	RevertReason     string    `orm:"size(255);null" json:"revert_reason"`
 	CreatedAt        time.Time `orm:"auto_now_add" json:"created_at"`
 }
 
@@ -131,6 +193,9 @@ type GoodsDelivery struct {
 	Location         string    `orm:"size(255)" json:"location"`
 	Notes            string    `orm:"type(text);null" json:"notes"`
 	BlockchainTxHash string    `orm:"size(66);null" json:"blockchain_tx_hash"`
+	ChainStatus      string    `orm:"size(20);default(pending)" json:"chain_status"`
+	BlockNumber      int64     `orm:"default(0)" json:"block_number"`
+	RevertReason     string    `orm:"size(255);null" json:"revert_reason"`
 	CreatedAt        time.Time `orm:"auto_now_add" json:"created_at"`
 }
 
@@ -139,6 +204,30 @@ func (g *GoodsDelivery) TableName() string {
 	return "goods_delivery"
 }
 
+// GoodsDisposition 验货不合格货物的处置记录（隔离、退回生产商或销毁）
+type GoodsDisposition struct {
+	Id               int         `orm:"pk;auto" json:"id"`
+	GoodsId          int         `orm:"index" json:"goods_id"`
+	GoodId           string      `orm:"size(64);index" json:"good_id"`
+	FromStatus       GoodsStatus `json:"from_status"`
+	ToStatus         GoodsStatus `json:"to_status"`
+	Reason           string      `orm:"size(255)" json:"reason"`
+	CompanyId        int         `orm:"default(0)" json:"company_id"`
+	CompanyName      string      `orm:"size(100);null" json:"company_name"`
+	OperatorId       int         `orm:"default(0)" json:"operator_id"`
+	OperatorName     string      `orm:"size(100);null" json:"operator_name"`
+	BlockchainTxHash string      `orm:"size(66);null" json:"blockchain_tx_hash"`
+	ChainStatus      string      `orm:"size(20);default(pending)" json:"chain_status"`
+	BlockNumber      int64       `orm:"default(0)" json:"block_number"`
+	RevertReason     string      `orm:"size(255);null" json:"revert_reason"`
+	CreatedAt        time.Time   `orm:"auto_now_add" json:"created_at"`
+}
+
+// TableName 指定表名
+func (g *GoodsDisposition) TableName() string {
+	return "goods_disposition"
+}
+
 // GetGoodByID 根据区块链ID获取货物
 func GetGoodByID(goodId string) (*Goods, error) {
 	o := GetOrm()
@@ -209,6 +298,187 @@ func UpdateGoodStatus(goodID string, status GoodsStatus, blockchainTxHash string
 	return err
 }
 
+// SaveGoodRegistration 在同一事务中保存货物、生产信息和上链发件箱记录
+func SaveGoodRegistration(good *Goods, production *GoodsProduction, outbox *ChainOutbox) error {
+	o := GetOrm()
+	err := o.DoTx(func(ctx context.Context, txOrm orm.TxOrmer) error {
+		if _, err := txOrm.Insert(good); err != nil {
+			return err
+		}
+
+		production.GoodsId = good.Id
+		production.ChainStatus = ChainStatusPending
+		id, err := txOrm.Insert(production)
+		if err != nil {
+			return err
+		}
+
+		outbox.StageRecordId = int(id)
+		return EnqueueChainOutbox(txOrm, outbox)
+	})
+	if err != nil {
+		logs.Error("保存货物注册信息失败 [goodID=%s, error=%v]", good.GoodId, err)
+	} else {
+		logs.Info("成功保存货物注册信息 [goodID=%s, outboxID=%d]", good.GoodId, outbox.Id)
+	}
+	return err
+}
+
+// SaveGoodsStage 在同一事务中保存环节记录、推进货物状态并写入上链发件箱记录
+// record 为 GoodsTransport、GoodsInspection、GoodsDelivery 或 GoodsDisposition 指针
+func SaveGoodsStage(goodID string, fromStatus, toStatus GoodsStatus, record interface{}, outbox *ChainOutbox) error {
+	o := GetOrm()
+	err := o.DoTx(func(ctx context.Context, txOrm orm.TxOrmer) error {
+		// 以当前状态为条件更新，防止并发请求重复推进同一货物
+		num, err := txOrm.QueryTable(new(Goods)).
+			Filter("good_id", goodID).
+			Filter("status", fromStatus).
+			Update(orm.Params{
+				"status":        toStatus,
+				"chain_status":  ChainStatusPending,
+				"block_number":  0,
+				"revert_reason": "",
+				"updated_at":    time.Now(),
+			})
+		if err != nil {
+			return err
+		}
+		if num == 0 {
+			return ErrGoodsStatusChanged
+		}
+
+		id, err := txOrm.Insert(record)
+		if err != nil {
+			return err
+		}
+
+		outbox.StageRecordId = int(id)
+		return EnqueueChainOutbox(txOrm, outbox)
+	})
+	if err != nil {
+		logs.Error("保存货物环节信息失败 [goodID=%s, stage=%s, error=%v]", goodID, outbox.Stage, err)
+	} else {
+		logs.Info("成功保存货物环节信息 [goodID=%s, stage=%s, status=%d, outboxID=%d]",
+			goodID, outbox.Stage, toStatus, outbox.Id)
+	}
+	return err
+}
+
+// UpdateStageChainStatus 更新环节记录的上链状态和交易哈希
+func UpdateStageChainStatus(stage string, recordID int, txHash string, chainStatus string) error {
+	table, ok := stageTables[stage]
+	if !ok {
+		return errors.New("未知的溯源环节: " + stage)
+	}
+
+	params := orm.Params{"chain_status": chainStatus}
+	if txHash != "" {
+		params["blockchain_tx_hash"] = txHash
+	}
+
+	o := GetOrm()
+	_, err := o.QueryTable(table).Filter("id", recordID).Update(params)
+	if err != nil {
+		logs.Error("更新环节上链状态失败 [stage=%s, id=%d, status=%s, error=%v]",
+			stage, recordID, chainStatus, err)
+	}
+	return err
+}
+
+// UpdateGoodChainStatus 更新货物最新一笔交易的哈希和上链状态，txHash为空时只更新状态
+func UpdateGoodChainStatus(goodID string, txHash string, chainStatus string) error {
+	params := orm.Params{
+		"chain_status":  chainStatus,
+		"block_number":  0,
+		"revert_reason": "",
+		"updated_at":    time.Now(),
+	}
+	if txHash != "" {
+		params["blockchain_tx_hash"] = txHash
+	}
+
+	o := GetOrm()
+	_, err := o.QueryTable(new(Goods)).Filter("good_id", goodID).Update(params)
+	if err != nil {
+		logs.Error("更新货物上链状态失败 [goodID=%s, status=%s, error=%v]", goodID, chainStatus, err)
+	}
+	return err
+}
+
+// StageConfirmation 等待交易回执的环节记录
+type StageConfirmation struct {
+	Stage    string
+	RecordId int
+	GoodId   string
+	TxHash   string
+}
+
+// GetStagesAwaitingConfirmation 获取已发送但尚未确认的环节记录
+func GetStagesAwaitingConfirmation(limit int) ([]*StageConfirmation, error) {
+	o := GetOrm()
+	var pending []*StageConfirmation
+
+	for _, stage := range []string{StageProduction, StageTransport, StageInspection, StageDelivery, StageDisposition} {
+		var rows []orm.ParamsList
+		_, err := o.QueryTable(stageTables[stage]).
+			Filter("chain_status", ChainStatusPendingConfirmation).
+			OrderBy("id").
+			Limit(limit).
+			ValuesList(&rows, "id", "good_id", "blockchain_tx_hash")
+		if err != nil {
+			logs.Error("获取待确认环节记录失败 [stage=%s, error=%v]", stage, err)
+			return nil, err
+		}
+
+		for _, row := range rows {
+			id, _ := strconv.Atoi(fmt.Sprint(row[0]))
+			pending = append(pending, &StageConfirmation{
+				Stage:    stage,
+				RecordId: id,
+				GoodId:   fmt.Sprint(row[1]),
+				TxHash:   fmt.Sprint(row[2]),
+			})
+		}
+	}
+	return pending, nil
+}
+
+// ApplyStageReceipt 根据交易回执更新环节记录，若该交易仍是货物最新一笔交易则同步更新货物
+func ApplyStageReceipt(ref *StageConfirmation, chainStatus string, blockNumber int64, revertReason string) error {
+	table, ok := stageTables[ref.Stage]
+	if !ok {
+		return errors.New("未知的溯源环节: " + ref.Stage)
+	}
+
+	params := orm.Params{
+		"chain_status":  chainStatus,
+		"block_number":  blockNumber,
+		"revert_reason": revertReason,
+	}
+
+	o := GetOrm()
+	err := o.DoTx(func(ctx context.Context, txOrm orm.TxOrmer) error {
+		if _, err := txOrm.QueryTable(table).Filter("id", ref.RecordId).Update(params); err != nil {
+			return err
+		}
+
+		goodParams := orm.Params{"updated_at": time.Now()}
+		for k, v := range params {
+			goodParams[k] = v
+		}
+		_, err := txOrm.QueryTable(new(Goods)).
+			Filter("good_id", ref.GoodId).
+			Filter("blockchain_tx_hash", ref.TxHash).
+			Update(goodParams)
+		return err
+	})
+	if err != nil {
+		logs.Error("更新交易回执状态失败 [stage=%s, id=%d, txHash=%s, error=%v]",
+			ref.Stage, ref.RecordId, ref.TxHash, err)
+	}
+	return err
+}
+
 // SaveGoodsProduction 保存货物生产信息
 func SaveGoodsProduction(goodsID int, goodID string, location, batchInfo, qualityLevel string,
 	operatorID int, operatorName string, expiryDate time.Time) (*GoodsProduction, error) {
@@ -374,30 +644,25 @@ func UpdateGoodsDelivery(delivery *GoodsDelivery) error {
 	return err
 }
 
-// GetGoodsList 获取货物列表
-func GetGoodsList(page, pageSize int, companyID int, search string, status int) ([]*Goods, int64, error) {
+// GetGoodsList 获取访问范围内的货物列表
+func GetGoodsList(page, pageSize int, scope DataScope, search string, status int) ([]*Goods, int64, error) {
 	o := GetOrm()
-	query := o.QueryTable(new(Goods))
-
-	// 按公司ID筛选
-	if companyID > 0 {
-		query = query.Filter("owner_company_id", companyID)
-	}
+	cond := goodsScopeCond(scope)
 
 	// 按状态筛选
 	if status > 0 {
-		query = query.Filter("status", status)
+		cond = cond.And("status", status)
 	}
 
 	// 按关键词搜索
 	if search != "" {
-		cond := orm.NewCondition()
-		searchCond := cond.Or("good_id__icontains", search).
+		searchCond := orm.NewCondition().Or("good_id__icontains", search).
 			Or("good_name__icontains", search).
 			Or("batch_number__icontains", search).
 			Or("description__icontains", search)
-		query = query.SetCond(searchCond)
+		cond = cond.AndCond(searchCond)
 	}
+	query := o.QueryTable(new(Goods)).SetCond(cond)
 
 	// 获取总数
 	total, err := query.Count()
@@ -418,6 +683,89 @@ func GetGoodsList(page, pageSize int, companyID int, search string, status int)
 	return goods, total, nil
 }
 
+// GoodStages 货物各环节的数据库记录，不存在的环节为nil
+type GoodStages struct {
+	Production    *GoodsProduction
+	TransportLegs []*GoodsTransport // 按运输段序号排列
+	Inspection    *GoodsInspection  // 最新一次验货
+	Inspections   []*GoodsInspection
+	Delivery      *GoodsDelivery
+	Dispositions  []*GoodsDisposition
+}
+
+// GetGoodStages 获取货物各环节的数据库记录
+func GetGoodStages(goodID string) *GoodStages {
+	o := GetOrm()
+	stages := &GoodStages{}
+
+	var production GoodsProduction
+	if o.QueryTable(new(GoodsProduction)).Filter("good_id", goodID).OrderBy("-id").One(&production) == nil {
+		stages.Production = &production
+	}
+	stages.TransportLegs, _ = GetTransportLegs(goodID)
+	stages.Inspections, _ = GetGoodsInspections(goodID)
+	if len(stages.Inspections) > 0 {
+		stages.Inspection = stages.Inspections[len(stages.Inspections)-1]
+	}
+	var delivery GoodsDelivery
+	if o.QueryTable(new(GoodsDelivery)).Filter("good_id", goodID).OrderBy("-id").One(&delivery) == nil {
+		stages.Delivery = &delivery
+	}
+	stages.Dispositions, _ = GetGoodsDispositions(goodID)
+	return stages
+}
+
+// GetGoodsInspections 获取货物的全部验货记录，按时间顺序排列
+func GetGoodsInspections(goodID string) ([]*GoodsInspection, error) {
+	o := GetOrm()
+	var inspections []*GoodsInspection
+	_, err := o.QueryTable(new(GoodsInspection)).Filter("good_id", goodID).OrderBy("id").All(&inspections)
+	if err != nil {
+		logs.Error("获取货物验货记录失败 [goodID=%s, error=%v]", goodID, err)
+	}
+	return inspections, err
+}
+
+// GetGoodsDispositions 获取货物的全部处置记录，按时间顺序排列
+func GetGoodsDispositions(goodID string) ([]*GoodsDisposition, error) {
+	o := GetOrm()
+	var dispositions []*GoodsDisposition
+	_, err := o.QueryTable(new(GoodsDisposition)).Filter("good_id", goodID).OrderBy("id").All(&dispositions)
+	if err != nil {
+		logs.Error("获取货物处置记录失败 [goodID=%s, error=%v]", goodID, err)
+	}
+	return dispositions, err
+}
+
+// GetTransportLegs 获取货物的全部运输段，按序号排列
+func GetTransportLegs(goodID string) ([]*GoodsTransport, error) {
+	o := GetOrm()
+	var legs []*GoodsTransport
+	_, err := o.QueryTable(new(GoodsTransport)).Filter("good_id", goodID).OrderBy("leg_index", "id").All(&legs)
+	if err != nil {
+		logs.Error("获取货物运输段失败 [goodID=%s, error=%v]", goodID, err)
+	}
+	return legs, err
+}
+
+// CountTransportLegs 统计货物已有的运输段数量
+func CountTransportLegs(goodID string) (int, error) {
+	o := GetOrm()
+	count, err := o.QueryTable(new(GoodsTransport)).Filter("good_id", goodID).Count()
+	return int(count), err
+}
+
+// GetGoodsBatch 按ID顺序分批获取货物，用于全量扫描
+func GetGoodsBatch(afterID int, limit int) ([]*Goods, error) {
+	o := GetOrm()
+	var goods []*Goods
+	_, err := o.QueryTable(new(Goods)).Filter("id__gt", afterID).OrderBy("id").Limit(limit).All(&goods)
+	if err != nil {
+		logs.Error("分批获取货物失败 [afterID=%d, error=%v]", afterID, err)
+	}
+	return goods, err
+}
+
 // GetTraceInfo 获取完整溯源信息
 func GetTraceInfo(goodID string) (map[string]interface{}, error) {
 	o := GetOrm()
@@ -443,14 +791,13 @@ func GetTraceInfo(goodID string) (map[string]interface{}, error) {
 	hasProduction := err == nil
 
 	// 获取运输信息
-	var transport GoodsTransport
-	err = o.QueryTable(new(GoodsTransport)).Filter("good_id", goodID).One(&transport)
-	hasTransport := err == nil
+	legs, _ := GetTransportLegs(goodID)
+
+	// 获取验货信息，不合格后可重新验货，因此可能有多条
+	inspections, _ := GetGoodsInspections(goodID)
 
-	// 获取验货信息
-	var inspection GoodsInspection
-	err = o.QueryTable(new(GoodsInspection)).Filter("good_id", goodID).One(&inspection)
-	hasInspection := err == nil
+	// 获取处置信息
+	dispositions, _ := GetGoodsDispositions(goodID)
 
 	// 获取交付信息
 	var delivery GoodsDelivery
@@ -485,42 +832,39 @@ func GetTraceInfo(goodID string) (map[string]interface{}, error) {
 			"expiry_date":     production.ExpiryDate.Format("2006-01-02"),
 			"operator_name":   production.OperatorName,
 			"blockchain_hash": production.BlockchainTxHash,
+			"chain_status":    production.ChainStatus,
+			"block_number":    production.BlockNumber,
+			"revert_reason":   production.RevertReason,
 		}
 	}
 
-	// 添加运输信息
-	if hasTransport {
-		trace["transport"] = map[string]interface{}{
-			"id":                  transport.Id,
-			"transporter_id":      transport.TransporterId,
-			"transporter_name":    transport.TransporterName,
-			"start_location":      transport.StartLocation,
-			"end_location":        transport.EndLocation,
-			"transport_info":      transport.TransportInfo,
-			"start_time":          transport.StartTime.Format("2006-01-02 15:04:05"),
-			"end_time":            transport.EndTime.Format("2006-01-02 15:04:05"),
-			"actual_arrival_time": transport.ActualArrivalTime.Format("2006-01-02 15:04:05"),
-			"tracking_number":     transport.TrackingNumber,
-			"operator_name":       transport.OperatorName,
-			"blockchain_hash":     transport.BlockchainTxHash,
+	// 添加运输信息，transport 为最新一段运输，transport_legs 为按顺序排列的全部运输段
+	if len(legs) > 0 {
+		transportLegs := make([]map[string]interface{}, 0, len(legs))
+		for _, leg := range legs {
+			transportLegs = append(transportLegs, transportLegInfo(leg))
 		}
+		trace["transport"] = transportLegs[len(transportLegs)-1]
+		trace["transport_legs"] = transportLegs
 	}
 
-	// 添加验货信息
-	if hasInspection {
-		trace["inspection"] = map[string]interface{}{
-			"id":              inspection.Id,
-			"inspector_id":    inspection.InspectorId,
-			"inspector_name":  inspection.InspectorName,
-			"inspection_info": inspection.InspectionInfo,
-			"quality_score":   inspection.QualityScore,
-			"pass_status":     inspection.PassStatus,
-			"inspection_time": inspection.InspectionTime.Format("2006-01-02 15:04:05"),
-			"location":        inspection.Location,
-			"notes":           inspection.Notes,
-			"operator_name":   inspection.OperatorName,
-			"blockchain_hash": inspection.BlockchainTxHash,
+	// 添加验货信息，inspection 为最新一次验货，inspections 为全部验货记录
+	if len(inspections) > 0 {
+		inspectionList := make([]map[string]interface{}, 0, len(inspections))
+		for _, inspection := range inspections {
+			inspectionList = append(inspectionList, inspectionInfo(inspection))
 		}
+		trace["inspection"] = inspectionList[len(inspectionList)-1]
+		trace["inspections"] = inspectionList
+	}
+
+	// 添加处置信息
+	if len(dispositions) > 0 {
+		dispositionList := make([]map[string]interface{}, 0, len(dispositions))
+		for _, disposition := range dispositions {
+			dispositionList = append(dispositionList, dispositionInfo(disposition))
+		}
+		trace["dispositions"] = dispositionList
 	}
 
 	// 添加交付信息
@@ -537,8 +881,74 @@ func GetTraceInfo(goodID string) (map[string]interface{}, error) {
 			"notes":             delivery.Notes,
 			"operator_name":     delivery.OperatorName,
 			"blockchain_hash":   delivery.BlockchainTxHash,
+			"chain_status":      delivery.ChainStatus,
+			"block_number":      delivery.BlockNumber,
+			"revert_reason":     delivery.RevertReason,
 		}
 	}
 
 	return trace, nil
 }
+
+// transportLegInfo 构建单段运输的溯源信息
+func transportLegInfo(transport *GoodsTransport) map[string]interface{} {
+	return map[string]interface{}{
+		"id":                  transport.Id,
+		"leg_index":           transport.LegIndex,
+		"transporter_id":      transport.TransporterId,
+		"transporter_name":    transport.TransporterName,
+		"start_location":      transport.StartLocation,
+		"end_location":        transport.EndLocation,
+		"transport_info":      transport.TransportInfo,
+		"start_time":          transport.StartTime.Format("2006-01-02 15:04:05"),
+		"end_time":            transport.EndTime.Format("2006-01-02 15:04:05"),
+		"actual_arrival_time": transport.ActualArrivalTime.Format("2006-01-02 15:04:05"),
+		"tracking_number":     transport.TrackingNumber,
+		"operator_name":       transport.OperatorName,
+		"blockchain_hash":     transport.BlockchainTxHash,
+		"chain_status":        transport.ChainStatus,
+		"block_number":        transport.BlockNumber,
+		"revert_reason":       transport.RevertReason,
+	}
+}
+
+// inspectionInfo 构建单次验货的溯源信息
+func inspectionInfo(inspection *GoodsInspection) map[string]interface{} {
+	return map[string]interface{}{
+		"id":              inspection.Id,
+		"inspector_id":    inspection.InspectorId,
+		"inspector_name":  inspection.InspectorName,
+		"inspection_info": inspection.InspectionInfo,
+		"quality_score":   inspection.QualityScore,
+		"pass_status":     inspection.PassStatus,
+		"reject_reason":   inspection.RejectReason,
+		"inspection_time": inspection.InspectionTime.Format("2006-01-02 15:04:05"),
+		"location":        inspection.Location,
+		"notes":           inspection.Notes,
+		"operator_name":   inspection.OperatorName,
+		"blockchain_hash": inspection.BlockchainTxHash,
+		"chain_status":    inspection.ChainStatus,
+		"block_number":    inspection.BlockNumber,
+		"revert_reason":   inspection.RevertReason,
+	}
+}
+
+// dispositionInfo 构建单次处置的溯源信息
+func dispositionInfo(disposition *GoodsDisposition) map[string]interface{} {
+	return map[string]interface{}{
+		"id":               disposition.Id,
+		"from_status":      disposition.FromStatus,
+		"from_status_text": GoodsStatusMap[disposition.FromStatus],
+		"to_status":        disposition.ToStatus,
+		"to_status_text":   GoodsStatusMap[disposition.ToStatus],
+		"reason":           disposition.Reason,
+		"company_id":       disposition.CompanyId,
+		"company_name":     disposition.CompanyName,
+		"operator_name":    disposition.OperatorName,
+		"created_at":       disposition.CreatedAt.Format("2006-01-02 15:04:05"),
+		"blockchain_hash":  disposition.BlockchainTxHash,
+		"chain_status":     disposition.ChainStatus,
+		"block_number":     disposition.BlockNumber,
+		"revert_reason":    disposition.RevertReason,
+	}
+}
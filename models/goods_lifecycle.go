@@ -0,0 +1,214 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// 货物操作
+const (
+	GoodsActionRegister   = "register"   // 登记生产
+	GoodsActionShip       = "ship"       // 运输
+	GoodsActionInspect    = "inspect"    // 验货合格
+	GoodsActionReject     = "reject"     // 验货不合格
+	GoodsActionQuarantine = "quarantine" // 隔离
+	GoodsActionReturn     = "return"     // 退回生产商
+	GoodsActionDestroy    = "destroy"    // 销毁
+	GoodsActionDeliver    = "deliver"    // 交付
+)
+
+// GoodsTransition 货物生命周期中的一次状态转换
+type GoodsTransition struct {
+	Action         string        `json:"action"`
+	Name           string        `json:"name"`
+	From           []GoodsStatus `json:"from"` // 允许执行该操作的货物状态，为空表示新登记的货物
+	To             GoodsStatus   `json:"to"`
+	CompanyType    CompanyType   `json:"company_type"` // 允许执行该操作的公司类型
+	Stage          string        `json:"stage"`
+	FuncName       string        `json:"func_name"`       // 对应的合约写方法，合约修饰符与本表保持一致
+	RequiredFields []string      `json:"required_fields"` // 请求中必须填写的字段，为请求结构体的json名称
+}
+
+// GoodsLifecycle 货物生命周期定义，各环节处理均以此表为准
+var GoodsLifecycle = []*GoodsTransition{
+	{
+		Action:         GoodsActionRegister,
+		Name:           "登记生产",
+		To:             GoodsStatusProduced,
+		CompanyType:    Producer,
+		Stage:          StageProduction,
+		FuncName:       "registerGood",
+		RequiredFields: []string{"good_name", "location"},
+	},
+	{
+		Action:         GoodsActionShip,
+		Name:           "运输",
+		From:           []GoodsStatus{GoodsStatusProduced, GoodsStatusShipped},
+		To:             GoodsStatusShipped,
+		CompanyType:    Shipper,
+		Stage:          StageTransport,
+		FuncName:       "shipGood",
+		RequiredFields: []string{"good_id", "start_location", "end_location", "transport_info"},
+	},
+	{
+		Action:         GoodsActionInspect,
+		Name:           "验货合格",
+		From:           []GoodsStatus{GoodsStatusShipped, GoodsStatusRejected, GoodsStatusQuarantined},
+		To:             GoodsStatusInspected,
+		CompanyType:    Port,
+		Stage:          StageInspection,
+		FuncName:       "inspectGood",
+		RequiredFields: []string{"good_id", "inspection_info", "location"},
+	},
+	{
+		Action:         GoodsActionReject,
+		Name:           "验货不合格",
+		From:           []GoodsStatus{GoodsStatusShipped, GoodsStatusRejected, GoodsStatusQuarantined},
+		To:             GoodsStatusRejected,
+		CompanyType:    Port,
+		Stage:          StageInspection,
+		FuncName:       "inspectGood",
+		RequiredFields: []string{"good_id", "inspection_info", "location", "reject_reason"},
+	},
+	{
+		Action:         GoodsActionQuarantine,
+		Name:           "隔离",
+		From:           []GoodsStatus{GoodsStatusRejected},
+		To:             GoodsStatusQuarantined,
+		CompanyType:    Port,
+		Stage:          StageDisposition,
+		FuncName:       "disposeGood",
+		RequiredFields: []string{"good_id", "reason"},
+	},
+	{
+		Action:         GoodsActionReturn,
+		Name:           "退回生产商",
+		From:           []GoodsStatus{GoodsStatusRejected, GoodsStatusQuarantined},
+		To:             GoodsStatusReturnedToProducer,
+		CompanyType:    Port,
+		Stage:          StageDisposition,
+		FuncName:       "disposeGood",
+		RequiredFields: []string{"good_id", "reason"},
+	},
+	{
+		Action:         GoodsActionDestroy,
+		Name:           "销毁",
+		From:           []GoodsStatus{GoodsStatusRejected, GoodsStatusQuarantined},
+		To:             GoodsStatusDestroyed,
+		CompanyType:    Port,
+		Stage:          StageDisposition,
+		FuncName:       "disposeGood",
+		RequiredFields: []string{"good_id", "reason"},
+	},
+	{
+		Action:         GoodsActionDeliver,
+		Name:           "交付",
+		From:           []GoodsStatus{GoodsStatusInspected},
+		To:             GoodsStatusDelivered,
+		CompanyType:    Dealer,
+		Stage:          StageDelivery,
+		FuncName:       "deliverGood",
+		RequiredFields: []string{"good_id", "delivery_info", "recipient_name", "recipient_contact", "location"},
+	},
+}
+
+// GetGoodsTransition 根据操作获取状态转换定义，不存在时返回 nil
+func GetGoodsTransition(action string) *GoodsTransition {
+	for _, t := range GoodsLifecycle {
+		if t.Action == action {
+			return t
+		}
+	}
+	return nil
+}
+
+// AllowsStatus 货物处于该状态时是否可以执行此操作
+func (t *GoodsTransition) AllowsStatus(status GoodsStatus) bool {
+	if len(t.From) == 0 {
+		return status == 0
+	}
+	for _, from := range t.From {
+		if from == status {
+			return true
+		}
+	}
+	return false
+}
+
+// RequiresHandler 对处于该状态的货物执行此操作是否要求本公司已经手过该货物
+// 运输、验货、交付是货物在公司之间的交接，由符合类型的公司接手；
+// 验货不合格货物的处置和复检只能由已经手该货物的公司执行
+func (t *GoodsTransition) RequiresHandler(status GoodsStatus) bool {
+	return t.Stage == StageDisposition || status == GoodsStatusRejected || status == GoodsStatusQuarantined
+}
+
+// RequiresCarrier 对处于该状态的货物执行此操作是否要求本公司承运最后一段运输或被其指定为接续承运方
+// 追加运输段是运输商之间的交接，由当前承运方发起或指定，其他运输商不能接手（见 GoodStages.CanAppendLeg）
+func (t *GoodsTransition) RequiresCarrier(status GoodsStatus) bool {
+	return t.Action == GoodsActionShip && status == GoodsStatusShipped
+}
+
+// MissingField 返回请求中第一个未填写的必填字段，全部填写时返回空字符串
+// req 为请求结构体或其指针，按json名称匹配字段
+func (t *GoodsTransition) MissingField(req interface{}) string {
+	v := reflect.Indirect(reflect.ValueOf(req))
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+
+	values := make(map[string]reflect.Value, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		name := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		values[name] = v.Field(i)
+	}
+	for _, field := range t.RequiredFields {
+		value, ok := values[field]
+		if !ok || value.IsZero() {
+			return field
+		}
+	}
+	return ""
+}
+
+// CheckGoodsTransition 校验货物操作：当前状态、执行公司类型和必填字段，通过时返回状态转换定义
+// 新登记的货物 status 传 0，req 为 nil 时不校验必填字段
+func CheckGoodsTransition(action string, status GoodsStatus, companyType CompanyType, req interface{}) (*GoodsTransition, error) {
+	t := GetGoodsTransition(action)
+	if t == nil {
+		return nil, fmt.Errorf("未知的货物操作: %s", action)
+	}
+	if !t.AllowsStatus(status) {
+		return nil, fmt.Errorf("当前货物状态（%s）不允许执行%s操作", GoodsStatusMap[status], t.Name)
+	}
+	if t.CompanyType != companyType {
+		return nil, fmt.Errorf("只有%s才能执行%s操作", CompanyTypeMap[t.CompanyType], t.Name)
+	}
+	if req != nil {
+		if field := t.MissingField(req); field != "" {
+			return nil, fmt.Errorf("缺少必填字段: %s", field)
+		}
+	}
+	return t, nil
+}
+
+// StageFuncName 获取溯源环节对应的合约写方法
+func StageFuncName(stage string) string {
+	for _, t := range GoodsLifecycle {
+		if t.Stage == stage {
+			return t.FuncName
+		}
+	}
+	return ""
+}
+
+// AvailableGoodsTransitions 获取货物处于该状态时可执行的全部操作
+func AvailableGoodsTransitions(status GoodsStatus) []*GoodsTransition {
+	var available []*GoodsTransition
+	for _, t := range GoodsLifecycle {
+		if t.AllowsStatus(status) {
+			available = append(available, t)
+		}
+	}
+	return available
+}
@@ -65,12 +65,13 @@ func (r *GoodsRegisterRequest) UnmarshalJSON(data []byte) error {
 
 // GoodsShipRequest 货物运输请求
 type GoodsShipRequest struct {
-	GoodID         string    `json:"good_id" binding:"required"`
-	StartLocation  string    `json:"start_location" binding:"required"`
-	EndLocation    string    `json:"end_location" binding:"required"`
-	TransportInfo  string    `json:"transport_info" binding:"required"`
-	EndTime        time.Time `json:"end_time" binding:"required"`
-	TrackingNumber string    `json:"tracking_number"`
+	GoodID            string    `json:"good_id" binding:"required"`
+	StartLocation     string    `json:"start_location" binding:"required"`
+	EndLocation       string    `json:"end_location" binding:"required"`
+	TransportInfo     string    `json:"transport_info" binding:"required"`
+	EndTime           time.Time `json:"end_time" binding:"required"`
+	TrackingNumber    string    `json:"tracking_number"`
+	NextTransporterID int       `json:"next_transporter_id"` // 指定接续承运下一段运输的运输商公司ID，可选，未指定时只有本公司可以追加运输段
 }
 
 // GoodsInspectRequest 货物验货请求
@@ -79,10 +80,18 @@ type GoodsInspectRequest struct {
 	InspectionInfo string `json:"inspection_info" binding:"required"`
 	QualityScore   int    `json:"quality_score" binding:"required,min=0,max=100"`
 	PassStatus     bool   `json:"pass_status"`
+	RejectReason   string `json:"reject_reason"` // 不合格原因，pass_status 为 false 时必填
 	Location       string `json:"location" binding:"required"`
 	Notes          string `json:"notes"`
 }
 
+// GoodsDisposeRequest 验货不合格货物处置请求
+type GoodsDisposeRequest struct {
+	GoodID string `json:"good_id" binding:"required"`
+	Action string `json:"action" binding:"required"` // GoodsActionQuarantine/GoodsActionReturn/GoodsActionDestroy
+	Reason string `json:"reason" binding:"required"`
+}
+
 // GoodsDeliverRequest 货物交付请求
 type GoodsDeliverRequest struct {
 	GoodID           string `json:"good_id" binding:"required"`
@@ -93,6 +102,26 @@ type GoodsDeliverRequest struct {
 	Notes            string `json:"notes"`
 }
 
+// GoodsTransitionOption 货物当前可执行的操作
+type GoodsTransitionOption struct {
+	Action          string      `json:"action"`
+	Name            string      `json:"name"`
+	To              GoodsStatus `json:"to_status"`
+	ToText          string      `json:"to_status_text"`
+	CompanyType     CompanyType `json:"company_type"`
+	CompanyTypeText string      `json:"company_type_text"`
+	RequiredFields  []string    `json:"required_fields"`
+	Permitted       bool        `json:"permitted"` // 当前用户所在公司能否执行
+}
+
+// GoodsTransitionsResponse 货物可执行操作响应
+type GoodsTransitionsResponse struct {
+	GoodID      string                  `json:"good_id"`
+	Status      GoodsStatus             `json:"status"`
+	StatusText  string                  `json:"status_text"`
+	Transitions []GoodsTransitionOption `json:"transitions"`
+}
+
 // GoodsTraceRequest 溯源查询请求
 type GoodsTraceRequest struct {
 	GoodID string `form:"good_id" binding:"required"`
@@ -120,6 +149,9 @@ type GoodsBasicResponse struct {
 	CreatedAt        time.Time   `json:"created_at"`
 	UpdatedAt        time.Time   `json:"updated_at"`
 	BlockchainTxHash string      `json:"blockchain_tx_hash"`
+	ChainStatus      string      `json:"chain_status"` // 最新一笔交易的上链状态：pending/pending_confirmation/confirmed/reverted/failed
+	BlockNumber      int64       `json:"block_number"`
+	RevertReason     string      `json:"revert_reason,omitempty"`
 }
 
 // GoodsListResponse 货物列表响应
@@ -127,3 +159,29 @@ type GoodsListResponse struct {
 	Total int                  `json:"total"`
 	List  []GoodsBasicResponse `json:"list"`
 }
+
+// 批量操作单项结果
+const (
+	BulkItemSubmitted = "submitted" // 已保存并上链
+	BulkItemQueued    = "queued"    // 已保存，暂未上链，由后台调度器重试
+	BulkItemFailed    = "failed"    // 保存失败
+	BulkItemInvalid   = "invalid"   // 校验未通过，整批未执行
+)
+
+// BulkItemResult 批量操作中单条货物的处理结果
+type BulkItemResult struct {
+	Index       int    `json:"index"` // 在请求中的序号，从0开始
+	GoodID      string `json:"good_id"`
+	Status      string `json:"status"`
+	TxHash      string `json:"tx_hash,omitempty"`
+	ChainStatus string `json:"chain_status,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// BulkOperationResponse 批量操作响应
+type BulkOperationResponse struct {
+	Total     int              `json:"total"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Items     []BulkItemResult `json:"items"`
+}
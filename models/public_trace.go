@@ -0,0 +1,356 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"sea_trace_server_V2.0/utils"
+
+	"github.com/beego/beego/v2/client/orm"
+)
+
+// 公开溯源字段的可见性
+const (
+	VisibilityPublic = "public" // 原样公开
+	VisibilityMasked = "masked" // 脱敏后公开，仅适用于人名和电话
+	VisibilityHidden = "hidden" // 不公开
+)
+
+// 公开溯源字段类型，决定脱敏方式
+const (
+	TraceFieldText  = "text"
+	TraceFieldName  = "name"
+	TraceFieldPhone = "phone"
+)
+
+// PublicTraceField 公开溯源中可由公司设置可见性的字段
+type PublicTraceField struct {
+	Stage   string `json:"stage"`
+	Field   string `json:"field"`
+	Label   string `json:"label"`
+	Kind    string `json:"kind"`
+	Default string `json:"default"` // 公司未设置时的可见性
+}
+
+// Key 字段在可见性设置中的键，如 delivery.recipient_contact
+func (f PublicTraceField) Key() string {
+	return f.Stage + "." + f.Field
+}
+
+// PublicTraceFields 公开溯源字段，未列出的字段（内部编号、上链状态等）一律不公开
+// 各环节的字段由执行该环节的公司设置：生产为货物所属公司，运输、验货、处置、交付为经手公司
+var PublicTraceFields = []PublicTraceField{
+	{StageProduction, "description", "货物描述", TraceFieldText, VisibilityPublic},
+	{StageProduction, "location", "产地", TraceFieldText, VisibilityPublic},
+	{StageProduction, "produced_at", "生产时间", TraceFieldText, VisibilityPublic},
+	{StageProduction, "batch_info", "批次信息", TraceFieldText, VisibilityPublic},
+	{StageProduction, "quality_level", "质量等级", TraceFieldText, VisibilityPublic},
+	{StageProduction, "expiry_date", "保质期", TraceFieldText, VisibilityPublic},
+	{StageProduction, "operator_name", "登记人", TraceFieldName, VisibilityMasked},
+
+	{StageTransport, "transporter_name", "运输公司", TraceFieldText, VisibilityPublic},
+	{StageTransport, "start_location", "起运地", TraceFieldText, VisibilityPublic},
+	{StageTransport, "end_location", "目的地", TraceFieldText, VisibilityPublic},
+	{StageTransport, "start_time", "起运时间", TraceFieldText, VisibilityPublic},
+	{StageTransport, "end_time", "预计到达时间", TraceFieldText, VisibilityPublic},
+	{StageTransport, "actual_arrival_time", "实际到达时间", TraceFieldText, VisibilityPublic},
+	{StageTransport, "transport_info", "运输说明", TraceFieldText, VisibilityHidden},
+	{StageTransport, "tracking_number", "运单号", TraceFieldText, VisibilityHidden},
+	{StageTransport, "operator_name", "经办人", TraceFieldName, VisibilityMasked},
+
+	{StageInspection, "inspector_name", "验货单位", TraceFieldText, VisibilityPublic},
+	{StageInspection, "inspection_time", "验货时间", TraceFieldText, VisibilityPublic},
+	{StageInspection, "location", "验货地点", TraceFieldText, VisibilityPublic},
+	{StageInspection, "pass_status", "是否合格", TraceFieldText, VisibilityPublic},
+	{StageInspection, "quality_score", "质量评分", TraceFieldText, VisibilityPublic},
+	{StageInspection, "reject_reason", "不合格原因", TraceFieldText, VisibilityPublic},
+	{StageInspection, "inspection_info", "验货说明", TraceFieldText, VisibilityHidden},
+	{StageInspection, "notes", "备注", TraceFieldText, VisibilityHidden},
+	{StageInspection, "operator_name", "验货人", TraceFieldName, VisibilityMasked},
+
+	{StageDisposition, "company_name", "处置单位", TraceFieldText, VisibilityPublic},
+	{StageDisposition, "to_status_text", "处置结果", TraceFieldText, VisibilityPublic},
+	{StageDisposition, "created_at", "处置时间", TraceFieldText, VisibilityPublic},
+	{StageDisposition, "reason", "处置原因", TraceFieldText, VisibilityHidden},
+	{StageDisposition, "operator_name", "经办人", TraceFieldName, VisibilityMasked},
+
+	{StageDelivery, "dealer_name", "经销商", TraceFieldText, VisibilityPublic},
+	{StageDelivery, "delivery_time", "交付时间", TraceFieldText, VisibilityPublic},
+	{StageDelivery, "location", "交付地点", TraceFieldText, VisibilityPublic},
+	{StageDelivery, "delivery_info", "交付说明", TraceFieldText, VisibilityHidden},
+	{StageDelivery, "notes", "备注", TraceFieldText, VisibilityHidden},
+	{StageDelivery, "recipient_name", "收货人", TraceFieldName, VisibilityMasked},
+	{StageDelivery, "recipient_contact", "收货人电话", TraceFieldPhone, VisibilityMasked},
+	{StageDelivery, "operator_name", "经办人", TraceFieldName, VisibilityMasked},
+}
+
+// publicTraceFieldIndex 按键索引的公开溯源字段
+var publicTraceFieldIndex = func() map[string]PublicTraceField {
+	index := make(map[string]PublicTraceField, len(PublicTraceFields))
+	for _, field := range PublicTraceFields {
+		index[field.Key()] = field
+	}
+	return index
+}()
+
+// TraceVisibility 公司的公开溯源字段可见性设置，键为 PublicTraceField.Key()，未设置的字段使用默认值
+type TraceVisibility map[string]string
+
+// Of 字段的可见性
+func (v TraceVisibility) Of(field PublicTraceField) string {
+	if visibility, ok := v[field.Key()]; ok {
+		return visibility
+	}
+	return field.Default
+}
+
+// ValidateTraceVisibility 校验可见性设置：字段必须存在，脱敏只适用于人名和电话
+func ValidateTraceVisibility(settings TraceVisibility) error {
+	for key, visibility := range settings {
+		field, ok := publicTraceFieldIndex[key]
+		if !ok {
+			return fmt.Errorf("未知的溯源字段: %s", key)
+		}
+		switch visibility {
+		case VisibilityPublic, VisibilityHidden:
+		case VisibilityMasked:
+			if field.Kind == TraceFieldText {
+				return fmt.Errorf("%s 不支持脱敏显示", key)
+			}
+		default:
+			return fmt.Errorf("无效的可见性: %s=%s", key, visibility)
+		}
+	}
+	return nil
+}
+
+// CompanyTraceVisibility 公司的公开溯源字段可见性设置，只保存与默认值不同的字段
+type CompanyTraceVisibility struct {
+	Id        int       `orm:"pk;auto" json:"id"`
+	CompanyId int       `orm:"unique" json:"company_id"`
+	Settings  string    `orm:"type(text)" json:"settings"` // JSON对象：字段键 -> 可见性
+	UpdatedAt time.Time `orm:"auto_now" json:"updated_at"`
+}
+
+// TableName 表名
+func (c *CompanyTraceVisibility) TableName() string {
+	return "company_trace_visibility"
+}
+
+// GetTraceVisibilities 批量获取公司的可见性设置，未设置的公司不在结果中
+func GetTraceVisibilities(companyIDs []int) (map[int]TraceVisibility, error) {
+	result := make(map[int]TraceVisibility)
+	if len(companyIDs) == 0 {
+		return result, nil
+	}
+	o := orm.NewOrm()
+	var rows []*CompanyTraceVisibility
+	if _, err := o.QueryTable(new(CompanyTraceVisibility)).Filter("company_id__in", companyIDs).All(&rows); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		settings := TraceVisibility{}
+		if err := json.Unmarshal([]byte(row.Settings), &settings); err != nil {
+			return nil, err
+		}
+		result[row.CompanyId] = settings
+	}
+	return result, nil
+}
+
+// GetTraceVisibility 获取公司的可见性设置
+func GetTraceVisibility(companyID int) (TraceVisibility, error) {
+	all, err := GetTraceVisibilities([]int{companyID})
+	if err != nil {
+		return nil, err
+	}
+	if settings, ok := all[companyID]; ok {
+		return settings, nil
+	}
+	return TraceVisibility{}, nil
+}
+
+// SaveTraceVisibility 保存公司的可见性设置，与默认值相同的字段不保存
+func SaveTraceVisibility(companyID int, settings TraceVisibility) error {
+	if err := ValidateTraceVisibility(settings); err != nil {
+		return err
+	}
+	overrides := TraceVisibility{}
+	for key, visibility := range settings {
+		if publicTraceFieldIndex[key].Default != visibility {
+			overrides[key] = visibility
+		}
+	}
+	data, err := json.Marshal(overrides)
+	if err != nil {
+		return err
+	}
+
+	o := orm.NewOrm()
+	row := &CompanyTraceVisibility{CompanyId: companyID}
+	err = o.Read(row, "CompanyId")
+	row.Settings = string(data)
+	if err == orm.ErrNoRows {
+		_, err = o.Insert(row)
+	} else if err == nil {
+		_, err = o.Update(row, "Settings", "UpdatedAt")
+	}
+	return err
+}
+
+// PublicStage 单个环节的公开信息，只包含可见的字段
+type PublicStage map[string]interface{}
+
+// PublicTrace 公开溯源视图，供无需登录的溯源查询使用
+type PublicTrace struct {
+	GoodID         string        `json:"good_id"`
+	GoodName       string        `json:"good_name"`
+	BatchNumber    string        `json:"batch_number"`
+	Producer       string        `json:"producer"`
+	Status         GoodsStatus   `json:"status"`
+	StatusText     string        `json:"status_text"`
+	RegisteredAt   string        `json:"registered_at"`
+	BlockchainHash string        `json:"blockchain_hash"`
+	Production     PublicStage   `json:"production,omitempty"`
+	TransportLegs  []PublicStage `json:"transport_legs,omitempty"`
+	Inspections    []PublicStage `json:"inspections,omitempty"`
+	Dispositions   []PublicStage `json:"dispositions,omitempty"`
+	Delivery       PublicStage   `json:"delivery,omitempty"`
+}
+
+// TraceCompanyIDs 货物各环节经手公司，即需要读取可见性设置的公司
+func TraceCompanyIDs(good *Goods, stages *GoodStages) []int {
+	ids := []int{good.OwnerCompanyId}
+	for _, leg := range stages.TransportLegs {
+		ids = append(ids, leg.TransporterId)
+	}
+	for _, inspection := range stages.Inspections {
+		ids = append(ids, inspection.InspectorId)
+	}
+	for _, disposition := range stages.Dispositions {
+		ids = append(ids, disposition.CompanyId)
+	}
+	if stages.Delivery != nil {
+		ids = append(ids, stages.Delivery.DealerId)
+	}
+	return ids
+}
+
+// NewPublicTrace 按各环节经手公司的可见性设置生成公开溯源视图，visibility 中没有的公司使用默认设置
+func NewPublicTrace(good *Goods, producer string, stages *GoodStages, visibility map[int]TraceVisibility) *PublicTrace {
+	trace := &PublicTrace{
+		GoodID:         good.GoodId,
+		GoodName:       good.GoodName,
+		BatchNumber:    good.BatchNumber,
+		Producer:       producer,
+		Status:         good.Status,
+		StatusText:     GoodsStatusMap[good.Status],
+		RegisteredAt:   publicTime(good.CreatedAt),
+		BlockchainHash: good.BlockchainTxHash,
+	}
+
+	if p := stages.Production; p != nil {
+		trace.Production = publicStage(StageProduction, visibility[good.OwnerCompanyId], p.BlockchainTxHash, map[string]interface{}{
+			"description":   good.Description,
+			"location":      p.Location,
+			"produced_at":   publicTime(p.ProducedAt),
+			"batch_info":    p.BatchInfo,
+			"quality_level": p.QualityLevel,
+			"expiry_date":   publicDate(p.ExpiryDate),
+			"operator_name": p.OperatorName,
+		})
+	}
+	for _, leg := range stages.TransportLegs {
+		stage := publicStage(StageTransport, visibility[leg.TransporterId], leg.BlockchainTxHash, map[string]interface{}{
+			"transporter_name":    leg.TransporterName,
+			"start_location":      leg.StartLocation,
+			"end_location":        leg.EndLocation,
+			"start_time":          publicTime(leg.StartTime),
+			"end_time":            publicTime(leg.EndTime),
+			"actual_arrival_time": publicTime(leg.ActualArrivalTime),
+			"transport_info":      leg.TransportInfo,
+			"tracking_number":     leg.TrackingNumber,
+			"operator_name":       leg.OperatorName,
+		})
+		stage["leg_index"] = leg.LegIndex
+		trace.TransportLegs = append(trace.TransportLegs, stage)
+	}
+	for _, inspection := range stages.Inspections {
+		trace.Inspections = append(trace.Inspections, publicStage(StageInspection, visibility[inspection.InspectorId], inspection.BlockchainTxHash, map[string]interface{}{
+			"inspector_name":  inspection.InspectorName,
+			"inspection_time": publicTime(inspection.InspectionTime),
+			"location":        inspection.Location,
+			"pass_status":     inspection.PassStatus,
+			"quality_score":   inspection.QualityScore,
+			"reject_reason":   inspection.RejectReason,
+			"inspection_info": inspection.InspectionInfo,
+			"notes":           inspection.Notes,
+			"operator_name":   inspection.OperatorName,
+		}))
+	}
+	for _, disposition := range stages.Dispositions {
+		trace.Dispositions = append(trace.Dispositions, publicStage(StageDisposition, visibility[disposition.CompanyId], disposition.BlockchainTxHash, map[string]interface{}{
+			"company_name":   disposition.CompanyName,
+			"to_status_text": GoodsStatusMap[disposition.ToStatus],
+			"created_at":     publicTime(disposition.CreatedAt),
+			"reason":         disposition.Reason,
+			"operator_name":  disposition.OperatorName,
+		}))
+	}
+	if d := stages.Delivery; d != nil {
+		trace.Delivery = publicStage(StageDelivery, visibility[d.DealerId], d.BlockchainTxHash, map[string]interface{}{
+			"dealer_name":       d.DealerName,
+			"delivery_time":     publicTime(d.DeliveryTime),
+			"location":          d.Location,
+			"delivery_info":     d.DeliveryInfo,
+			"notes":             d.Notes,
+			"recipient_name":    d.RecipientName,
+			"recipient_contact": d.RecipientContact,
+			"operator_name":     d.OperatorName,
+		})
+	}
+	return trace
+}
+
+// publicStage 按可见性筛选环节字段，只输出 PublicTraceFields 中列出且可见的字段，另附上链交易哈希供核验
+func publicStage(stage string, visibility TraceVisibility, txHash string, values map[string]interface{}) PublicStage {
+	result := PublicStage{"blockchain_hash": txHash}
+	for _, field := range PublicTraceFields {
+		if field.Stage != stage {
+			continue
+		}
+		value, ok := values[field.Field]
+		if !ok {
+			continue
+		}
+		switch visibility.Of(field) {
+		case VisibilityPublic:
+			result[field.Field] = value
+		case VisibilityMasked:
+			text, _ := value.(string)
+			if field.Kind == TraceFieldPhone {
+				result[field.Field] = utils.MaskPhone(text)
+			} else {
+				result[field.Field] = utils.MaskName(text)
+			}
+		}
+	}
+	return result
+}
+
+// publicTime 格式化时间，未设置的时间为空字符串
+func publicTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// publicDate 格式化日期，未设置的日期为空字符串
+func publicDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,396 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+)
+
+// 账户类型，保存在 User.Role 中，决定账户所属范围（全局或公司）；具体权限由角色分配决定
+const (
+	RoleSuperAdmin   = "super_admin"
+	RoleCompanyAdmin = "company_admin"
+	RoleOperator     = "operator"
+)
+
+// 权限
+const (
+	// 全局权限，只授予系统角色，公司自定义角色不可使用
+	PermCompanyManage   = "company.manage"    // 管理公司及公司管理员
+	PermUserManage      = "user.manage"       // 管理全部用户
+	PermTransactionView = "transaction.view"  // 查看交易账本
+	PermReconcileManage = "reconcile.manage"  // 链上数据核对
+	PermBlockchainAdmin = "blockchain.manage" // 区块链账户管理
+	PermAuditViewAll    = "audit.view_all"    // 查看全部审计日志
+
+	// 公司权限
+	PermCompanyView    = "company.view"    // 查看本公司信息
+	PermCompanyEdit    = "company.edit"    // 修改本公司信息
+	PermOperatorView   = "operator.view"   // 查看本公司操作员
+	PermOperatorManage = "operator.manage" // 创建、删除、启停操作员
+	PermRoleManage     = "role.manage"     // 管理本公司自定义角色及角色分配
+	PermUserView       = "user.view"       // 查看用户及账户安全事件
+	PermUserUnlock     = "user.unlock"     // 解除账户锁定
+	PermStatsView      = "stats.view"      // 查看统计数据
+	PermAuditView      = "audit.view"      // 查看本公司审计日志
+	PermGoodsView      = "goods.view"      // 查看货物及溯源信息
+	PermGoodsRegister  = "goods.register"  // 登记生产
+	PermGoodsShip      = "goods.ship"      // 运输
+	PermGoodsInspect   = "goods.inspect"   // 验货
+	PermGoodsDispose   = "goods.dispose"   // 处置不合格货物
+	PermGoodsDeliver   = "goods.deliver"   // 交付
+)
+
+// Permission 权限定义
+type Permission struct {
+	Code   string `json:"code"`
+	Name   string `json:"name"`
+	Global bool   `json:"global"` // 全局权限不能授予公司自定义角色
+}
+
+// Permissions 全部权限
+var Permissions = []Permission{
+	{PermCompanyManage, "管理公司", true},
+	{PermUserManage, "管理用户", true},
+	{PermTransactionView, "查看交易账本", true},
+	{PermReconcileManage, "链上数据核对", true},
+	{PermBlockchainAdmin, "区块链账户管理", true},
+	{PermAuditViewAll, "查看全部审计日志", true},
+	{PermCompanyView, "查看公司信息", false},
+	{PermCompanyEdit, "修改公司信息", false},
+	{PermOperatorView, "查看操作员", false},
+	{PermOperatorManage, "管理操作员", false},
+	{PermRoleManage, "管理角色", false},
+	{PermUserView, "查看用户", false},
+	{PermUserUnlock, "解除账户锁定", false},
+	{PermStatsView, "查看统计数据", false},
+	{PermAuditView, "查看审计日志", false},
+	{PermGoodsView, "查看货物", false},
+	{PermGoodsRegister, "登记生产", false},
+	{PermGoodsShip, "运输", false},
+	{PermGoodsInspect, "验货", false},
+	{PermGoodsDispose, "处置不合格货物", false},
+	{PermGoodsDeliver, "交付", false},
+}
+
+// goodsPermissions 货物相关的全部权限
+var goodsPermissions = []string{
+	PermGoodsView, PermGoodsRegister, PermGoodsShip, PermGoodsInspect, PermGoodsDispose, PermGoodsDeliver,
+}
+
+// SystemRoles 系统角色，启动时同步到角色表，不可修改或删除
+// 未分配任何角色的用户按账户类型使用同名系统角色
+var SystemRoles = []*Role{
+	{
+		Code:        RoleSuperAdmin,
+		Name:        "超级管理员",
+		Permissions: allPermissionCodes(),
+	},
+	{
+		Code: RoleCompanyAdmin,
+		Name: "公司管理员",
+		Permissions: JoinPermissions(append([]string{
+			PermCompanyView, PermCompanyEdit, PermOperatorView, PermOperatorManage, PermRoleManage,
+			PermUserView, PermUserUnlock, PermStatsView, PermAuditView,
+		}, goodsPermissions...)),
+	},
+	{
+		Code:        RoleOperator,
+		Name:        "操作员",
+		Permissions: JoinPermissions(goodsPermissions),
+	},
+}
+
+// Role 角色，CompanyId 为0的是系统角色
+type Role struct {
+	Id          int       `orm:"pk;auto" json:"id"`
+	CompanyId   int       `orm:"default(0);index" json:"company_id"`
+	Code        string    `orm:"size(50)" json:"code"`
+	Name        string    `orm:"size(50)" json:"name"`
+	Description string    `orm:"size(255);null" json:"description"`
+	Permissions string    `orm:"type(text)" json:"-"` // 逗号分隔的权限列表
+	System      bool      `orm:"default(false)" json:"system"`
+	CreatedAt   time.Time `orm:"auto_now_add;type(datetime)" json:"created_at"`
+	UpdatedAt   time.Time `orm:"auto_now;type(datetime)" json:"updated_at"`
+}
+
+// TableName 表名
+func (r *Role) TableName() string {
+	return "roles"
+}
+
+// TableUnique 同一公司内角色编码唯一
+func (r *Role) TableUnique() [][]string {
+	return [][]string{{"CompanyId", "Code"}}
+}
+
+// PermissionList 角色的权限列表
+func (r *Role) PermissionList() []string {
+	return SplitPermissions(r.Permissions)
+}
+
+// UserRole 用户角色分配
+type UserRole struct {
+	Id        int       `orm:"pk;auto" json:"id"`
+	UserId    int       `orm:"index" json:"user_id"`
+	RoleId    int       `orm:"index" json:"role_id"`
+	CreatedAt time.Time `orm:"auto_now_add;type(datetime)" json:"created_at"`
+}
+
+// TableName 表名
+func (u *UserRole) TableName() string {
+	return "user_roles"
+}
+
+// TableUnique 同一角色不重复分配
+func (u *UserRole) TableUnique() [][]string {
+	return [][]string{{"UserId", "RoleId"}}
+}
+
+// PermissionSet 权限集合
+type PermissionSet map[string]bool
+
+// NewPermissionSet 由权限列表创建权限集合
+func NewPermissionSet(codes ...string) PermissionSet {
+	set := make(PermissionSet, len(codes))
+	for _, code := range codes {
+		set[code] = true
+	}
+	return set
+}
+
+// Has 是否拥有该权限
+func (s PermissionSet) Has(code string) bool {
+	return s[code]
+}
+
+// List 权限列表，按字母排序
+func (s PermissionSet) List() []string {
+	list := make([]string, 0, len(s))
+	for code := range s {
+		list = append(list, code)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// GetPermission 根据编码获取权限定义
+func GetPermission(code string) (Permission, bool) {
+	for _, p := range Permissions {
+		if p.Code == code {
+			return p, true
+		}
+	}
+	return Permission{}, false
+}
+
+// SplitPermissions 解析逗号分隔的权限列表
+func SplitPermissions(s string) []string {
+	var codes []string
+	for _, code := range strings.Split(s, ",") {
+		if code = strings.TrimSpace(code); code != "" {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
+
+// JoinPermissions 将权限列表保存为逗号分隔的字符串
+func JoinPermissions(codes []string) string {
+	return strings.Join(NewPermissionSet(codes...).List(), ",")
+}
+
+// allPermissionCodes 全部权限
+func allPermissionCodes() string {
+	codes := make([]string, 0, len(Permissions))
+	for _, p := range Permissions {
+		codes = append(codes, p.Code)
+	}
+	return JoinPermissions(codes)
+}
+
+// ValidateCompanyRolePermissions 校验公司自定义角色的权限：必须是已定义的公司权限，且不超出授予者自身的权限
+func ValidateCompanyRolePermissions(codes []string, grantor PermissionSet) error {
+	if len(codes) == 0 {
+		return errors.New("角色至少需要一项权限")
+	}
+	for _, code := range codes {
+		p, ok := GetPermission(code)
+		if !ok {
+			return errors.New("未知的权限: " + code)
+		}
+		if p.Global {
+			return errors.New("公司角色不能包含全局权限: " + code)
+		}
+		if !grantor.Has(code) {
+			return errors.New("不能授予自己没有的权限: " + code)
+		}
+	}
+	return nil
+}
+
+// ValidateRoleAssignmentTarget 校验能否修改目标用户的角色分配
+// 公司管理员账户的角色只能由超级管理员修改；目标用户现有的权限必须都在授予者的权限之内，
+// 否则低权限账户可以通过替换角色降低更高权限用户的权限
+func ValidateRoleAssignmentTarget(target *User, current PermissionSet, grantor PermissionSet, grantorIsSuperAdmin bool) error {
+	if grantorIsSuperAdmin {
+		return nil
+	}
+	if target.Role == RoleCompanyAdmin {
+		return errors.New("公司管理员账户的角色只能由超级管理员修改")
+	}
+	for code := range current {
+		if !grantor.Has(code) {
+			return errors.New("不能修改拥有自己没有的权限的用户: " + code)
+		}
+	}
+	return nil
+}
+
+// EnsureSystemRoles 将系统角色同步到角色表，权限以代码定义为准
+func EnsureSystemRoles() error {
+	o := GetOrm()
+	for _, def := range SystemRoles {
+		role := &Role{}
+		err := o.QueryTable(new(Role)).Filter("company_id", 0).Filter("code", def.Code).One(role)
+		if err == orm.ErrNoRows {
+			role = &Role{Code: def.Code, Name: def.Name, Permissions: def.Permissions, System: true}
+			if _, err := o.Insert(role); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if role.Permissions != def.Permissions || role.Name != def.Name || !role.System {
+			role.Name, role.Permissions, role.System = def.Name, def.Permissions, true
+			if _, err := o.Update(role, "Name", "Permissions", "System", "UpdatedAt"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SystemRolePermissions 系统角色的权限，未知角色返回空集合
+func SystemRolePermissions(code string) PermissionSet {
+	for _, def := range SystemRoles {
+		if def.Code == code {
+			return NewPermissionSet(def.PermissionList()...)
+		}
+	}
+	return PermissionSet{}
+}
+
+// GetUserPermissions 获取用户的有效权限：已分配角色的权限并集，未分配角色时使用账户类型对应的系统角色
+func GetUserPermissions(user *User) (PermissionSet, error) {
+	o := GetOrm()
+	var rows []orm.Params
+	_, err := o.Raw("SELECT r.permissions FROM roles r INNER JOIN user_roles ur ON ur.role_id = r.id WHERE ur.user_id = ?", user.Id).
+		Values(&rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return SystemRolePermissions(user.Role), nil
+	}
+
+	set := PermissionSet{}
+	for _, row := range rows {
+		value, _ := row["permissions"].(string)
+		for _, code := range SplitPermissions(value) {
+			set[code] = true
+		}
+	}
+	return set, nil
+}
+
+// GetRoleByID 根据ID获取角色
+func GetRoleByID(id int) (*Role, error) {
+	o := GetOrm()
+	role := &Role{Id: id}
+	if err := o.Read(role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// GetAssignableRoles 获取公司可分配的角色：公司自定义角色以及除超级管理员外的系统角色
+func GetAssignableRoles(companyID int) ([]*Role, error) {
+	o := GetOrm()
+	cond := orm.NewCondition().
+		AndCond(orm.NewCondition().And("company_id", 0).AndNot("code", RoleSuperAdmin))
+	if companyID > 0 {
+		cond = cond.OrCond(orm.NewCondition().And("company_id", companyID))
+	}
+	var roles []*Role
+	_, err := o.QueryTable(new(Role)).SetCond(cond).OrderBy("company_id", "id").All(&roles)
+	return roles, err
+}
+
+// CreateRole 创建角色
+func CreateRole(role *Role) error {
+	o := GetOrm()
+	exist := o.QueryTable(new(Role)).Filter("company_id", role.CompanyId).Filter("code", role.Code).Exist()
+	if exist {
+		return errors.New("角色编码已存在")
+	}
+	_, err := o.Insert(role)
+	return err
+}
+
+// UpdateRole 更新角色名称、说明和权限
+func UpdateRole(role *Role) error {
+	o := GetOrm()
+	_, err := o.Update(role, "Name", "Description", "Permissions", "UpdatedAt")
+	return err
+}
+
+// DeleteRole 删除角色及其分配
+func DeleteRole(id int) error {
+	o := GetOrm()
+	return o.DoTx(func(ctx context.Context, txOrm orm.TxOrmer) error {
+		if _, err := txOrm.QueryTable(new(UserRole)).Filter("role_id", id).Delete(); err != nil {
+			return err
+		}
+		_, err := txOrm.Delete(&Role{Id: id})
+		return err
+	})
+}
+
+// GetUserRoles 获取用户已分配的角色
+func GetUserRoles(userID int) ([]*Role, error) {
+	o := GetOrm()
+	var roles []*Role
+	_, err := o.Raw("SELECT r.* FROM roles r INNER JOIN user_roles ur ON ur.role_id = r.id WHERE ur.user_id = ? ORDER BY r.id", userID).
+		QueryRows(&roles)
+	return roles, err
+}
+
+// SetUserRoles 替换用户的角色分配，roleIDs 为空时恢复为账户类型对应的系统角色
+func SetUserRoles(userID int, roleIDs []int) error {
+	o := GetOrm()
+	return o.DoTx(func(ctx context.Context, txOrm orm.TxOrmer) error {
+		if _, err := txOrm.QueryTable(new(UserRole)).Filter("user_id", userID).Delete(); err != nil {
+			return err
+		}
+		for _, roleID := range roleIDs {
+			if _, err := txOrm.Insert(&UserRole{UserId: userID, RoleId: roleID}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// DeleteUserRoles 删除用户的全部角色分配，删除用户时调用
+func DeleteUserRoles(userID int) error {
+	o := GetOrm()
+	_, err := o.QueryTable(new(UserRole)).Filter("user_id", userID).Delete()
+	return err
+}
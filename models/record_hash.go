@@ -0,0 +1,133 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"sea_trace_server_V2.0/certverify"
+)
+
+// RecordHashVersion 环节记录哈希的计算规则版本，规则变化时递增
+const RecordHashVersion = 1
+
+// ZeroRecordHash 未锚定的环节记录哈希，写入时未附带记录哈希（如旧版本服务端排队的发件箱记录）的环节在合约中为该值
+const ZeroRecordHash = "0x0000000000000000000000000000000000000000000000000000000000000000"
+
+// StageRecordHash 计算环节记录的哈希，写入合约后用于发现数据库记录被修改
+// 哈希为 {"stage", "version", "fields"} 的规范化JSON的SHA-256，fields 为记录的全部业务字段，
+// 时间取Unix秒（未设置为0）；数据库编号、上链状态和记录创建/更新时间不参与计算
+// 生产环节包含货物基本信息，good 只在计算生产环节时使用
+func StageRecordHash(good *Goods, record interface{}) (string, error) {
+	stage, fields, err := stageRecordFields(good, record)
+	if err != nil {
+		return "", err
+	}
+	payload, err := certverify.Canonical(map[string]interface{}{
+		"stage":   stage,
+		"version": RecordHashVersion,
+		"fields":  fields,
+	})
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(payload)
+	return "0x" + hex.EncodeToString(digest[:]), nil
+}
+
+// IsZeroRecordHash 哈希是否为空或全零，即该记录未锚定
+func IsZeroRecordHash(hash string) bool {
+	return strings.Trim(strings.TrimPrefix(strings.ToLower(hash), "0x"), "0") == ""
+}
+
+// recordTime 参与哈希计算的时间，未设置的时间为0
+func recordTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// stageRecordFields 环节记录参与哈希计算的字段
+func stageRecordFields(good *Goods, record interface{}) (string, map[string]interface{}, error) {
+	switch r := record.(type) {
+	case *GoodsProduction:
+		if good == nil {
+			return "", nil, fmt.Errorf("计算生产环节哈希需要货物信息 [goodID=%s]", r.GoodId)
+		}
+		return StageProduction, map[string]interface{}{
+			"good_id":          r.GoodId,
+			"good_name":        good.GoodName,
+			"owner_company_id": good.OwnerCompanyId,
+			"description":      good.Description,
+			"batch_number":     good.BatchNumber,
+			"location":         r.Location,
+			"batch_info":       r.BatchInfo,
+			"quality_level":    r.QualityLevel,
+			"produced_at":      recordTime(r.ProducedAt),
+			"expiry_date":      recordTime(r.ExpiryDate),
+			"operator_id":      r.OperatorId,
+			"operator_name":    r.OperatorName,
+		}, nil
+	case *GoodsTransport:
+		// 实际到达时间在运输完成后补填，不参与计算
+		return StageTransport, map[string]interface{}{
+			"good_id":          r.GoodId,
+			"leg_index":        r.LegIndex,
+			"transporter_id":   r.TransporterId,
+			"transporter_name": r.TransporterName,
+			"operator_id":      r.OperatorId,
+			"operator_name":    r.OperatorName,
+			"start_location":   r.StartLocation,
+			"end_location":     r.EndLocation,
+			"transport_info":   r.TransportInfo,
+			"start_time":       recordTime(r.StartTime),
+			"end_time":         recordTime(r.EndTime),
+			"tracking_number":  r.TrackingNumber,
+		}, nil
+	case *GoodsInspection:
+		return StageInspection, map[string]interface{}{
+			"good_id":         r.GoodId,
+			"inspector_id":    r.InspectorId,
+			"inspector_name":  r.InspectorName,
+			"operator_id":     r.OperatorId,
+			"operator_name":   r.OperatorName,
+			"inspection_info": r.InspectionInfo,
+			"quality_score":   r.QualityScore,
+			"pass_status":     r.PassStatus,
+			"reject_reason":   r.RejectReason,
+			"inspection_time": recordTime(r.InspectionTime),
+			"location":        r.Location,
+			"notes":           r.Notes,
+		}, nil
+	case *GoodsDisposition:
+		return StageDisposition, map[string]interface{}{
+			"good_id":       r.GoodId,
+			"from_status":   r.FromStatus,
+			"to_status":     r.ToStatus,
+			"reason":        r.Reason,
+			"company_id":    r.CompanyId,
+			"company_name":  r.CompanyName,
+			"operator_id":   r.OperatorId,
+			"operator_name": r.OperatorName,
+			"created_at":    recordTime(r.CreatedAt),
+		}, nil
+	case *GoodsDelivery:
+		return StageDelivery, map[string]interface{}{
+			"good_id":           r.GoodId,
+			"dealer_id":         r.DealerId,
+			"dealer_name":       r.DealerName,
+			"operator_id":       r.OperatorId,
+			"operator_name":     r.OperatorName,
+			"delivery_info":     r.DeliveryInfo,
+			"recipient_name":    r.RecipientName,
+			"recipient_contact": r.RecipientContact,
+			"delivery_time":     recordTime(r.DeliveryTime),
+			"location":          r.Location,
+			"notes":             r.Notes,
+		}, nil
+	}
+	return "", nil, fmt.Errorf("不支持的环节记录类型 %T", record)
+}
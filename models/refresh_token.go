@@ -0,0 +1,105 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+)
+
+// ErrRefreshTokenReused 刷新令牌已被使用过，可能已泄露
+var ErrRefreshTokenReused = errors.New("刷新令牌已失效")
+
+// RefreshToken 刷新令牌，只保存令牌哈希
+// 每次刷新都会签发新令牌并吊销旧令牌，同一次登录签发的令牌属于同一会话
+type RefreshToken struct {
+	Id        int       `orm:"pk;auto" json:"id"`
+	UserId    int       `orm:"index" json:"user_id"`
+	SessionId string    `orm:"size(36);index" json:"session_id"`
+	TokenHash string    `orm:"size(64);unique" json:"-"`
+	ExpiresAt time.Time `orm:"type(datetime)" json:"expires_at"`
+	RevokedAt time.Time `orm:"type(datetime);null" json:"revoked_at"`
+	CreatedAt time.Time `orm:"auto_now_add;type(datetime)" json:"created_at"`
+}
+
+// TableName 表名
+func (t *RefreshToken) TableName() string {
+	return "refresh_tokens"
+}
+
+// Revoked 是否已吊销
+func (t *RefreshToken) Revoked() bool {
+	return !t.RevokedAt.IsZero()
+}
+
+// CreateRefreshToken 保存刷新令牌
+func CreateRefreshToken(token *RefreshToken) error {
+	o := GetOrm()
+	_, err := o.Insert(token)
+	return err
+}
+
+// GetRefreshTokenByHash 根据令牌哈希获取刷新令牌
+func GetRefreshTokenByHash(hash string) (*RefreshToken, error) {
+	o := GetOrm()
+	token := &RefreshToken{}
+	err := o.QueryTable(new(RefreshToken)).Filter("token_hash", hash).One(token)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// RotateRefreshToken 吊销旧令牌并保存新令牌
+// 旧令牌已被并发使用时返回 ErrRefreshTokenReused，不保存新令牌
+func RotateRefreshToken(old *RefreshToken, next *RefreshToken) error {
+	o := GetOrm()
+	return o.DoTx(func(ctx context.Context, txOrm orm.TxOrmer) error {
+		num, err := txOrm.QueryTable(new(RefreshToken)).
+			Filter("id", old.Id).
+			Filter("revoked_at__isnull", true).
+			Update(orm.Params{"revoked_at": time.Now()})
+		if err != nil {
+			return err
+		}
+		if num == 0 {
+			return ErrRefreshTokenReused
+		}
+		_, err = txOrm.Insert(next)
+		return err
+	})
+}
+
+// RevokeRefreshSession 吊销会话中的全部刷新令牌
+func RevokeRefreshSession(sessionID string) error {
+	o := GetOrm()
+	_, err := o.QueryTable(new(RefreshToken)).
+		Filter("session_id", sessionID).
+		Filter("revoked_at__isnull", true).
+		Update(orm.Params{"revoked_at": time.Now()})
+	return err
+}
+
+// RevokeUserRefreshTokens 吊销用户的全部刷新令牌
+func RevokeUserRefreshTokens(userID int) error {
+	o := GetOrm()
+	_, err := o.QueryTable(new(RefreshToken)).
+		Filter("user_id", userID).
+		Filter("revoked_at__isnull", true).
+		Update(orm.Params{"revoked_at": time.Now()})
+	return err
+}
+
+// IsRefreshSessionActive 会话中是否还有未吊销且未过期的刷新令牌
+func IsRefreshSessionActive(sessionID string) bool {
+	if sessionID == "" {
+		return false
+	}
+	o := GetOrm()
+	return o.QueryTable(new(RefreshToken)).
+		Filter("session_id", sessionID).
+		Filter("revoked_at__isnull", true).
+		Filter("expires_at__gt", time.Now()).
+		Exist()
+}
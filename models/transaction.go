@@ -1,18 +1,60 @@
 package models
 
 import (
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
 	"github.com/beego/beego/v2/core/logs"
 )
 
+// 交易状态
+const (
+	TransactionStatusFailed  = 0 // 失败
+	TransactionStatusSuccess = 1 // 成功
+)
+
+// TransactionTypeMap 合约方法与交易类型的对应关系
+var TransactionTypeMap = map[string]string{
+	"registerCompany":  "注册公司",
+	"registerGood":     "注册货物",
+	"shipGood":         "运输",
+	"inspectGood":      "验货",
+	"deliverGood":      "交付",
+	"disposeGood":      "处置",
+	"registerOperator": "登记操作员",
+	"removeOperator":   "移除操作员",
+}
+
+// companyTransactionFuncs 公司和操作员相关的合约方法，其参数中不含货物ID
+var companyTransactionFuncs = map[string]bool{
+	"registerCompany":  true,
+	"registerOperator": true,
+	"removeOperator":   true,
+}
+
+// IsGoodsTransaction 合约方法是否为货物相关操作，货物相关方法的第一个参数为货物ID
+func IsGoodsTransaction(funcName string) bool {
+	_, ok := TransactionTypeMap[funcName]
+	return ok && !companyTransactionFuncs[funcName]
+}
+
 // Transaction 交易记录模型
+// 记录服务端推送到区块链的每一笔写交易，作为本地账本供审计使用
 type Transaction struct {
-	ID               int    `orm:"pk;auto" json:"id"`
-	BlockchainTxHash string `orm:"size(66);unique" json:"blockchain_tx_hash"`
-	Type             string `orm:"size(50)" json:"type"`           // 交易类型：注册公司、注册货物、运输、验货、交付等
-	Content          string `orm:"type(text)" json:"content"`      // 交易内容JSON
-	Status           int    `orm:"default(1)" json:"status"`       // 交易状态: 0=失败, 1=成功
-	BlockNumber      int64  `orm:"default(0)" json:"block_number"` // 区块高度
-	CreatedAt        string `orm:"size(19)" json:"created_at"`     // 交易时间
+	ID               int       `orm:"pk;auto" json:"id"`
+	BlockchainTxHash string    `orm:"size(66);null;index" json:"blockchain_tx_hash"` // 交易未被节点接受时为空
+	Type             string    `orm:"size(50)" json:"type"`                          // 交易类型：注册公司、注册货物、运输、验货、交付等
+	FuncName         string    `orm:"size(50);index" json:"func_name"`               // 合约方法名
+	Params           string    `orm:"type(text)" json:"params"`                      // 合约参数JSON
+	GoodId           string    `orm:"size(64);null;index" json:"good_id"`            // 关联货物ID（货物相关交易）
+	SenderAddress    string    `orm:"size(42);index" json:"sender_address"`          // 发送方地址
+	Content          string    `orm:"type(text);null" json:"content"`                // 节点返回的回执JSON
+	Status           int       `orm:"default(1)" json:"status"`                      // 交易状态: 0=失败, 1=成功
+	ReceiptStatus    string    `orm:"size(20);null" json:"receipt_status"`           // 回执状态码，0x0表示成功
+	ErrorMessage     string    `orm:"type(text);null" json:"error_message"`          // 失败原因
+	BlockNumber      int64     `orm:"default(0)" json:"block_number"`                // 区块高度
+	GasUsed          int64     `orm:"default(0)" json:"gas_used"`                    // 消耗的gas
+	CreatedAt        time.Time `orm:"auto_now_add;index" json:"created_at"`          // 交易时间
 }
 
 // TableName 指定表名
@@ -20,27 +62,53 @@ func (t *Transaction) TableName() string {
 	return "transactions"
 }
 
+// TransactionFilter 交易记录查询条件
+type TransactionFilter struct {
+	FuncName      string
+	GoodId        string
+	SenderAddress string
+	Status        int // -1表示全部
+	StartTime     time.Time
+	EndTime       time.Time
+}
+
 // SaveTransaction 保存交易记录
-func SaveTransaction(txHash, txType, content string, blockNumber int64) (*Transaction, error) {
-	tx := &Transaction{
-		BlockchainTxHash: txHash,
-		Type:             txType,
-		Content:          content,
-		Status:           1,
-		BlockNumber:      blockNumber,
-		CreatedAt:        "2025-05-14 12:17:23", // 使用当前时间
+func SaveTransaction(tx *Transaction) error {
+	if tx.Type == "" {
+		tx.Type = TransactionTypeMap[tx.FuncName]
 	}
 
 	o := GetOrm()
 	_, err := o.Insert(tx)
 	if err != nil {
-		logs.Error("保存交易记录失败 [txHash=%s, type=%s, error=%v, time=%s]",
-			txHash, txType, err, "2025-05-14 12:17:23")
+		logs.Error("保存交易记录失败 [txHash=%s, func=%s, error=%v]",
+			tx.BlockchainTxHash, tx.FuncName, err)
 	} else {
-		logs.Info("成功保存交易记录 [txHash=%s, type=%s, blockNumber=%d, time=%s]",
-			txHash, txType, blockNumber, "2025-05-14 12:17:23")
+		logs.Info("成功保存交易记录 [txHash=%s, func=%s, status=%d, blockNumber=%d]",
+			tx.BlockchainTxHash, tx.FuncName, tx.Status, tx.BlockNumber)
 	}
-	return tx, err
+	return err
+}
+
+// UpdateTransactionReceipt 根据交易回执更新交易记录
+func UpdateTransactionReceipt(txHash string, receiptStatus string, blockNumber int64, gasUsed int64, errorMessage string) error {
+	params := orm.Params{
+		"receipt_status": receiptStatus,
+		"block_number":   blockNumber,
+		"gas_used":       gasUsed,
+		"status":         TransactionStatusSuccess,
+	}
+	if receiptStatus != "0x0" {
+		params["status"] = TransactionStatusFailed
+		params["error_message"] = errorMessage
+	}
+
+	o := GetOrm()
+	_, err := o.QueryTable(new(Transaction)).Filter("blockchain_tx_hash", txHash).Update(params)
+	if err != nil {
+		logs.Error("更新交易回执失败 [txHash=%s, error=%v]", txHash, err)
+	}
+	return err
 }
 
 // CountTransactions 统计系统中的交易总数
@@ -48,7 +116,7 @@ func CountTransactions() (int64, error) {
 	o := GetOrm()
 	count, err := o.QueryTable(new(Transaction)).Count()
 	if err != nil {
-		logs.Error("统计交易总数失败: %v [time=%s]", err, "2025-05-14 12:17:23")
+		logs.Error("统计交易总数失败: %v", err)
 	}
 	return count, err
 }
@@ -65,19 +133,58 @@ func GetTransactionList(limit int, offset int) ([]*Transaction, error) {
 
 	_, err := query.All(&transactions)
 	if err != nil {
-		logs.Error("获取交易记录列表失败: %v [time=%s]", err, "2025-05-14 12:17:23")
+		logs.Error("获取交易记录列表失败: %v", err)
 	}
 	return transactions, err
 }
 
+// QueryTransactions 按条件分页查询交易记录
+func QueryTransactions(filter TransactionFilter, page, pageSize int) ([]*Transaction, int64, error) {
+	o := GetOrm()
+	query := o.QueryTable(new(Transaction))
+
+	if filter.FuncName != "" {
+		query = query.Filter("func_name", filter.FuncName)
+	}
+	if filter.GoodId != "" {
+		query = query.Filter("good_id", filter.GoodId)
+	}
+	if filter.SenderAddress != "" {
+		query = query.Filter("sender_address__iexact", filter.SenderAddress)
+	}
+	if filter.Status >= 0 {
+		query = query.Filter("status", filter.Status)
+	}
+	if !filter.StartTime.IsZero() {
+		query = query.Filter("created_at__gte", filter.StartTime)
+	}
+	if !filter.EndTime.IsZero() {
+		query = query.Filter("created_at__lt", filter.EndTime)
+	}
+
+	total, err := query.Count()
+	if err != nil {
+		logs.Error("统计交易记录失败: %v", err)
+		return nil, 0, err
+	}
+
+	var transactions []*Transaction
+	offset := (page - 1) * pageSize
+	_, err = query.OrderBy("-id").Limit(pageSize, offset).All(&transactions)
+	if err != nil {
+		logs.Error("查询交易记录失败: %v", err)
+		return nil, 0, err
+	}
+	return transactions, total, nil
+}
+
 // GetTransactionByHash 根据交易哈希获取交易记录
 func GetTransactionByHash(txHash string) (*Transaction, error) {
 	o := GetOrm()
 	tx := &Transaction{}
-	err := o.QueryTable(new(Transaction)).Filter("blockchain_tx_hash", txHash).One(tx)
+	err := o.QueryTable(new(Transaction)).Filter("blockchain_tx_hash", txHash).OrderBy("-id").One(tx)
 	if err != nil {
-		logs.Error("获取交易记录失败 [txHash=%s, error=%v, time=%s]",
-			txHash, err, "2025-05-14 12:17:23")
+		logs.Error("获取交易记录失败 [txHash=%s, error=%v]", txHash, err)
 	}
 	return tx, err
 }
@@ -11,6 +11,12 @@ import (
 	"github.com/beego/beego/v2/core/logs"
 )
 
+// 区块链用户类型，对应WeBASE-Front的用户类型
+const (
+	BlockchainUserTypeLocal    = 0 // 本地用户，私钥保存在WeBASE-Front
+	BlockchainUserTypeExternal = 2 // 外部用户，私钥由WeBASE-Sign托管，按 signUserId 签名
+)
+
 // User 用户模型
 // User 用户模型
 type User struct {
@@ -29,8 +35,14 @@ type User struct {
 	LastLogin      time.Time `orm:"null" json:"last_login"`
 	BlockchainAddr string    `orm:"size(42);null" json:"blockchain_addr"` // 区块链钱包地址
 	SignUserId     string    `orm:"size(64);null" json:"sign_user_id"`    // WeBASE-Sign用户ID
-	BlockchainType int       `orm:"default(0)" json:"blockchain_type"`    // 区块链用户类型
+	BlockchainType int       `orm:"default(0)" json:"blockchain_type"`    // 区块链用户类型：BlockchainUserTypeLocal/BlockchainUserTypeExternal
+	TokenVersion   int       `orm:"default(0)" json:"-"`                  // 令牌版本，递增后已签发的访问令牌全部失效
+	FailedLogins   int       `orm:"default(0)" json:"failed_logins"`      // 连续登录失败次数，登录成功或解除锁定后清零
+	LockedUntil    time.Time `orm:"null" json:"locked_until"`             // 账户锁定截止时间
 	CompanyName    string    `orm:"-" json:"company_name"`                // 非数据库字段，仅用于API返回
+
+	// 首次登录须修改初始密码，修改前只能访问修改密码、个人信息和退出登录接口
+	MustChangePassword bool `orm:"default(false)" json:"must_change_password"`
 }
 
 // GetUserList 获取用户列表，支持分页、关键词搜索和角色筛选
@@ -134,7 +146,7 @@ func fillCompanyNames(users []*User) error {
 // CountAdmins 统计超级管理员数量
 func CountAdmins() (int64, error) {
 	o := orm.NewOrm()
-	return o.QueryTable(new(User)).Filter("role", "super_admin").Count()
+	return o.QueryTable(new(User)).Filter("role", RoleSuperAdmin).Count()
 }
 
 // TableName 指定表名
@@ -305,25 +317,96 @@ func UpdateUser(uid string, userUpdate *User) (*User, error) {
 	return existingUser, err
 }
 
-// DeleteUser 根据ID删除用户 (字符串版本)
-func DeleteUser(uid string) error {
-	id, err := strconv.Atoi(uid)
+// UpdateUserStatus 更新用户状态，禁用时递增令牌版本并吊销刷新令牌，使已登录的会话立即失效
+func UpdateUserStatus(id int, status int) error {
+	params := orm.Params{"status": status, "updated_at": time.Now()}
+	if status != 1 {
+		params["token_version"] = orm.ColValue(orm.ColAdd, 1)
+	}
+
+	o := orm.NewOrm()
+	num, err := o.QueryTable(new(User)).Filter("id", id).Update(params)
 	if err != nil {
 		return err
 	}
+	if num == 0 {
+		return errors.New("用户不存在")
+	}
+	if status != 1 {
+		return RevokeUserRefreshTokens(id)
+	}
+	return nil
+}
 
+// IsLocked 账户当前是否处于锁定状态
+func (u *User) IsLocked() bool {
+	return u.LockedUntil.After(time.Now())
+}
+
+// UpdateUserLoginFailures 保存连续登录失败次数和锁定截止时间
+func UpdateUserLoginFailures(id int, failures int, lockedUntil time.Time) error {
+	params := orm.Params{"failed_logins": failures}
+	if !lockedUntil.IsZero() {
+		params["locked_until"] = lockedUntil
+	}
 	o := orm.NewOrm()
-	_, err = o.Delete(&User{Id: id})
+	_, err := o.QueryTable(new(User)).Filter("id", id).Update(params)
 	return err
 }
 
-// DeleteUserByID 根据ID删除用户 (int版本)
-func DeleteUserByID(id int) error {
+// UnlockUser 解除账户锁定并清零登录失败次数
+func UnlockUser(id int) error {
 	o := orm.NewOrm()
-	_, err := o.Delete(&User{Id: id})
+	_, err := o.QueryTable(new(User)).Filter("id", id).Update(orm.Params{
+		"failed_logins": 0,
+		"locked_until":  nil,
+	})
 	return err
 }
 
+// RevokeUserTokens 递增令牌版本并吊销刷新令牌，使用户的全部会话失效
+func RevokeUserTokens(id int) error {
+	o := orm.NewOrm()
+	_, err := o.QueryTable(new(User)).Filter("id", id).Update(orm.Params{
+		"token_version": orm.ColValue(orm.ColAdd, 1),
+	})
+	if err != nil {
+		return err
+	}
+	return RevokeUserRefreshTokens(id)
+}
+
+// ChangeUserPassword 保存新密码哈希并清除修改初始密码的要求，同时使用户的全部会话失效
+func ChangeUserPassword(id int, hashedPassword string) error {
+	o := orm.NewOrm()
+	_, err := o.QueryTable(new(User)).Filter("id", id).Update(orm.Params{
+		"password":             hashedPassword,
+		"must_change_password": false,
+	})
+	if err != nil {
+		return err
+	}
+	return RevokeUserTokens(id)
+}
+
+// DeleteUser 根据ID删除用户 (字符串版本)
+func DeleteUser(uid string) error {
+	id, err := strconv.Atoi(uid)
+	if err != nil {
+		return err
+	}
+	return DeleteUserByID(id)
+}
+
+// DeleteUserByID 根据ID删除用户 (int版本)，同时删除角色分配
+func DeleteUserByID(id int) error {
+	o := orm.NewOrm()
+	if _, err := o.Delete(&User{Id: id}); err != nil {
+		return err
+	}
+	return DeleteUserRoles(id)
+}
+
 // Login 验证用户登录 (布尔版本)
 func Login(username, password string) bool {
 	o := orm.NewOrm()
@@ -422,7 +505,7 @@ func GetCompanyAdmins(companyID int) ([]*User, error) {
 	var admins []*User
 	_, err := o.QueryTable(new(User)).
 		Filter("company_id", companyID).
-		Filter("role", "company_admin").
+		Filter("role", RoleCompanyAdmin).
 		All(&admins)
 	if err != nil {
 		logs.Error("获取公司管理员列表失败 [companyId=%d, error=%v]", companyID, err)
@@ -436,7 +519,7 @@ func GetCompanyOperatorsNoPage(companyID int) ([]*User, error) {
 	var operators []*User
 	_, err := o.QueryTable(new(User)).
 		Filter("company_id", companyID).
-		Filter("role", "operator").
+		Filter("role", RoleOperator).
 		All(&operators)
 	if err != nil {
 		logs.Error("获取公司操作员列表失败 [companyId=%d, error=%v]", companyID, err)
@@ -449,3 +532,65 @@ func CountUsers() (int64, error) {
 	o := orm.NewOrm()
 	return o.QueryTable(new(User)).Count()
 }
+
+// UpdateUserBlockchainIdentity 保存用户的区块链地址、WeBASE-Sign用户ID和区块链用户类型
+func UpdateUserBlockchainIdentity(user *User) error {
+	o := orm.NewOrm()
+	_, err := o.Update(user, "BlockchainAddr", "SignUserId", "BlockchainType", "UpdatedAt")
+	return err
+}
+
+// GetOperatorsWithoutBlockchainIdentity 获取尚未配置区块链身份的操作员
+func GetOperatorsWithoutBlockchainIdentity() ([]*User, error) {
+	var users []*User
+	o := orm.NewOrm()
+	cond := orm.NewCondition().Or("blockchain_addr__isnull", true).Or("blockchain_addr", "")
+	_, err := o.QueryTable(new(User)).Filter("role", RoleOperator).SetCond(cond).All(&users)
+	return users, err
+}
+
+// GetOperatorsWithBlockchainIdentity 获取已配置区块链身份的操作员，按ID顺序排列
+func GetOperatorsWithBlockchainIdentity() ([]*User, error) {
+	var users []*User
+	o := GetOrm()
+	_, err := o.QueryTable(new(User)).Filter("role", RoleOperator).
+		Exclude("blockchain_addr__isnull", true).Exclude("blockchain_addr", "").
+		OrderBy("id").All(&users)
+	return users, err
+}
+
+// GetSignUserIDByAddress 根据区块链地址查找托管在WeBASE-Sign中的外部用户编号，未托管时返回空字符串
+func GetSignUserIDByAddress(address string) string {
+	o := orm.NewOrm()
+
+	var user User
+	err := o.QueryTable(new(User)).
+		Filter("blockchain_addr__iexact", address).
+		Filter("blockchain_type", BlockchainUserTypeExternal).
+		One(&user, "SignUserId")
+	if err == nil && user.SignUserId != "" {
+		return user.SignUserId
+	}
+
+	var company Company
+	err = o.QueryTable(new(Company)).
+		Filter("address__iexact", address).
+		Filter("blockchain_type", BlockchainUserTypeExternal).
+		One(&company, "SignUserId")
+	if err == nil {
+		return company.SignUserId
+	}
+	return ""
+}
+
+// GetLocalBlockchainUsers 获取区块链身份仍为本地用户的用户
+func GetLocalBlockchainUsers() ([]*User, error) {
+	var users []*User
+	o := orm.NewOrm()
+	_, err := o.QueryTable(new(User)).
+		Exclude("blockchain_type", BlockchainUserTypeExternal).
+		Exclude("blockchain_addr__isnull", true).
+		Exclude("blockchain_addr", "").
+		All(&users)
+	return users, err
+}
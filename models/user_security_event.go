@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"github.com/beego/beego/v2/client/orm"
+)
+
+// 账户安全事件
+const (
+	SecurityEventAccountLocked   = "account_locked"   // 连续登录失败，账户被临时锁定
+	SecurityEventAccountUnlocked = "account_unlocked" // 管理员解除锁定
+	SecurityEventIPBlocked       = "ip_blocked"       // 同一来源地址登录失败次数过多，暂时拒绝该地址登录
+)
+
+// UserSecurityEvent 账户安全事件记录
+type UserSecurityEvent struct {
+	Id        int       `orm:"pk;auto" json:"id"`
+	UserId    int       `orm:"index;default(0)" json:"user_id"` // 用户不存在或按地址封禁时为0
+	Username  string    `orm:"size(50);index" json:"username"`
+	Event     string    `orm:"size(32)" json:"event"`
+	Ip        string    `orm:"size(64);null" json:"ip"`
+	Detail    string    `orm:"size(255);null" json:"detail"`
+	Operator  string    `orm:"size(50);null" json:"operator"` // 执行操作的管理员，自动锁定时为空
+	CreatedAt time.Time `orm:"auto_now_add;type(datetime)" json:"created_at"`
+}
+
+// TableName 表名
+func (e *UserSecurityEvent) TableName() string {
+	return "user_security_events"
+}
+
+// AddUserSecurityEvent 记录账户安全事件
+func AddUserSecurityEvent(event *UserSecurityEvent) error {
+	o := orm.NewOrm()
+	_, err := o.Insert(event)
+	return err
+}
+
+// GetUserSecurityEvents 获取用户的安全事件，按时间倒序
+func GetUserSecurityEvents(userID int, page, pageSize int) ([]*UserSecurityEvent, int64, error) {
+	o := orm.NewOrm()
+	query := o.QueryTable(new(UserSecurityEvent)).Filter("user_id", userID)
+
+	total, err := query.Count()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var events []*UserSecurityEvent
+	_, err = query.OrderBy("-id").Limit(pageSize, (page-1)*pageSize).All(&events)
+	return events, total, err
+}
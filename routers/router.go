@@ -1,6 +1,9 @@
 package routers
 
 import (
+	"net/http"
+
+	"github.com/beego/beego/v2/core/logs"
 	"github.com/beego/beego/v2/server/web"
 	"github.com/beego/beego/v2/server/web/filter/cors"
 	"sea_trace_server_V2.0/controllers"
@@ -8,15 +11,22 @@ import (
 )
 
 func init() {
+	// 为每个请求分配请求ID，用于关联日志和审计记录
+	web.InsertFilter("*", web.BeforeRouter, middleware.RequestID)
+
 	// 跨域配置
 	web.InsertFilter("*", web.BeforeRouter, cors.Allow(&cors.Options{
 		AllowAllOrigins:  true,
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type", middleware.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", middleware.RequestIDHeader},
 		AllowCredentials: true,
 	}))
 
+	// 无需认证的溯源接口按来源地址限流
+	web.InsertFilter("/api/public/*", web.BeforeRouter, middleware.PublicRateLimit)
+	web.InsertFilter("/api/chain/trace/*", web.BeforeRouter, middleware.PublicRateLimit)
+
 	// 创建货物控制器实例
 	goodsController := controllers.NewGoodsController()
 
@@ -24,13 +34,33 @@ func init() {
 	// 公共溯源查询接口 - 无需认证（使用参数形式）
 	web.Router("/api/public/trace", goodsController, "get:PublicTrace") // 新增：公开溯源查询接口
 
+	// 溯源证书：签发(JSON/PDF)、核验和签名公钥，均无需认证
+	web.Router("/api/public/goods/:id/certificate", goodsController, "get:GetCertificate")
+	web.Router("/api/public/certificates/verify", goodsController, "post:VerifyCertificate")
+	web.Router("/api/public/certificates/key", goodsController, "get:GetCertificateKey")
+
 	// 货物管理API - 需要操作员权限
 	web.Router("/api/operator/goods/register", goodsController, "post:RegisterGood") // 新增：生产商注册货物
 	web.Router("/api/operator/goods/ship", goodsController, "post:ShipGood")         // 新增：运输商运输货物
 	web.Router("/api/operator/goods/inspect", goodsController, "post:InspectGood")   // 新增：验货商验货
+	web.Router("/api/operator/goods/dispose", goodsController, "post:DisposeGood")   // 验货商处置不合格货物
 	web.Router("/api/operator/goods/deliver", goodsController, "post:DeliverGood")   // 新增：经销商交付货物
 	web.Router("/api/operator/goods/list", goodsController, "get:GetGoodsList")      // 新增：获取货物列表
 	web.Router("/api/operator/goods/trace", goodsController, "get:GetGoodsTrace")    // 新增：获取货物溯源信息
+
+	// 货物当前可执行的操作，按货物生命周期定义计算
+	web.Router("/api/operator/goods/transitions", goodsController, "get:GetTransitions")
+	web.Router("/api/operator/goods/verify", goodsController, "get:VerifyRecordAnchors")
+
+	// 批量操作，支持JSON数组或CSV上传
+	web.Router("/api/operator/goods/bulk/register", goodsController, "post:BulkRegisterGoods")
+	web.Router("/api/operator/goods/bulk/ship", goodsController, "post:BulkShipGoods")
+	web.Router("/api/operator/goods/bulk/inspect", goodsController, "post:BulkInspectGoods")
+	web.Router("/api/operator/goods/bulk/deliver", goodsController, "post:BulkDeliverGoods")
+
+	// 溯源二维码(PNG/SVG)和整批货物标签(PDF/ZPL)
+	web.Router("/api/operator/goods/qrcode", goodsController, "get:GetGoodsQRCode")
+	web.Router("/api/operator/goods/labels", goodsController, "get:GetGoodsLabels")
 	// =========================================================
 
 	// 公司管理员路由
@@ -44,12 +74,22 @@ func init() {
 
 	// Admin API
 	web.Router("/api/admin/stats", &controllers.AdminController{}, "get:Stats")
+	web.Router("/api/admin/activities", &controllers.AdminController{}, "get:Activities")
+
+	// 交易账本 - 仅超级管理员
+	web.Router("/api/admin/transactions", &controllers.TransactionController{}, "get:List")
+	web.Router("/api/admin/transactions/:hash", &controllers.TransactionController{}, "get:Detail")
+
+	// 链上数据核对 - 仅超级管理员
+	web.Router("/api/admin/reconcile/discrepancies", &controllers.ReconcileController{}, "get:Discrepancies")
+	web.Router("/api/admin/reconcile/run", &controllers.ReconcileController{}, "post:Run")
+	web.Router("/api/admin/reconcile/redrive/:id", &controllers.ReconcileController{}, "post:Redrive")
 
 	// Chain API
 	web.Router("/api/chain/sysinfo", &controllers.ChainController{}, "get:GetChainInfo")
 	web.Router("/api/chain/trace/:goodId", &controllers.ChainController{}, "get:TraceInfo")
-	// 初始化路由 - 仅用于系统初始化
-	web.Router("/api/init/admin", &controllers.InitController{}, "get:InitAdmin")
+	// 初始化路由 - 凭一次性令牌创建超级管理员，初始化完成后不再可用
+	web.Router("/api/init/admin", &controllers.InitController{}, "post:InitAdmin")
 
 	// 认证接口 - 无需认证
 	web.Router("/api/auth/login", &controllers.AuthController{}, "post:Login")
@@ -65,6 +105,15 @@ func init() {
 	web.Router("/api/auth/myinfo", authController, "get:MyInfo")
 	web.InsertFilter("/api/auth/myinfo", web.BeforeRouter, middleware.JWTAuth)
 
+	// 刷新令牌无需访问令牌，退出登录需要
+	web.Router("/api/auth/refresh", authController, "post:Refresh")
+	web.Router("/api/auth/logout", authController, "post:Logout")
+	web.InsertFilter("/api/auth/logout", web.BeforeRouter, middleware.JWTAuth)
+
+	// 修改密码，首次登录的超级管理员须先修改初始密码
+	web.Router("/api/auth/password", authController, "post:ChangePassword")
+	web.InsertFilter("/api/auth/password", web.BeforeRouter, middleware.JWTAuth)
+
 	// 区块链信息路由 - 任何认证用户可访问
 	web.Router("/api/chain/sysinfo", chainController, "get:GetChainInfo")
 	web.InsertFilter("/api/chain/sysinfo", web.BeforeRouter, middleware.JWTAuth)
@@ -77,31 +126,73 @@ func init() {
 	web.Router("/api/su/company/delete/:id", superAdminController, "delete:DeleteCompany")
 	web.Router("/api/su/company/admin/create", superAdminController, "post:CreateCompanyAdmin")
 
-	// 为所有超级管理员路由添加中间件
+	// 为所有超级管理员路由添加中间件，权限按 middleware.RoutePolicies 校验
 	web.InsertFilter("/api/su/*", web.BeforeRouter, middleware.JWTAuth)
-	web.InsertFilter("/api/su/*", web.BeforeRouter, middleware.SuperAdminAuth)
+	web.InsertFilter("/api/su/*", web.BeforeRouter, middleware.Authorize)
 
 	// 公司管理员路由
 	web.Router("/api/admin/company/info", companyAdminController, "get:CompanyInfo")
 	web.Router("/api/admin/company/info", companyAdminController, "put:UpdateCompanyInfo")
+	// 公开溯源字段可见性，各公司设置其经手环节的哪些字段对公众可见
+	web.Router("/api/admin/company/trace-visibility", companyAdminController, "get:GetTraceVisibility;put:UpdateTraceVisibility")
 	web.Router("/api/admin/company/operator/create", companyAdminController, "post:CreateOperator")
 	web.Router("/api/admin/company/operator/delete/:id", companyAdminController, "delete:DeleteOperator")
-	// 为所有公司管理员路由添加中间件
+	// 为所有公司管理员路由添加中间件，权限按 middleware.RoutePolicies 校验
 	web.InsertFilter("/api/admin/*", web.BeforeRouter, middleware.JWTAuth)
-	web.InsertFilter("/api/admin/*", web.BeforeRouter, middleware.CompanyAdminAuth)
+	web.InsertFilter("/api/admin/*", web.BeforeRouter, middleware.Authorize)
 	// 用户管理路由组
 	web.Router("/api/admin/user/list", &controllers.UserManagementController{}, "get:ListUsers")
 	web.Router("/api/admin/user/create", &controllers.UserManagementController{}, "post:CreateUser")
 	web.Router("/api/admin/user/update/:id", &controllers.UserManagementController{}, "put:UpdateUser")
 	web.Router("/api/admin/user/delete/:id", &controllers.UserManagementController{}, "delete:DeleteUser")
 
+	// 角色与权限管理
+	roleController := &controllers.RoleController{}
+	web.Router("/api/admin/roles", roleController, "get:List;post:Create")
+	web.Router("/api/admin/roles/permissions", roleController, "get:Permissions")
+	web.Router("/api/admin/roles/:id", roleController, "put:Update;delete:Delete")
+	web.Router("/api/admin/user/roles/:id", roleController, "get:UserRoles;put:AssignRoles")
+
+	// 账户锁定管理
+	web.Router("/api/admin/user/unlock/:id", &controllers.UserManagementController{}, "put:UnlockUser")
+	web.Router("/api/admin/user/security-events/:id", &controllers.UserManagementController{}, "get:SecurityEvents")
+
+	// 审计日志：超级管理员查询全部，公司账户查询本公司
+	auditController := &controllers.AuditController{}
+	web.Router("/api/su/audit-logs", auditController, "get:List")
+	web.Router("/api/admin/audit-logs", auditController, "get:CompanyList")
+
 	// // 操作员路由 - 根据公司类型进行操作
 	// web.Router("/api/operator/reggood", operatorController, "post:RegisterGood")    // 货主注册货物
 	// web.Router("/api/operator/shipgood", operatorController, "post:ShipGood")       // 船东运输登记
 	// web.Router("/api/operator/inspectgood", operatorController, "post:InspectGood") // 港口验货登记
 	// web.Router("/api/operator/delivergood", operatorController, "post:DeliverGood") // 经销商收货登记
 
-	// 为所有操作员路由添加中间件
+	// 为所有操作员路由添加中间件，权限按 middleware.RoutePolicies 校验
 	web.InsertFilter("/api/operator/*", web.BeforeRouter, middleware.JWTAuth)
-	web.InsertFilter("/api/operator/*", web.BeforeRouter, middleware.CompanyOperatorAuth)
+	web.InsertFilter("/api/operator/*", web.BeforeRouter, middleware.Authorize)
+}
+
+// KeystoreSignHandler 本地密钥库签名接口，与WeBASE-Sign兼容，供WeBASE-Front签名交易
+// 不注册在对外的主服务上，由 StartKeystoreSignServer 在独立的本机端口提供，且仅允许配置的来源地址访问
+func KeystoreSignHandler() http.Handler {
+	handler := web.NewControllerRegister()
+	keystoreSignController := &controllers.KeystoreSignController{}
+	handler.Add("/WeBASE-Sign/sign", keystoreSignController,
+		web.WithRouterMethods(keystoreSignController, "post:Sign"))
+	handler.Add("/WeBASE-Sign/user/:signUserId/userInfo", keystoreSignController,
+		web.WithRouterMethods(keystoreSignController, "get:UserInfo"))
+	handler.Init()
+	return handler
+}
+
+// StartKeystoreSignServer 在 keystore_sign_addr（默认 127.0.0.1:5004，即WeBASE-Sign的默认端口）启动签名接口
+func StartKeystoreSignServer() {
+	addr := web.AppConfig.DefaultString("keystore_sign_addr", "127.0.0.1:5004")
+	go func() {
+		logs.Info("本地密钥库签名接口已启动 [addr=%s]", addr)
+		if err := http.ListenAndServe(addr, KeystoreSignHandler()); err != nil {
+			logs.Critical("本地密钥库签名接口启动失败 [addr=%s]: %v", addr, err)
+		}
+	}()
 }
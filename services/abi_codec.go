@@ -0,0 +1,276 @@
+package services
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// abiArgument 合约ABI中的参数定义
+type abiArgument struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Indexed bool   `json:"indexed"`
+}
+
+// abiEvent 合约ABI中的事件定义
+type abiEvent struct {
+	Name   string        `json:"name"`
+	Type   string        `json:"type"`
+	Inputs []abiArgument `json:"inputs"`
+}
+
+// Signature 事件签名，如 Shipped(string,uint256,address,string,uint256)
+func (e *abiEvent) Signature() string {
+	types := make([]string, 0, len(e.Inputs))
+	for _, input := range e.Inputs {
+		types = append(types, input.Type)
+	}
+	return fmt.Sprintf("%s(%s)", e.Name, strings.Join(types, ","))
+}
+
+// Topic 事件签名的keccak256哈希，即日志的第一个topic
+func (e *abiEvent) Topic() string {
+	return keccak256Hex([]byte(e.Signature()))
+}
+
+// EventDecoder 根据合约ABI解码事件日志
+// 仅支持 Traceability 合约用到的 uint*/address/bool/string 类型
+type EventDecoder struct {
+	events map[string]*abiEvent // topic -> 事件定义
+}
+
+// DecodedEvent 解码后的事件
+type DecodedEvent struct {
+	Name string
+	Args map[string]interface{} // uint* 解码为字符串形式的十进制数，address 为小写十六进制，indexed string 为其哈希
+}
+
+// keccak256Hex 计算keccak256哈希并返回0x前缀的十六进制字符串
+func keccak256Hex(data []byte) string {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(data)
+	return "0x" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// NewEventDecoderFromFile 从ABI文件创建事件解码器
+func NewEventDecoderFromFile(path string) (*EventDecoder, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取合约ABI失败: %v", err)
+	}
+	return NewEventDecoder(data)
+}
+
+// NewEventDecoder 从ABI JSON创建事件解码器
+func NewEventDecoder(abiJSON []byte) (*EventDecoder, error) {
+	var entries []*abiEvent
+	if err := json.Unmarshal(abiJSON, &entries); err != nil {
+		return nil, fmt.Errorf("解析合约ABI失败: %v", err)
+	}
+
+	decoder := &EventDecoder{events: make(map[string]*abiEvent)}
+	for _, entry := range entries {
+		if entry.Type == "event" {
+			decoder.events[entry.Topic()] = entry
+		}
+	}
+	return decoder, nil
+}
+
+// Event 根据事件名获取事件定义
+func (d *EventDecoder) Event(name string) *abiEvent {
+	for _, event := range d.events {
+		if event.Name == name {
+			return event
+		}
+	}
+	return nil
+}
+
+// Decode 解码一条日志，非本合约事件返回 nil
+func (d *EventDecoder) Decode(topics []string, data string) (*DecodedEvent, error) {
+	if len(topics) == 0 {
+		return nil, nil
+	}
+	event, ok := d.events[strings.ToLower(topics[0])]
+	if !ok {
+		return nil, nil
+	}
+
+	raw, err := hex.DecodeString(strings.TrimPrefix(data, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("日志数据格式错误: %v", err)
+	}
+
+	decoded := &DecodedEvent{Name: event.Name, Args: make(map[string]interface{})}
+	topicIndex := 1
+	slot := 0
+	for _, input := range event.Inputs {
+		if input.Indexed {
+			if topicIndex >= len(topics) {
+				return nil, fmt.Errorf("事件 %s 缺少 indexed 参数 %s", event.Name, input.Name)
+			}
+			// 动态类型的 indexed 参数只保留其哈希
+			value := strings.ToLower(topics[topicIndex])
+			if input.Type != "string" && input.Type != "bytes" {
+				word, _ := hex.DecodeString(strings.TrimPrefix(value, "0x"))
+				decoded.Args[input.Name], _ = decodeStaticWord(input.Type, word)
+			} else {
+				decoded.Args[input.Name] = value
+			}
+			topicIndex++
+			continue
+		}
+
+		value, err := decodeSlot(input.Type, raw, slot)
+		if err != nil {
+			return nil, fmt.Errorf("解码事件 %s 参数 %s 失败: %v", event.Name, input.Name, err)
+		}
+		decoded.Args[input.Name] = value
+		slot++
+	}
+	return decoded, nil
+}
+
+// decodeSlot 解码数据区第 slot 个参数
+func decodeSlot(typ string, raw []byte, slot int) (interface{}, error) {
+	head := slot * 32
+	if head+32 > len(raw) {
+		return nil, errors.New("数据长度不足")
+	}
+	word := raw[head : head+32]
+
+	if typ != "string" {
+		return decodeStaticWord(typ, word)
+	}
+
+	offset := new(big.Int).SetBytes(word).Int64()
+	if offset < 0 || offset+32 > int64(len(raw)) {
+		return nil, errors.New("字符串偏移量越界")
+	}
+	length := new(big.Int).SetBytes(raw[offset : offset+32]).Int64()
+	start := offset + 32
+	if length < 0 || start+length > int64(len(raw)) {
+		return nil, errors.New("字符串长度越界")
+	}
+	return string(raw[start : start+length]), nil
+}
+
+// decodeStaticWord 解码32字节的静态类型
+func decodeStaticWord(typ string, word []byte) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(typ, "uint"):
+		return new(big.Int).SetBytes(word).String(), nil
+	case typ == "address":
+		return "0x" + hex.EncodeToString(word[12:]), nil
+	case typ == "bool":
+		return word[31] == 1, nil
+	}
+	return nil, fmt.Errorf("不支持的ABI类型: %s", typ)
+}
+
+// EncodeLog 按ABI编码事件日志，返回 topics 和 data，供模拟链产生与真实链相同格式的日志
+func (d *EventDecoder) EncodeLog(name string, args ...interface{}) ([]string, string, error) {
+	event := d.Event(name)
+	if event == nil {
+		return nil, "", fmt.Errorf("ABI中不存在事件: %s", name)
+	}
+	if len(args) != len(event.Inputs) {
+		return nil, "", fmt.Errorf("事件 %s 参数数量不匹配", name)
+	}
+
+	topics := []string{event.Topic()}
+	var heads, tails [][]byte
+	var dynamic []int
+
+	for i, input := range event.Inputs {
+		if input.Indexed {
+			if input.Type == "string" {
+				topics = append(topics, keccak256Hex([]byte(fmt.Sprint(args[i]))))
+			} else {
+				word, err := encodeStaticWord(input.Type, args[i])
+				if err != nil {
+					return nil, "", err
+				}
+				topics = append(topics, "0x"+hex.EncodeToString(word))
+			}
+			continue
+		}
+
+		if input.Type == "string" {
+			dynamic = append(dynamic, len(heads))
+			heads = append(heads, nil)
+			tails = append(tails, encodeString(fmt.Sprint(args[i])))
+			continue
+		}
+		word, err := encodeStaticWord(input.Type, args[i])
+		if err != nil {
+			return nil, "", err
+		}
+		heads = append(heads, word)
+	}
+
+	// 动态参数的头部为其在数据区中的偏移量
+	offset := len(heads) * 32
+	for n, index := range dynamic {
+		heads[index] = leftPad(big.NewInt(int64(offset)).Bytes())
+		offset += len(tails[n])
+	}
+
+	var data []byte
+	for _, head := range heads {
+		data = append(data, head...)
+	}
+	for _, tail := range tails {
+		data = append(data, tail...)
+	}
+	return topics, "0x" + hex.EncodeToString(data), nil
+}
+
+// encodeStaticWord 编码静态类型为32字节
+func encodeStaticWord(typ string, value interface{}) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(typ, "uint"):
+		n, ok := new(big.Int).SetString(fmt.Sprint(value), 10)
+		if !ok {
+			return nil, fmt.Errorf("无效的整数: %v", value)
+		}
+		return leftPad(n.Bytes()), nil
+	case typ == "address":
+		raw, err := hex.DecodeString(strings.TrimPrefix(strings.ToLower(fmt.Sprint(value)), "0x"))
+		if err != nil || len(raw) > 20 {
+			return nil, fmt.Errorf("无效的地址: %v", value)
+		}
+		return leftPad(raw), nil
+	case typ == "bool":
+		word := make([]byte, 32)
+		if b, _ := value.(bool); b {
+			word[31] = 1
+		}
+		return word, nil
+	}
+	return nil, fmt.Errorf("不支持的ABI类型: %s", typ)
+}
+
+// encodeString 编码字符串：32字节长度 + 按32字节补齐的内容
+func encodeString(s string) []byte {
+	data := []byte(s)
+	out := leftPad(big.NewInt(int64(len(data))).Bytes())
+	padded := make([]byte, (len(data)+31)/32*32)
+	copy(padded, data)
+	return append(out, padded...)
+}
+
+// leftPad 左侧补零到32字节
+func leftPad(b []byte) []byte {
+	word := make([]byte, 32)
+	copy(word[32-len(b):], b)
+	return word
+}
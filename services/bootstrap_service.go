@@ -0,0 +1,188 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"sync"
+
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/utils"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/core/logs"
+)
+
+// 系统初始化错误
+var (
+	ErrAlreadyBootstrapped = errors.New("已存在超级管理员账户，无法再次初始化")
+	ErrInvalidSetupToken   = errors.New("初始化令牌无效或已使用")
+)
+
+// SetupToken 一次性初始化令牌，只保存在内存中，服务重启后重新生成
+type SetupToken struct {
+	mu    sync.Mutex
+	value string
+	used  bool
+}
+
+// NewSetupToken 生成随机初始化令牌
+func NewSetupToken() (*SetupToken, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	return &SetupToken{value: hex.EncodeToString(buf)}, nil
+}
+
+// Value 令牌内容
+func (t *SetupToken) Value() string {
+	return t.value
+}
+
+// Consume 校验并作废令牌，同一令牌只能成功使用一次
+func (t *SetupToken) Consume(token string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.used || subtle.ConstantTimeCompare([]byte(token), []byte(t.value)) != 1 {
+		return false
+	}
+	t.used = true
+	return true
+}
+
+// Release 初始化失败时恢复令牌，允许重新提交
+func (t *SetupToken) Release() {
+	t.mu.Lock()
+	t.used = false
+	t.mu.Unlock()
+}
+
+// BootstrapService 系统初始化，创建第一个超级管理员
+// 可通过命令行 bootstrap admin 完成，或在首次启动时使用日志中输出的一次性令牌调用初始化接口
+type BootstrapService struct {
+	mu    sync.Mutex
+	token *SetupToken
+}
+
+var (
+	bootstrapService     *BootstrapService
+	bootstrapServiceOnce sync.Once
+)
+
+// DefaultBootstrapService 获取全局系统初始化实例
+func DefaultBootstrapService() *BootstrapService {
+	bootstrapServiceOnce.Do(func() {
+		bootstrapService = &BootstrapService{}
+	})
+	return bootstrapService
+}
+
+// NeedsBootstrap 是否尚未创建超级管理员
+func (s *BootstrapService) NeedsBootstrap() (bool, error) {
+	count, err := models.CountAdmins()
+	if err != nil {
+		return false, err
+	}
+	return count == 0, nil
+}
+
+// AnnounceSetupToken 尚未初始化时生成一次性令牌并输出到日志，已初始化时不生成，初始化接口随之关闭
+func (s *BootstrapService) AnnounceSetupToken() {
+	needed, err := s.NeedsBootstrap()
+	if err != nil {
+		logs.Error("检查系统初始化状态失败: %v", err)
+		return
+	}
+	if !needed {
+		return
+	}
+
+	token, err := NewSetupToken()
+	if err != nil {
+		logs.Error("生成初始化令牌失败: %v", err)
+		return
+	}
+	s.mu.Lock()
+	s.token = token
+	s.mu.Unlock()
+
+	logs.Warn("系统尚未创建超级管理员，请使用一次性初始化令牌调用 POST /api/init/admin，"+
+		"或执行 sea_trace_server bootstrap admin [setupToken=%s]", token.Value())
+}
+
+// SetupWithToken 校验一次性令牌后创建超级管理员，令牌校验通过后即作废
+func (s *BootstrapService) SetupWithToken(setupToken, username, password, realName string) (*models.User, error) {
+	s.mu.Lock()
+	token := s.token
+	s.mu.Unlock()
+	if token == nil {
+		return nil, ErrAlreadyBootstrapped
+	}
+	if !token.Consume(setupToken) {
+		return nil, ErrInvalidSetupToken
+	}
+
+	user, err := s.CreateSuperAdmin(username, password, realName)
+	if err != nil {
+		if err == ErrAlreadyBootstrapped {
+			s.disable()
+		} else {
+			token.Release()
+		}
+		return nil, err
+	}
+	s.disable()
+	return user, nil
+}
+
+// CreateSuperAdmin 创建第一个超级管理员，首次登录须修改密码；已存在超级管理员时拒绝
+func (s *BootstrapService) CreateSuperAdmin(username, password, realName string) (*models.User, error) {
+	if username == "" {
+		return nil, errors.New("用户名不能为空")
+	}
+	if err := utils.ValidatePassword(password); err != nil {
+		return nil, err
+	}
+	if realName == "" {
+		realName = "超级管理员"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	needed, err := s.NeedsBootstrap()
+	if err != nil {
+		return nil, err
+	}
+	if !needed {
+		return nil, ErrAlreadyBootstrapped
+	}
+
+	hashedPassword, err := utils.HashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+	admin := &models.User{
+		Username:           username,
+		Password:           hashedPassword,
+		RealName:           realName,
+		Role:               models.RoleSuperAdmin,
+		Status:             1,
+		MustChangePassword: true,
+	}
+	o := orm.NewOrm()
+	if _, err := o.Insert(admin); err != nil {
+		return nil, err
+	}
+	logs.Info("已创建超级管理员 [username=%s]", username)
+	return admin, nil
+}
+
+// disable 初始化完成后作废令牌，初始化接口不再可用
+func (s *BootstrapService) disable() {
+	s.mu.Lock()
+	s.token = nil
+	s.mu.Unlock()
+}
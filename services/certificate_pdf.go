@@ -0,0 +1,135 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+
+	"sea_trace_server_V2.0/certverify"
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/utils"
+)
+
+// 证书PDF版式：A4纸，单位为点
+const (
+	certPDFMargin = 50.0
+	certPDFQRSide = 90.0
+)
+
+// CertificateAttachmentName 证书PDF中嵌入的签名证书文件名
+const CertificateAttachmentName = "certificate.json"
+
+// certificateStageNames 证书中的环节名称
+var certificateStageNames = map[string]string{
+	models.StageProduction:  "生产",
+	models.StageTransport:   "运输",
+	models.StageInspection:  "验货",
+	models.StageDisposition: "处置",
+	models.StageDelivery:    "交付",
+}
+
+// certificatePDF 按行排版的PDF页面，写满一页后自动换页
+type certificatePDF struct {
+	pages   [][]byte
+	content bytes.Buffer
+	y       float64
+}
+
+// newPage 结束当前页并开始新的一页
+func (p *certificatePDF) newPage() {
+	if p.content.Len() > 0 {
+		p.pages = append(p.pages, append([]byte(nil), p.content.Bytes()...))
+		p.content.Reset()
+	}
+	p.y = pdfPageHeight - certPDFMargin
+}
+
+// text 写入一段文字，按宽度折行
+func (p *certificatePDF) text(text string, size, indent, width float64) {
+	for _, line := range wrapPDFText(text, size, width-indent, 100) {
+		if p.y-line.size*1.4 < certPDFMargin {
+			p.newPage()
+		}
+		p.y -= line.size * 1.4
+		fmt.Fprintf(&p.content, "BT /F1 %.1f Tf %.3f %.3f Td <%s> Tj ET\n",
+			line.size, certPDFMargin+indent, p.y, pdfHexText(line.text))
+	}
+}
+
+// gap 空出一段距离
+func (p *certificatePDF) gap(height float64) {
+	p.y -= height
+}
+
+// RenderCertificatePDF 生成溯源证书PDF：货物信息、各环节上链记录和签名，右上角为公开溯源二维码
+// 签名后的证书JSON作为附件嵌入PDF，可取出后用 certverify 包或核验接口核验
+func RenderCertificatePDF(signed *certverify.SignedCertificate, document []byte, traceURL string) ([]byte, error) {
+	cert := signed.Certificate
+	width := pdfPageWidth - 2*certPDFMargin
+	headerWidth := width - certPDFQRSide - 10
+
+	p := &certificatePDF{}
+	p.newPage()
+
+	qr, err := utils.EncodeQR(traceURL, utils.QRLevelM)
+	if err != nil {
+		return nil, fmt.Errorf("生成二维码失败: %v", err)
+	}
+	writePDFQR(&p.content, qr, pdfPageWidth-certPDFMargin-certPDFQRSide, p.y-certPDFQRSide, certPDFQRSide)
+
+	p.text("海产品溯源证书", 20, 0, headerWidth)
+	p.gap(6)
+	p.text("证书编号: "+cert.Serial, 9, 0, headerWidth)
+	p.text("签发时间: "+cert.IssuedAt, 9, 0, headerWidth)
+	p.text("扫描右侧二维码查看公开溯源信息", 9, 0, headerWidth)
+	p.y = min(p.y, pdfPageHeight-certPDFMargin-certPDFQRSide)
+
+	p.gap(14)
+	p.text("货物信息", 13, 0, width)
+	p.gap(2)
+	p.text("货物名称: "+cert.GoodName, 10, 0, width)
+	p.text("货物ID: "+cert.GoodID, 10, 0, width)
+	p.text("批次: "+cert.BatchNumber, 10, 0, width)
+	p.text("生产商: "+cert.Producer, 10, 0, width)
+	p.text("当前状态: "+cert.Status, 10, 0, width)
+	p.text("合约地址: "+cert.ContractAddress, 10, 0, width)
+
+	p.gap(14)
+	p.text("溯源环节", 13, 0, width)
+	for i, stage := range cert.Stages {
+		p.gap(4)
+		title := fmt.Sprintf("%d. %s", i+1, certificateStageNames[stage.Stage])
+		if stage.Stage == models.StageTransport {
+			title += fmt.Sprintf("(第%d段)", stage.Index+1)
+		}
+		for _, part := range []string{stage.Company, stage.Time, stage.Result} {
+			if part != "" {
+				title += "  " + part
+			}
+		}
+		p.text(title, 10, 0, width)
+		block := "未确认"
+		if stage.BlockNumber > 0 {
+			block = fmt.Sprintf("%d", stage.BlockNumber)
+		}
+		p.text(fmt.Sprintf("区块: %s  上链状态: %s", block, stage.ChainStatus), 8, 14, width)
+		p.text("交易哈希: "+stage.TxHash, 8, 14, width)
+	}
+	if len(cert.Stages) == 0 {
+		p.text("暂无环节记录", 10, 0, width)
+	}
+
+	p.gap(14)
+	p.text("签名", 13, 0, width)
+	p.gap(2)
+	p.text("算法: "+signed.Algorithm, 8, 0, width)
+	p.text("密钥标识: "+cert.KeyID, 8, 0, width)
+	p.text("公钥: "+signed.PublicKey, 8, 0, width)
+	p.text("签名: "+signed.Signature, 8, 0, width)
+	p.gap(8)
+	p.text("本证书的签名JSON已作为附件 "+CertificateAttachmentName+" 嵌入本文件。核验时请取出该附件，"+
+		"使用 certverify 包离线核验，或提交至 /api/public/certificates/verify；"+
+		"公钥可通过 /api/public/certificates/key 获取，交易哈希可在区块链上核对。", 8, 0, width)
+
+	p.pages = append(p.pages, p.content.Bytes())
+	return buildPDF(p.pages, pdfAttachment{name: CertificateAttachmentName, mimeType: "application/json", data: document})
+}
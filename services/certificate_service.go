@@ -0,0 +1,246 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
+	"github.com/google/uuid"
+	"sea_trace_server_V2.0/certverify"
+	"sea_trace_server_V2.0/models"
+)
+
+// CertificateKeyEnv 证书签名私钥环境变量，优先于配置项 certificate_key_file
+const CertificateKeyEnv = "SEA_TRACE_CERT_KEY"
+
+// defaultCertificateKeyFile 未配置 certificate_key_file 时的私钥文件
+const defaultCertificateKeyFile = "./conf/certificate_ed25519.key"
+
+// LoadCertificateKey 读取证书签名私钥：优先环境变量 SEA_TRACE_CERT_KEY，其次配置项 certificate_key_file 指向的文件
+// 私钥文件不存在时生成新的私钥并写入该文件
+func LoadCertificateKey() (ed25519.PrivateKey, error) {
+	if value := os.Getenv(CertificateKeyEnv); value != "" {
+		return ParseCertificateKey(value)
+	}
+	path := web.AppConfig.DefaultString("certificate_key_file", defaultCertificateKeyFile)
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		return ParseCertificateKey(string(data))
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取证书签名私钥失败: %v", err)
+	}
+
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path, []byte(hex.EncodeToString(seed)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("保存证书签名私钥失败: %v", err)
+	}
+	key := ed25519.NewKeyFromSeed(seed)
+	logs.Warn("已生成新的证书签名私钥 [file=%s, keyID=%s]，请妥善备份，更换私钥后旧证书需以旧公钥核验",
+		path, certverify.KeyID(key.Public().(ed25519.PublicKey)))
+	return key, nil
+}
+
+// ParseCertificateKey 解析证书签名私钥，为32字节种子的十六进制字符串
+func ParseCertificateKey(value string) (ed25519.PrivateKey, error) {
+	seed, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(value), "0x"))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errors.New("证书签名私钥必须是32字节的十六进制字符串")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// CertificateService 溯源证书的签发和核验
+type CertificateService struct {
+	ContractAddress string
+	key             ed25519.PrivateKey
+	err             error // 私钥加载失败的原因，签发和核验均返回该错误
+}
+
+var (
+	certificateService     *CertificateService
+	certificateServiceOnce sync.Once
+)
+
+// DefaultCertificateService 获取全局证书服务实例，首次调用时加载签名私钥
+func DefaultCertificateService() *CertificateService {
+	certificateServiceOnce.Do(func() {
+		key, err := LoadCertificateKey()
+		if err != nil {
+			logs.Error("加载证书签名私钥失败: %v", err)
+			certificateService = &CertificateService{err: err}
+			return
+		}
+		certificateService = NewCertificateService(key)
+	})
+	return certificateService
+}
+
+// NewCertificateService 使用指定私钥创建证书服务
+func NewCertificateService(key ed25519.PrivateKey) *CertificateService {
+	contract, _ := web.AppConfig.String("contract_address")
+	return &CertificateService{ContractAddress: contract, key: key}
+}
+
+// PublicKey 证书签名公钥
+func (s *CertificateService) PublicKey() (ed25519.PublicKey, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.key.Public().(ed25519.PublicKey), nil
+}
+
+// Issue 为货物签发溯源证书，证书内容遵循各公司的公开溯源设置
+func (s *CertificateService) Issue(goodID string) (*certverify.SignedCertificate, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	trace, stages, err := loadPublicTrace(goodID)
+	if err != nil {
+		return nil, err
+	}
+	return s.Sign(NewTraceCertificate(trace, stages, s.ContractAddress))
+}
+
+// Sign 签名证书，未填写的序列号和签发时间自动生成
+func (s *CertificateService) Sign(cert certverify.Certificate) (*certverify.SignedCertificate, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if cert.Serial == "" {
+		cert.Serial = uuid.New().String()
+	}
+	if cert.IssuedAt == "" {
+		cert.IssuedAt = time.Now().UTC().Format(time.RFC3339)
+	}
+	return certverify.Sign(cert, s.key)
+}
+
+// CertificateVerification 证书核验结果
+type CertificateVerification struct {
+	Valid        bool                    `json:"valid"`
+	Reason       string                  `json:"reason,omitempty"`
+	KeyID        string                  `json:"key_id"`
+	Certificate  *certverify.Certificate `json:"certificate,omitempty"`
+	RecordsMatch bool                    `json:"records_match"` // 证书中的上链记录与系统当前记录一致
+	Mismatches   []string                `json:"mismatches,omitempty"`
+}
+
+// Verify 核验证书文档：签名须由本服务的私钥签发，签名有效时再与货物当前的上链记录比对
+func (s *CertificateService) Verify(data []byte) (*CertificateVerification, error) {
+	publicKey, err := s.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	result := &CertificateVerification{KeyID: certverify.KeyID(publicKey)}
+	cert, err := certverify.Verify(data, publicKey)
+	if err != nil {
+		result.Reason = err.Error()
+		return result, nil
+	}
+	result.Valid = true
+	result.Certificate = cert
+
+	trace, stages, err := loadPublicTrace(cert.GoodID)
+	if err != nil {
+		result.Mismatches = []string{"货物不存在"}
+		return result, nil
+	}
+	result.Mismatches = CompareCertificateStages(cert.Stages, NewTraceCertificate(trace, stages, s.ContractAddress).Stages)
+	result.RecordsMatch = len(result.Mismatches) == 0
+	return result, nil
+}
+
+// CompareCertificateStages 比对证书中的环节与当前记录，返回不一致的说明
+// 证书签发后新增的环节和新确认的区块不视为不一致
+func CompareCertificateStages(certified, current []certverify.Stage) []string {
+	index := make(map[string]certverify.Stage, len(current))
+	for _, stage := range current {
+		index[fmt.Sprintf("%s#%d", stage.Stage, stage.Index)] = stage
+	}
+	var mismatches []string
+	for _, stage := range certified {
+		key := fmt.Sprintf("%s#%d", stage.Stage, stage.Index)
+		now, ok := index[key]
+		switch {
+		case !ok:
+			mismatches = append(mismatches, key+": 环节记录不存在")
+		case !strings.EqualFold(now.TxHash, stage.TxHash):
+			mismatches = append(mismatches, key+": 交易哈希不一致")
+		case stage.BlockNumber != 0 && now.BlockNumber != stage.BlockNumber:
+			mismatches = append(mismatches, key+": 区块高度不一致")
+		}
+	}
+	return mismatches
+}
+
+// NewTraceCertificate 由公开溯源视图和环节记录生成证书内容（未签名）
+// 经手公司、时间和结论取自公开视图，公司设置为不公开的字段在证书中为空
+func NewTraceCertificate(trace *models.PublicTrace, stages *models.GoodStages, contractAddress string) certverify.Certificate {
+	cert := certverify.Certificate{
+		ContractAddress: contractAddress,
+		GoodID:          trace.GoodID,
+		GoodName:        trace.GoodName,
+		BatchNumber:     trace.BatchNumber,
+		Producer:        trace.Producer,
+		Status:          trace.StatusText,
+		Stages:          []certverify.Stage{},
+	}
+	add := func(stage string, index int, view models.PublicStage, companyField, timeField, result string,
+		txHash string, blockNumber int64, chainStatus string) {
+		company, _ := view[companyField].(string)
+		if stage == models.StageProduction {
+			company = trace.Producer
+		}
+		at, _ := view[timeField].(string)
+		cert.Stages = append(cert.Stages, certverify.Stage{
+			Stage:       stage,
+			Index:       index,
+			Company:     company,
+			Time:        at,
+			Result:      result,
+			TxHash:      txHash,
+			BlockNumber: blockNumber,
+			ChainStatus: chainStatus,
+		})
+	}
+
+	if p := stages.Production; p != nil {
+		add(models.StageProduction, 0, trace.Production, "", "produced_at", "",
+			p.BlockchainTxHash, p.BlockNumber, p.ChainStatus)
+	}
+	for i, leg := range stages.TransportLegs {
+		add(models.StageTransport, leg.LegIndex, trace.TransportLegs[i], "transporter_name", "start_time", "",
+			leg.BlockchainTxHash, leg.BlockNumber, leg.ChainStatus)
+	}
+	for i, inspection := range stages.Inspections {
+		result := ""
+		if passed, ok := trace.Inspections[i]["pass_status"].(bool); ok {
+			result = map[bool]string{true: "合格", false: "不合格"}[passed]
+		}
+		add(models.StageInspection, i, trace.Inspections[i], "inspector_name", "inspection_time", result,
+			inspection.BlockchainTxHash, inspection.BlockNumber, inspection.ChainStatus)
+	}
+	for i, disposition := range stages.Dispositions {
+		result, _ := trace.Dispositions[i]["to_status_text"].(string)
+		add(models.StageDisposition, i, trace.Dispositions[i], "company_name", "created_at", result,
+			disposition.BlockchainTxHash, disposition.BlockNumber, disposition.ChainStatus)
+	}
+	if d := stages.Delivery; d != nil {
+		add(models.StageDelivery, 0, trace.Delivery, "dealer_name", "delivery_time", "",
+			d.BlockchainTxHash, d.BlockNumber, d.ChainStatus)
+	}
+	return cert
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"sync"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
+	"sea_trace_server_V2.0/models"
+)
+
+// 区块链后端类型
+const (
+	ChainBackendWebase    = "webase"    // 通过WeBASE-Front访问真实链
+	ChainBackendSimulator = "simulator" // 纯内存模拟链，用于测试和本地开发
+)
+
+// 合约中货物的处置状态，对应 TraceabilityV3.GoodState
+const (
+	ChainGoodStateNormal      = 0 // 正常
+	ChainGoodStateRejected    = 1 // 验货不合格
+	ChainGoodStateQuarantined = 2 // 已隔离
+	ChainGoodStateReturned    = 3 // 已退回生产商
+	ChainGoodStateDestroyed   = 4 // 已销毁
+)
+
+// 合约中环节记录的类型，对应 TraceabilityV3.RecordStage
+var chainRecordStages = map[string]int{
+	models.StageProduction:  0,
+	models.StageTransport:   1,
+	models.StageInspection:  2,
+	models.StageDisposition: 3,
+	models.StageDelivery:    4,
+}
+
+// ChainClient 溯源合约访问接口
+// 业务层只依赖该接口，具体实现由配置项 chain_backend 决定
+// 各环节写方法的 recordHash 为链下完整环节记录的哈希（见 models.StageRecordHash），为空时写入0
+type ChainClient interface {
+	// RegisterCompany 注册公司，返回交易哈希
+	RegisterCompany(name string, companyType int, adminAddress string) (string, error)
+	// RegisterOperator 由公司管理员地址登记本公司操作员地址，返回交易哈希
+	RegisterOperator(operatorAddress string, adminAddress string) (string, error)
+	// RemoveOperator 由公司管理员地址移除本公司操作员地址，返回交易哈希
+	RemoveOperator(operatorAddress string, adminAddress string) (string, error)
+	// CompanyOf 获取地址在合约中所属的公司编号（公司管理员或已登记的操作员），均不属于时返回0
+	CompanyOf(address string) (int, error)
+	// RegisterGood 注册货物，返回交易哈希和回执消息
+	RegisterGood(goodID string, goodName string, recordHash string, userAddress string) (string, string, error)
+	// ShipGood 追加一段运输，返回交易哈希和回执消息
+	ShipGood(goodID string, fromLocation string, toLocation string, trackingNumber string, transportInfo string, recordHash string, userAddress string) (string, string, error)
+	// InspectGood 验货，passed 为 false 时需给出不合格原因，返回交易哈希和回执消息
+	InspectGood(goodID string, inspectionInfo string, passed bool, reason string, recordHash string, userAddress string) (string, string, error)
+	// DisposeGood 处置验货不合格的货物，state 为 ChainGoodStateQuarantined/Returned/Destroyed，返回交易哈希和回执消息
+	DisposeGood(goodID string, state int, reason string, recordHash string, userAddress string) (string, string, error)
+	// DeliverGood 交付货物，返回交易哈希和回执消息
+	DeliverGood(goodID string, deliveryInfo string, recordHash string, userAddress string) (string, string, error)
+	// GetFullTrace 获取完整溯源信息
+	GetFullTrace(goodID string) (*TraceRecord, error)
+	// GetRawTrace 获取合约原始溯源记录，不做公司名称和时间格式转换
+	GetRawTrace(goodID string) (*TraceRecord, error)
+	// GetRecordHash 获取链上保存的环节记录哈希，index 为运输段、验货、处置记录的序号，生产和交付环节为0
+	// 记录不存在时返回错误，写入时未附带记录哈希的记录返回 models.ZeroRecordHash
+	GetRecordHash(goodID string, stage string, index int) (string, error)
+	// GetRecordHashCount 获取某环节已锚定的记录数量
+	GetRecordHashCount(goodID string, stage string) (int, error)
+	// GetGoodStatus 获取货物链上状态：0-已创建 1-已运输 2-已验货 3-已交付 4-验货不合格 5-已隔离 6-已退回 7-已销毁
+	GetGoodStatus(goodID string) (int, error)
+	// GetBlockNumber 获取当前区块高度
+	GetBlockNumber() (int64, error)
+	// GetTransactionByHash 根据交易哈希获取交易信息
+	GetTransactionByHash(txHash string) (map[string]interface{}, error)
+	// GetTransactionReceipt 获取交易回执，交易尚未打包时返回 ErrReceiptNotFound
+	GetTransactionReceipt(txHash string) (*TransactionReceipt, error)
+	// GetBlockTransactionHashes 获取指定区块内的交易哈希列表
+	GetBlockTransactionHashes(blockNumber int64) ([]string, error)
+	// GetContractAddress 获取溯源合约地址
+	GetContractAddress() string
+}
+
+// AccountProvider 区块链账户提供者
+type AccountProvider interface {
+	// CreateBlockchainUser 创建区块链外部用户，私钥由签名服务托管，不会返回
+	CreateBlockchainUser(username string) (*BlockchainUserResponse, error)
+}
+
+var (
+	simulatorOnce     sync.Once
+	simulatorInstance *SimulatorChainClient
+)
+
+// ChainBackend 获取当前配置的区块链后端类型
+func ChainBackend() string {
+	backend, _ := web.AppConfig.String("chain_backend")
+	if backend == "" {
+		return ChainBackendWebase
+	}
+	return backend
+}
+
+// NewChainClient 根据配置创建区块链客户端
+func NewChainClient() ChainClient {
+	if ChainBackend() == ChainBackendSimulator {
+		return sharedSimulator()
+	}
+	return NewWebaseService()
+}
+
+// NewAccountProvider 根据配置创建区块链账户提供者
+func NewAccountProvider() AccountProvider {
+	return &SignAccountProvider{Sign: NewSignService(), AppID: SignAppID()}
+}
+
+// sharedSimulator 获取进程内共享的模拟链实例，保证各服务看到同一份链上状态
+func sharedSimulator() *SimulatorChainClient {
+	simulatorOnce.Do(func() {
+		superAdmin, _ := web.AppConfig.String("super_admin_blockchain_address")
+		simulatorInstance = NewSimulatorChainClient(superAdmin)
+
+		abiPath, _ := web.AppConfig.String("contract_abi")
+		if decoder, err := NewEventDecoderFromFile(abiPath); err == nil {
+			simulatorInstance.Events = decoder
+		} else {
+			logs.Warning("模拟链未加载合约ABI，交易将不产生事件日志: %v", err)
+		}
+		logs.Info("使用内存模拟链作为区块链后端 [superAdmin=%s]", superAdmin)
+	})
+	return simulatorInstance
+}
+
+// chainRecordHash 写入合约的环节记录哈希，为空时写入0
+func chainRecordHash(recordHash string) string {
+	if recordHash == "" {
+		return models.ZeroRecordHash
+	}
+	return recordHash
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ErrReceiptNotFound 交易尚未被打包，暂无回执
+var ErrReceiptNotFound = errors.New("交易回执不存在")
+
+// receiptStatusSuccess 回执成功状态码
+const receiptStatusSuccess = "0x0"
+
+// revertSelector Error(string) 的函数选择器
+const revertSelector = "08c379a0"
+
+// ChainLog 交易回执中的事件日志
+type ChainLog struct {
+	Address         string   `json:"address"`
+	Topics          []string `json:"topics"`
+	Data            string   `json:"data"`
+	LogIndex        int      `json:"logIndex"`
+	BlockNumber     int64    `json:"blockNumber"`
+	TransactionHash string   `json:"transactionHash"`
+}
+
+// TransactionReceipt 交易回执
+type TransactionReceipt struct {
+	TransactionHash string     `json:"transactionHash"`
+	BlockNumber     int64      `json:"blockNumber"`
+	GasUsed         int64      `json:"gasUsed"`
+	Status          string     `json:"status"`
+	Output          string     `json:"output"`
+	RevertReason    string     `json:"revertReason"`
+	Logs            []ChainLog `json:"logs"`
+}
+
+// Succeeded 交易是否执行成功
+func (r *TransactionReceipt) Succeeded() bool {
+	return r.Status == receiptStatusSuccess
+}
+
+// parseQuantity 解析回执中的数值字段，兼容十进制数字和十六进制字符串
+func parseQuantity(value interface{}) int64 {
+	switch v := value.(type) {
+	case float64:
+		return int64(v)
+	case string:
+		if strings.HasPrefix(v, "0x") {
+			n, _ := strconv.ParseInt(v[2:], 16, 64)
+			return n
+		}
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return 0
+}
+
+// parseReceiptLogs 解析回执中的日志列表，logIndex 缺失时按顺序编号
+func parseReceiptLogs(value interface{}, txHash string, blockNumber int64) []ChainLog {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	logs := make([]ChainLog, 0, len(items))
+	for i, item := range items {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		log := ChainLog{
+			LogIndex:        i,
+			BlockNumber:     blockNumber,
+			TransactionHash: txHash,
+		}
+		if address, ok := entry["address"].(string); ok {
+			log.Address = strings.ToLower(address)
+		}
+		if data, ok := entry["data"].(string); ok {
+			log.Data = data
+		}
+		if topics, ok := entry["topics"].([]interface{}); ok {
+			for _, topic := range topics {
+				if t, ok := topic.(string); ok {
+					log.Topics = append(log.Topics, strings.ToLower(t))
+				}
+			}
+		}
+		if entry["logIndex"] != nil {
+			log.LogIndex = int(parseQuantity(entry["logIndex"]))
+		}
+		logs = append(logs, log)
+	}
+	return logs
+}
+
+// decodeRevertReason 解析合约 require/revert 返回的 Error(string) 数据
+func decodeRevertReason(output string) string {
+	data := strings.TrimPrefix(output, "0x")
+	if !strings.HasPrefix(data, revertSelector) {
+		return ""
+	}
+
+	raw, err := hex.DecodeString(data[len(revertSelector):])
+	if err != nil || len(raw) < 64 {
+		return ""
+	}
+
+	// ABI编码: 32字节偏移量 + 32字节长度 + 字符串内容
+	offset := new(big.Int).SetBytes(raw[:32]).Int64()
+	if offset < 0 || offset+32 > int64(len(raw)) {
+		return ""
+	}
+	length := new(big.Int).SetBytes(raw[offset : offset+32]).Int64()
+	start := offset + 32
+	if length < 0 || start+length > int64(len(raw)) {
+		return ""
+	}
+	return string(raw[start : start+length])
+}
@@ -0,0 +1,298 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/beego/beego/v2/core/logs"
+	"sea_trace_server_V2.0/models"
+)
+
+// 重放结果
+const (
+	ChainReplayRegistered = "registered" // 已在新合约中登记公司或操作员
+	ChainReplayEnqueued   = "enqueued"   // 货物的全部环节已写入发件箱，等待调度器按顺序发送
+	ChainReplayPlanned    = "planned"    // 演练模式下将要执行的操作
+	ChainReplaySkipped    = "skipped"    // 新合约中已存在，无需重放
+	ChainReplayFailed     = "failed"
+)
+
+// ChainReplayItem 单个公司、操作员或货物的重放结果
+type ChainReplayItem struct {
+	Kind   string // company、operator 或 good
+	Key    string
+	Result string
+	Detail string
+}
+
+// ChainReplayReport 重放报告
+type ChainReplayReport struct {
+	Items  []ChainReplayItem
+	Failed int
+}
+
+// add 记录一项重放结果
+func (r *ChainReplayReport) add(kind, key, result, detail string) {
+	r.Items = append(r.Items, ChainReplayItem{Kind: kind, Key: key, Result: result, Detail: detail})
+	if result == ChainReplayFailed {
+		r.Failed++
+	}
+}
+
+// ChainReplayService 将数据库中的公司、操作员和货物环节重放到新部署的溯源合约
+// 新合约不继承旧合约的存储，切换 contract_address 后需执行一次重放：
+// 公司按数据库ID顺序登记，保证合约分配的公司编号与数据库一致；操作员登记到所属公司名下；
+// 货物各环节按原顺序写入发件箱，由调度器以原操作员地址发送，并附带根据数据库记录计算的环节记录哈希
+// 已在新合约中存在的公司、操作员和货物会被跳过，重放可以重复执行
+type ChainReplayService struct {
+	Chain     ChainClient
+	BatchSize int
+	DryRun    bool // 只输出将要执行的操作，不发送交易也不写入发件箱
+}
+
+// NewChainReplayService 创建合约重放服务
+func NewChainReplayService() *ChainReplayService {
+	return &ChainReplayService{
+		Chain:     NewChainClient(),
+		BatchSize: 200,
+	}
+}
+
+// Run 重放全部公司和操作员，goodID 不为空时只重放该货物，否则重放全部货物
+// 公司编号与数据库不一致时停止重放并返回错误，此时链上溯源记录中的公司编号无法对应到数据库
+func (s *ChainReplayService) Run(goodID string) (*ChainReplayReport, error) {
+	report := &ChainReplayReport{}
+	if err := s.replayCompanies(report); err != nil {
+		return report, err
+	}
+	if err := s.replayOperators(report); err != nil {
+		return report, err
+	}
+
+	if goodID != "" {
+		good, err := models.GetGoodByID(goodID)
+		if err != nil {
+			return report, fmt.Errorf("货物不存在: %s", goodID)
+		}
+		s.replayGood(report, good)
+		return report, nil
+	}
+
+	afterID := 0
+	for {
+		goods, err := models.GetGoodsBatch(afterID, s.BatchSize)
+		if err != nil {
+			return report, fmt.Errorf("获取货物失败: %v", err)
+		}
+		if len(goods) == 0 {
+			break
+		}
+		for _, good := range goods {
+			s.replayGood(report, good)
+		}
+		afterID = goods[len(goods)-1].Id
+	}
+	return report, nil
+}
+
+// replayCompanies 按数据库ID顺序在新合约中登记公司
+func (s *ChainReplayService) replayCompanies(report *ChainReplayReport) error {
+	companies, err := models.GetAllCompanies()
+	if err != nil {
+		return fmt.Errorf("获取公司失败: %v", err)
+	}
+
+	for _, company := range companies {
+		key := fmt.Sprintf("%d:%s", company.ID, company.CompanyName)
+		if company.Address == "" {
+			report.add("company", key, ChainReplaySkipped, "公司未配置区块链地址")
+			continue
+		}
+		chainID, err := s.Chain.CompanyOf(company.Address)
+		if err != nil {
+			return fmt.Errorf("查询公司链上编号失败 [company=%s]: %v", key, err)
+		}
+		if chainID == company.ID {
+			report.add("company", key, ChainReplaySkipped, "新合约中已登记")
+			continue
+		}
+		if chainID != 0 {
+			return fmt.Errorf("公司链上编号与数据库不一致 [company=%s, chainID=%d]", key, chainID)
+		}
+		if s.DryRun {
+			report.add("company", key, ChainReplayPlanned, "登记公司")
+			continue
+		}
+
+		txHash, err := s.Chain.RegisterCompany(company.CompanyName, int(company.CompanyType), company.Address)
+		if err != nil {
+			return fmt.Errorf("登记公司失败 [company=%s]: %v", key, err)
+		}
+		// 合约按登记顺序分配公司编号，数据库ID有空缺或新合约已有其他公司时编号会错位
+		if chainID, err = s.Chain.CompanyOf(company.Address); err != nil || chainID != company.ID {
+			return fmt.Errorf("公司链上编号与数据库不一致 [company=%s, chainID=%d, txHash=%s]", key, chainID, txHash)
+		}
+		report.add("company", key, ChainReplayRegistered, txHash)
+		logs.Info("公司已登记到新合约 [company=%s, txHash=%s]", key, txHash)
+	}
+	return nil
+}
+
+// replayOperators 将已有区块链身份的操作员登记到新合约中所属公司名下
+func (s *ChainReplayService) replayOperators(report *ChainReplayReport) error {
+	users, err := models.GetOperatorsWithBlockchainIdentity()
+	if err != nil {
+		return fmt.Errorf("获取操作员失败: %v", err)
+	}
+
+	for _, user := range users {
+		key := fmt.Sprintf("%d:%s", user.Id, user.Username)
+		company, err := models.GetCompanyByID(user.CompanyId)
+		if err != nil || company.Address == "" {
+			report.add("operator", key, ChainReplayFailed, "所属公司不存在或未配置区块链地址")
+			continue
+		}
+		chainID, err := s.Chain.CompanyOf(user.BlockchainAddr)
+		if err != nil {
+			return fmt.Errorf("查询操作员所属公司失败 [user=%s]: %v", key, err)
+		}
+		switch {
+		case chainID == company.ID:
+			report.add("operator", key, ChainReplaySkipped, "新合约中已登记")
+		case chainID != 0:
+			report.add("operator", key, ChainReplayFailed, fmt.Sprintf("该地址已属于链上公司 %d", chainID))
+		case s.DryRun:
+			report.add("operator", key, ChainReplayPlanned, "登记操作员")
+		default:
+			txHash, err := s.Chain.RegisterOperator(user.BlockchainAddr, company.Address)
+			if err != nil {
+				report.add("operator", key, ChainReplayFailed, err.Error())
+				continue
+			}
+			report.add("operator", key, ChainReplayRegistered, txHash)
+		}
+	}
+	return nil
+}
+
+// replayGood 将货物的全部环节写入发件箱，新合约中已有该货物时跳过
+func (s *ChainReplayService) replayGood(report *ChainReplayReport, good *models.Goods) {
+	anchored, err := s.Chain.GetRecordHashCount(good.GoodId, models.StageProduction)
+	if err != nil {
+		report.add("good", good.GoodId, ChainReplayFailed, fmt.Sprintf("查询链上记录失败: %v", err))
+		return
+	}
+	if anchored > 0 {
+		report.add("good", good.GoodId, ChainReplaySkipped, "新合约中已存在")
+		return
+	}
+
+	sender := func(stage string, recordID int, operatorID int) (string, error) {
+		return replaySender(good.GoodId, stage, recordID, operatorID)
+	}
+	sequence := func(stage string, recordID int) int {
+		return models.GetFirstChainOutboxID(good.GoodId, stage, recordID)
+	}
+	entries, err := ReplayOutboxEntries(good, models.GetGoodStages(good.GoodId), sender, sequence)
+	if err != nil {
+		report.add("good", good.GoodId, ChainReplayFailed, err.Error())
+		return
+	}
+	if len(entries) == 0 {
+		report.add("good", good.GoodId, ChainReplaySkipped, "没有环节记录")
+		return
+	}
+	if s.DryRun {
+		report.add("good", good.GoodId, ChainReplayPlanned, fmt.Sprintf("写入 %d 条发件箱记录", len(entries)))
+		return
+	}
+
+	if err := models.EnqueueChainReplay(good.GoodId, entries); err != nil {
+		if errors.Is(err, models.ErrChainOutboxInFlight) {
+			report.add("good", good.GoodId, ChainReplayFailed, "仍有未完成的上链任务，请待其完成或失败后重新执行")
+			return
+		}
+		report.add("good", good.GoodId, ChainReplayFailed, fmt.Sprintf("写入发件箱失败: %v", err))
+		return
+	}
+	for _, entry := range entries {
+		models.UpdateStageChainStatus(entry.Stage, entry.StageRecordId, "", models.ChainStatusPending)
+	}
+	models.UpdateGoodChainStatus(good.GoodId, "", models.ChainStatusPending)
+	DefaultTraceCache().Invalidate(good.GoodId)
+	report.add("good", good.GoodId, ChainReplayEnqueued, fmt.Sprintf("写入 %d 条发件箱记录", len(entries)))
+}
+
+// replaySender 环节记录的发送方地址：操作员的区块链地址，历史记录没有操作员时使用该记录最近一次上链的发送方
+func replaySender(goodID string, stage string, recordID int, operatorID int) (string, error) {
+	if operator, err := models.GetUserByID(operatorID); err == nil && operator.BlockchainAddr != "" {
+		return operator.BlockchainAddr, nil
+	}
+	if latest, err := models.GetLatestChainOutbox(goodID, stage, recordID); err == nil && latest.SenderAddress != "" {
+		return latest.SenderAddress, nil
+	}
+	return "", fmt.Errorf("无法确定上链发送方地址 [stage=%s, recordID=%d]", stage, recordID)
+}
+
+// ReplayOutboxEntries 按合约要求的顺序为货物的全部环节记录生成发件箱记录：
+// 生产、各运输段、按创建时间交替的验货和处置记录、交付
+// sender 根据环节、记录ID和操作员ID确定发送方地址；sequence 返回记录原先的上链顺序，
+// 创建时间只精确到秒，同一秒内的验货和处置记录按该顺序排列，为0表示没有原始上链记录
+func ReplayOutboxEntries(good *models.Goods, stages *models.GoodStages,
+	sender func(stage string, recordID int, operatorID int) (string, error),
+	sequence func(stage string, recordID int) int) ([]*models.ChainOutbox, error) {
+	type stageRow struct {
+		stage  string
+		record interface{}
+		at     int64
+		seq    int
+	}
+
+	var rows []stageRow
+	if stages.Production != nil {
+		rows = append(rows, stageRow{stage: models.StageProduction, record: stages.Production})
+	}
+	for _, leg := range stages.TransportLegs {
+		rows = append(rows, stageRow{stage: models.StageTransport, record: leg})
+	}
+
+	// 重新验货和处置只能在验货不合格之后进行，两类记录按创建时间合并
+	var checks []stageRow
+	for _, inspection := range stages.Inspections {
+		checks = append(checks, stageRow{models.StageInspection, inspection,
+			inspection.CreatedAt.Unix(), sequence(models.StageInspection, inspection.Id)})
+	}
+	for _, disposition := range stages.Dispositions {
+		checks = append(checks, stageRow{models.StageDisposition, disposition,
+			disposition.CreatedAt.Unix(), sequence(models.StageDisposition, disposition.Id)})
+	}
+	sort.SliceStable(checks, func(i, j int) bool {
+		a, b := checks[i], checks[j]
+		if a.at != b.at {
+			return a.at < b.at
+		}
+		return a.seq > 0 && b.seq > 0 && a.seq < b.seq
+	})
+	rows = append(rows, checks...)
+
+	if stages.Delivery != nil {
+		rows = append(rows, stageRow{stage: models.StageDelivery, record: stages.Delivery})
+	}
+
+	entries := make([]*models.ChainOutbox, 0, len(rows))
+	for _, row := range rows {
+		recordID, params, operatorID, err := stageOutboxParams(good.GoodId, good, row.record)
+		if err != nil {
+			return nil, err
+		}
+		address, err := sender(row.stage, recordID, operatorID)
+		if err != nil {
+			return nil, err
+		}
+		entry := models.NewChainOutbox(good.GoodId, row.stage, models.StageFuncName(row.stage), params, address)
+		entry.StageRecordId = recordID
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
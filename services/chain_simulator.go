@@ -0,0 +1,667 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
+	"sea_trace_server_V2.0/models"
+)
+
+// 模拟链使用的零地址，对应Solidity中未赋值的address
+const simZeroAddress = "0x0000000000000000000000000000000000000000"
+
+// 模拟合约地址
+const simContractAddress = "0x000000000000000000000000000000000000feed"
+
+// 模拟交易消耗的gas
+const simGasUsed = 36000
+
+// simCompany 链上公司记录
+type simCompany struct {
+	id          int
+	name        string
+	companyType int
+	admin       string
+}
+
+// simGood 链上货物记录
+type simGood struct {
+	goodID         string
+	ownerCompanyID int
+	goodName       string
+	registerTime   int64
+}
+
+// simStageRecord 链上运输/验货/交付记录
+type simStageRecord struct {
+	companyID    int
+	operatorAddr string
+	info         string
+	time         int64
+}
+
+// simTransportLeg 链上运输段
+type simTransportLeg struct {
+	simStageRecord
+	fromLocation   string
+	toLocation     string
+	trackingNumber string
+}
+
+// simInspection 链上验货记录，不合格后可重新验货，因此每件货物可有多条
+type simInspection struct {
+	simStageRecord
+	passed bool
+	reason string
+}
+
+// simDisposition 链上处置记录
+type simDisposition struct {
+	companyID    int
+	operatorAddr string
+	state        int
+	reason       string
+	time         int64
+}
+
+// SimulatorChainClient 纯内存模拟链
+// 复刻 TraceabilityV3.sol 的业务规则：公司类型修饰符、环节先后顺序、多段运输、验货不合格处置、重复记录回滚以及环节记录哈希
+type SimulatorChainClient struct {
+	mu sync.Mutex
+
+	superAdmin        string
+	blockNumber       int64
+	companyCount      int
+	companies         map[int]*simCompany
+	companyOfAdmin    map[string]int
+	companyOfOperator map[string]int
+
+	goods        map[string]*simGood
+	legs         map[string][]*simTransportLeg
+	inspections  map[string][]*simInspection
+	dispositions map[string][]*simDisposition
+	states       map[string]int // 货物处置状态，对应合约的 goodStates
+	deliveries   map[string]*simStageRecord
+	recordHashes map[string]map[string][]string // 货物ID -> 环节 -> 环节记录哈希，对应合约的 recordHashes
+
+	transactions map[string]map[string]interface{}
+	txLogs       map[string][]ChainLog
+	blockTxs     map[int64][]string
+
+	// Now 链上时间来源，测试中可替换
+	Now func() time.Time
+	// Events 事件编码器，为空时交易不产生事件日志
+	Events *EventDecoder
+}
+
+// NewSimulatorChainClient 创建内存模拟链，superAdmin 相当于合约的部署者
+func NewSimulatorChainClient(superAdmin string) *SimulatorChainClient {
+	return &SimulatorChainClient{
+		superAdmin:        normalizeAddress(superAdmin),
+		companies:         make(map[int]*simCompany),
+		companyOfAdmin:    make(map[string]int),
+		companyOfOperator: make(map[string]int),
+		goods:             make(map[string]*simGood),
+		legs:              make(map[string][]*simTransportLeg),
+		inspections:       make(map[string][]*simInspection),
+		dispositions:      make(map[string][]*simDisposition),
+		states:            make(map[string]int),
+		deliveries:        make(map[string]*simStageRecord),
+		recordHashes:      make(map[string]map[string][]string),
+		transactions:      make(map[string]map[string]interface{}),
+		txLogs:            make(map[string][]ChainLog),
+		blockTxs:          make(map[int64][]string),
+		Now:               time.Now,
+	}
+}
+
+// normalizeAddress 统一地址格式，便于作为map键比较
+func normalizeAddress(address string) string {
+	return strings.ToLower(strings.TrimSpace(address))
+}
+
+// revert 模拟合约require失败，错误格式与WebaseService保持一致
+func (s *SimulatorChainClient) revert(funcName string, reason string) error {
+	logs.Warning("模拟链交易回滚 [function=%s, reason=%s]", funcName, reason)
+	return fmt.Errorf("交易调用失败: %s", reason)
+}
+
+// requireCompany 对应合约中的 onlyCompany 修饰符
+func (s *SimulatorChainClient) requireCompany(sender string, companyType int) (int, string) {
+	companyID := s.companyOf(sender)
+	company, ok := s.companies[companyID]
+	if !ok {
+		return 0, "公司不存在"
+	}
+	if company.companyType != companyType {
+		return 0, "公司类型不匹配"
+	}
+	return companyID, ""
+}
+
+// companyOf 账户所属公司：公司管理员或已登记的操作员，均不属于时返回0
+func (s *SimulatorChainClient) companyOf(account string) int {
+	account = normalizeAddress(account)
+	if companyID := s.companyOfAdmin[account]; companyID != 0 {
+		return companyID
+	}
+	return s.companyOfOperator[account]
+}
+
+// mine 打包一笔成功交易并返回交易哈希，event 为合约在该交易中触发的事件
+func (s *SimulatorChainClient) mine(funcName string, sender string, params []interface{}, event string, eventArgs ...interface{}) string {
+	s.blockNumber++
+
+	seed := make([]byte, 16)
+	rand.Read(seed)
+	digest := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%v|%d|%x", funcName, sender, params, s.blockNumber, seed)))
+	txHash := "0x" + hex.EncodeToString(digest[:])
+
+	s.transactions[txHash] = map[string]interface{}{
+		"hash":        txHash,
+		"blockNumber": "0x" + strconv.FormatInt(s.blockNumber, 16),
+		"from":        normalizeAddress(sender),
+		"to":          simContractAddress,
+		"funcName":    funcName,
+		"funcParam":   params,
+		"status":      receiptStatusSuccess,
+	}
+	s.blockTxs[s.blockNumber] = []string{txHash}
+
+	if s.Events != nil {
+		topics, data, err := s.Events.EncodeLog(event, eventArgs...)
+		if err != nil {
+			logs.Error("模拟链编码事件失败 [event=%s, error=%v]", event, err)
+		} else {
+			s.txLogs[txHash] = []ChainLog{{
+				Address:         simContractAddress,
+				Topics:          topics,
+				Data:            data,
+				LogIndex:        0,
+				BlockNumber:     s.blockNumber,
+				TransactionHash: txHash,
+			}}
+		}
+	}
+	return txHash
+}
+
+// RegisterCompany 注册公司 (仅超级管理员)
+func (s *SimulatorChainClient) RegisterCompany(name string, companyType int, adminAddress string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 与WebaseService一致，注册公司总是以超级管理员身份发起
+	sender := s.superAdmin
+	if companyType < 0 || companyType > 3 {
+		return "", s.revert("registerCompany", "无效的公司类型")
+	}
+
+	s.companyCount++
+	admin := normalizeAddress(adminAddress)
+	s.companies[s.companyCount] = &simCompany{
+		id:          s.companyCount,
+		name:        name,
+		companyType: companyType,
+		admin:       admin,
+	}
+	s.companyOfAdmin[admin] = s.companyCount
+
+	txHash := s.mine("registerCompany", sender, []interface{}{name, companyType, adminAddress},
+		"CompanyRegistered", s.companyCount, name, companyType, admin)
+	logs.Info("模拟链公司注册成功 [name=%s, chainCompanyID=%d, txHash=%s]", name, s.companyCount, txHash)
+	return txHash, nil
+}
+
+// RegisterOperator 登记操作员 (仅公司管理员，操作员归属管理员所在公司)
+func (s *SimulatorChainClient) RegisterOperator(operatorAddress string, adminAddress string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	companyID := s.companyOfAdmin[normalizeAddress(adminAddress)]
+	if _, ok := s.companies[companyID]; !ok {
+		return "", s.revert("registerOperator", "只有公司管理员可执行此操作")
+	}
+	operator := normalizeAddress(operatorAddress)
+	if s.companyOf(operator) != 0 {
+		return "", s.revert("registerOperator", "该地址已属于其他公司")
+	}
+
+	s.companyOfOperator[operator] = companyID
+	txHash := s.mine("registerOperator", adminAddress, []interface{}{operatorAddress},
+		"OperatorRegistered", companyID, operator)
+	return txHash, nil
+}
+
+// CompanyOf 获取地址所属的公司编号
+func (s *SimulatorChainClient) CompanyOf(address string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.companyOf(address), nil
+}
+
+// RemoveOperator 移除操作员 (仅公司管理员)
+func (s *SimulatorChainClient) RemoveOperator(operatorAddress string, adminAddress string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	companyID := s.companyOfAdmin[normalizeAddress(adminAddress)]
+	if _, ok := s.companies[companyID]; !ok {
+		return "", s.revert("removeOperator", "只有公司管理员可执行此操作")
+	}
+	operator := normalizeAddress(operatorAddress)
+	if s.companyOfOperator[operator] != companyID {
+		return "", s.revert("removeOperator", "该操作员不属于本公司")
+	}
+
+	delete(s.companyOfOperator, operator)
+	txHash := s.mine("removeOperator", adminAddress, []interface{}{operatorAddress},
+		"OperatorRemoved", companyID, operator)
+	return txHash, nil
+}
+
+// RegisterGood 注册货物 (仅生产商)
+func (s *SimulatorChainClient) RegisterGood(goodID string, goodName string, recordHash string, userAddress string) (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	companyID, reason := s.requireCompany(userAddress, 0)
+	if reason != "" {
+		return "", reason, s.revert("registerGood", reason)
+	}
+	if _, ok := s.goods[goodID]; ok {
+		return "", "货物ID已存在", s.revert("registerGood", "货物ID已存在")
+	}
+
+	s.goods[goodID] = &simGood{
+		goodID:         goodID,
+		ownerCompanyID: companyID,
+		goodName:       goodName,
+		registerTime:   s.Now().Unix(),
+	}
+
+	s.anchorRecord(goodID, models.StageProduction, recordHash)
+
+	txHash := s.mine("registerGood", userAddress, []interface{}{goodID, goodName, chainRecordHash(recordHash)},
+		"GoodRegistered", goodID, companyID, goodName, s.goods[goodID].registerTime)
+	return txHash, "Success", nil
+}
+
+// ShipGood 运输商追加运输段
+func (s *SimulatorChainClient) ShipGood(goodID string, fromLocation string, toLocation string, trackingNumber string, transportInfo string, recordHash string, userAddress string) (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	companyID, reason := s.requireCompany(userAddress, 1)
+	if reason != "" {
+		return "", reason, s.revert("shipGood", reason)
+	}
+	if _, ok := s.goods[goodID]; !ok {
+		return "", "货物不存在", s.revert("shipGood", "货物不存在")
+	}
+	if len(s.inspections[goodID]) > 0 {
+		return "", "该货物已验货，不能追加运输记录", s.revert("shipGood", "该货物已验货，不能追加运输记录")
+	}
+
+	leg := &simTransportLeg{
+		simStageRecord: simStageRecord{
+			companyID:    companyID,
+			operatorAddr: normalizeAddress(userAddress),
+			info:         transportInfo,
+			time:         s.Now().Unix(),
+		},
+		fromLocation:   fromLocation,
+		toLocation:     toLocation,
+		trackingNumber: trackingNumber,
+	}
+	s.legs[goodID] = append(s.legs[goodID], leg)
+	legIndex := len(s.legs[goodID]) - 1
+	s.anchorRecord(goodID, models.StageTransport, recordHash)
+
+	txHash := s.mine("shipGood", userAddress, []interface{}{goodID, fromLocation, toLocation, trackingNumber, transportInfo, chainRecordHash(recordHash)},
+		"Shipped", goodID, legIndex, companyID, leg.operatorAddr, fromLocation, toLocation, trackingNumber, transportInfo, leg.time)
+	return txHash, "Success", nil
+}
+
+// InspectGood 港口登记验货，不合格的货物可重新验货
+func (s *SimulatorChainClient) InspectGood(goodID string, inspectionInfo string, passed bool, reason string, recordHash string, userAddress string) (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	companyID, msg := s.requireCompany(userAddress, 2)
+	if msg != "" {
+		return "", msg, s.revert("inspectGood", msg)
+	}
+	if _, ok := s.goods[goodID]; !ok {
+		return "", "货物不存在", s.revert("inspectGood", "货物不存在")
+	}
+	if len(s.legs[goodID]) == 0 {
+		return "", "该货物未有运输记录", s.revert("inspectGood", "该货物未有运输记录")
+	}
+	if s.inspectionPassed(goodID) {
+		return "", "该货物已有验货记录", s.revert("inspectGood", "该货物已有验货记录")
+	}
+	if state := s.states[goodID]; state == ChainGoodStateReturned || state == ChainGoodStateDestroyed {
+		return "", "货物已退回或销毁", s.revert("inspectGood", "货物已退回或销毁")
+	}
+
+	record := &simInspection{
+		simStageRecord: simStageRecord{
+			companyID:    companyID,
+			operatorAddr: normalizeAddress(userAddress),
+			info:         inspectionInfo,
+			time:         s.Now().Unix(),
+		},
+		passed: passed,
+		reason: reason,
+	}
+	s.inspections[goodID] = append(s.inspections[goodID], record)
+	if passed {
+		s.states[goodID] = ChainGoodStateNormal
+	} else {
+		s.states[goodID] = ChainGoodStateRejected
+	}
+	s.anchorRecord(goodID, models.StageInspection, recordHash)
+
+	txHash := s.mine("inspectGood", userAddress, []interface{}{goodID, inspectionInfo, passed, reason, chainRecordHash(recordHash)},
+		"Inspected", goodID, companyID, record.operatorAddr, inspectionInfo, passed, reason, record.time)
+	return txHash, "Success", nil
+}
+
+// DisposeGood 港口处置验货不合格的货物
+func (s *SimulatorChainClient) DisposeGood(goodID string, state int, reason string, recordHash string, userAddress string) (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	companyID, msg := s.requireCompany(userAddress, 2)
+	if msg != "" {
+		return "", msg, s.revert("disposeGood", msg)
+	}
+	if _, ok := s.goods[goodID]; !ok {
+		return "", "货物不存在", s.revert("disposeGood", "货物不存在")
+	}
+	current := s.states[goodID]
+	if current != ChainGoodStateRejected && current != ChainGoodStateQuarantined {
+		return "", "只有验货不合格的货物可以处置", s.revert("disposeGood", "只有验货不合格的货物可以处置")
+	}
+	if state != ChainGoodStateQuarantined && state != ChainGoodStateReturned && state != ChainGoodStateDestroyed {
+		return "", "无效的处置类型", s.revert("disposeGood", "无效的处置类型")
+	}
+	if state == ChainGoodStateQuarantined && current == ChainGoodStateQuarantined {
+		return "", "货物已在隔离中", s.revert("disposeGood", "货物已在隔离中")
+	}
+
+	record := &simDisposition{
+		companyID:    companyID,
+		operatorAddr: normalizeAddress(userAddress),
+		state:        state,
+		reason:       reason,
+		time:         s.Now().Unix(),
+	}
+	s.dispositions[goodID] = append(s.dispositions[goodID], record)
+	s.states[goodID] = state
+	s.anchorRecord(goodID, models.StageDisposition, recordHash)
+
+	txHash := s.mine("disposeGood", userAddress, []interface{}{goodID, state, reason, chainRecordHash(recordHash)},
+		"Disposed", goodID, companyID, record.operatorAddr, state, reason, record.time)
+	return txHash, "Success", nil
+}
+
+// anchorRecord 保存环节记录哈希，对应合约的 anchorRecord，调用方需持有锁
+func (s *SimulatorChainClient) anchorRecord(goodID string, stage string, recordHash string) {
+	if s.recordHashes[goodID] == nil {
+		s.recordHashes[goodID] = make(map[string][]string)
+	}
+	s.recordHashes[goodID][stage] = append(s.recordHashes[goodID][stage], strings.ToLower(chainRecordHash(recordHash)))
+}
+
+// inspectionPassed 最新一次验货是否合格，对应合约的 isInspectionPassed
+func (s *SimulatorChainClient) inspectionPassed(goodID string) bool {
+	records := s.inspections[goodID]
+	return len(records) > 0 && records[len(records)-1].passed
+}
+
+// DeliverGood 经销商收货登记
+func (s *SimulatorChainClient) DeliverGood(goodID string, deliveryInfo string, recordHash string, userAddress string) (string, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	companyID, reason := s.requireCompany(userAddress, 3)
+	if reason != "" {
+		return "", reason, s.revert("deliverGood", reason)
+	}
+	if _, ok := s.goods[goodID]; !ok {
+		return "", "货物不存在", s.revert("deliverGood", "货物不存在")
+	}
+	if len(s.legs[goodID]) == 0 {
+		return "", "该货物未有运输记录", s.revert("deliverGood", "该货物未有运输记录")
+	}
+	if len(s.inspections[goodID]) == 0 {
+		return "", "该货物未有验货记录", s.revert("deliverGood", "该货物未有验货记录")
+	}
+	if !s.inspectionPassed(goodID) {
+		return "", "该货物未通过验货", s.revert("deliverGood", "该货物未通过验货")
+	}
+	if _, ok := s.deliveries[goodID]; ok {
+		return "", "该货物已有收货记录", s.revert("deliverGood", "该货物已有收货记录")
+	}
+
+	s.deliveries[goodID] = &simStageRecord{
+		companyID:    companyID,
+		operatorAddr: normalizeAddress(userAddress),
+		info:         deliveryInfo,
+		time:         s.Now().Unix(),
+	}
+	s.anchorRecord(goodID, models.StageDelivery, recordHash)
+
+	txHash := s.mine("deliverGood", userAddress, []interface{}{goodID, deliveryInfo, chainRecordHash(recordHash)},
+		"Delivered", goodID, companyID, normalizeAddress(userAddress), deliveryInfo, s.deliveries[goodID].time)
+	return txHash, "Success", nil
+}
+
+// rawTrace 按合约 getFullTrace 的返回格式构建原始溯源记录
+func (s *SimulatorChainClient) rawTrace(goodID string) *TraceRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trace := &TraceRecord{
+		OwnerCompanyID:       "0",
+		RegisterTime:         "0",
+		ShipCompanyID:        "0",
+		ShipOperatorAddr:     simZeroAddress,
+		ShipTime:             "0",
+		PortCompanyID:        "0",
+		InspectOperatorAddr:  simZeroAddress,
+		InspectTime:          "0",
+		DealerCompanyID:      "0",
+		DeliveryOperatorAddr: simZeroAddress,
+		DeliveryTime:         "0",
+	}
+
+	if g, ok := s.goods[goodID]; ok {
+		trace.GoodID = g.goodID
+		trace.OwnerCompanyID = strconv.Itoa(g.ownerCompanyID)
+		trace.GoodName = g.goodName
+		trace.RegisterTime = strconv.FormatInt(g.registerTime, 10)
+	}
+	for i, leg := range s.legs[goodID] {
+		// 与合约一致，getFullTrace 中的运输字段为第一段运输
+		if i == 0 {
+			trace.ShipCompanyID = strconv.Itoa(leg.companyID)
+			trace.ShipOperatorAddr = leg.operatorAddr
+			trace.TransportInfo = leg.info
+			trace.ShipTime = strconv.FormatInt(leg.time, 10)
+			trace.ShipExists = true
+		}
+		trace.TransportLegs = append(trace.TransportLegs, TransportLegRecord{
+			LegIndex:       i,
+			ShipCompanyID:  strconv.Itoa(leg.companyID),
+			OperatorAddr:   leg.operatorAddr,
+			FromLocation:   leg.fromLocation,
+			ToLocation:     leg.toLocation,
+			TrackingNumber: leg.trackingNumber,
+			TransportInfo:  leg.info,
+			Time:           strconv.FormatInt(leg.time, 10),
+		})
+	}
+	// 与合约一致，验货字段为最新一次验货
+	if records := s.inspections[goodID]; len(records) > 0 {
+		r := records[len(records)-1]
+		trace.PortCompanyID = strconv.Itoa(r.companyID)
+		trace.InspectOperatorAddr = r.operatorAddr
+		trace.InspectionInfo = r.info
+		trace.InspectTime = strconv.FormatInt(r.time, 10)
+		trace.InspectExists = true
+		trace.InspectPassed = r.passed
+		trace.InspectReason = r.reason
+	}
+	trace.GoodState = s.states[goodID]
+	for i, r := range s.dispositions[goodID] {
+		trace.Dispositions = append(trace.Dispositions, DispositionRecord{
+			Index:        i,
+			CompanyID:    strconv.Itoa(r.companyID),
+			OperatorAddr: r.operatorAddr,
+			State:        r.state,
+			Reason:       r.reason,
+			Time:         strconv.FormatInt(r.time, 10),
+		})
+	}
+	if r, ok := s.deliveries[goodID]; ok {
+		trace.DealerCompanyID = strconv.Itoa(r.companyID)
+		trace.DeliveryOperatorAddr = r.operatorAddr
+		trace.DeliveryInfo = r.info
+		trace.DeliveryTime = strconv.FormatInt(r.time, 10)
+		trace.DeliveryExists = true
+	}
+	return trace
+}
+
+// GetFullTrace 获取完整溯源信息
+func (s *SimulatorChainClient) GetFullTrace(goodID string) (*TraceRecord, error) {
+	trace := enrichTraceRecord(s.rawTrace(goodID))
+	logs.Info("模拟链获取货物溯源信息 [goodID=%s, stages=%d]", goodID, countCompletedStages(trace))
+	return trace, nil
+}
+
+// GetRawTrace 获取合约原始溯源记录
+func (s *SimulatorChainClient) GetRawTrace(goodID string) (*TraceRecord, error) {
+	return s.rawTrace(goodID), nil
+}
+
+// GetRecordHash 获取环节记录哈希
+func (s *SimulatorChainClient) GetRecordHash(goodID string, stage string, index int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := chainRecordStages[stage]; !ok {
+		return "", fmt.Errorf("未知的溯源环节: %s", stage)
+	}
+	hashes := s.recordHashes[goodID][stage]
+	if index < 0 || index >= len(hashes) {
+		return "", s.revert("getRecordHash", "环节记录不存在")
+	}
+	return hashes[index], nil
+}
+
+// GetRecordHashCount 获取某环节已锚定的记录数量
+func (s *SimulatorChainClient) GetRecordHashCount(goodID string, stage string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := chainRecordStages[stage]; !ok {
+		return 0, fmt.Errorf("未知的溯源环节: %s", stage)
+	}
+	return len(s.recordHashes[goodID][stage]), nil
+}
+
+// GetGoodStatus 获取货物当前状态：0-已创建 1-已运输 2-已验货 3-已交付 4-验货不合格 5-已隔离 6-已退回 7-已销毁
+func (s *SimulatorChainClient) GetGoodStatus(goodID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.goods[goodID]; !ok {
+		return -1, s.revert("getGoodStatus", "货物不存在")
+	}
+
+	if state := s.states[goodID]; state != ChainGoodStateNormal {
+		return state + 3, nil
+	}
+	if _, ok := s.deliveries[goodID]; ok {
+		return 3, nil
+	}
+	if len(s.inspections[goodID]) > 0 {
+		return 2, nil
+	}
+	if len(s.legs[goodID]) > 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// GetBlockNumber 获取当前区块高度，每笔成功交易出一个块
+func (s *SimulatorChainClient) GetBlockNumber() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.blockNumber, nil
+}
+
+// GetTransactionByHash 根据交易哈希获取交易信息
+func (s *SimulatorChainClient) GetTransactionByHash(txHash string) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, ok := s.transactions[strings.ToLower(txHash)]
+	if !ok {
+		return nil, errors.New("交易不存在")
+	}
+
+	result := make(map[string]interface{}, len(tx))
+	for k, v := range tx {
+		result[k] = v
+	}
+	return result, nil
+}
+
+// GetTransactionReceipt 获取交易回执，模拟链交易即时打包，回滚的交易不产生哈希
+func (s *SimulatorChainClient) GetTransactionReceipt(txHash string) (*TransactionReceipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, ok := s.transactions[strings.ToLower(txHash)]
+	if !ok {
+		return nil, ErrReceiptNotFound
+	}
+
+	return &TransactionReceipt{
+		TransactionHash: txHash,
+		BlockNumber:     parseQuantity(tx["blockNumber"]),
+		GasUsed:         simGasUsed,
+		Status:          receiptStatusSuccess,
+		Output:          "0x",
+		Logs:            append([]ChainLog(nil), s.txLogs[strings.ToLower(txHash)]...),
+	}, nil
+}
+
+// GetBlockTransactionHashes 获取指定区块内的交易哈希列表
+func (s *SimulatorChainClient) GetBlockTransactionHashes(blockNumber int64) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if blockNumber > s.blockNumber {
+		return nil, fmt.Errorf("区块不存在: %d", blockNumber)
+	}
+	return append([]string(nil), s.blockTxs[blockNumber]...), nil
+}
+
+// GetContractAddress 获取模拟合约地址
+func (s *SimulatorChainClient) GetContractAddress() string {
+	return simContractAddress
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"sea_trace_server_V2.0/models"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
+)
+
+// ConfirmationTracker 交易回执确认跟踪器
+// 轮询已发送交易的回执，记录区块高度、执行状态和回滚原因
+type ConfirmationTracker struct {
+	Chain        ChainClient
+	BatchSize    int
+	PollInterval time.Duration
+	// 自首次查询起超过该时间仍没有回执的交易标记为上链失败，不再占用待确认批次，由链上数据核对发现后重新提交
+	// 首次查询时间保存在内存中，服务重启后重新计时
+	ReceiptTimeout time.Duration
+	Now            func() time.Time
+	// Apply 更新环节记录的上链结果，默认写入数据库
+	Apply func(ref *models.StageConfirmation, chainStatus string, blockNumber int64, revertReason string) error
+
+	mu        sync.Mutex
+	firstSeen map[string]time.Time
+}
+
+// NewConfirmationTracker 创建交易回执确认跟踪器
+func NewConfirmationTracker() *ConfirmationTracker {
+	pollInterval, _ := web.AppConfig.Int("receipt_poll_interval")
+	receiptTimeout, _ := web.AppConfig.Int("receipt_timeout")
+	if pollInterval <= 0 {
+		pollInterval = 3
+	}
+	if receiptTimeout <= 0 {
+		receiptTimeout = 600
+	}
+
+	return &ConfirmationTracker{
+		Chain:          NewChainClient(),
+		BatchSize:      100,
+		PollInterval:   time.Duration(pollInterval) * time.Second,
+		ReceiptTimeout: time.Duration(receiptTimeout) * time.Second,
+		Now:            time.Now,
+		Apply:          models.ApplyStageReceipt,
+	}
+}
+
+// Start 启动后台轮询
+func (t *ConfirmationTracker) Start() {
+	go func() {
+		ticker := time.NewTicker(t.PollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			t.CheckPending()
+		}
+	}()
+
+	logs.Info("交易回执确认跟踪器已启动 [interval=%s]", t.PollInterval)
+}
+
+// CheckPending 检查所有等待确认的交易，返回本轮得到最终结果的数量
+func (t *ConfirmationTracker) CheckPending() int {
+	pending, err := models.GetStagesAwaitingConfirmation(t.BatchSize)
+	if err != nil {
+		return 0
+	}
+
+	settled := 0
+	for _, ref := range pending {
+		if t.Check(ref) {
+			settled++
+		}
+	}
+	t.prune(pending)
+	return settled
+}
+
+// confirmationKey 待确认交易的计时键，同一环节记录重新提交后交易哈希变化，重新计时
+func confirmationKey(ref *models.StageConfirmation) string {
+	return fmt.Sprintf("%s:%d:%s", ref.Stage, ref.RecordId, ref.TxHash)
+}
+
+// expired 交易自首次查询起是否已超过 ReceiptTimeout
+func (t *ConfirmationTracker) expired(ref *models.StageConfirmation) bool {
+	now := t.Now()
+	key := confirmationKey(ref)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.firstSeen == nil {
+		t.firstSeen = make(map[string]time.Time)
+	}
+	first, ok := t.firstSeen[key]
+	if !ok {
+		t.firstSeen[key] = now
+		return false
+	}
+	return now.Sub(first) > t.ReceiptTimeout
+}
+
+// prune 清理已不在待确认列表中的计时记录
+func (t *ConfirmationTracker) prune(pending []*models.StageConfirmation) {
+	keep := make(map[string]bool, len(pending))
+	for _, ref := range pending {
+		keep[confirmationKey(ref)] = true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key := range t.firstSeen {
+		if !keep[key] {
+			delete(t.firstSeen, key)
+		}
+	}
+}
+
+// timeout 没有回执的交易超时后标记为上链失败
+func (t *ConfirmationTracker) timeout(ref *models.StageConfirmation, reason string) bool {
+	if !t.expired(ref) {
+		return false
+	}
+	if err := t.Apply(ref, models.ChainStatusFailed, 0, reason); err != nil {
+		return false
+	}
+	logs.Error("交易超时未确认，已标记为上链失败 [goodID=%s, stage=%s, txHash=%s, timeout=%s, reason=%s]",
+		ref.GoodId, ref.Stage, ref.TxHash, t.ReceiptTimeout, reason)
+	return true
+}
+
+// Check 查询单笔交易回执并更新状态，返回交易是否已有最终结果
+func (t *ConfirmationTracker) Check(ref *models.StageConfirmation) bool {
+	if ref.TxHash == "" {
+		return t.timeout(ref, "缺少交易哈希，无法查询交易回执")
+	}
+
+	receipt, err := t.Chain.GetTransactionReceipt(ref.TxHash)
+	if err == ErrReceiptNotFound {
+		return t.timeout(ref, "超时未查询到交易回执")
+	}
+	if err != nil {
+		logs.Warning("查询交易回执失败 [goodID=%s, stage=%s, txHash=%s, error=%v]",
+			ref.GoodId, ref.Stage, ref.TxHash, err)
+		return false
+	}
+
+	chainStatus := models.ChainStatusConfirmed
+	if !receipt.Succeeded() {
+		chainStatus = models.ChainStatusReverted
+	}
+
+	if err := t.Apply(ref, chainStatus, receipt.BlockNumber, receipt.RevertReason); err != nil {
+		return false
+	}
+	models.UpdateTransactionReceipt(ref.TxHash, receipt.Status, receipt.BlockNumber, receipt.GasUsed, receipt.RevertReason)
+
+	if chainStatus == models.ChainStatusReverted {
+		logs.Error("交易被合约回滚 [goodID=%s, stage=%s, txHash=%s, blockNumber=%d, reason=%s]",
+			ref.GoodId, ref.Stage, ref.TxHash, receipt.BlockNumber, receipt.RevertReason)
+	} else {
+		logs.Info("交易已确认 [goodID=%s, stage=%s, txHash=%s, blockNumber=%d, gasUsed=%d]",
+			ref.GoodId, ref.Stage, ref.TxHash, receipt.BlockNumber, receipt.GasUsed)
+	}
+	return true
+}
@@ -0,0 +1,386 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"sea_trace_server_V2.0/models"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
+)
+
+// eventCheckpointKey 事件索引进度在系统配置中的键
+const eventCheckpointKey = "event_indexer_last_block"
+
+// zeroAddress 合约中未赋值的地址
+const zeroAddress = "0x0000000000000000000000000000000000000000"
+
+// EventIndexer 合约事件索引器
+// 按区块顺序读取溯源合约产生的事件日志并写入 chain_events 表
+// FISCO BCOS 的 PBFT 共识出块即最终确认，因此无需处理区块回滚
+type EventIndexer struct {
+	Chain        ChainClient
+	Decoder      *EventDecoder
+	PollInterval time.Duration
+	BatchBlocks  int64 // 每轮最多索引的区块数
+	StartBlock   int64 // 首次启动时的起始区块
+}
+
+// NewEventIndexer 创建合约事件索引器，合约ABI加载失败时返回 nil
+func NewEventIndexer() *EventIndexer {
+	abiPath, _ := web.AppConfig.String("contract_abi")
+	decoder, err := NewEventDecoderFromFile(abiPath)
+	if err != nil {
+		logs.Error("创建事件索引器失败: %v", err)
+		return nil
+	}
+
+	pollInterval, _ := web.AppConfig.Int("event_poll_interval")
+	if pollInterval <= 0 {
+		pollInterval = 5
+	}
+	startBlock, _ := web.AppConfig.Int64("event_start_block")
+	if startBlock <= 0 {
+		startBlock = 1
+	}
+
+	return &EventIndexer{
+		Chain:        NewChainClient(),
+		Decoder:      decoder,
+		PollInterval: time.Duration(pollInterval) * time.Second,
+		BatchBlocks:  500,
+		StartBlock:   startBlock,
+	}
+}
+
+// Start 启动后台索引
+func (x *EventIndexer) Start() {
+	if x == nil {
+		logs.Warning("合约事件索引器未启用")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(x.PollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			x.Sync()
+		}
+	}()
+
+	logs.Info("合约事件索引器已启动 [interval=%s, checkpoint=%d]", x.PollInterval, EventIndexCheckpoint())
+}
+
+// Sync 从上次的进度开始索引新区块，返回本轮写入的事件数量
+func (x *EventIndexer) Sync() (int, error) {
+	head, err := x.Chain.GetBlockNumber()
+	if err != nil {
+		logs.Warning("获取区块高度失败，跳过本轮事件索引: %v", err)
+		return 0, err
+	}
+
+	from := EventIndexCheckpoint() + 1
+	if from < x.StartBlock {
+		from = x.StartBlock
+	}
+	to := head
+	if to-from+1 > x.BatchBlocks {
+		to = from + x.BatchBlocks - 1
+	}
+
+	indexed, unresolved := 0, 0
+	for block := from; block <= to; block++ {
+		saved, missing, err := x.IndexBlock(block)
+		if err != nil {
+			// 区块未完整索引时不推进进度，下一轮从该区块重试
+			logs.Warning("索引区块事件失败 [block=%d, error=%v]", block, err)
+			return indexed, err
+		}
+		if err := models.SetSystemConfig(eventCheckpointKey, strconv.FormatInt(block, 10), "合约事件索引进度"); err != nil {
+			logs.Error("保存事件索引进度失败 [block=%d, error=%v]", block, err)
+			return indexed, err
+		}
+		indexed += saved
+		unresolved += missing
+	}
+
+	if unresolved > 0 {
+		x.resolveUnknownGoods()
+	}
+	if indexed > 0 {
+		logs.Info("合约事件索引完成 [from=%d, to=%d, events=%d]", from, to, indexed)
+	}
+	return indexed, nil
+}
+
+// IndexBlock 索引单个区块内本合约产生的事件，返回写入数量和无法关联货物的事件数量
+func (x *EventIndexer) IndexBlock(blockNumber int64) (int, int, error) {
+	hashes, err := x.Chain.GetBlockTransactionHashes(blockNumber)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	contract := strings.ToLower(x.Chain.GetContractAddress())
+	saved, unresolved := 0, 0
+	for _, txHash := range hashes {
+		receipt, err := x.Chain.GetTransactionReceipt(txHash)
+		if err != nil {
+			return saved, unresolved, err
+		}
+		if !receipt.Succeeded() {
+			continue
+		}
+
+		for _, log := range receipt.Logs {
+			if contract != "" && log.Address != "" && log.Address != contract {
+				continue
+			}
+			decoded, err := x.Decoder.Decode(log.Topics, log.Data)
+			if err != nil {
+				logs.Warning("解码合约事件失败 [txHash=%s, logIndex=%d, error=%v]", txHash, log.LogIndex, err)
+				continue
+			}
+			if decoded == nil {
+				continue
+			}
+
+			event := buildChainEvent(decoded, receipt, log)
+			if event.GoodIdHash != "" {
+				event.GoodId = resolveEventGoodID(txHash, event.GoodIdHash)
+				if event.GoodId == "" {
+					unresolved++
+				}
+			}
+			if err := models.SaveChainEvent(event); err != nil {
+				return saved, unresolved, err
+			}
+			saved++
+		}
+	}
+	return saved, unresolved, nil
+}
+
+// buildChainEvent 将解码后的事件转换为数据库记录
+func buildChainEvent(decoded *DecodedEvent, receipt *TransactionReceipt, log ChainLog) *models.ChainEvent {
+	payload, _ := json.Marshal(decoded.Args)
+	event := &models.ChainEvent{
+		BlockNumber: receipt.BlockNumber,
+		TxHash:      strings.ToLower(receipt.TransactionHash),
+		LogIndex:    log.LogIndex,
+		EventName:   decoded.Name,
+		Payload:     string(payload),
+	}
+
+	arg := func(name string) string {
+		if v, ok := decoded.Args[name]; ok {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+	parseInt := func(name string) int64 {
+		n, _ := strconv.ParseInt(arg(name), 10, 64)
+		return n
+	}
+
+	switch decoded.Name {
+	case models.EventCompanyRegistered:
+		event.CompanyId = parseInt("id")
+		event.OperatorAddr = arg("admin")
+		event.Info = arg("name")
+	case models.EventGoodRegistered:
+		event.GoodIdHash = arg("goodId")
+		event.CompanyId = parseInt("ownerCompanyId")
+		event.Info = arg("goodName")
+		event.EventTime = parseInt("registerTime")
+	case models.EventShipped:
+		event.GoodIdHash = arg("goodId")
+		event.LegIndex = int(parseInt("legIndex"))
+		event.CompanyId = parseInt("shipCompanyId")
+		event.OperatorAddr = arg("operatorAddr")
+		event.Info = arg("info")
+		event.EventTime = parseInt("time")
+	case models.EventInspected:
+		event.GoodIdHash = arg("goodId")
+		event.CompanyId = parseInt("portCompanyId")
+		event.OperatorAddr = arg("operatorAddr")
+		event.Info = arg("info")
+		event.EventTime = parseInt("time")
+	case models.EventDelivered:
+		event.GoodIdHash = arg("goodId")
+		event.CompanyId = parseInt("dealerCompanyId")
+		event.OperatorAddr = arg("operatorAddr")
+		event.Info = arg("info")
+		event.EventTime = parseInt("time")
+	case models.EventOperatorRegistered, models.EventOperatorRemoved:
+		event.CompanyId = parseInt("companyId")
+		event.OperatorAddr = arg("operator")
+	case models.EventDisposed:
+		event.GoodIdHash = arg("goodId")
+		event.CompanyId = parseInt("companyId")
+		event.OperatorAddr = arg("operatorAddr")
+		event.Info = arg("reason")
+		event.EventTime = parseInt("time")
+	}
+	return event
+}
+
+// resolveEventGoodID 根据交易账本反查事件对应的货物ID
+// 事件中的 goodId 为 indexed string，日志里只有其哈希，需要与本地记录比对
+func resolveEventGoodID(txHash string, goodIDHash string) string {
+	tx, err := models.GetTransactionByHash(txHash)
+	if err != nil || tx.GoodId == "" {
+		return ""
+	}
+	if keccak256Hex([]byte(tx.GoodId)) != goodIDHash {
+		return ""
+	}
+	return tx.GoodId
+}
+
+// resolveUnknownGoods 对账本中找不到的事件，遍历货物表按哈希回填货物ID
+func (x *EventIndexer) resolveUnknownGoods() {
+	events, err := models.GetUnresolvedChainEvents(1000)
+	if err != nil || len(events) == 0 {
+		return
+	}
+	pending := make(map[string]bool, len(events))
+	for _, event := range events {
+		pending[event.GoodIdHash] = true
+	}
+
+	afterID := 0
+	for len(pending) > 0 {
+		goods, err := models.GetGoodsBatch(afterID, 500)
+		if err != nil || len(goods) == 0 {
+			break
+		}
+		for _, good := range goods {
+			hash := keccak256Hex([]byte(good.GoodId))
+			if pending[hash] {
+				models.ResolveChainEventGoodID(hash, good.GoodId)
+				delete(pending, hash)
+			}
+		}
+		afterID = goods[len(goods)-1].Id
+	}
+}
+
+// EventIndexCheckpoint 获取已完成索引的最高区块
+func EventIndexCheckpoint() int64 {
+	config, err := models.GetSystemConfig(eventCheckpointKey)
+	if err != nil {
+		return 0
+	}
+	block, _ := strconv.ParseInt(config.Value, 10, 64)
+	return block
+}
+
+// GetIndexedTrace 从已索引的事件构建溯源记录
+// 仅当货物最新的上链交易已确认且已被索引时返回记录，否则返回 nil 由调用方回退到合约查询
+func GetIndexedTrace(goodID string) *TraceRecord {
+	good, err := models.GetGoodByID(goodID)
+	if err != nil || good.ChainStatus != models.ChainStatusConfirmed || good.BlockNumber <= 0 {
+		return nil
+	}
+	if EventIndexCheckpoint() < good.BlockNumber {
+		return nil
+	}
+
+	events, err := models.GetChainEventsByGoodID(goodID)
+	if err != nil || len(events) == 0 || events[0].EventName != models.EventGoodRegistered {
+		return nil
+	}
+
+	// 未发生的环节与合约 getFullTrace 的返回保持一致
+	trace := &TraceRecord{
+		GoodID:               goodID,
+		ShipCompanyID:        "0",
+		ShipOperatorAddr:     zeroAddress,
+		ShipTime:             "0",
+		PortCompanyID:        "0",
+		InspectOperatorAddr:  zeroAddress,
+		InspectTime:          "0",
+		DealerCompanyID:      "0",
+		DeliveryOperatorAddr: zeroAddress,
+		DeliveryTime:         "0",
+	}
+	for _, event := range events {
+		companyID := strconv.FormatInt(event.CompanyId, 10)
+		eventTime := strconv.FormatInt(event.EventTime, 10)
+		switch event.EventName {
+		case models.EventGoodRegistered:
+			trace.OwnerCompanyID = companyID
+			trace.GoodName = event.Info
+			trace.RegisterTime = eventTime
+		case models.EventShipped:
+			// 与合约一致，运输字段为第一段运输
+			if !trace.ShipExists {
+				trace.ShipCompanyID = companyID
+				trace.ShipOperatorAddr = event.OperatorAddr
+				trace.TransportInfo = event.Info
+				trace.ShipTime = eventTime
+				trace.ShipExists = true
+			}
+			var payload map[string]interface{}
+			json.Unmarshal([]byte(event.Payload), &payload)
+			trace.TransportLegs = append(trace.TransportLegs, TransportLegRecord{
+				LegIndex:       event.LegIndex,
+				ShipCompanyID:  companyID,
+				OperatorAddr:   event.OperatorAddr,
+				FromLocation:   fmt.Sprint(payload["fromLocation"]),
+				ToLocation:     fmt.Sprint(payload["toLocation"]),
+				TrackingNumber: fmt.Sprint(payload["trackingNumber"]),
+				TransportInfo:  event.Info,
+				Time:           eventTime,
+			})
+		case models.EventInspected:
+			// 与合约一致，验货字段为最新一次验货
+			var payload map[string]interface{}
+			json.Unmarshal([]byte(event.Payload), &payload)
+			trace.PortCompanyID = companyID
+			trace.InspectOperatorAddr = event.OperatorAddr
+			trace.InspectionInfo = event.Info
+			trace.InspectTime = eventTime
+			trace.InspectExists = true
+			trace.InspectPassed = payload["passed"] == true
+			trace.InspectReason = fmt.Sprint(payload["reason"])
+			if trace.InspectPassed {
+				trace.GoodState = ChainGoodStateNormal
+			} else {
+				trace.GoodState = ChainGoodStateRejected
+			}
+		case models.EventDisposed:
+			var payload map[string]interface{}
+			json.Unmarshal([]byte(event.Payload), &payload)
+			state, _ := strconv.Atoi(fmt.Sprint(payload["state"]))
+			trace.GoodState = state
+			trace.Dispositions = append(trace.Dispositions, DispositionRecord{
+				Index:        len(trace.Dispositions),
+				CompanyID:    companyID,
+				OperatorAddr: event.OperatorAddr,
+				State:        state,
+				Reason:       event.Info,
+				Time:         eventTime,
+			})
+		case models.EventDelivered:
+			trace.DealerCompanyID = companyID
+			trace.DeliveryOperatorAddr = event.OperatorAddr
+			trace.DeliveryInfo = event.Info
+			trace.DeliveryTime = eventTime
+			trace.DeliveryExists = true
+		}
+	}
+	return enrichTraceRecord(trace)
+}
+
+// ReadTrace 获取货物溯源记录，优先使用已索引的事件，未索引时查询合约
+func ReadTrace(chain ChainClient, goodID string) (*TraceRecord, error) {
+	if trace := GetIndexedTrace(goodID); trace != nil {
+		return trace, nil
+	}
+	return chain.GetFullTrace(goodID)
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/beego/beego/v2/core/logs"
+	"sea_trace_server_V2.0/models"
+)
+
+// 批量操作默认配置
+const (
+	defaultBulkMaxItems = 500
+	defaultBulkWorkers  = 8
+)
+
+// BulkRegisterGoods 批量注册货物（同一批次）
+func (s *GoodsService) BulkRegisterGoods(reqs []models.GoodsRegisterRequest, companyID int, operatorID int, operatorName string, blockchainAddress string) (*models.BulkOperationResponse, error) {
+	return s.runBulk("注册", len(reqs), func(i int) (*stageWrite, error) {
+		return s.planRegister(&reqs[i], companyID, operatorID, operatorName, blockchainAddress)
+	})
+}
+
+// BulkShipGoods 批量运输货物
+func (s *GoodsService) BulkShipGoods(reqs []models.GoodsShipRequest, transporterID int, operatorID int, operatorName string, blockchainAddress string) (*models.BulkOperationResponse, error) {
+	return s.runBulk("运输", len(reqs), func(i int) (*stageWrite, error) {
+		return s.planShip(&reqs[i], transporterID, operatorID, operatorName, blockchainAddress)
+	})
+}
+
+// BulkInspectGoods 批量验货
+func (s *GoodsService) BulkInspectGoods(reqs []models.GoodsInspectRequest, inspectorID int, operatorID int, operatorName string, blockchainAddress string) (*models.BulkOperationResponse, error) {
+	return s.runBulk("验货", len(reqs), func(i int) (*stageWrite, error) {
+		return s.planInspect(&reqs[i], inspectorID, operatorID, operatorName, blockchainAddress)
+	})
+}
+
+// BulkDeliverGoods 批量交付货物
+func (s *GoodsService) BulkDeliverGoods(reqs []models.GoodsDeliverRequest, dealerID int, operatorID int, operatorName string, blockchainAddress string) (*models.BulkOperationResponse, error) {
+	return s.runBulk("交付", len(reqs), func(i int) (*stageWrite, error) {
+		return s.planDeliver(&reqs[i], dealerID, operatorID, operatorName, blockchainAddress)
+	})
+}
+
+// runBulk 执行批量操作
+// 先校验全部条目，任一条目不通过时整批不执行，返回的响应中标出不通过的条目；
+// 全部通过后逐条保存，再由有限数量的工作协程并发上链，每条返回交易哈希或错误
+func (s *GoodsService) runBulk(label string, total int, plan func(i int) (*stageWrite, error)) (*models.BulkOperationResponse, error) {
+	if total == 0 {
+		return nil, errors.New("批量操作不能为空")
+	}
+	if total > s.BulkMaxItems {
+		return nil, fmt.Errorf("单次批量操作最多%d条，当前%d条", s.BulkMaxItems, total)
+	}
+
+	// 1. 校验全部条目
+	resp := &models.BulkOperationResponse{Total: total, Items: make([]models.BulkItemResult, total)}
+	writes := make([]*stageWrite, total)
+	seen := make(map[string]int, total)
+	invalid := 0
+	for i := 0; i < total; i++ {
+		item := &resp.Items[i]
+		item.Index = i
+
+		write, err := plan(i)
+		if err == nil {
+			item.GoodID = write.goodID
+			if first, ok := seen[write.goodID]; ok {
+				err = fmt.Errorf("与第%d条货物ID重复", first+1)
+			} else {
+				seen[write.goodID] = i
+			}
+		}
+		if err != nil {
+			item.Status = models.BulkItemInvalid
+			item.Error = err.Error()
+			invalid++
+			continue
+		}
+		writes[i] = write
+	}
+	if invalid > 0 {
+		resp.Failed = invalid
+		return resp, fmt.Errorf("批量%s校验未通过: %d/%d 条数据有误，未执行任何操作", label, invalid, total)
+	}
+
+	// 2. 逐条保存，单条失败不影响其他条目
+	saved := make([]int, 0, total)
+	for i, write := range writes {
+		if err := write.save(); err != nil {
+			resp.Items[i].Status = models.BulkItemFailed
+			resp.Items[i].Error = err.Error()
+			continue
+		}
+		saved = append(saved, i)
+	}
+
+	// 3. 并发上链
+	s.dispatchBulk(writes, saved, resp.Items)
+
+	for _, item := range resp.Items {
+		if item.Status == models.BulkItemFailed {
+			resp.Failed++
+		} else {
+			resp.Succeeded++
+		}
+	}
+	logs.Info("批量%s完成 [total=%d, succeeded=%d, failed=%d]", label, total, resp.Succeeded, resp.Failed)
+	return resp, nil
+}
+
+// dispatchBulk 使用有限数量的工作协程发送已保存条目的发件箱记录
+// 未能立即上链的记录保留在发件箱中，由后台调度器重试
+func (s *GoodsService) dispatchBulk(writes []*stageWrite, indexes []int, items []models.BulkItemResult) {
+	workers := s.BulkWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(indexes) {
+		workers = len(indexes)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				outbox := writes[i].outbox
+				if err := s.Dispatcher.Dispatch(outbox); err != nil {
+					logs.Warning("货物信息暂未上链，已加入重试队列 [goodID=%s, stage=%s, error=%v]",
+						outbox.GoodId, outbox.Stage, err)
+					items[i].Status = models.BulkItemQueued
+					items[i].ChainStatus = models.ChainStatusPending
+					items[i].Error = err.Error()
+					continue
+				}
+				items[i].Status = models.BulkItemSubmitted
+				items[i].TxHash = outbox.TxHash
+				items[i].ChainStatus = models.ChainStatusPendingConfirmation
+			}
+		}()
+	}
+	for _, i := range indexes {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
@@ -1,362 +1,430 @@
 package services
 
 import (
-	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
 	"github.com/google/uuid"
 	"sea_trace_server_V2.0/models"
 )
 
 // GoodsService 货物业务服务
 type GoodsService struct {
-	WebaseService *WebaseService
+	Chain        ChainClient
+	Dispatcher   *OutboxDispatcher
+	BulkMaxItems int // 单次批量操作最多条数
+	BulkWorkers  int // 批量操作并发上链的工作协程数
 }
 
 // NewGoodsService 创建货物服务实例
 func NewGoodsService() *GoodsService {
+	bulkMaxItems, _ := web.AppConfig.Int("bulk_max_items")
+	if bulkMaxItems <= 0 {
+		bulkMaxItems = defaultBulkMaxItems
+	}
+	bulkWorkers, _ := web.AppConfig.Int("bulk_workers")
+	if bulkWorkers <= 0 {
+		bulkWorkers = defaultBulkWorkers
+	}
+
 	return &GoodsService{
-		WebaseService: NewWebaseService(),
+		Chain:        NewChainClient(),
+		Dispatcher:   NewOutboxDispatcher(),
+		BulkMaxItems: bulkMaxItems,
+		BulkWorkers:  bulkWorkers,
 	}
 }
 
-// RegisterGood 注册货物
-func (s *GoodsService) RegisterGood(req *models.GoodsRegisterRequest, companyID int, operatorID int, operatorName string, blockchainAddress string) (*models.GoodsBasicResponse, error) {
-	// 1. 生成唯一货物ID
-	goodID := s.generateGoodID(companyID)
+// stageWrite 一次经过校验、尚未保存的环节写入
+type stageWrite struct {
+	goodID string
+	label  string // 环节名称，用于日志和错误信息
+	from   models.GoodsStatus
+	to     models.GoodsStatus
+	good   *models.Goods // 仅登记货物时使用
+	record interface{}   // 环节记录，登记时为 GoodsProduction
+	outbox *models.ChainOutbox
+}
 
-	// 2. 获取公司信息
-	company, err := models.GetCompanyByID(companyID)
+// save 在同一事务中保存环节记录、推进货物状态并写入上链发件箱记录，保存后失效该货物的溯源查询缓存
+func (w *stageWrite) save() error {
+	var err error
+	if production, ok := w.record.(*models.GoodsProduction); ok {
+		err = models.SaveGoodRegistration(w.good, production, w.outbox)
+	} else {
+		err = models.SaveGoodsStage(w.goodID, w.from, w.to, w.record, w.outbox)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("获取公司信息失败: %v", err)
+		return fmt.Errorf("保存货物%s信息失败: %v", w.label, err)
 	}
+	DefaultTraceCache().Invalidate(w.goodID)
+	return nil
+}
 
-	// 3. 保存货物基本信息
-	good, err := models.SaveGood(goodID, req.GoodName, companyID, req.Description, req.BatchNumber)
-	if err != nil {
-		return nil, fmt.Errorf("保存货物基本信息失败: %v", err)
-	}
-
-	// 4. 保存货物生产信息
-	production, err := models.SaveGoodsProduction(
-		good.Id,
-		goodID,
-		req.Location,
-		req.BatchInfo,
-		req.QualityLevel,
-		operatorID,
-		operatorName,
-		req.ExpiryDate,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("保存货物生产信息失败: %v", err)
+// commit 保存环节写入并立即尝试上链，失败时由后台调度器重试
+func (s *GoodsService) commit(w *stageWrite) (*models.GoodsBasicResponse, error) {
+	if err := w.save(); err != nil {
+		return nil, err
 	}
+	s.dispatchNow(w.outbox)
 
-	// 5. 将货物信息上链
-	txHash, message, err := s.WebaseService.RegisterGood(goodID, req.GoodName, blockchainAddress)
+	logs.Info("货物%s信息记录成功 [goodID=%s, status=%d, outboxStatus=%s, txHash=%s]",
+		w.label, w.goodID, w.to, w.outbox.Status, w.outbox.TxHash)
+	return s.buildResponse(w.goodID)
+}
+
+// RegisterGood 注册货物
+func (s *GoodsService) RegisterGood(req *models.GoodsRegisterRequest, companyID int, operatorID int, operatorName string, blockchainAddress string) (*models.GoodsBasicResponse, error) {
+	write, err := s.planRegister(req, companyID, operatorID, operatorName, blockchainAddress)
 	if err != nil {
-		return nil, fmt.Errorf("货物信息上链失败: %v", err)
-	}
-	if message != "Success" {
-		return nil, fmt.Errorf("货物信息上链失败: %v", message)
+		return nil, err
 	}
+	return s.commit(write)
+}
 
-	// 6. 更新区块链交易哈希
-	good.BlockchainTxHash = txHash
-	err = models.UpdateGood(good)
+// planRegister 校验货物注册请求并生成货物、生产信息和上链发件箱记录
+func (s *GoodsService) planRegister(req *models.GoodsRegisterRequest, companyID int, operatorID int, operatorName string, blockchainAddress string) (*stageWrite, error) {
+	// 1. 获取公司信息并按生命周期定义校验
+	company, err := models.GetCompanyByID(companyID)
 	if err != nil {
-		logs.Warning("更新货物区块链交易哈希失败: %v", err)
+		return nil, fmt.Errorf("获取公司信息失败: %v", err)
 	}
-
-	production.BlockchainTxHash = txHash
-	err = models.UpdateGoodsProduction(production)
+	transition, err := models.CheckGoodsTransition(models.GoodsActionRegister, 0, company.CompanyType, req)
 	if err != nil {
-		logs.Warning("更新生产信息区块链交易哈希失败: %v", err)
+		return nil, err
 	}
 
-	// 7. 构建响应
-	response := &models.GoodsBasicResponse{
-		ID:               good.Id,
-		GoodID:           good.GoodId,
-		GoodName:         good.GoodName,
-		BatchNumber:      good.BatchNumber,
-		OwnerCompanyId:   good.OwnerCompanyId,
-		OwnerCompany:     company.CompanyName,
-		Description:      good.Description,
-		Status:           good.Status,
-		StatusText:       models.GoodsStatusMap[good.Status],
-		CreatedAt:        good.CreatedAt,
-		UpdatedAt:        good.UpdatedAt,
-		BlockchainTxHash: txHash,
+	// 2. 生成唯一货物ID
+	goodID := s.generateGoodID(companyID)
+
+	// 3. 构建货物基本信息、生产信息和上链发件箱记录
+	good := &models.Goods{
+		GoodId:         goodID,
+		GoodName:       req.GoodName,
+		OwnerCompanyId: companyID,
+		Description:    req.Description,
+		BatchNumber:    req.BatchNumber,
+		Status:         transition.To,
+		ChainStatus:    models.ChainStatusPending,
+	}
+	production := &models.GoodsProduction{
+		GoodId:       goodID,
+		Location:     req.Location,
+		BatchInfo:    req.BatchInfo,
+		QualityLevel: req.QualityLevel,
+		ProducedAt:   recordNow(),
+		ExpiryDate:   req.ExpiryDate.Truncate(time.Second),
+		OperatorId:   operatorID,
+		OperatorName: operatorName,
+		ChainStatus:  models.ChainStatusPending,
+	}
+	params, err := recordHashParams(good, production, goodID, req.GoodName)
+	if err != nil {
+		return nil, err
 	}
+	outbox := models.NewChainOutbox(goodID, transition.Stage, transition.FuncName, params, blockchainAddress)
 
-	logs.Info("货物注册成功 [goodID=%s, goodName=%s, companyID=%d, txHash=%s, time=%s]",
-		goodID, req.GoodName, companyID, txHash, "2025-05-15 02:50:46")
+	return &stageWrite{goodID: goodID, label: "注册", to: transition.To, good: good, record: production, outbox: outbox}, nil
+}
 
-	return response, nil
+// recordNow 环节记录的时间，取整到秒以便与数据库中保存的时间一致，保证记录哈希可复算
+func recordNow() time.Time {
+	return time.Now().Truncate(time.Second)
 }
 
-// ShipGood 运输货物
-func (s *GoodsService) ShipGood(req *models.GoodsShipRequest, transporterID int, operatorID int, operatorName string, blockchainAddress string) (*models.GoodsBasicResponse, error) {
-	// 1. 获取货物信息
-	good, err := models.GetGoodByID(req.GoodID)
+// recordHashParams 在上链参数末尾追加环节记录哈希，写入合约后用于核验数据库记录是否被修改
+func recordHashParams(good *models.Goods, record interface{}, params ...string) ([]string, error) {
+	hash, err := models.StageRecordHash(good, record)
 	if err != nil {
-		return nil, fmt.Errorf("获取货物信息失败: %v", err)
+		return nil, fmt.Errorf("计算环节记录哈希失败: %v", err)
 	}
+	return append(params, hash), nil
+}
 
-	// 2. 检查货物状态
-	if good.Status != models.GoodsStatusProduced {
-		return nil, errors.New("当前货物状态不允许运输，只有已生产的货物可以运输")
+// checkStage 获取货物和执行公司，并按生命周期定义校验该操作
+func (s *GoodsService) checkStage(action string, goodID string, companyID int, req interface{}) (*models.Goods, *models.Company, *models.GoodsTransition, error) {
+	good, err := models.GetGoodByID(goodID)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("获取货物信息失败: %v", err)
 	}
 
-	// 3. 获取公司信息
-	company, err := models.GetCompanyByID(transporterID)
-	if err != nil {
-		return nil, fmt.Errorf("获取运输商信息失败: %v", err)
-	}
-
-	if company.CompanyType != models.Shipper {
-		return nil, errors.New("只有运输商公司才能执行运输操作")
-	}
-
-	// 4. 保存货物运输信息
-	transport, err := models.SaveGoodsTransport(
-		good.Id,
-		req.GoodID,
-		transporterID,
-		company.CompanyName,
-		operatorID,
-		operatorName,
-		req.StartLocation,
-		req.EndLocation,
-		req.TransportInfo,
-		req.EndTime,
-		req.TrackingNumber,
-	)
+	company, err := models.GetCompanyByID(companyID)
 	if err != nil {
-		return nil, fmt.Errorf("保存货物运输信息失败: %v", err)
+		return nil, nil, nil, fmt.Errorf("获取公司信息失败: %v", err)
 	}
 
-	// 5. 将货物运输信息上链
-	txHash, message, err := s.WebaseService.ShipGood(req.GoodID, req.TransportInfo, blockchainAddress)
+	transition, err := models.CheckGoodsTransition(action, good.Status, company.CompanyType, req)
 	if err != nil {
-		return nil, fmt.Errorf("货物信息上链失败: %v", err)
+		return nil, nil, nil, err
 	}
-	if message != "Success" {
-		return nil, fmt.Errorf("货物信息上链失败: %v", message)
+	if transition.RequiresHandler(good.Status) &&
+		!models.CompanyScope(companyID).CanAccessGood(good, models.GetGoodStages(goodID)) {
+		return nil, nil, nil, fmt.Errorf("只有经手过该货物的公司才能执行%s操作", transition.Name)
 	}
+	if transition.RequiresCarrier(good.Status) && !models.GetGoodStages(goodID).CanAppendLeg(companyID) {
+		return nil, nil, nil, fmt.Errorf("只有最后一段运输的承运方或其指定的接续承运方才能执行%s操作", transition.Name)
+	}
+	return good, company, transition, nil
+}
 
-	// 6. 更新区块链交易哈希和货物状态
-	transport.BlockchainTxHash = txHash
-	err = models.UpdateGoodsTransport(transport)
+// ShipGood 运输货物，已运输的货物可继续追加运输段（如陆运后转海运、中转）
+func (s *GoodsService) ShipGood(req *models.GoodsShipRequest, transporterID int, operatorID int, operatorName string, blockchainAddress string) (*models.GoodsBasicResponse, error) {
+	write, err := s.planShip(req, transporterID, operatorID, operatorName, blockchainAddress)
 	if err != nil {
-		logs.Warning("更新运输信息区块链交易哈希失败: %v", err)
+		return nil, err
 	}
+	return s.commit(write)
+}
 
-	err = models.UpdateGoodStatus(req.GoodID, models.GoodsStatusShipped, txHash)
+// planShip 校验运输请求并生成运输段和上链发件箱记录
+func (s *GoodsService) planShip(req *models.GoodsShipRequest, transporterID int, operatorID int, operatorName string, blockchainAddress string) (*stageWrite, error) {
+	good, company, transition, err := s.checkStage(models.GoodsActionShip, req.GoodID, transporterID, req)
 	if err != nil {
-		return nil, fmt.Errorf("更新货物状态失败: %v", err)
+		return nil, err
 	}
 
-	// 获取最新货物状态
-	good, _ = models.GetGoodByID(req.GoodID)
-
-	// 7. 构建响应
-	ownerCompany, _ := models.GetCompanyByID(good.OwnerCompanyId)
-	ownerCompanyName := ""
-	if ownerCompany != nil {
-		ownerCompanyName = ownerCompany.CompanyName
+	if req.NextTransporterID > 0 {
+		next, err := models.GetCompanyByID(req.NextTransporterID)
+		if err != nil || next.CompanyType != models.Shipper {
+			return nil, fmt.Errorf("指定的接续承运方不是运输商")
+		}
 	}
 
-	response := &models.GoodsBasicResponse{
-		ID:               good.Id,
-		GoodID:           good.GoodId,
-		GoodName:         good.GoodName,
-		BatchNumber:      good.BatchNumber,
-		OwnerCompanyId:   good.OwnerCompanyId,
-		OwnerCompany:     ownerCompanyName,
-		Description:      good.Description,
-		Status:           good.Status,
-		StatusText:       models.GoodsStatusMap[good.Status],
-		CreatedAt:        good.CreatedAt,
-		UpdatedAt:        good.UpdatedAt,
-		BlockchainTxHash: txHash,
+	legIndex, err := models.CountTransportLegs(req.GoodID)
+	if err != nil {
+		return nil, fmt.Errorf("获取货物运输段失败: %v", err)
+	}
+
+	transport := &models.GoodsTransport{
+		GoodsId:           good.Id,
+		GoodId:            req.GoodID,
+		LegIndex:          legIndex,
+		TransporterId:     transporterID,
+		TransporterName:   company.CompanyName,
+		OperatorId:        operatorID,
+		OperatorName:      operatorName,
+		StartLocation:     req.StartLocation,
+		EndLocation:       req.EndLocation,
+		TransportInfo:     req.TransportInfo,
+		StartTime:         recordNow(),
+		EndTime:           req.EndTime.Truncate(time.Second),
+		TrackingNumber:    req.TrackingNumber,
+		NextTransporterId: req.NextTransporterID,
+		ChainStatus:       models.ChainStatusPending,
+	}
+	params, err := recordHashParams(nil, transport, req.GoodID, req.StartLocation, req.EndLocation, req.TrackingNumber, req.TransportInfo)
+	if err != nil {
+		return nil, err
 	}
+	outbox := models.NewChainOutbox(req.GoodID, transition.Stage, transition.FuncName, params, blockchainAddress)
 
-	logs.Info("货物运输信息记录成功 [goodID=%s, transporter=%s, txHash=%s, time=%s]",
-		req.GoodID, company.CompanyName, txHash, "2025-05-15 02:50:46")
-
-	return response, nil
+	return &stageWrite{goodID: req.GoodID, label: "运输", from: good.Status, to: transition.To, record: transport, outbox: outbox}, nil
 }
 
-// InspectGood 验货
+// InspectGood 验货，合格的货物进入已验货状态，不合格的进入验货不合格状态
+// 验货不合格或已隔离的货物可以重新验货
 func (s *GoodsService) InspectGood(req *models.GoodsInspectRequest, inspectorID int, operatorID int, operatorName string, blockchainAddress string) (*models.GoodsBasicResponse, error) {
-	// 1. 获取货物信息
-	good, err := models.GetGoodByID(req.GoodID)
+	write, err := s.planInspect(req, inspectorID, operatorID, operatorName, blockchainAddress)
 	if err != nil {
-		return nil, fmt.Errorf("获取货物信息失败: %v", err)
-	}
-
-	// 2. 检查货物状态
-	if good.Status != models.GoodsStatusShipped {
-		return nil, errors.New("当前货物状态不允许验货，只有已运输的货物可以验货")
+		return nil, err
 	}
+	return s.commit(write)
+}
 
-	// 3. 获取公司信息
-	company, err := models.GetCompanyByID(inspectorID)
-	if err != nil {
-		return nil, fmt.Errorf("获取验货商信息失败: %v", err)
-	}
-
-	if company.CompanyType != models.Port {
-		return nil, errors.New("只有验货商公司才能执行验货操作")
-	}
-
-	// 4. 保存货物验货信息
-	inspection, err := models.SaveGoodsInspection(
-		good.Id,
-		req.GoodID,
-		inspectorID,
-		company.CompanyName,
-		operatorID,
-		operatorName,
-		req.InspectionInfo,
-		req.QualityScore,
-		req.PassStatus,
-		req.Location,
-		req.Notes,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("保存货物验货信息失败: %v", err)
+// planInspect 校验验货请求并生成验货记录和上链发件箱记录，按验货结果校验对应的操作
+func (s *GoodsService) planInspect(req *models.GoodsInspectRequest, inspectorID int, operatorID int, operatorName string, blockchainAddress string) (*stageWrite, error) {
+	action := models.GoodsActionInspect
+	if !req.PassStatus {
+		action = models.GoodsActionReject
 	}
-
-	// 5. 将货物验货信息上链
-	txHash, message, err := s.WebaseService.InspectGood(req.GoodID, req.InspectionInfo, blockchainAddress)
+	good, company, transition, err := s.checkStage(action, req.GoodID, inspectorID, req)
 	if err != nil {
-		return nil, fmt.Errorf("货物验货信息上链失败: %v", err)
-	}
-	if message != "Success" {
-		return nil, fmt.Errorf("货物信息上链失败: %v", message)
-	}
-
-	// 6. 更新区块链交易哈希和货物状态
-	inspection.BlockchainTxHash = txHash
-	err = models.UpdateGoodsInspection(inspection)
+		return nil, err
+	}
+
+	inspection := &models.GoodsInspection{
+		GoodsId:        good.Id,
+		GoodId:         req.GoodID,
+		InspectorId:    inspectorID,
+		InspectorName:  company.CompanyName,
+		OperatorId:     operatorID,
+		OperatorName:   operatorName,
+		InspectionInfo: req.InspectionInfo,
+		QualityScore:   req.QualityScore,
+		PassStatus:     req.PassStatus,
+		RejectReason:   req.RejectReason,
+		InspectionTime: recordNow(),
+		Location:       req.Location,
+		Notes:          req.Notes,
+		ChainStatus:    models.ChainStatusPending,
+	}
+	params, err := recordHashParams(nil, inspection, req.GoodID, req.InspectionInfo, strconv.FormatBool(req.PassStatus), req.RejectReason)
 	if err != nil {
-		logs.Warning("更新验货信息区块链交易哈希失败: %v", err)
+		return nil, err
 	}
+	outbox := models.NewChainOutbox(req.GoodID, transition.Stage, transition.FuncName, params, blockchainAddress)
 
-	err = models.UpdateGoodStatus(req.GoodID, models.GoodsStatusInspected, txHash)
-	if err != nil {
-		return nil, fmt.Errorf("更新货物状态失败: %v", err)
-	}
+	return &stageWrite{goodID: req.GoodID, label: "验货", from: good.Status, to: transition.To, record: inspection, outbox: outbox}, nil
+}
 
-	// 获取最新货物状态
-	good, _ = models.GetGoodByID(req.GoodID)
+// disposeChainStates 处置后的货物状态对应的合约处置状态
+var disposeChainStates = map[models.GoodsStatus]int{
+	models.GoodsStatusQuarantined:        ChainGoodStateQuarantined,
+	models.GoodsStatusReturnedToProducer: ChainGoodStateReturned,
+	models.GoodsStatusDestroyed:          ChainGoodStateDestroyed,
+}
 
-	// 7. 构建响应
-	ownerCompany, _ := models.GetCompanyByID(good.OwnerCompanyId)
-	ownerCompanyName := ""
-	if ownerCompany != nil {
-		ownerCompanyName = ownerCompany.CompanyName
+// DisposeGood 处置验货不合格的货物：隔离、退回生产商或销毁
+func (s *GoodsService) DisposeGood(req *models.GoodsDisposeRequest, companyID int, operatorID int, operatorName string, blockchainAddress string) (*models.GoodsBasicResponse, error) {
+	t := models.GetGoodsTransition(req.Action)
+	if t == nil || t.Stage != models.StageDisposition {
+		return nil, fmt.Errorf("无效的处置方式: %s", req.Action)
 	}
-
-	response := &models.GoodsBasicResponse{
-		ID:               good.Id,
-		GoodID:           good.GoodId,
-		GoodName:         good.GoodName,
-		BatchNumber:      good.BatchNumber,
-		OwnerCompanyId:   good.OwnerCompanyId,
-		OwnerCompany:     ownerCompanyName,
-		Description:      good.Description,
-		Status:           good.Status,
-		StatusText:       models.GoodsStatusMap[good.Status],
-		CreatedAt:        good.CreatedAt,
-		UpdatedAt:        good.UpdatedAt,
-		BlockchainTxHash: txHash,
+	good, company, transition, err := s.checkStage(req.Action, req.GoodID, companyID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	disposition := &models.GoodsDisposition{
+		GoodsId:      good.Id,
+		GoodId:       req.GoodID,
+		FromStatus:   good.Status,
+		ToStatus:     transition.To,
+		Reason:       req.Reason,
+		CompanyId:    companyID,
+		CompanyName:  company.CompanyName,
+		OperatorId:   operatorID,
+		OperatorName: operatorName,
+		ChainStatus:  models.ChainStatusPending,
+		CreatedAt:    recordNow(),
+	}
+	params, err := recordHashParams(nil, disposition, req.GoodID, strconv.Itoa(disposeChainStates[transition.To]), req.Reason)
+	if err != nil {
+		return nil, err
 	}
+	outbox := models.NewChainOutbox(req.GoodID, transition.Stage, transition.FuncName, params, blockchainAddress)
 
-	logs.Info("货物验货信息记录成功 [goodID=%s, inspector=%s, passed=%v, txHash=%s, time=%s]",
-		req.GoodID, company.CompanyName, req.PassStatus, txHash, "2025-05-15 02:50:46")
-
-	return response, nil
+	return s.commit(&stageWrite{goodID: req.GoodID, label: "处置", from: good.Status, to: transition.To, record: disposition, outbox: outbox})
 }
 
 // DeliverGood 交付货物
 func (s *GoodsService) DeliverGood(req *models.GoodsDeliverRequest, dealerID int, operatorID int, operatorName string, blockchainAddress string) (*models.GoodsBasicResponse, error) {
-	// 1. 获取货物信息
-	good, err := models.GetGoodByID(req.GoodID)
+	write, err := s.planDeliver(req, dealerID, operatorID, operatorName, blockchainAddress)
 	if err != nil {
-		return nil, fmt.Errorf("获取货物信息失败: %v", err)
-	}
-
-	// 2. 检查货物状态
-	if good.Status != models.GoodsStatusInspected {
-		return nil, errors.New("当前货物状态不允许交付，只有已验货的货物可以交付")
+		return nil, err
 	}
+	return s.commit(write)
+}
 
-	// 3. 获取公司信息
-	company, err := models.GetCompanyByID(dealerID)
+// planDeliver 校验交付请求并生成交付记录和上链发件箱记录
+func (s *GoodsService) planDeliver(req *models.GoodsDeliverRequest, dealerID int, operatorID int, operatorName string, blockchainAddress string) (*stageWrite, error) {
+	good, company, transition, err := s.checkStage(models.GoodsActionDeliver, req.GoodID, dealerID, req)
 	if err != nil {
-		return nil, fmt.Errorf("获取经销商信息失败: %v", err)
-	}
-
-	if company.CompanyType != models.Dealer {
-		return nil, errors.New("只有经销商公司才能执行交付操作")
-	}
-
-	// 4. 保存货物交付信息
-	delivery, err := models.SaveGoodsDelivery(
-		good.Id,
-		req.GoodID,
-		dealerID,
-		company.CompanyName,
-		operatorID,
-		operatorName,
-		req.DeliveryInfo,
-		req.RecipientName,
-		req.RecipientContact,
-		req.Location,
-		req.Notes,
-	)
+		return nil, err
+	}
+
+	delivery := &models.GoodsDelivery{
+		GoodsId:          good.Id,
+		GoodId:           req.GoodID,
+		DealerId:         dealerID,
+		DealerName:       company.CompanyName,
+		OperatorId:       operatorID,
+		OperatorName:     operatorName,
+		DeliveryInfo:     req.DeliveryInfo,
+		RecipientName:    req.RecipientName,
+		RecipientContact: req.RecipientContact,
+		DeliveryTime:     recordNow(),
+		Location:         req.Location,
+		Notes:            req.Notes,
+		ChainStatus:      models.ChainStatusPending,
+	}
+	params, err := recordHashParams(nil, delivery, req.GoodID, req.DeliveryInfo)
 	if err != nil {
-		return nil, fmt.Errorf("保存货物交付信息失败: %v", err)
+		return nil, err
 	}
+	outbox := models.NewChainOutbox(req.GoodID, transition.Stage, transition.FuncName, params, blockchainAddress)
+
+	return &stageWrite{goodID: req.GoodID, label: "交付", from: good.Status, to: transition.To, record: delivery, outbox: outbox}, nil
+}
 
-	// 5. 将货物交付信息上链
-	txHash, message, err := s.WebaseService.DeliverGood(req.GoodID, req.DeliveryInfo, blockchainAddress)
+// GetGoodsTransitions 获取货物当前可执行的操作，permitted 表示该公司类型能否执行
+// 访问范围外的货物只有在本公司可以接手（执行交接操作）时才返回
+func (s *GoodsService) GetGoodsTransitions(goodID string, companyType models.CompanyType, scope models.DataScope) (*models.GoodsTransitionsResponse, error) {
+	good, err := models.GetGoodByID(goodID)
 	if err != nil {
-		return nil, fmt.Errorf("货物交付信息上链失败: %v", err)
+		return nil, fmt.Errorf("获取货物信息失败: %v", models.ErrOutOfScope)
+	}
+	stages := models.GetGoodStages(goodID)
+	if !scope.CanAccessGood(good, stages) && !canTakeOver(good.Status, stages, scope.CompanyID, companyType) {
+		return nil, fmt.Errorf("获取货物信息失败: %v", models.ErrOutOfScope)
+	}
+
+	response := &models.GoodsTransitionsResponse{
+		GoodID:      good.GoodId,
+		Status:      good.Status,
+		StatusText:  models.GoodsStatusMap[good.Status],
+		Transitions: []models.GoodsTransitionOption{},
+	}
+	for _, t := range models.AvailableGoodsTransitions(good.Status) {
+		response.Transitions = append(response.Transitions, models.GoodsTransitionOption{
+			Action:          t.Action,
+			Name:            t.Name,
+			To:              t.To,
+			ToText:          models.GoodsStatusMap[t.To],
+			CompanyType:     t.CompanyType,
+			CompanyTypeText: models.CompanyTypeMap[t.CompanyType],
+			RequiredFields:  t.RequiredFields,
+			Permitted:       t.CompanyType == companyType,
+		})
 	}
-	if message != "Success" {
-		return nil, fmt.Errorf("货物信息上链失败: %v", message)
+	return response, nil
+}
+
+// canTakeOver 该公司能否接手处于该状态的货物
+func canTakeOver(status models.GoodsStatus, stages *models.GoodStages, companyID int, companyType models.CompanyType) bool {
+	for _, t := range models.AvailableGoodsTransitions(status) {
+		if t.CompanyType != companyType || t.RequiresHandler(status) {
+			continue
+		}
+		if t.RequiresCarrier(status) && !stages.CanAppendLeg(companyID) {
+			continue
+		}
+		return true
 	}
+	return false
+}
 
-	// 6. 更新区块链交易哈希和货物状态
-	delivery.BlockchainTxHash = txHash
-	err = models.UpdateGoodsDelivery(delivery)
-	if err != nil {
-		logs.Warning("更新交付信息区块链交易哈希失败: %v", err)
+// dispatchNow 立即发送发件箱记录
+// 发送失败不影响已提交的数据库事务，记录保留在发件箱中等待后台重试
+func (s *GoodsService) dispatchNow(outbox *models.ChainOutbox) {
+	if err := s.Dispatcher.Dispatch(outbox); err != nil {
+		logs.Warning("货物信息暂未上链，已加入重试队列 [goodID=%s, stage=%s, error=%v]",
+			outbox.GoodId, outbox.Stage, err)
 	}
+}
 
-	err = models.UpdateGoodStatus(req.GoodID, models.GoodsStatusDelivered, txHash)
+// buildResponse 读取最新货物信息并构建响应
+func (s *GoodsService) buildResponse(goodID string) (*models.GoodsBasicResponse, error) {
+	good, err := models.GetGoodByID(goodID)
 	if err != nil {
-		return nil, fmt.Errorf("更新货物状态失败: %v", err)
+		return nil, fmt.Errorf("获取货物信息失败: %v", err)
 	}
 
-	// 获取最新货物状态
-	good, _ = models.GetGoodByID(req.GoodID)
-
-	// 7. 构建响应
-	ownerCompany, _ := models.GetCompanyByID(good.OwnerCompanyId)
 	ownerCompanyName := ""
-	if ownerCompany != nil {
+	if ownerCompany, err := models.GetCompanyByID(good.OwnerCompanyId); err == nil && ownerCompany != nil {
 		ownerCompanyName = ownerCompany.CompanyName
 	}
 
-	response := &models.GoodsBasicResponse{
+	response := toGoodsBasicResponse(good, ownerCompanyName)
+	return &response, nil
+}
+
+// toGoodsBasicResponse 将货物模型转换为响应格式
+func toGoodsBasicResponse(good *models.Goods, ownerCompanyName string) models.GoodsBasicResponse {
+	return models.GoodsBasicResponse{
 		ID:               good.Id,
 		GoodID:           good.GoodId,
 		GoodName:         good.GoodName,
@@ -368,25 +436,30 @@ func (s *GoodsService) DeliverGood(req *models.GoodsDeliverRequest, dealerID int
 		StatusText:       models.GoodsStatusMap[good.Status],
 		CreatedAt:        good.CreatedAt,
 		UpdatedAt:        good.UpdatedAt,
-		BlockchainTxHash: txHash,
+		BlockchainTxHash: good.BlockchainTxHash,
+		ChainStatus:      good.ChainStatus,
+		BlockNumber:      good.BlockNumber,
+		RevertReason:     good.RevertReason,
 	}
-
-	logs.Info("货物交付信息记录成功 [goodID=%s, dealer=%s, recipient=%s, txHash=%s, time=%s]",
-		req.GoodID, company.CompanyName, req.RecipientName, txHash, "2025-05-15 02:50:46")
-
-	return response, nil
 }
 
-// GetGoodsTrace 获取货物溯源信息
-func (s *GoodsService) GetGoodsTrace(goodID string) (map[string]interface{}, error) {
-	// 1. 获取数据库溯源信息
+// GetGoodsTrace 获取访问范围内货物的溯源信息，收货人信息只对执行交付的经销商可见
+func (s *GoodsService) GetGoodsTrace(goodID string, scope models.DataScope) (map[string]interface{}, error) {
+	// 1. 校验访问范围并获取数据库溯源信息
+	_, stages, err := models.GetScopedGood(goodID, scope)
+	if err != nil {
+		return nil, fmt.Errorf("获取货物溯源信息失败: %v", err)
+	}
 	trace, err := models.GetTraceInfo(goodID)
 	if err != nil {
 		return nil, fmt.Errorf("获取货物溯源信息失败: %v", err)
 	}
+	if stages.Delivery != nil && !scope.CanViewRecipient(stages.Delivery) {
+		hideRecipient(trace)
+	}
 
-	// 2. 获取区块链溯源记录
-	blockchainTrace, err := s.WebaseService.GetFullTrace(goodID)
+	// 2. 获取区块链溯源记录，已索引的货物直接读取事件表
+	blockchainTrace, err := ReadTrace(s.Chain, goodID)
 	if err != nil {
 		logs.Warning("获取区块链溯源记录失败: %v", err)
 	} else {
@@ -398,10 +471,43 @@ func (s *GoodsService) GetGoodsTrace(goodID string) (map[string]interface{}, err
 	return trace, nil
 }
 
+// GetPublicTrace 获取公开溯源信息，各环节字段按经手公司的可见性设置筛选，人名和电话默认脱敏
+func (s *GoodsService) GetPublicTrace(goodID string) (*models.PublicTrace, error) {
+	trace, _, err := loadPublicTrace(goodID)
+	return trace, err
+}
+
+// loadPublicTrace 读取货物各环节记录并生成公开溯源视图
+func loadPublicTrace(goodID string) (*models.PublicTrace, *models.GoodStages, error) {
+	good, err := models.GetGoodByID(goodID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("货物不存在")
+	}
+	stages := models.GetGoodStages(goodID)
+
+	producer := ""
+	if company, err := models.GetCompanyByID(good.OwnerCompanyId); err == nil {
+		producer = company.CompanyName
+	}
+	visibility, err := models.GetTraceVisibilities(models.TraceCompanyIDs(good, stages))
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取公开溯源设置失败: %v", err)
+	}
+	return models.NewPublicTrace(good, producer, stages, visibility), stages, nil
+}
+
+// hideRecipient 移除溯源信息中的收货人信息
+func hideRecipient(trace map[string]interface{}) {
+	if delivery, ok := trace["delivery"].(map[string]interface{}); ok {
+		delete(delivery, "recipient_name")
+		delete(delivery, "recipient_contact")
+	}
+}
+
 // GetGoodsList 获取货物列表
-func (s *GoodsService) GetGoodsList(page, pageSize, companyID int, search string, status int) (*models.GoodsListResponse, error) {
-	// 1. 获取货物列表
-	goods, total, err := models.GetGoodsList(page, pageSize, companyID, search, status)
+func (s *GoodsService) GetGoodsList(page, pageSize int, scope models.DataScope, search string, status int) (*models.GoodsListResponse, error) {
+	// 1. 获取访问范围内的货物列表
+	goods, total, err := models.GetGoodsList(page, pageSize, scope, search, status)
 	if err != nil {
 		return nil, fmt.Errorf("获取货物列表失败: %v", err)
 	}
@@ -416,20 +522,7 @@ func (s *GoodsService) GetGoodsList(page, pageSize, companyID int, search string
 			companyName = company.CompanyName
 		}
 
-		list = append(list, models.GoodsBasicResponse{
-			ID:               good.Id,
-			GoodID:           good.GoodId,
-			GoodName:         good.GoodName,
-			BatchNumber:      good.BatchNumber,
-			OwnerCompanyId:   good.OwnerCompanyId,
-			OwnerCompany:     companyName,
-			Description:      good.Description,
-			Status:           good.Status,
-			StatusText:       models.GoodsStatusMap[good.Status],
-			CreatedAt:        good.CreatedAt,
-			UpdatedAt:        good.UpdatedAt,
-			BlockchainTxHash: good.BlockchainTxHash,
-		})
+		list = append(list, toGoodsBasicResponse(good, companyName))
 	}
 
 	// 3. 构建响应
@@ -439,7 +532,7 @@ func (s *GoodsService) GetGoodsList(page, pageSize, companyID int, search string
 	}
 
 	logs.Info("获取货物列表成功 [page=%d, pageSize=%d, companyID=%d, total=%d, time=%s]",
-		page, pageSize, companyID, total, "2025-05-15 02:50:46")
+		page, pageSize, scope.CompanyID, total, "2025-05-15 02:50:46")
 
 	return response, nil
 }
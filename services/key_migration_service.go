@@ -0,0 +1,188 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/google/uuid"
+	"sea_trace_server_V2.0/models"
+)
+
+// LocalKeyStore WeBASE-Front 本地用户私钥
+type LocalKeyStore struct {
+	Address    string `json:"address"`
+	PublicKey  string `json:"publicKey"`
+	PrivateKey string `json:"privateKey"`
+	UserName   string `json:"userName"`
+	Type       int    `json:"type"`
+}
+
+// LocalKeySource 本地用户私钥来源
+type LocalKeySource interface {
+	// ListLocalKeys 列出本地用户及其私钥
+	ListLocalKeys() ([]LocalKeyStore, error)
+	// DeleteLocalKey 删除本地用户私钥
+	DeleteLocalKey(address string) error
+}
+
+// ListLocalKeys 列出WeBASE-Front中保存的本地用户
+func (w *WebaseService) ListLocalKeys() ([]LocalKeyStore, error) {
+	body, err := w.doGetRequest(w.BaseURL + "/WeBASE-Front/privateKey/localKeyStores")
+	if err != nil {
+		return nil, err
+	}
+	var keys []LocalKeyStore
+	if err := json.Unmarshal(body, &keys); err != nil {
+		return nil, fmt.Errorf("解析本地用户列表失败: %v", err)
+	}
+	return keys, nil
+}
+
+// DeleteLocalKey 删除WeBASE-Front中的本地用户私钥
+func (w *WebaseService) DeleteLocalKey(address string) error {
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/WeBASE-Front/privateKey/%s", w.BaseURL, address), nil)
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %v", err)
+	}
+	if w.AppKey != "" && w.AppSecret != "" {
+		req.Header.Set("App-Key", w.AppKey)
+		req.Header.Set("App-Secret", w.AppSecret)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("执行请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("删除本地用户失败: HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// KeyMigrationItem 单个账户的迁移结果
+type KeyMigrationItem struct {
+	Owner      string `json:"owner"` // 账户所有者，如 company:1、user:2、super_admin
+	Address    string `json:"address"`
+	SignUserID string `json:"sign_user_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// KeyMigrationReport 迁移报告
+type KeyMigrationReport struct {
+	Migrated []KeyMigrationItem `json:"migrated"`
+	Skipped  []KeyMigrationItem `json:"skipped"` // WeBASE-Front中没有对应私钥的账户
+	Failed   []KeyMigrationItem `json:"failed"`
+}
+
+// KeyMigrationService 将WeBASE-Front本地用户迁移为WeBASE-Sign外部用户
+// 私钥仅在迁移过程中经过内存转交给签名服务，不写入日志和数据库；迁移后地址不变，链上的公司和操作员登记无需改动
+type KeyMigrationService struct {
+	Local LocalKeySource
+	Sign  SignService
+	AppID string
+}
+
+// NewKeyMigrationService 创建私钥迁移服务实例
+func NewKeyMigrationService() *KeyMigrationService {
+	return &KeyMigrationService{
+		Local: NewWebaseService(),
+		Sign:  NewSignService(),
+		AppID: SignAppID(),
+	}
+}
+
+// MigrateKey 将一个本地用户私钥导入签名服务，并核对导入后的地址
+func (s *KeyMigrationService) MigrateKey(key *LocalKeyStore) (*SignUser, error) {
+	if key.PrivateKey == "" {
+		return nil, fmt.Errorf("WeBASE-Front未返回地址 %s 的私钥", key.Address)
+	}
+	signUser, err := s.Sign.ImportSignUser(uuid.New().String(), s.AppID, key.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("导入签名服务失败: %v", err)
+	}
+	if !strings.EqualFold(signUser.Address, key.Address) {
+		return nil, fmt.Errorf("导入后地址不一致: %s != %s", signUser.Address, key.Address)
+	}
+	return signUser, nil
+}
+
+// Run 迁移全部仍为本地用户的公司、用户和超级管理员账户
+// deleteLocal 为 true 时迁移成功后删除WeBASE-Front中的本地私钥
+func (s *KeyMigrationService) Run(superAdminAddress string, deleteLocal bool) (*KeyMigrationReport, error) {
+	keys, err := s.Local.ListLocalKeys()
+	if err != nil {
+		return nil, fmt.Errorf("获取本地用户失败: %v", err)
+	}
+	keyByAddress := make(map[string]*LocalKeyStore, len(keys))
+	for i := range keys {
+		keyByAddress[strings.ToLower(keys[i].Address)] = &keys[i]
+	}
+
+	companies, err := models.GetLocalBlockchainCompanies()
+	if err != nil {
+		return nil, fmt.Errorf("获取公司失败: %v", err)
+	}
+	users, err := models.GetLocalBlockchainUsers()
+	if err != nil {
+		return nil, fmt.Errorf("获取用户失败: %v", err)
+	}
+
+	report := &KeyMigrationReport{}
+	migrate := func(owner string, address string, save func(signUserID string) error) {
+		item := KeyMigrationItem{Owner: owner, Address: address}
+		key, ok := keyByAddress[strings.ToLower(address)]
+		if !ok {
+			report.Skipped = append(report.Skipped, item)
+			return
+		}
+
+		signUser, err := s.MigrateKey(key)
+		if err == nil {
+			err = save(signUser.SignUserID)
+		}
+		if err != nil {
+			item.Error = err.Error()
+			report.Failed = append(report.Failed, item)
+			logs.Error("迁移区块链账户失败 [owner=%s, address=%s, error=%v]", owner, address, err)
+			return
+		}
+
+		item.SignUserID = signUser.SignUserID
+		report.Migrated = append(report.Migrated, item)
+		logs.Info("区块链账户已迁移到签名服务 [owner=%s, address=%s, signUserId=%s]", owner, address, item.SignUserID)
+		if deleteLocal {
+			if err := s.Local.DeleteLocalKey(key.Address); err != nil {
+				logs.Warning("删除本地私钥失败 [address=%s, error=%v]", key.Address, err)
+			}
+		}
+	}
+
+	for _, company := range companies {
+		company := company
+		migrate(fmt.Sprintf("company:%d", company.ID), company.Address, func(signUserID string) error {
+			company.SignUserId = signUserID
+			company.BlockchainType = models.BlockchainUserTypeExternal
+			return models.UpdateCompanySignIdentity(company)
+		})
+	}
+	for _, user := range users {
+		user := user
+		migrate(fmt.Sprintf("user:%d", user.Id), user.BlockchainAddr, func(signUserID string) error {
+			user.SignUserId = signUserID
+			user.BlockchainType = models.BlockchainUserTypeExternal
+			return models.UpdateUserBlockchainIdentity(user)
+		})
+	}
+	if superAdminAddress != "" {
+		migrate(models.RoleSuperAdmin, superAdminAddress, func(signUserID string) error {
+			return models.SetSystemConfig("super_admin_sign_user_id", signUserID, "超级管理员账户在WeBASE-Sign中的用户编号")
+		})
+	}
+	return report, nil
+}
@@ -0,0 +1,253 @@
+package services
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
+	"sea_trace_server_V2.0/models"
+)
+
+// 私钥托管方式
+const (
+	KeyCustodySign     = "sign"     // 私钥托管在WeBASE-Sign
+	KeyCustodyKeystore = "keystore" // 私钥加密保存在本地密钥库，由本服务提供WeBASE-Sign兼容的签名接口
+)
+
+// MasterKeyEnv 主密钥环境变量，优先于配置项 keystore_master_key_file
+const MasterKeyEnv = "SEA_TRACE_MASTER_KEY"
+
+// KeyCustody 获取当前配置的私钥托管方式
+func KeyCustody() string {
+	custody, _ := web.AppConfig.String("key_custody")
+	if custody == "" {
+		return KeyCustodySign
+	}
+	return custody
+}
+
+// LoadMasterKey 读取主密钥：优先环境变量 SEA_TRACE_MASTER_KEY，其次配置项 keystore_master_key_file 指向的文件
+func LoadMasterKey() ([]byte, error) {
+	if value := os.Getenv(MasterKeyEnv); value != "" {
+		return ParseMasterKey(value)
+	}
+	path, _ := web.AppConfig.String("keystore_master_key_file")
+	if path == "" {
+		return nil, fmt.Errorf("未配置主密钥，请设置环境变量 %s 或配置项 keystore_master_key_file", MasterKeyEnv)
+	}
+	return ReadMasterKeyFile(path)
+}
+
+// ReadMasterKeyFile 从文件读取主密钥
+func ReadMasterKeyFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取主密钥文件失败: %v", err)
+	}
+	return ParseMasterKey(string(data))
+}
+
+// Keystore 本地密钥库
+// 公司和操作员的secp256k1私钥以主密钥AES-GCM加密后保存在 chain_keys 表，实现 SignService，
+// 交易由WeBASE-Front调用本服务的签名接口完成签名
+type Keystore struct {
+	master   []byte
+	masterID string
+	err      error // 主密钥加载失败的原因，所有操作均返回该错误
+}
+
+// NewKeystore 使用配置的主密钥创建密钥库
+func NewKeystore() *Keystore {
+	master, err := LoadMasterKey()
+	if err != nil {
+		logs.Error("加载密钥库主密钥失败: %v", err)
+		return &Keystore{err: err}
+	}
+	return NewKeystoreWithMaster(master)
+}
+
+// NewKeystoreWithMaster 使用指定主密钥创建密钥库
+func NewKeystoreWithMaster(master []byte) *Keystore {
+	return &Keystore{master: master, masterID: MasterKeyID(master)}
+}
+
+// CreateSignUser 生成新私钥并加密保存
+func (k *Keystore) CreateSignUser(signUserID string, appID string) (*SignUser, error) {
+	if k.err != nil {
+		return nil, k.err
+	}
+	key, err := GenerateChainKey()
+	if err != nil {
+		return nil, err
+	}
+	return k.store(signUserID, appID, key)
+}
+
+// ImportSignUser 导入已有私钥（十六进制）并加密保存
+func (k *Keystore) ImportSignUser(signUserID string, appID string, privateKey string) (*SignUser, error) {
+	if k.err != nil {
+		return nil, k.err
+	}
+	key, err := decodeHexKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return k.store(signUserID, appID, key)
+}
+
+// GetSignUser 查询密钥库中的用户
+func (k *Keystore) GetSignUser(signUserID string) (*SignUser, error) {
+	record, err := models.GetChainKeyBySignUserID(signUserID)
+	if err != nil {
+		return nil, fmt.Errorf("密钥不存在: %s", signUserID)
+	}
+	return &SignUser{
+		SignUserID: record.SignUserId,
+		AppID:      SignAppID(),
+		Address:    record.Address,
+		PublicKey:  record.PublicKey,
+	}, nil
+}
+
+// Sign 使用签名用户的私钥对32字节哈希签名，返回 r||s||v
+func (k *Keystore) Sign(signUserID string, hash []byte) ([]byte, error) {
+	key, _, err := k.privateKey(signUserID)
+	if err != nil {
+		return nil, err
+	}
+	return SignChainHash(key, hash)
+}
+
+// ExportV3 将私钥导出为以太坊 keystore v3 文件
+func (k *Keystore) ExportV3(signUserID string, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("导出密码不能为空")
+	}
+	key, _, err := k.privateKey(signUserID)
+	if err != nil {
+		return nil, err
+	}
+	return EncryptKeystoreV3(key, passphrase, KeystoreStandardScryptN, KeystoreStandardScryptP)
+}
+
+// ImportV3 从以太坊 keystore v3 文件导入私钥
+func (k *Keystore) ImportV3(signUserID string, data []byte, passphrase string) (*SignUser, error) {
+	if k.err != nil {
+		return nil, k.err
+	}
+	key, err := DecryptKeystoreV3(data, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return k.store(signUserID, SignAppID(), key)
+}
+
+// Rotate 用新主密钥重新加密全部私钥，整个过程在一个事务中完成
+// 已由新主密钥加密的记录会跳过，因此中断后可重复执行
+func (k *Keystore) Rotate(newMaster []byte) (int, error) {
+	if k.err != nil {
+		return 0, k.err
+	}
+	newID := MasterKeyID(newMaster)
+	rotated, err := models.RotateChainKeys(newID, func(record *models.ChainKey) (string, bool, error) {
+		if record.MasterKeyId == newID {
+			return "", false, nil
+		}
+		if record.MasterKeyId != k.masterID {
+			return "", false, fmt.Errorf("密钥 %s 不是由当前主密钥加密的 [masterKeyId=%s]", record.Address, record.MasterKeyId)
+		}
+		key, err := OpenChainKey(k.master, record.Address, record.Ciphertext)
+		if err != nil {
+			return "", false, err
+		}
+		ciphertext, err := SealChainKey(newMaster, record.Address, key)
+		return ciphertext, err == nil, err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	logs.Info("密钥库主密钥轮换完成 [from=%s, to=%s, rotated=%d]", k.masterID, newID, rotated)
+	k.master, k.masterID = newMaster, newID
+	return rotated, nil
+}
+
+// store 加密保存私钥
+func (k *Keystore) store(signUserID string, appID string, key []byte) (*SignUser, error) {
+	address, publicKey, err := ChainKeyAddress(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := models.GetChainKeyByAddress(address); err == nil {
+		return nil, fmt.Errorf("密钥库中已存在地址 %s", address)
+	}
+
+	ciphertext, err := SealChainKey(k.master, address, key)
+	if err != nil {
+		return nil, fmt.Errorf("加密私钥失败: %v", err)
+	}
+	record := &models.ChainKey{
+		SignUserId:  signUserID,
+		Address:     address,
+		PublicKey:   publicKey,
+		Ciphertext:  ciphertext,
+		MasterKeyId: k.masterID,
+	}
+	if err := models.SaveChainKey(record); err != nil {
+		return nil, fmt.Errorf("保存私钥失败: %v", err)
+	}
+
+	logs.Info("密钥库新增私钥 [signUserId=%s, address=%s]", signUserID, address)
+	return &SignUser{SignUserID: signUserID, AppID: appID, Address: address, PublicKey: publicKey}, nil
+}
+
+// privateKey 解密签名用户的私钥
+func (k *Keystore) privateKey(signUserID string) ([]byte, *models.ChainKey, error) {
+	if k.err != nil {
+		return nil, nil, k.err
+	}
+	record, err := models.GetChainKeyBySignUserID(signUserID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("密钥不存在: %s", signUserID)
+	}
+	if record.MasterKeyId != k.masterID {
+		return nil, nil, fmt.Errorf("密钥 %s 由其他主密钥加密 [masterKeyId=%s]，请先完成主密钥轮换", record.Address, record.MasterKeyId)
+	}
+	key, err := OpenChainKey(k.master, record.Address, record.Ciphertext)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, record, nil
+}
+
+// decodeHexKey 解析十六进制私钥
+func decodeHexKey(privateKey string) ([]byte, error) {
+	key, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(privateKey), "0x"))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("无效的私钥")
+	}
+	return key, nil
+}
+
+// KeystoreSignAllowed 签名接口是否允许该来源地址访问
+// 仅在本地密钥库托管模式下开放，默认只允许本机的WeBASE-Front，可通过 keystore_sign_allow_ips 配置
+func KeystoreSignAllowed(remoteIP string) bool {
+	if KeyCustody() != KeyCustodyKeystore {
+		return false
+	}
+	allowed, _ := web.AppConfig.String("keystore_sign_allow_ips")
+	if allowed == "" {
+		allowed = "127.0.0.1,::1"
+	}
+	for _, ip := range strings.Split(allowed, ",") {
+		if strings.TrimSpace(ip) == remoteIP {
+			return true
+		}
+	}
+	return false
+}
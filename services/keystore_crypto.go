@@ -0,0 +1,283 @@
+package services
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/sha3"
+)
+
+// 以太坊 keystore v3 的 scrypt 参数
+const (
+	KeystoreStandardScryptN = 1 << 18
+	KeystoreStandardScryptP = 1
+	KeystoreLightScryptN    = 1 << 12
+	KeystoreLightScryptP    = 6
+
+	keystoreScryptR     = 8
+	keystoreScryptDKLen = 32
+)
+
+// GenerateChainKey 生成secp256k1私钥
+func GenerateChainKey() ([]byte, error) {
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		return nil, fmt.Errorf("生成私钥失败: %v", err)
+	}
+	return key.Serialize(), nil
+}
+
+// ChainKeyAddress 计算私钥对应的区块链地址和非压缩公钥（均为0x前缀的十六进制）
+func ChainKeyAddress(privateKey []byte) (string, string, error) {
+	if len(privateKey) != 32 {
+		return "", "", errors.New("无效的私钥")
+	}
+	pub := secp256k1.PrivKeyFromBytes(privateKey).PubKey().SerializeUncompressed()
+
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(pub[1:])
+	return "0x" + hex.EncodeToString(hash.Sum(nil)[12:]), "0x" + hex.EncodeToString(pub[1:]), nil
+}
+
+// SignChainHash 对32字节哈希签名，返回 r||s||v，v 为 27 或 28
+func SignChainHash(privateKey []byte, hash []byte) ([]byte, error) {
+	if len(hash) != 32 {
+		return nil, errors.New("待签名数据必须是32字节哈希")
+	}
+	compact := ecdsa.SignCompact(secp256k1.PrivKeyFromBytes(privateKey), hash, false)
+	return append(compact[1:], compact[0]), nil
+}
+
+// MasterKeyID 主密钥指纹，用于识别密钥记录由哪个主密钥加密
+func MasterKeyID(master []byte) string {
+	digest := sha256.Sum256(master)
+	return hex.EncodeToString(digest[:8])
+}
+
+// ParseMasterKey 解析主密钥，支持64位十六进制字符串
+func ParseMasterKey(value string) ([]byte, error) {
+	master, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(value), "0x"))
+	if err != nil || len(master) != 32 {
+		return nil, errors.New("主密钥必须是32字节的十六进制字符串")
+	}
+	return master, nil
+}
+
+// SealChainKey 用主密钥以AES-GCM加密私钥，地址作为附加数据，密文不能被挪用到其他地址
+func SealChainKey(master []byte, address string, privateKey []byte) (string, error) {
+	gcm, err := newMasterGCM(master)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, privateKey, []byte(strings.ToLower(address)))
+	return hex.EncodeToString(sealed), nil
+}
+
+// OpenChainKey 用主密钥解密 SealChainKey 生成的密文
+func OpenChainKey(master []byte, address string, ciphertext string) ([]byte, error) {
+	gcm, err := newMasterGCM(master)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := hex.DecodeString(ciphertext)
+	if err != nil || len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("密文格式错误")
+	}
+	nonce, data := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	key, err := gcm.Open(nil, nonce, data, []byte(strings.ToLower(address)))
+	if err != nil {
+		return nil, errors.New("解密私钥失败，主密钥不匹配或密文已损坏")
+	}
+	return key, nil
+}
+
+// newMasterGCM 使用主密钥创建AES-256-GCM
+func newMasterGCM(master []byte) (cipher.AEAD, error) {
+	if len(master) != 32 {
+		return nil, errors.New("主密钥长度必须为32字节")
+	}
+	block, err := aes.NewCipher(master)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// keystoreV3 以太坊 keystore v3 文件
+type keystoreV3 struct {
+	Address string           `json:"address"`
+	Crypto  keystoreV3Crypto `json:"crypto"`
+	ID      string           `json:"id"`
+	Version int              `json:"version"`
+}
+
+// keystoreV3Params keystore v3 的加密参数
+type keystoreV3Params struct {
+	IV string `json:"iv"`
+}
+
+// keystoreV3Crypto keystore v3 的加密部分
+type keystoreV3Crypto struct {
+	Cipher       string                 `json:"cipher"`
+	CipherText   string                 `json:"ciphertext"`
+	CipherParams keystoreV3Params       `json:"cipherparams"`
+	KDF          string                 `json:"kdf"`
+	KDFParams    map[string]interface{} `json:"kdfparams"`
+	MAC          string                 `json:"mac"`
+}
+
+// EncryptKeystoreV3 将私钥导出为以太坊 keystore v3 格式（scrypt + aes-128-ctr）
+func EncryptKeystoreV3(privateKey []byte, passphrase string, scryptN int, scryptP int) ([]byte, error) {
+	address, _, err := ChainKeyAddress(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	derived, err := scrypt.Key([]byte(passphrase), salt, scryptN, keystoreScryptR, scryptP, keystoreScryptDKLen)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := aesCTR(derived[:16], iv, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	file := keystoreV3{
+		Address: strings.TrimPrefix(address, "0x"),
+		ID:      uuid.New().String(),
+		Version: 3,
+	}
+	file.Crypto.Cipher = "aes-128-ctr"
+	file.Crypto.CipherText = hex.EncodeToString(ciphertext)
+	file.Crypto.CipherParams.IV = hex.EncodeToString(iv)
+	file.Crypto.KDF = "scrypt"
+	file.Crypto.KDFParams = map[string]interface{}{
+		"n":     scryptN,
+		"r":     keystoreScryptR,
+		"p":     scryptP,
+		"dklen": keystoreScryptDKLen,
+		"salt":  hex.EncodeToString(salt),
+	}
+	file.Crypto.MAC = hex.EncodeToString(keystoreMAC(derived, ciphertext))
+	return json.MarshalIndent(file, "", "  ")
+}
+
+// DecryptKeystoreV3 解密以太坊 keystore v3 文件，支持 scrypt 和 pbkdf2 两种密钥派生方式
+func DecryptKeystoreV3(data []byte, passphrase string) ([]byte, error) {
+	var file keystoreV3
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析keystore文件失败: %v", err)
+	}
+	if file.Version != 3 {
+		return nil, fmt.Errorf("不支持的keystore版本: %d", file.Version)
+	}
+	if file.Crypto.Cipher != "aes-128-ctr" {
+		return nil, fmt.Errorf("不支持的加密算法: %s", file.Crypto.Cipher)
+	}
+
+	derived, err := keystoreDeriveKey(file.Crypto.KDF, file.Crypto.KDFParams, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := hex.DecodeString(file.Crypto.CipherText)
+	if err != nil {
+		return nil, errors.New("keystore密文格式错误")
+	}
+	mac, err := hex.DecodeString(file.Crypto.MAC)
+	if err != nil || !bytes.Equal(mac, keystoreMAC(derived, ciphertext)) {
+		return nil, errors.New("keystore密码错误")
+	}
+	iv, err := hex.DecodeString(file.Crypto.CipherParams.IV)
+	if err != nil {
+		return nil, errors.New("keystore iv格式错误")
+	}
+
+	key, err := aesCTR(derived[:16], iv, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	if file.Address != "" {
+		address, _, err := ChainKeyAddress(key)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(strings.TrimPrefix(address, "0x"), strings.TrimPrefix(file.Address, "0x")) {
+			return nil, errors.New("keystore地址与私钥不一致")
+		}
+	}
+	return key, nil
+}
+
+// keystoreDeriveKey 按 kdfparams 派生解密密钥
+func keystoreDeriveKey(kdf string, params map[string]interface{}, passphrase string) ([]byte, error) {
+	intParam := func(name string) int {
+		if v, ok := params[name].(float64); ok {
+			return int(v)
+		}
+		return 0
+	}
+	salt, err := hex.DecodeString(fmt.Sprint(params["salt"]))
+	if err != nil {
+		return nil, errors.New("keystore salt格式错误")
+	}
+	dkLen := intParam("dklen")
+	if dkLen < 32 {
+		return nil, errors.New("keystore dklen参数错误")
+	}
+
+	switch kdf {
+	case "scrypt":
+		return scrypt.Key([]byte(passphrase), salt, intParam("n"), intParam("r"), intParam("p"), dkLen)
+	case "pbkdf2":
+		if params["prf"] != "hmac-sha256" {
+			return nil, fmt.Errorf("不支持的prf: %v", params["prf"])
+		}
+		return pbkdf2.Key([]byte(passphrase), salt, intParam("c"), dkLen, sha256.New), nil
+	}
+	return nil, fmt.Errorf("不支持的密钥派生方式: %s", kdf)
+}
+
+// keystoreMAC keccak256(派生密钥后16字节 || 密文)
+func keystoreMAC(derived []byte, ciphertext []byte) []byte {
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write(derived[16:32])
+	hash.Write(ciphertext)
+	return hash.Sum(nil)
+}
+
+// aesCTR AES-128-CTR 加解密
+func aesCTR(key []byte, iv []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	cipher.NewCTR(block, iv).XORKeyStream(out, data)
+	return out, nil
+}
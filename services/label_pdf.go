@@ -0,0 +1,220 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"sea_trace_server_V2.0/utils"
+)
+
+// PDF标签纸版式：A4纸3列8行，单位为点(1/72英寸)
+const (
+	pdfPageWidth    = 595.28
+	pdfPageHeight   = 841.89
+	pdfMM           = 72 / 25.4
+	pdfLabelColumns = 3
+	pdfLabelRows    = 8
+	pdfLabelWidth   = 70 * pdfMM
+	pdfLabelHeight  = 37 * pdfMM
+	pdfLabelPadding = 3 * pdfMM
+)
+
+// pdfFont 标签使用的字体：Adobe标准中文字体 STSong-Light，不嵌入字体文件，由阅读器提供
+// 编码为 UniGB-UCS2-H，文本按UTF-16BE写入；ASCII字符为半角
+const pdfFont = `<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light-UniGB-UCS2-H /Encoding /UniGB-UCS2-H /DescendantFonts [4 0 R] >>`
+
+const pdfCIDFont = `<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light ` +
+	`/CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> /FontDescriptor 5 0 R /DW 1000 /W [1 95 500] >>`
+
+const pdfFontDescriptor = `<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] ` +
+	`/ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>`
+
+// pdfTextLine 标签中的一行文字
+type pdfTextLine struct {
+	size float64
+	text string
+}
+
+// RenderPDF 生成A4标签纸PDF，每页24个标签，左侧为二维码，右侧为货物名称、批次、生产商和货物ID
+func (s *LabelService) RenderPDF(labels []GoodsLabel) ([]byte, error) {
+	perPage := pdfLabelColumns * pdfLabelRows
+	pages := make([][]byte, max(1, (len(labels)+perPage-1)/perPage))
+	for p := range pages {
+		var content bytes.Buffer
+		for i, label := range labels[p*perPage : min((p+1)*perPage, len(labels))] {
+			x := (pdfPageWidth-pdfLabelColumns*pdfLabelWidth)/2 + float64(i%pdfLabelColumns)*pdfLabelWidth
+			y := pdfPageHeight - (pdfPageHeight-pdfLabelRows*pdfLabelHeight)/2 - float64(i/pdfLabelColumns+1)*pdfLabelHeight
+			if err := writePDFLabel(&content, label, x, y); err != nil {
+				return nil, err
+			}
+		}
+		pages[p] = content.Bytes()
+	}
+	return buildPDF(pages)
+}
+
+// writePDFLabel 在 (x, y) 为左下角的位置绘制一个标签
+func writePDFLabel(w *bytes.Buffer, label GoodsLabel, x, y float64) error {
+	qr, err := utils.EncodeQR(label.TraceURL, utils.QRLevelM)
+	if err != nil {
+		return fmt.Errorf("生成二维码失败 [goodID=%s]: %v", label.GoodID, err)
+	}
+
+	qrSide := pdfLabelHeight - 2*pdfLabelPadding
+	qrX, qrY := x+pdfLabelPadding, y+pdfLabelPadding
+	writePDFQR(w, qr, qrX, qrY, qrSide)
+
+	// 文字
+	textX := qrX + qrSide + pdfLabelPadding
+	textWidth := x + pdfLabelWidth - pdfLabelPadding - textX
+	var lines []pdfTextLine
+	lines = append(lines, wrapPDFText(label.GoodName, 9, textWidth, 2)...)
+	lines = append(lines, wrapPDFText("批次: "+label.BatchNumber, 6.5, textWidth, 1)...)
+	lines = append(lines, wrapPDFText("生产商: "+label.Producer, 6.5, textWidth, 1)...)
+	lines = append(lines, wrapPDFText("ID: "+label.GoodID, 6.5, textWidth, 3)...)
+
+	lineY := y + pdfLabelHeight - pdfLabelPadding
+	for _, line := range lines {
+		lineY -= line.size * 1.3
+		fmt.Fprintf(w, "BT /F1 %.1f Tf %.3f %.3f Td <%s> Tj ET\n", line.size, textX, lineY, pdfHexText(line.text))
+	}
+	return nil
+}
+
+// writePDFQR 在 (x, y) 为左下角、边长为 side 的区域绘制二维码
+// 四周保留1个模块的空白，相邻深色模块合并为一个矩形
+func writePDFQR(w *bytes.Buffer, qr *utils.QRCode, x, y, side float64) {
+	module := side / float64(qr.Size+2)
+	w.WriteString("0 g\n")
+	for row := 0; row < qr.Size; row++ {
+		for col := 0; col < qr.Size; {
+			if !qr.Dark(col, row) {
+				col++
+				continue
+			}
+			run := 1
+			for qr.Dark(col+run, row) {
+				run++
+			}
+			fmt.Fprintf(w, "%.3f %.3f %.3f %.3f re\n",
+				x+float64(col+1)*module, y+side-float64(row+2)*module, float64(run)*module, module)
+			col += run
+		}
+	}
+	w.WriteString("f\n")
+}
+
+// pdfTextWidth 文字宽度，ASCII字符为半角
+func pdfTextWidth(text string, size float64) float64 {
+	width := 0.0
+	for _, r := range text {
+		if r < utf8.RuneSelf {
+			width += size / 2
+		} else {
+			width += size
+		}
+	}
+	return width
+}
+
+// wrapPDFText 按宽度折行，超出 maxLines 时截断并以省略号结尾
+func wrapPDFText(text string, size, width float64, maxLines int) []pdfTextLine {
+	var lines []pdfTextLine
+	var line strings.Builder
+	for _, r := range text {
+		if pdfTextWidth(line.String()+string(r), size) > width && line.Len() > 0 {
+			if len(lines) == maxLines-1 {
+				truncated := []rune(line.String())
+				for len(truncated) > 0 && pdfTextWidth(string(truncated)+"…", size) > width {
+					truncated = truncated[:len(truncated)-1]
+				}
+				return append(lines, pdfTextLine{size, string(truncated) + "…"})
+			}
+			lines = append(lines, pdfTextLine{size, line.String()})
+			line.Reset()
+		}
+		line.WriteRune(r)
+	}
+	return append(lines, pdfTextLine{size, line.String()})
+}
+
+// pdfHexText 将文字编码为UTF-16BE十六进制字符串，超出基本平面的字符以问号代替
+func pdfHexText(text string) string {
+	var hex strings.Builder
+	for _, r := range text {
+		if r > 0xFFFF {
+			r = '?'
+		}
+		fmt.Fprintf(&hex, "%04X", r)
+	}
+	return hex.String()
+}
+
+// pdfAttachment PDF中嵌入的附件，名称只能包含ASCII字母、数字和点、横线、下划线
+type pdfAttachment struct {
+	name     string
+	mimeType string
+	data     []byte
+}
+
+// buildPDF 组装PDF文件：目录、页面树、字体，之后每页一个页面对象和一个压缩的内容流，最后是附件
+func buildPDF(pages [][]byte, attachments ...pdfAttachment) ([]byte, error) {
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	if len(attachments) == 0 {
+		object("<< /Type /Catalog /Pages 2 0 R >>")
+	} else {
+		names := make([]string, len(attachments))
+		for i, attachment := range attachments {
+			names[i] = fmt.Sprintf("(%s) %d 0 R", attachment.name, 6+2*len(pages)+2*i)
+		}
+		object(fmt.Sprintf("<< /Type /Catalog /Pages 2 0 R /PageMode /UseAttachments "+
+			"/Names << /EmbeddedFiles << /Names [%s] >> >> >>", strings.Join(names, " ")))
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object(pdfFont)
+	object(pdfCIDFont)
+	object(pdfFontDescriptor)
+
+	for i, content := range pages {
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if _, err := zw.Write(content); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, 7+2*i))
+		object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", compressed.Len(), compressed.Bytes()))
+	}
+	for i, attachment := range attachments {
+		object(fmt.Sprintf("<< /Type /Filespec /F (%s) /UF (%s) /EF << /F %d 0 R >> >>",
+			attachment.name, attachment.name, 7+2*len(pages)+2*i))
+		object(fmt.Sprintf("<< /Type /EmbeddedFile /Subtype /%s /Length %d /Params << /Size %d >> >>\nstream\n%s\nendstream",
+			strings.ReplaceAll(attachment.mimeType, "/", "#2F"), len(attachment.data), len(attachment.data), attachment.data))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.Bytes(), nil
+}
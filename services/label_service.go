@@ -0,0 +1,158 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/beego/beego/v2/server/web"
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/utils"
+)
+
+// defaultPublicTraceURL 未配置 public_trace_url 时二维码指向的公开溯源地址
+const defaultPublicTraceURL = "http://localhost:8080/api/public/trace"
+
+// ZPL标签尺寸，按203dpi打印机的4x2英寸标签
+const (
+	zplLabelWidth  = 812
+	zplLabelHeight = 406
+	zplMargin      = 20
+	zplQRModule    = 5 // 二维码每个模块的点数
+)
+
+// GoodsLabel 货物标签内容
+type GoodsLabel struct {
+	GoodID      string `json:"good_id"`
+	GoodName    string `json:"good_name"`
+	BatchNumber string `json:"batch_number"`
+	Producer    string `json:"producer"`
+	TraceURL    string `json:"trace_url"`
+}
+
+// LabelService 货物二维码和标签生成，全部在本地完成，不依赖外部服务
+type LabelService struct {
+	PublicTraceURL string // 公开溯源地址，二维码内容为该地址加 good_id 参数
+	ZPLFont        string // ZPL字体：单个字符为打印机内置字体，否则为打印机中的字体文件名，如 E:SIMSUN.TTF
+	MaxItems       int    // 单次最多生成的标签数
+}
+
+// NewLabelService 按配置创建标签服务
+func NewLabelService() *LabelService {
+	maxItems := web.AppConfig.DefaultInt("bulk_max_items", defaultBulkMaxItems)
+	if maxItems <= 0 {
+		maxItems = defaultBulkMaxItems
+	}
+	return &LabelService{
+		PublicTraceURL: web.AppConfig.DefaultString("public_trace_url", defaultPublicTraceURL),
+		ZPLFont:        web.AppConfig.DefaultString("label_zpl_font", "0"),
+		MaxItems:       maxItems,
+	}
+}
+
+// TraceURL 货物的公开溯源地址
+func (s *LabelService) TraceURL(goodID string) string {
+	separator := "?"
+	if strings.Contains(s.PublicTraceURL, "?") {
+		separator = "&"
+	}
+	return s.PublicTraceURL + separator + "good_id=" + url.QueryEscape(goodID)
+}
+
+// QRCode 生成指向货物公开溯源地址的二维码
+func (s *LabelService) QRCode(goodID string) (*utils.QRCode, error) {
+	return utils.EncodeQR(s.TraceURL(goodID), utils.QRLevelM)
+}
+
+// Labels 生成货物的标签内容，生产商为货物所属公司
+func (s *LabelService) Labels(goods []*models.Goods) ([]GoodsLabel, error) {
+	if len(goods) > s.MaxItems {
+		return nil, fmt.Errorf("单次最多生成%d个标签", s.MaxItems)
+	}
+	ids := make([]int, 0, len(goods))
+	for _, good := range goods {
+		ids = append(ids, good.OwnerCompanyId)
+	}
+	producers, err := models.GetCompanyNames(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make([]GoodsLabel, 0, len(goods))
+	for _, good := range goods {
+		labels = append(labels, GoodsLabel{
+			GoodID:      good.GoodId,
+			GoodName:    good.GoodName,
+			BatchNumber: good.BatchNumber,
+			Producer:    producers[good.OwnerCompanyId],
+			TraceURL:    s.TraceURL(good.GoodId),
+		})
+	}
+	return labels, nil
+}
+
+// RenderZPL 生成热敏打印机使用的ZPL指令，每个标签一段 ^XA...^XZ
+// 二维码以位图形式嵌入，与PNG、SVG、PDF中的二维码完全一致
+func (s *LabelService) RenderZPL(labels []GoodsLabel) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, label := range labels {
+		qr, err := utils.EncodeQR(label.TraceURL, utils.QRLevelM)
+		if err != nil {
+			return nil, fmt.Errorf("生成二维码失败 [goodID=%s]: %v", label.GoodID, err)
+		}
+		qrSide := (qr.Size + 2) * zplQRModule
+		textX := zplMargin + qrSide + zplMargin
+		textWidth := zplLabelWidth - textX - zplMargin
+
+		buf.WriteString("^XA\n^CI28\n")
+		fmt.Fprintf(&buf, "^PW%d\n^LL%d\n", zplLabelWidth, zplLabelHeight)
+		fmt.Fprintf(&buf, "^FO%d,%d%s^FS\n", zplMargin, (zplLabelHeight-qrSide)/2, zplGraphic(qr, zplQRModule))
+		fmt.Fprintf(&buf, "^FO%d,40%s^FB%d,2,0,L,0%s^FS\n", textX, s.zplFont(36), textWidth, zplField(label.GoodName))
+		fmt.Fprintf(&buf, "^FO%d,140%s^FB%d,1,0,L,0%s^FS\n", textX, s.zplFont(26), textWidth, zplField("批次: "+label.BatchNumber))
+		fmt.Fprintf(&buf, "^FO%d,190%s^FB%d,1,0,L,0%s^FS\n", textX, s.zplFont(26), textWidth, zplField("生产商: "+label.Producer))
+		fmt.Fprintf(&buf, "^FO%d,250%s^FB%d,3,0,L,0%s^FS\n", textX, s.zplFont(22), textWidth, zplField("ID: "+label.GoodID))
+		buf.WriteString("^XZ\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// zplFont 字体选择指令
+func (s *LabelService) zplFont(height int) string {
+	if len(s.ZPLFont) == 1 {
+		return fmt.Sprintf("^A%sN,%d,%d", s.ZPLFont, height, height)
+	}
+	return fmt.Sprintf("^A@N,%d,%d,%s", height, height, s.ZPLFont)
+}
+
+// zplField 字段内容，含ZPL控制字符时使用 ^FH 十六进制转义
+func zplField(text string) string {
+	if !strings.ContainsAny(text, "^~_") {
+		return "^FD" + text
+	}
+	var escaped strings.Builder
+	for _, r := range text {
+		switch r {
+		case '^', '~', '_':
+			fmt.Fprintf(&escaped, "_%02X", r)
+		default:
+			escaped.WriteRune(r)
+		}
+	}
+	return "^FH_^FD" + escaped.String()
+}
+
+// zplGraphic 将二维码转换为 ^GFA 位图指令，四周保留1个模块的空白
+func zplGraphic(qr *utils.QRCode, module int) string {
+	side := (qr.Size + 2) * module
+	rowBytes := (side + 7) / 8
+	data := make([]byte, rowBytes*side)
+	for y := 0; y < side; y++ {
+		for x := 0; x < side; x++ {
+			if qr.Dark(x/module-1, y/module-1) {
+				data[y*rowBytes+x/8] |= 0x80 >> uint(x%8)
+			}
+		}
+	}
+	return fmt.Sprintf("^GFA,%d,%d,%d,%X", len(data), len(data), rowBytes, data)
+}
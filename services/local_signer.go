@@ -0,0 +1,103 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// LocalSignService 进程内的签名服务替身，供模拟链和测试使用
+// 地址由私钥的SHA-256摘要派生，与真实链不同，但同一私钥总是得到同一地址，足以验证迁移等流程
+type LocalSignService struct {
+	mu    sync.Mutex
+	users map[string]*SignUser
+	keys  map[string][]byte // signUserId -> 私钥，只在替身内部保存
+}
+
+var (
+	localSignerOnce     sync.Once
+	localSignerInstance *LocalSignService
+)
+
+// NewLocalSignService 创建本地签名服务替身
+func NewLocalSignService() *LocalSignService {
+	return &LocalSignService{
+		users: make(map[string]*SignUser),
+		keys:  make(map[string][]byte),
+	}
+}
+
+// sharedLocalSigner 获取进程内共享的签名服务替身
+func sharedLocalSigner() *LocalSignService {
+	localSignerOnce.Do(func() {
+		localSignerInstance = NewLocalSignService()
+	})
+	return localSignerInstance
+}
+
+// LocalSignerAddress 计算私钥（十六进制）在本地替身中对应的地址
+func LocalSignerAddress(privateKey string) (string, error) {
+	key, err := hex.DecodeString(strings.TrimPrefix(privateKey, "0x"))
+	if err != nil || len(key) != 32 {
+		return "", errors.New("无效的私钥")
+	}
+	digest := sha256.Sum256(key)
+	return "0x" + hex.EncodeToString(digest[12:]), nil
+}
+
+// CreateSignUser 生成随机私钥并创建外部用户
+func (s *LocalSignService) CreateSignUser(signUserID string, appID string) (*SignUser, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("生成私钥失败: %v", err)
+	}
+	return s.save(signUserID, appID, key)
+}
+
+// ImportSignUser 以已有私钥创建外部用户
+func (s *LocalSignService) ImportSignUser(signUserID string, appID string, privateKey string) (*SignUser, error) {
+	key, err := hex.DecodeString(strings.TrimPrefix(privateKey, "0x"))
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("无效的私钥")
+	}
+	return s.save(signUserID, appID, key)
+}
+
+// GetSignUser 查询外部用户
+func (s *LocalSignService) GetSignUser(signUserID string) (*SignUser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[signUserID]
+	if !ok {
+		return nil, fmt.Errorf("签名用户不存在: %s", signUserID)
+	}
+	copied := *user
+	return &copied, nil
+}
+
+// save 保存私钥并返回不含私钥的外部用户信息
+func (s *LocalSignService) save(signUserID string, appID string, key []byte) (*SignUser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[signUserID]; ok {
+		return nil, fmt.Errorf("签名用户已存在: %s", signUserID)
+	}
+	digest := sha256.Sum256(key)
+	user := &SignUser{
+		SignUserID: signUserID,
+		AppID:      appID,
+		Address:    "0x" + hex.EncodeToString(digest[12:]),
+		PublicKey:  "0x" + hex.EncodeToString(digest[:]),
+	}
+	s.users[signUserID] = user
+	s.keys[signUserID] = key
+
+	copied := *user
+	return &copied, nil
+}
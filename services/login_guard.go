@@ -0,0 +1,286 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
+	"sea_trace_server_V2.0/models"
+)
+
+// LoginThrottledError 登录尝试被限制，需等待 Wait 后重试
+type LoginThrottledError struct {
+	Wait   time.Duration
+	Locked bool // 账户或来源地址已被临时锁定
+}
+
+func (e *LoginThrottledError) Error() string {
+	seconds := int(math.Ceil(e.Wait.Seconds()))
+	if e.Locked {
+		return fmt.Sprintf("登录失败次数过多，账户已被临时锁定，请%d分钟后重试或联系管理员", (seconds+59)/60)
+	}
+	return fmt.Sprintf("登录尝试过于频繁，请%d秒后重试", seconds)
+}
+
+// LoginPolicy 登录失败计数策略
+// 失败次数达到 DelayAfter 后，每次失败后的等待时间从 DelayBase 起逐次翻倍，最长 DelayMax；
+// 达到 MaxFailures 时锁定 Lockout；距上次失败超过 Lockout 后计数清零
+type LoginPolicy struct {
+	DelayAfter  int
+	MaxFailures int
+	DelayBase   time.Duration
+	DelayMax    time.Duration
+	Lockout     time.Duration
+}
+
+// loginAttempts 单个用户名或来源地址的失败记录
+type loginAttempts struct {
+	failures    int
+	last        time.Time
+	lockedUntil time.Time
+}
+
+// LoginGuard 登录防暴力破解，分别按用户名和来源地址统计连续失败次数
+// 计数保存在内存中；已存在用户的锁定状态同时写入用户记录，服务重启后仍然有效
+type LoginGuard struct {
+	User    LoginPolicy
+	IP      LoginPolicy
+	Now     func() time.Time
+	OnEvent func(event *models.UserSecurityEvent) // 记录锁定事件，默认写入账户安全事件表
+
+	mu       sync.Mutex
+	attempts map[string]*loginAttempts
+}
+
+var (
+	loginGuard     *LoginGuard
+	loginGuardOnce sync.Once
+)
+
+// DefaultLoginGuard 获取全局登录防护实例
+func DefaultLoginGuard() *LoginGuard {
+	loginGuardOnce.Do(func() {
+		loginGuard = NewLoginGuard()
+	})
+	return loginGuard
+}
+
+// NewLoginGuard 按配置创建登录防护实例
+func NewLoginGuard() *LoginGuard {
+	lockout := time.Duration(web.AppConfig.DefaultInt("login_lockout_minutes", 15)) * time.Minute
+	delayBase := time.Duration(web.AppConfig.DefaultInt("login_delay_base", 1)) * time.Second
+	delayMax := time.Duration(web.AppConfig.DefaultInt("login_delay_max", 30)) * time.Second
+	return &LoginGuard{
+		User: LoginPolicy{
+			DelayAfter:  web.AppConfig.DefaultInt("login_delay_after", 3),
+			MaxFailures: web.AppConfig.DefaultInt("login_max_failures", 5),
+			DelayBase:   delayBase,
+			DelayMax:    delayMax,
+			Lockout:     lockout,
+		},
+		IP: LoginPolicy{
+			DelayAfter:  web.AppConfig.DefaultInt("login_ip_delay_after", 10),
+			MaxFailures: web.AppConfig.DefaultInt("login_ip_max_failures", 30),
+			DelayBase:   delayBase,
+			DelayMax:    delayMax,
+			Lockout:     lockout,
+		},
+		Now: time.Now,
+		OnEvent: func(event *models.UserSecurityEvent) {
+			if err := models.AddUserSecurityEvent(event); err != nil {
+				logs.Error("记录账户安全事件失败 [event=%s, username=%s]: %v", event.Event, event.Username, err)
+			}
+		},
+		attempts: make(map[string]*loginAttempts),
+	}
+}
+
+// LoginAttempt 已预占失败计数的一次登录尝试，校验密码后调用 Failure 或 Success
+type LoginAttempt struct {
+	username string
+	ip       string
+	user     loginAttempts // 预占后用户名的失败记录
+	addr     loginAttempts // 预占后来源地址的失败记录
+}
+
+// Check 查询当前是否允许登录，user 为空表示用户不存在，只读取计数不预占
+// 被限制时返回 *LoginThrottledError；登录流程应使用 Begin，避免并发请求同时通过检查
+func (g *LoginGuard) Check(user *models.User, username, ip string) error {
+	now := g.Now()
+	if user != nil && user.LockedUntil.After(now) {
+		return &LoginThrottledError{Wait: user.LockedUntil.Sub(now), Locked: true}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.throttled(username, ip, now)
+}
+
+// Begin 校验本次登录是否允许进行，允许时先按失败预占一次计数，返回的尝试在校验密码后交给 Failure 或 Success
+// 检查与预占在同一把锁内完成，并发的登录请求依次计数，超出阈值的请求在校验密码前即被限制
+// 被限制时返回 *LoginThrottledError，此时不应再校验密码
+func (g *LoginGuard) Begin(user *models.User, username, ip string) (*LoginAttempt, error) {
+	now := g.Now()
+	if user != nil && user.LockedUntil.After(now) {
+		return nil, &LoginThrottledError{Wait: user.LockedUntil.Sub(now), Locked: true}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.throttled(username, ip, now); err != nil {
+		return nil, err
+	}
+	return &LoginAttempt{
+		username: username,
+		ip:       ip,
+		user:     g.fail("user:"+username, g.User, now),
+		addr:     g.fail("ip:"+ip, g.IP, now),
+	}, nil
+}
+
+// throttled 用户名或来源地址需要等待时返回等待时间较长的限制，调用方持有锁
+func (g *LoginGuard) throttled(username, ip string, now time.Time) error {
+	var result *LoginThrottledError
+	for _, key := range []struct {
+		id     string
+		policy LoginPolicy
+	}{{"user:" + username, g.User}, {"ip:" + ip, g.IP}} {
+		a := g.attempts[key.id]
+		if a == nil {
+			continue
+		}
+		wait, locked := a.wait(key.policy, now)
+		if wait > 0 && (result == nil || wait > result.Wait) {
+			result = &LoginThrottledError{Wait: wait, Locked: locked}
+		}
+	}
+	if result == nil {
+		return nil
+	}
+	return result
+}
+
+// Failure 确认一次登录失败：保存用户的失败次数，本次预占达到阈值时记录锁定事件
+func (g *LoginGuard) Failure(attempt *LoginAttempt, user *models.User) {
+	username, ip := attempt.username, attempt.ip
+	userAttempts, ipAttempts := attempt.user, attempt.addr
+
+	userLocked := userAttempts.failures == g.User.MaxFailures
+	if user != nil {
+		var lockedUntil time.Time
+		if userLocked {
+			lockedUntil = userAttempts.lockedUntil
+		}
+		user.FailedLogins = userAttempts.failures
+		if err := models.UpdateUserLoginFailures(user.Id, userAttempts.failures, lockedUntil); err != nil {
+			logs.Error("保存登录失败次数失败 [username=%s]: %v", username, err)
+		}
+	}
+
+	if userLocked {
+		event := &models.UserSecurityEvent{
+			Username: username,
+			Event:    models.SecurityEventAccountLocked,
+			Ip:       ip,
+			Detail:   fmt.Sprintf("连续登录失败%d次，锁定至%s", userAttempts.failures, userAttempts.lockedUntil.Format("2006-01-02 15:04:05")),
+		}
+		if user != nil {
+			event.UserId = user.Id
+		}
+		logs.Warn("账户已被临时锁定 [username=%s, ip=%s, until=%s]", username, ip, userAttempts.lockedUntil.Format(time.RFC3339))
+		g.OnEvent(event)
+	}
+	if ipAttempts.failures == g.IP.MaxFailures {
+		logs.Warn("来源地址登录失败次数过多，暂停登录 [ip=%s, until=%s]", ip, ipAttempts.lockedUntil.Format(time.RFC3339))
+		g.OnEvent(&models.UserSecurityEvent{
+			Username: username,
+			Event:    models.SecurityEventIPBlocked,
+			Ip:       ip,
+			Detail:   fmt.Sprintf("该地址连续登录失败%d次，暂停登录至%s", ipAttempts.failures, ipAttempts.lockedUntil.Format("2006-01-02 15:04:05")),
+		})
+	}
+}
+
+// Success 登录成功后清零用户名的失败计数，并退还本次尝试预占的来源地址计数
+// 来源地址此前的失败计数不清零，避免以自己的账户重置对其他账户的尝试
+func (g *LoginGuard) Success(attempt *LoginAttempt, user *models.User) {
+	g.mu.Lock()
+	delete(g.attempts, "user:"+user.Username)
+	if a := g.attempts["ip:"+attempt.ip]; a != nil && a.failures > 0 {
+		a.failures--
+		if a.failures < g.IP.MaxFailures {
+			a.lockedUntil = time.Time{}
+		}
+	}
+	g.mu.Unlock()
+
+	if user.FailedLogins > 0 || !user.LockedUntil.IsZero() {
+		if err := models.UnlockUser(user.Id); err != nil {
+			logs.Error("清零登录失败次数失败 [username=%s]: %v", user.Username, err)
+		}
+	}
+}
+
+// Unlock 管理员解除账户锁定
+func (g *LoginGuard) Unlock(user *models.User, operator string) error {
+	if err := models.UnlockUser(user.Id); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	delete(g.attempts, "user:"+user.Username)
+	g.mu.Unlock()
+
+	logs.Info("账户已解除锁定 [username=%s, operator=%s]", user.Username, operator)
+	g.OnEvent(&models.UserSecurityEvent{
+		UserId:   user.Id,
+		Username: user.Username,
+		Event:    models.SecurityEventAccountUnlocked,
+		Operator: operator,
+	})
+	return nil
+}
+
+// fail 累加失败次数，调用方持有锁
+func (g *LoginGuard) fail(key string, policy LoginPolicy, now time.Time) loginAttempts {
+	a := g.attempts[key]
+	if a == nil || now.Sub(a.last) > policy.Lockout {
+		if len(g.attempts) > 10000 {
+			g.prune(now)
+		}
+		a = &loginAttempts{}
+		g.attempts[key] = a
+	}
+	a.failures++
+	a.last = now
+	if a.failures == policy.MaxFailures {
+		a.lockedUntil = now.Add(policy.Lockout)
+	}
+	return *a
+}
+
+// prune 清理已过期的失败记录，调用方持有锁
+func (g *LoginGuard) prune(now time.Time) {
+	for key, a := range g.attempts {
+		if now.Sub(a.last) > g.User.Lockout && now.Sub(a.last) > g.IP.Lockout {
+			delete(g.attempts, key)
+		}
+	}
+}
+
+// wait 距下次允许登录的等待时间
+func (a *loginAttempts) wait(policy LoginPolicy, now time.Time) (time.Duration, bool) {
+	if a.lockedUntil.After(now) {
+		return a.lockedUntil.Sub(now), true
+	}
+	if a.failures < policy.DelayAfter || now.Sub(a.last) > policy.Lockout {
+		return 0, false
+	}
+	delay := policy.DelayBase << uint(a.failures-policy.DelayAfter)
+	if delay > policy.DelayMax || delay <= 0 {
+		delay = policy.DelayMax
+	}
+	return a.last.Add(delay).Sub(now), false
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/beego/beego/v2/core/logs"
+	"sea_trace_server_V2.0/models"
+)
+
+// OperatorIdentityService 操作员区块链身份服务
+// 每个操作员拥有自己的区块链账户并登记在所属公司名下，各环节以操作员地址签名，链上可区分实际操作人
+type OperatorIdentityService struct {
+	Chain    ChainClient
+	Accounts AccountProvider
+}
+
+// NewOperatorIdentityService 创建操作员区块链身份服务实例
+func NewOperatorIdentityService() *OperatorIdentityService {
+	return &OperatorIdentityService{
+		Chain:    NewChainClient(),
+		Accounts: NewAccountProvider(),
+	}
+}
+
+// Provision 为操作员创建区块链账户，以公司管理员地址将其登记到公司名下，并保存到用户记录
+// 已有区块链地址的操作员不重复创建
+func (s *OperatorIdentityService) Provision(user *models.User, company *models.Company) error {
+	if user.BlockchainAddr != "" {
+		return nil
+	}
+	if company.Address == "" {
+		return errors.New("公司区块链地址未配置，请联系管理员")
+	}
+
+	account, err := s.Accounts.CreateBlockchainUser(user.Username)
+	if err != nil {
+		return fmt.Errorf("创建区块链账户失败: %v", err)
+	}
+
+	txHash, err := s.Chain.RegisterOperator(account.Address, company.Address)
+	if err != nil {
+		return fmt.Errorf("链上登记操作员失败: %v", err)
+	}
+
+	user.BlockchainAddr = account.Address
+	user.SignUserId = account.SignUserID
+	user.BlockchainType = account.Type
+	if err := models.UpdateUserBlockchainIdentity(user); err != nil {
+		return fmt.Errorf("保存操作员区块链身份失败: %v", err)
+	}
+
+	logs.Info("操作员区块链身份创建成功 [user=%s, company=%s, address=%s, txHash=%s]",
+		user.Username, company.CompanyName, account.Address, txHash)
+	return nil
+}
+
+// Revoke 将操作员地址从公司名下移除，删除操作员前调用
+func (s *OperatorIdentityService) Revoke(user *models.User, company *models.Company) error {
+	if user.BlockchainAddr == "" {
+		return nil
+	}
+
+	txHash, err := s.Chain.RemoveOperator(user.BlockchainAddr, company.Address)
+	if err != nil {
+		return fmt.Errorf("链上移除操作员失败: %v", err)
+	}
+
+	logs.Info("操作员已从链上移除 [user=%s, company=%s, address=%s, txHash=%s]",
+		user.Username, company.CompanyName, user.BlockchainAddr, txHash)
+	return nil
+}
+
+// SigningAddress 获取用户签名链上交易使用的地址
+// 操作员必须使用自己的地址；公司管理员未单独配置地址时使用公司地址（即链上的公司管理员地址）
+func SigningAddress(user *models.User, company *models.Company) (string, error) {
+	if user.BlockchainAddr != "" {
+		return user.BlockchainAddr, nil
+	}
+	if user.Role == models.RoleOperator {
+		return "", errors.New("操作员未配置区块链身份，请联系公司管理员")
+	}
+	if company.Address == "" {
+		return "", errors.New("公司区块链地址未配置，请联系管理员")
+	}
+	return company.Address, nil
+}
@@ -0,0 +1,342 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"sea_trace_server_V2.0/models"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
+)
+
+// 同一货物存在尚未上链的前序环节
+var (
+	errOutboxWaiting = errors.New("前序环节尚未上链，等待前序环节发送")
+	errOutboxBlocked = errors.New("前序环节上链失败，等待前序环节重新提交")
+)
+
+// OutboxStore 发件箱记录及环节上链状态的存储
+type OutboxStore interface {
+	GetDueChainOutbox(limit int) ([]*models.ChainOutbox, error)
+	ClaimChainOutbox(id int) (bool, error)
+	ReleaseStaleChainOutbox(staleBefore time.Time) (int64, error)
+	GetUnsentChainOutboxBefore(goodID string, id int) (*models.ChainOutbox, error)
+	DeferChainOutbox(id int, next time.Time) error
+	BlockChainOutboxAfter(goodID string, id int, reason string) (int64, error)
+	UpdateChainOutbox(entry *models.ChainOutbox, cols ...string) error
+	UpdateStageChainStatus(stage string, recordID int, txHash string, chainStatus string) error
+	UpdateGoodChainStatus(goodID string, txHash string, chainStatus string) error
+}
+
+// dbOutboxStore 基于数据库的发件箱存储
+type dbOutboxStore struct{}
+
+func (dbOutboxStore) GetDueChainOutbox(limit int) ([]*models.ChainOutbox, error) {
+	return models.GetDueChainOutbox(limit)
+}
+
+func (dbOutboxStore) ClaimChainOutbox(id int) (bool, error) {
+	return models.ClaimChainOutbox(id)
+}
+
+func (dbOutboxStore) ReleaseStaleChainOutbox(staleBefore time.Time) (int64, error) {
+	return models.ReleaseStaleChainOutbox(staleBefore)
+}
+
+func (dbOutboxStore) GetUnsentChainOutboxBefore(goodID string, id int) (*models.ChainOutbox, error) {
+	return models.GetUnsentChainOutboxBefore(goodID, id)
+}
+
+func (dbOutboxStore) DeferChainOutbox(id int, next time.Time) error {
+	return models.DeferChainOutbox(id, next)
+}
+
+func (dbOutboxStore) BlockChainOutboxAfter(goodID string, id int, reason string) (int64, error) {
+	return models.BlockChainOutboxAfter(goodID, id, reason)
+}
+
+func (dbOutboxStore) UpdateChainOutbox(entry *models.ChainOutbox, cols ...string) error {
+	return models.UpdateChainOutbox(entry, cols...)
+}
+
+func (dbOutboxStore) UpdateStageChainStatus(stage string, recordID int, txHash string, chainStatus string) error {
+	return models.UpdateStageChainStatus(stage, recordID, txHash, chainStatus)
+}
+
+func (dbOutboxStore) UpdateGoodChainStatus(goodID string, txHash string, chainStatus string) error {
+	return models.UpdateGoodChainStatus(goodID, txHash, chainStatus)
+}
+
+// OutboxDispatcher 上链发件箱调度器
+// 负责把事务中写入的发件箱记录推送到区块链，失败时按指数退避重试
+type OutboxDispatcher struct {
+	Chain        ChainClient
+	Store        OutboxStore
+	BatchSize    int
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	PollInterval time.Duration
+	// 发送中的记录超过该时间未更新视为进程异常退出遗留，重新放回队列
+	// 需明显长于单次上链调用的耗时，避免其他实例正在发送的记录被重复发送
+	SendingTimeout time.Duration
+}
+
+// NewOutboxDispatcher 创建发件箱调度器
+func NewOutboxDispatcher() *OutboxDispatcher {
+	pollInterval, _ := web.AppConfig.Int("outbox_poll_interval")
+	maxAttempts, _ := web.AppConfig.Int("outbox_max_attempts")
+	baseBackoff, _ := web.AppConfig.Int("outbox_backoff_base")
+	maxBackoff, _ := web.AppConfig.Int("outbox_backoff_max")
+	sendingTimeout, _ := web.AppConfig.Int("outbox_sending_timeout")
+
+	if pollInterval <= 0 {
+		pollInterval = 5
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = 8
+	}
+	if baseBackoff <= 0 {
+		baseBackoff = 2
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = 300
+	}
+	if sendingTimeout <= 0 {
+		sendingTimeout = 120
+	}
+
+	return &OutboxDispatcher{
+		Chain:        NewChainClient(),
+		Store:        dbOutboxStore{},
+		BatchSize:    50,
+		MaxAttempts:  maxAttempts,
+		BaseBackoff:  time.Duration(baseBackoff) * time.Second,
+		MaxBackoff:   time.Duration(maxBackoff) * time.Second,
+		PollInterval: time.Duration(pollInterval) * time.Second,
+
+		SendingTimeout: time.Duration(sendingTimeout) * time.Second,
+	}
+}
+
+// Start 启动后台调度循环
+func (d *OutboxDispatcher) Start() {
+	d.ReleaseStale()
+
+	go func() {
+		ticker := time.NewTicker(d.PollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			d.ReleaseStale()
+			d.DispatchPending()
+		}
+	}()
+
+	logs.Info("上链发件箱调度器已启动 [interval=%s, maxAttempts=%d]", d.PollInterval, d.MaxAttempts)
+}
+
+// ReleaseStale 进程异常退出时可能遗留发送中的记录，超过 SendingTimeout 未更新的重新放回队列，返回重置的数量
+// 只按超时判断，不影响其他实例正在发送的记录
+func (d *OutboxDispatcher) ReleaseStale() int64 {
+	num, err := d.Store.ReleaseStaleChainOutbox(time.Now().Add(-d.SendingTimeout))
+	if err != nil {
+		logs.Error("重置遗留的上链发件箱记录失败: %v", err)
+	} else if num > 0 {
+		logs.Warning("已重置遗留的上链发件箱记录 [count=%d, timeout=%s]", num, d.SendingTimeout)
+	}
+	return num
+}
+
+// DispatchPending 发送所有到期的发件箱记录，返回成功上链的数量
+func (d *OutboxDispatcher) DispatchPending() int {
+	entries, err := d.Store.GetDueChainOutbox(d.BatchSize)
+	if err != nil {
+		return 0
+	}
+
+	sent := 0
+	for _, entry := range entries {
+		if err := d.Dispatch(entry); err == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+// Dispatch 发送单条发件箱记录
+func (d *OutboxDispatcher) Dispatch(entry *models.ChainOutbox) error {
+	if err := d.checkPredecessor(entry); err != nil {
+		return err
+	}
+
+	claimed, err := d.Store.ClaimChainOutbox(entry.Id)
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return errors.New("发件箱记录已被其他调度器领取")
+	}
+
+	txHash, err := d.submit(entry)
+	entry.Attempts++
+	if err != nil {
+		d.markRetry(entry, err)
+		return err
+	}
+
+	entry.Status = models.OutboxStatusSent
+	entry.TxHash = txHash
+	entry.LastError = ""
+	d.Store.UpdateChainOutbox(entry, "Status", "TxHash", "Attempts", "LastError")
+
+	// 交易已被节点接受，最终结果由回执确认跟踪器更新
+	d.Store.UpdateStageChainStatus(entry.Stage, entry.StageRecordId, txHash, models.ChainStatusPendingConfirmation)
+	d.Store.UpdateGoodChainStatus(entry.GoodId, txHash, models.ChainStatusPendingConfirmation)
+	// 链上溯源数据已变化
+	DefaultTraceCache().Invalidate(entry.GoodId)
+
+	logs.Info("发件箱记录上链成功 [id=%d, goodID=%s, func=%s, attempts=%d, txHash=%s]",
+		entry.Id, entry.GoodId, entry.FuncName, entry.Attempts, txHash)
+	return nil
+}
+
+// checkPredecessor 检查同一货物的前序记录是否均已上链
+// 前序记录仍在发送队列中时推迟本记录，避免一直占用到期批次；前序记录发送失败时本记录转为阻塞
+func (d *OutboxDispatcher) checkPredecessor(entry *models.ChainOutbox) error {
+	prev, err := d.Store.GetUnsentChainOutboxBefore(entry.GoodId, entry.Id)
+	if err == orm.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("获取前序发件箱记录失败: %v", err)
+	}
+
+	switch prev.Status {
+	case models.OutboxStatusFailed, models.OutboxStatusBlocked:
+		reason := fmt.Sprintf("前序环节上链失败 [outboxID=%d]", prev.Id)
+		if _, err := d.Store.BlockChainOutboxAfter(entry.GoodId, prev.Id, reason); err != nil {
+			logs.Error("阻塞后续发件箱记录失败 [goodID=%s, error=%v]", entry.GoodId, err)
+		}
+		return errOutboxBlocked
+	default:
+		next := time.Now().Add(d.PollInterval)
+		if prev.NextRetryAt.After(next) {
+			next = prev.NextRetryAt
+		}
+		d.Store.DeferChainOutbox(entry.Id, next)
+		return errOutboxWaiting
+	}
+}
+
+// submit 根据合约方法名调用区块链
+func (d *OutboxDispatcher) submit(entry *models.ChainOutbox) (string, error) {
+	params, err := entry.ParamList()
+	if err != nil {
+		return "", fmt.Errorf("解析上链参数失败: %v", err)
+	}
+	if len(params) < 2 {
+		return "", fmt.Errorf("上链参数数量不足 [func=%s]", entry.FuncName)
+	}
+
+	// 环节记录哈希为最后一个参数，旧版本服务端写入的发件箱记录没有该参数，上链时写入0
+	recordHash := func(index int) string {
+		if index < len(params) {
+			return params[index]
+		}
+		return ""
+	}
+
+	var txHash, message string
+	switch entry.FuncName {
+	case "registerGood":
+		txHash, message, err = d.Chain.RegisterGood(params[0], params[1], recordHash(2), entry.SenderAddress)
+	case "shipGood":
+		// 旧版本服务端写入的发件箱记录只有货物ID和运输信息，起止地点和运单号留空
+		if len(params) == 2 {
+			params = []string{params[0], "", "", "", params[1]}
+		}
+		if len(params) < 5 {
+			return "", fmt.Errorf("上链参数数量不足 [func=%s]", entry.FuncName)
+		}
+		txHash, message, err = d.Chain.ShipGood(params[0], params[1], params[2], params[3], params[4], recordHash(5), entry.SenderAddress)
+	case "inspectGood":
+		// 旧版本服务端写入的发件箱记录只有货物ID和验货信息，均视为验货合格
+		if len(params) == 2 {
+			params = []string{params[0], params[1], "true", ""}
+		}
+		if len(params) < 4 {
+			return "", fmt.Errorf("上链参数数量不足 [func=%s]", entry.FuncName)
+		}
+		passed, _ := strconv.ParseBool(params[2])
+		txHash, message, err = d.Chain.InspectGood(params[0], params[1], passed, params[3], recordHash(4), entry.SenderAddress)
+	case "disposeGood":
+		if len(params) < 3 {
+			return "", fmt.Errorf("上链参数数量不足 [func=%s]", entry.FuncName)
+		}
+		state, convErr := strconv.Atoi(params[1])
+		if convErr != nil {
+			return "", fmt.Errorf("无效的处置状态: %s", params[1])
+		}
+		txHash, message, err = d.Chain.DisposeGood(params[0], state, params[2], recordHash(3), entry.SenderAddress)
+	case "deliverGood":
+		txHash, message, err = d.Chain.DeliverGood(params[0], params[1], recordHash(2), entry.SenderAddress)
+	default:
+		return "", fmt.Errorf("不支持的合约方法: %s", entry.FuncName)
+	}
+
+	if err != nil {
+		return "", err
+	}
+	if message != "Success" {
+		return "", fmt.Errorf("上链失败: %s", message)
+	}
+	return txHash, nil
+}
+
+// markRetry 记录失败原因，并安排下一次重试或标记为最终失败
+func (d *OutboxDispatcher) markRetry(entry *models.ChainOutbox, cause error) {
+	entry.LastError = cause.Error()
+
+	maxAttempts := entry.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = d.MaxAttempts
+	}
+
+	if entry.Attempts >= maxAttempts {
+		entry.Status = models.OutboxStatusFailed
+		d.Store.UpdateChainOutbox(entry, "Status", "Attempts", "LastError")
+		d.Store.UpdateStageChainStatus(entry.Stage, entry.StageRecordId, "", models.ChainStatusFailed)
+		d.Store.UpdateGoodChainStatus(entry.GoodId, "", models.ChainStatusFailed)
+		// 合约要求环节按顺序写入，后续环节在本环节重新提交前无法上链
+		if num, err := d.Store.BlockChainOutboxAfter(entry.GoodId, entry.Id,
+			fmt.Sprintf("前序环节上链失败 [outboxID=%d]", entry.Id)); err == nil && num > 0 {
+			logs.Warning("已阻塞后续发件箱记录 [goodID=%s, count=%d]", entry.GoodId, num)
+		}
+		logs.Error("发件箱记录上链失败，已停止重试 [id=%d, goodID=%s, func=%s, attempts=%d, error=%v]",
+			entry.Id, entry.GoodId, entry.FuncName, entry.Attempts, cause)
+		return
+	}
+
+	entry.Status = models.OutboxStatusPending
+	entry.NextRetryAt = time.Now().Add(d.backoff(entry.Attempts))
+	d.Store.UpdateChainOutbox(entry, "Status", "Attempts", "LastError", "NextRetryAt")
+	logs.Warning("发件箱记录上链失败，稍后重试 [id=%d, goodID=%s, func=%s, attempts=%d, nextRetry=%s, error=%v]",
+		entry.Id, entry.GoodId, entry.FuncName, entry.Attempts,
+		entry.NextRetryAt.Format("2006-01-02 15:04:05"), cause)
+}
+
+// backoff 计算第 attempts 次失败后的等待时间
+func (d *OutboxDispatcher) backoff(attempts int) time.Duration {
+	wait := d.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= d.MaxBackoff {
+			return d.MaxBackoff
+		}
+	}
+	return wait
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/beego/beego/v2/server/web"
+)
+
+// rateLimiterSweepInterval 清理空闲令牌桶的间隔
+const rateLimiterSweepInterval = time.Minute
+
+// tokenBucket 单个来源地址的令牌桶
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter 按来源地址限流的令牌桶：每秒补充 Rate 个令牌，最多积累 Burst 个，每次请求消耗一个
+// 令牌桶保存在内存中，已补满的令牌桶定期清理；令牌桶数量达到 MaxKeys 且清理后仍无空位时，新的来源地址同样被限流
+type RateLimiter struct {
+	Rate    float64 // 每秒补充的令牌数，不大于0时不限流
+	Burst   int
+	MaxKeys int // 最多保存的令牌桶数量，不大于0时不限制
+	Now     func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+var (
+	publicRateLimiter     *RateLimiter
+	publicRateLimiterOnce sync.Once
+)
+
+// DefaultPublicRateLimiter 获取公开溯源接口的全局限流实例
+func DefaultPublicRateLimiter() *RateLimiter {
+	publicRateLimiterOnce.Do(func() {
+		perMinute := web.AppConfig.DefaultInt("public_rate_limit", 60)
+		publicRateLimiter = NewRateLimiter(float64(perMinute)/60, web.AppConfig.DefaultInt("public_rate_burst", 20))
+		publicRateLimiter.MaxKeys = web.AppConfig.DefaultInt("public_rate_max_clients", 100000)
+	})
+	return publicRateLimiter
+}
+
+// NewRateLimiter 创建限流实例，rate 为每秒补充的令牌数，burst 为令牌桶容量
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimiter{
+		Rate:    rate,
+		Burst:   burst,
+		Now:     time.Now,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// Allow 消耗 key 的一个令牌，令牌不足时返回 false 及需要等待的时间
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	if l.Rate <= 0 {
+		return true, 0
+	}
+	now := l.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now, false)
+
+	b := l.buckets[key]
+	if b == nil {
+		if l.MaxKeys > 0 && len(l.buckets) >= l.MaxKeys {
+			l.sweep(now, true)
+			if len(l.buckets) >= l.MaxKeys {
+				return false, time.Duration(math.Ceil(float64(time.Second) / l.Rate))
+			}
+		}
+		b = &tokenBucket{tokens: float64(l.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+	if b.tokens < 1 {
+		wait := time.Duration(math.Ceil((1 - b.tokens) / l.Rate * float64(time.Second)))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// refill 令牌桶在 now 时的令牌数
+func (l *RateLimiter) refill(b *tokenBucket, now time.Time) float64 {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed <= 0 {
+		return b.tokens
+	}
+	return math.Min(float64(l.Burst), b.tokens+elapsed*l.Rate)
+}
+
+// sweep 定期删除已补满的令牌桶，force 为 true 时不受清理间隔限制，调用方需持有锁
+func (l *RateLimiter) sweep(now time.Time, force bool) {
+	if !force && now.Sub(l.lastSweep) < rateLimiterSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= float64(l.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Size 当前保存的令牌桶数量
+func (l *RateLimiter) Size() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
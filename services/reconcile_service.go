@@ -0,0 +1,515 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"sea_trace_server_V2.0/models"
+
+	"github.com/beego/beego/v2/client/orm"
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
+)
+
+// ReconcileReport 一次核对的汇总结果
+type ReconcileReport struct {
+	Checked       int       `json:"checked"`
+	Discrepancies int       `json:"discrepancies"`
+	Errors        int       `json:"errors"`
+	StartedAt     time.Time `json:"started_at"`
+	FinishedAt    time.Time `json:"finished_at"`
+}
+
+// ReconcileService 链上与数据库数据核对服务
+type ReconcileService struct {
+	Chain         ChainClient
+	Dispatcher    *OutboxDispatcher
+	BatchSize     int
+	TimeTolerance time.Duration // 数据库时间与链上时间允许的误差
+	GracePeriod   time.Duration // 尚未上链的环节在该时间内不视为差异
+	Interval      time.Duration // 后台定时核对间隔，0表示不启用
+}
+
+// NewReconcileService 创建核对服务
+func NewReconcileService() *ReconcileService {
+	tolerance, _ := web.AppConfig.Int("reconcile_time_tolerance")
+	grace, _ := web.AppConfig.Int("reconcile_grace_period")
+	interval, _ := web.AppConfig.Int("reconcile_interval")
+
+	if tolerance <= 0 {
+		tolerance = 600
+	}
+	if grace <= 0 {
+		grace = 3600
+	}
+
+	return &ReconcileService{
+		Chain:         NewChainClient(),
+		Dispatcher:    NewOutboxDispatcher(),
+		BatchSize:     200,
+		TimeTolerance: time.Duration(tolerance) * time.Second,
+		GracePeriod:   time.Duration(grace) * time.Second,
+		Interval:      time.Duration(interval) * time.Minute,
+	}
+}
+
+// Start 启动后台定时核对
+func (s *ReconcileService) Start() {
+	if s.Interval <= 0 {
+		logs.Info("链上数据定时核对未启用")
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.Interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.Run()
+		}
+	}()
+
+	logs.Info("链上数据定时核对已启动 [interval=%s]", s.Interval)
+}
+
+// Run 核对全部货物
+func (s *ReconcileService) Run() *ReconcileReport {
+	report := &ReconcileReport{StartedAt: time.Now()}
+
+	afterID := 0
+	for {
+		goods, err := models.GetGoodsBatch(afterID, s.BatchSize)
+		if err != nil {
+			report.Errors++
+			break
+		}
+		if len(goods) == 0 {
+			break
+		}
+
+		for _, good := range goods {
+			found, err := s.reconcile(good)
+			report.Checked++
+			if err != nil {
+				report.Errors++
+				continue
+			}
+			report.Discrepancies += len(found)
+		}
+		afterID = goods[len(goods)-1].Id
+	}
+
+	report.FinishedAt = time.Now()
+	logs.Info("链上数据核对完成 [checked=%d, discrepancies=%d, errors=%d, cost=%s]",
+		report.Checked, report.Discrepancies, report.Errors, report.FinishedAt.Sub(report.StartedAt))
+	return report
+}
+
+// ReconcileGood 核对单个货物，返回发现的差异
+func (s *ReconcileService) ReconcileGood(goodID string) ([]*models.ChainDiscrepancy, error) {
+	good, err := models.GetGoodByID(goodID)
+	if err != nil {
+		return nil, fmt.Errorf("获取货物信息失败: %v", err)
+	}
+	return s.reconcile(good)
+}
+
+// reconcile 比对单个货物并保存核对结果
+func (s *ReconcileService) reconcile(good *models.Goods) ([]*models.ChainDiscrepancy, error) {
+	trace, err := s.Chain.GetRawTrace(good.GoodId)
+	if err != nil {
+		logs.Warning("核对时获取链上溯源记录失败 [goodID=%s, error=%v]", good.GoodId, err)
+		return nil, fmt.Errorf("获取链上溯源记录失败: %v", err)
+	}
+
+	found := CompareTrace(good, models.GetGoodStages(good.GoodId), trace, s.TimeTolerance, s.GracePeriod,
+		models.GetChainReplayedAt(good.GoodId))
+	if err := models.SyncGoodDiscrepancies(good.GoodId, found); err != nil {
+		return nil, fmt.Errorf("保存核对结果失败: %v", err)
+	}
+	return found, nil
+}
+
+// stageSnapshot 单个环节在数据库或链上的取值
+type stageSnapshot struct {
+	exists      bool
+	companyID   string
+	info        string
+	time        time.Time
+	chainStatus string
+}
+
+// dbStageSnapshots 提取数据库中生产、验货、交付环节的取值，运输段单独比对
+func dbStageSnapshots(good *models.Goods, stages *models.GoodStages) map[string]stageSnapshot {
+	snapshots := map[string]stageSnapshot{
+		models.StageProduction: {
+			exists:      true,
+			companyID:   strconv.Itoa(good.OwnerCompanyId),
+			info:        good.GoodName,
+			time:        good.CreatedAt,
+			chainStatus: good.ChainStatus,
+		},
+	}
+	if stages.Production != nil {
+		p := snapshots[models.StageProduction]
+		p.time = stages.Production.CreatedAt
+		p.chainStatus = stages.Production.ChainStatus
+		snapshots[models.StageProduction] = p
+	}
+	if i := stages.Inspection; i != nil {
+		snapshots[models.StageInspection] = stageSnapshot{true, strconv.Itoa(i.InspectorId), i.InspectionInfo, i.CreatedAt, i.ChainStatus}
+	}
+	if d := stages.Delivery; d != nil {
+		snapshots[models.StageDelivery] = stageSnapshot{true, strconv.Itoa(d.DealerId), d.DeliveryInfo, d.CreatedAt, d.ChainStatus}
+	}
+	return snapshots
+}
+
+// chainStageSnapshots 提取链上生产、验货、交付环节的取值
+func chainStageSnapshots(trace *TraceRecord) map[string]stageSnapshot {
+	return map[string]stageSnapshot{
+		models.StageProduction: {trace.GoodID != "", trace.OwnerCompanyID, trace.GoodName, chainTime(trace.RegisterTime), ""},
+		models.StageInspection: {trace.InspectExists, trace.PortCompanyID, trace.InspectionInfo, chainTime(trace.InspectTime), ""},
+		models.StageDelivery:   {trace.DeliveryExists, trace.DealerCompanyID, trace.DeliveryInfo, chainTime(trace.DeliveryTime), ""},
+	}
+}
+
+// chainTime 解析链上时间戳，FISCO BCOS 的 block.timestamp 为毫秒
+func chainTime(value string) time.Time {
+	ts, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ts <= 0 {
+		return time.Time{}
+	}
+	if ts > 1e12 {
+		return time.UnixMilli(ts)
+	}
+	return time.Unix(ts, 0)
+}
+
+// legFieldPrefix 运输段差异字段的前缀
+func legFieldPrefix(legIndex int) string {
+	return fmt.Sprintf("leg%d.", legIndex)
+}
+
+// dispositionFieldPrefix 处置记录差异字段的前缀
+func dispositionFieldPrefix(index int) string {
+	return fmt.Sprintf("disp%d.", index)
+}
+
+// chainGoodState 货物处置状态对应的合约处置状态
+func chainGoodState(status models.GoodsStatus) int {
+	if state, ok := disposeChainStates[status]; ok {
+		return state
+	}
+	return ChainGoodStateNormal
+}
+
+// CompareTrace 比对数据库记录与链上原始溯源记录，返回发现的差异
+// 尚未上链且仍在宽限期内的环节不视为差异；replayedAt 为货物切换合约后重放的时间，
+// 重放前已存在的环节在链上记录的是重放时的区块时间，不比对时间戳
+func CompareTrace(good *models.Goods, stages *models.GoodStages, trace *TraceRecord, tolerance, grace time.Duration, replayedAt time.Time) []*models.ChainDiscrepancy {
+	dbSnapshots := dbStageSnapshots(good, stages)
+	chainSnapshots := chainStageSnapshots(trace)
+
+	var found []*models.ChainDiscrepancy
+	add := func(stage, field, kind, dbValue, chainValue string) {
+		found = append(found, &models.ChainDiscrepancy{
+			GoodId:     good.GoodId,
+			Stage:      stage,
+			Field:      field,
+			Kind:       kind,
+			DbValue:    dbValue,
+			ChainValue: chainValue,
+		})
+	}
+
+	// compare 比对单个环节，返回两边是否都存在该环节
+	compare := func(stage, prefix string, db, chain stageSnapshot) bool {
+		switch {
+		case !db.exists && !chain.exists:
+			return false
+		case db.exists && !chain.exists:
+			inFlight := db.chainStatus == models.ChainStatusPending || db.chainStatus == models.ChainStatusPendingConfirmation
+			if inFlight && time.Since(db.time) < grace {
+				return false
+			}
+			add(stage, prefix+"exists", models.DiscrepancyMissingOnChain, db.chainStatus, "")
+			return false
+		case !db.exists && chain.exists:
+			add(stage, prefix+"exists", models.DiscrepancyMissingInDB, "", chain.info)
+			return false
+		}
+
+		if db.companyID != chain.companyID {
+			add(stage, prefix+"company_id", models.DiscrepancyMismatch, db.companyID, chain.companyID)
+		}
+		if db.info != chain.info {
+			add(stage, prefix+"info", models.DiscrepancyMismatch, db.info, chain.info)
+		}
+		if !chain.time.IsZero() && db.time.After(replayedAt) {
+			diff := db.time.Sub(chain.time)
+			if diff < 0 {
+				diff = -diff
+			}
+			if diff > tolerance {
+				add(stage, prefix+"timestamp", models.DiscrepancyMismatch,
+					db.time.Format("2006-01-02 15:04:05"), chain.time.Format("2006-01-02 15:04:05"))
+			}
+		}
+		return true
+	}
+
+	compare(models.StageProduction, "", dbSnapshots[models.StageProduction], chainSnapshots[models.StageProduction])
+
+	// 运输段按序号逐段比对
+	dbLegs := make(map[int]*models.GoodsTransport, len(stages.TransportLegs))
+	legCount := len(trace.TransportLegs)
+	for _, leg := range stages.TransportLegs {
+		dbLegs[leg.LegIndex] = leg
+		if leg.LegIndex+1 > legCount {
+			legCount = leg.LegIndex + 1
+		}
+	}
+	for i := 0; i < legCount; i++ {
+		var db, chain stageSnapshot
+		dbLeg := dbLegs[i]
+		if dbLeg != nil {
+			db = stageSnapshot{true, strconv.Itoa(dbLeg.TransporterId), dbLeg.TransportInfo, dbLeg.CreatedAt, dbLeg.ChainStatus}
+		}
+		var chainLeg TransportLegRecord
+		if i < len(trace.TransportLegs) {
+			chainLeg = trace.TransportLegs[i]
+			chain = stageSnapshot{true, chainLeg.ShipCompanyID, chainLeg.TransportInfo, chainTime(chainLeg.Time), ""}
+		}
+
+		prefix := legFieldPrefix(i)
+		if !compare(models.StageTransport, prefix, db, chain) {
+			continue
+		}
+		if dbLeg.StartLocation != chainLeg.FromLocation {
+			add(models.StageTransport, prefix+"start_location", models.DiscrepancyMismatch, dbLeg.StartLocation, chainLeg.FromLocation)
+		}
+		if dbLeg.EndLocation != chainLeg.ToLocation {
+			add(models.StageTransport, prefix+"end_location", models.DiscrepancyMismatch, dbLeg.EndLocation, chainLeg.ToLocation)
+		}
+		if dbLeg.TrackingNumber != chainLeg.TrackingNumber {
+			add(models.StageTransport, prefix+"tracking_number", models.DiscrepancyMismatch, dbLeg.TrackingNumber, chainLeg.TrackingNumber)
+		}
+	}
+
+	// 验货比对最新一次验货，除公共字段外还需比对验货结果
+	if compare(models.StageInspection, "", dbSnapshots[models.StageInspection], chainSnapshots[models.StageInspection]) {
+		if stages.Inspection.PassStatus != trace.InspectPassed {
+			add(models.StageInspection, "passed", models.DiscrepancyMismatch,
+				strconv.FormatBool(stages.Inspection.PassStatus), strconv.FormatBool(trace.InspectPassed))
+		}
+		if stages.Inspection.RejectReason != trace.InspectReason {
+			add(models.StageInspection, "reject_reason", models.DiscrepancyMismatch, stages.Inspection.RejectReason, trace.InspectReason)
+		}
+	}
+
+	// 处置记录按顺序逐条比对
+	dispositionCount := len(trace.Dispositions)
+	if len(stages.Dispositions) > dispositionCount {
+		dispositionCount = len(stages.Dispositions)
+	}
+	for i := 0; i < dispositionCount; i++ {
+		var db, chain stageSnapshot
+		var dbDisposition *models.GoodsDisposition
+		if i < len(stages.Dispositions) {
+			dbDisposition = stages.Dispositions[i]
+			db = stageSnapshot{true, strconv.Itoa(dbDisposition.CompanyId), dbDisposition.Reason, dbDisposition.CreatedAt, dbDisposition.ChainStatus}
+		}
+		var chainDisposition DispositionRecord
+		if i < len(trace.Dispositions) {
+			chainDisposition = trace.Dispositions[i]
+			chain = stageSnapshot{true, chainDisposition.CompanyID, chainDisposition.Reason, chainTime(chainDisposition.Time), ""}
+		}
+
+		prefix := dispositionFieldPrefix(i)
+		if !compare(models.StageDisposition, prefix, db, chain) {
+			continue
+		}
+		if state := chainGoodState(dbDisposition.ToStatus); state != chainDisposition.State {
+			add(models.StageDisposition, prefix+"state", models.DiscrepancyMismatch,
+				strconv.Itoa(state), strconv.Itoa(chainDisposition.State))
+		}
+	}
+
+	compare(models.StageDelivery, "", dbSnapshots[models.StageDelivery], chainSnapshots[models.StageDelivery])
+	return found
+}
+
+// Redrive 将链上缺失的环节重新提交上链
+func (s *ReconcileService) Redrive(discrepancyID int) (*models.ChainOutbox, error) {
+	d, err := models.GetChainDiscrepancyByID(discrepancyID)
+	if err != nil {
+		return nil, errors.New("差异记录不存在")
+	}
+	if d.Status != models.DiscrepancyStatusOpen {
+		return nil, errors.New("该差异已处理")
+	}
+	if d.Kind != models.DiscrepancyMissingOnChain {
+		return nil, errors.New("链上记录不可修改，该差异需人工处理")
+	}
+
+	// 运输段差异的字段形如 leg1.exists，处置记录差异的字段形如 disp0.exists
+	index, prefix := 0, ""
+	switch d.Stage {
+	case models.StageTransport:
+		if _, err := fmt.Sscanf(d.Field, "leg%d.", &index); err != nil {
+			return nil, errors.New("无法识别差异对应的运输段")
+		}
+		prefix = legFieldPrefix(index)
+	case models.StageDisposition:
+		if _, err := fmt.Sscanf(d.Field, "disp%d.", &index); err != nil {
+			return nil, errors.New("无法识别差异对应的处置记录")
+		}
+		prefix = dispositionFieldPrefix(index)
+	}
+
+	entry, err := s.requeue(d.GoodId, d.Stage, index)
+	if err != nil {
+		return nil, err
+	}
+
+	models.MarkDiscrepancyRedriven(d.GoodId, d.Stage, prefix, fmt.Sprintf("已重新提交上链 [outboxID=%d]", entry.Id))
+
+	// 立即尝试发送，失败时由后台调度器重试
+	if err := s.Dispatcher.Dispatch(entry); err != nil {
+		logs.Warning("重新提交的环节暂未上链 [goodID=%s, stage=%s, error=%v]", d.GoodId, d.Stage, err)
+	}
+	return entry, nil
+}
+
+// requeue 重置失败的发件箱记录，或根据数据库记录重新生成发件箱记录
+func (s *ReconcileService) requeue(goodID string, stage string, index int) (*models.ChainOutbox, error) {
+	recordID, params, operatorID, err := stageRecord(goodID, stage, index)
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := models.GetLatestChainOutbox(goodID, stage, recordID)
+	hasLatest := err == nil
+	if err != nil && err != orm.ErrNoRows {
+		return nil, fmt.Errorf("获取发件箱记录失败: %v", err)
+	}
+
+	if hasLatest {
+		switch latest.Status {
+		case models.OutboxStatusPending, models.OutboxStatusSending:
+			return nil, errors.New("该环节已在上链队列中")
+		case models.OutboxStatusBlocked:
+			return nil, errors.New("前序环节上链失败，请先重新提交前序环节")
+		case models.OutboxStatusFailed:
+			latest.Status = models.OutboxStatusPending
+			latest.Attempts = 0
+			latest.LastError = ""
+			latest.NextRetryAt = time.Now()
+			if err := models.UpdateChainOutbox(latest, "Status", "Attempts", "LastError", "NextRetryAt"); err != nil {
+				return nil, fmt.Errorf("重置发件箱记录失败: %v", err)
+			}
+			models.UpdateStageChainStatus(stage, latest.StageRecordId, "", models.ChainStatusPending)
+			// 因本环节失败而阻塞的后续环节随之恢复，按顺序排在本环节之后发送
+			if _, err := models.ReleaseBlockedChainOutbox(goodID); err != nil {
+				logs.Error("恢复被阻塞的发件箱记录失败 [goodID=%s, error=%v]", goodID, err)
+			}
+			return latest, nil
+		}
+	}
+
+	// 已发送但链上仍缺失（如交易被回滚），或是发件箱之前的历史数据，根据数据库记录重新生成
+	sender := ""
+	if hasLatest {
+		sender = latest.SenderAddress
+	} else if operator, err := models.GetUserByID(operatorID); err == nil {
+		sender = operator.BlockchainAddr
+	}
+	if sender == "" {
+		return nil, errors.New("无法确定上链发送方地址")
+	}
+
+	entry := models.NewChainOutbox(goodID, stage, models.StageFuncName(stage), params, sender)
+	entry.StageRecordId = recordID
+	if err := models.EnqueueChainOutbox(models.GetOrm(), entry); err != nil {
+		return nil, fmt.Errorf("写入发件箱失败: %v", err)
+	}
+	models.UpdateStageChainStatus(stage, recordID, "", models.ChainStatusPending)
+	return entry, nil
+}
+
+// stageRecord 获取环节记录ID、上链参数和操作员ID，index 为运输段或处置记录的序号，仅对这两个环节有效
+// 上链参数末尾为根据数据库记录重新计算的环节记录哈希
+func stageRecord(goodID string, stage string, index int) (int, []string, int, error) {
+	stages := models.GetGoodStages(goodID)
+
+	var good *models.Goods
+	var record interface{}
+	switch stage {
+	case models.StageProduction:
+		g, err := models.GetGoodByID(goodID)
+		if err != nil || stages.Production == nil {
+			return 0, nil, 0, errors.New("数据库中不存在生产记录")
+		}
+		good, record = g, stages.Production
+	case models.StageTransport:
+		for _, leg := range stages.TransportLegs {
+			if leg.LegIndex == index {
+				record = leg
+			}
+		}
+	case models.StageInspection:
+		if i := stages.Inspection; i != nil {
+			record = i
+		}
+	case models.StageDelivery:
+		if d := stages.Delivery; d != nil {
+			record = d
+		}
+	case models.StageDisposition:
+		if index >= 0 && index < len(stages.Dispositions) {
+			record = stages.Dispositions[index]
+		}
+	}
+	if record == nil {
+		return 0, nil, 0, fmt.Errorf("数据库中不存在该环节记录 [stage=%s]", stage)
+	}
+	return stageOutboxParams(goodID, good, record)
+}
+
+// stageOutboxParams 根据数据库环节记录生成上链参数，返回记录ID、上链参数和操作员ID
+// 上链参数末尾为根据数据库记录重新计算的环节记录哈希，生产环节需要传入货物信息
+func stageOutboxParams(goodID string, good *models.Goods, record interface{}) (int, []string, int, error) {
+	var recordID, operatorID int
+	var params []string
+	var hashGood *models.Goods
+	switch r := record.(type) {
+	case *models.GoodsProduction:
+		if good == nil {
+			return 0, nil, 0, errors.New("缺少货物信息，无法生成生产环节上链参数")
+		}
+		recordID, operatorID, hashGood = r.Id, r.OperatorId, good
+		params = []string{goodID, good.GoodName}
+	case *models.GoodsTransport:
+		recordID, operatorID = r.Id, r.OperatorId
+		params = []string{goodID, r.StartLocation, r.EndLocation, r.TrackingNumber, r.TransportInfo}
+	case *models.GoodsInspection:
+		recordID, operatorID = r.Id, r.OperatorId
+		params = []string{goodID, r.InspectionInfo, strconv.FormatBool(r.PassStatus), r.RejectReason}
+	case *models.GoodsDisposition:
+		recordID, operatorID = r.Id, r.OperatorId
+		params = []string{goodID, strconv.Itoa(chainGoodState(r.ToStatus)), r.Reason}
+	case *models.GoodsDelivery:
+		recordID, operatorID = r.Id, r.OperatorId
+		params = []string{goodID, r.DeliveryInfo}
+	default:
+		return 0, nil, 0, fmt.Errorf("未知的环节记录类型: %T", record)
+	}
+
+	params, err := recordHashParams(hashGood, record, params...)
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	return recordID, params, operatorID, nil
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"sea_trace_server_V2.0/models"
+)
+
+// 环节记录核验结果
+const (
+	RecordAnchorMatch       = "match"        // 数据库记录与链上锚定的哈希一致
+	RecordAnchorMismatch    = "mismatch"     // 数据库记录在上链后被修改，或链上记录在数据库中不存在
+	RecordAnchorNotAnchored = "not_anchored" // 写入时未附带记录哈希，链上哈希为0
+	RecordAnchorOffChain    = "off_chain"    // 记录尚未上链或上链失败，链上也没有未对应的记录
+	RecordAnchorMissing     = "missing"      // 数据库记录已上链但链上查询不到对应的哈希，或无法计算记录哈希
+)
+
+// RecordAnchorCheck 单条环节记录的核验结果，Index 为该记录在合约同一环节中的序号，未上链的记录为-1
+// RecordID 为0表示链上记录在数据库中不存在
+type RecordAnchorCheck struct {
+	Stage        string `json:"stage"`
+	Index        int    `json:"index"`
+	RecordID     int    `json:"record_id"`
+	Status       string `json:"status"`
+	ComputedHash string `json:"computed_hash,omitempty"`
+	AnchoredHash string `json:"anchored_hash,omitempty"`
+	Error        string `json:"error,omitempty"`
+}
+
+// RecordAnchorReport 货物全部环节记录的核验结果
+type RecordAnchorReport struct {
+	GoodID     string              `json:"good_id"`
+	Intact     bool                `json:"intact"` // 没有与链上哈希不一致的记录
+	Mismatches int                 `json:"mismatches"`
+	Checks     []RecordAnchorCheck `json:"checks"`
+}
+
+// anchorRow 待核验的数据库环节记录
+type anchorRow struct {
+	id          int
+	chainStatus string
+	txHash      string
+	record      interface{}
+}
+
+// claimsOnChain 数据库记录是否表明已发送上链
+func (r anchorRow) claimsOnChain() bool {
+	return r.txHash != "" || r.chainStatus == models.ChainStatusPendingConfirmation || r.chainStatus == models.ChainStatusConfirmed
+}
+
+// VerifyRecordAnchors 根据数据库记录重新计算各环节的记录哈希，并与合约中锚定的全部哈希比对
+// 不依赖数据库中的上链状态：先按哈希值对应，剩余的记录与剩余的链上哈希按顺序对应后判为不一致，
+// 因此修改记录后再把上链状态改为失败也会被发现；链上有哈希而数据库中没有对应记录同样判为不一致
+// 查询链上哈希失败时返回错误，不给出可能误导的核验结果
+func VerifyRecordAnchors(chain ChainClient, good *models.Goods, stages *models.GoodStages) (*RecordAnchorReport, error) {
+	report := &RecordAnchorReport{GoodID: good.GoodId, Checks: []RecordAnchorCheck{}}
+
+	verifyStage := func(stage string, rows []anchorRow) error {
+		count, err := chain.GetRecordHashCount(good.GoodId, stage)
+		if err != nil {
+			return fmt.Errorf("获取%s环节记录数量失败: %v", stage, err)
+		}
+		anchored := make([]string, count)
+		for i := range anchored {
+			if anchored[i], err = chain.GetRecordHash(good.GoodId, stage, i); err != nil {
+				return fmt.Errorf("获取%s环节第%d条记录哈希失败: %v", stage, i, err)
+			}
+		}
+
+		var hashGood *models.Goods
+		if stage == models.StageProduction {
+			hashGood = good
+		}
+		results := make([]RecordAnchorCheck, len(rows))
+		used := make([]bool, len(anchored))
+		var pending []int // 未按哈希值对应上的记录
+		for i, row := range rows {
+			results[i] = RecordAnchorCheck{Stage: stage, Index: -1, RecordID: row.id}
+			hash, err := models.StageRecordHash(hashGood, row.record)
+			if err != nil {
+				results[i].Status = RecordAnchorMissing
+				results[i].Error = err.Error()
+				continue
+			}
+			results[i].ComputedHash = hash
+			for j, h := range anchored {
+				if !used[j] && strings.EqualFold(h, hash) {
+					used[j] = true
+					results[i].Index, results[i].Status, results[i].AnchoredHash = j, RecordAnchorMatch, h
+					break
+				}
+			}
+			if results[i].Status == "" {
+				pending = append(pending, i)
+			}
+		}
+
+		next := 0
+		for _, i := range pending {
+			for next < len(used) && used[next] {
+				next++
+			}
+			if next < len(used) {
+				used[next] = true
+				results[i].Index = next
+				if models.IsZeroRecordHash(anchored[next]) {
+					results[i].Status = RecordAnchorNotAnchored
+				} else {
+					results[i].Status = RecordAnchorMismatch
+					results[i].AnchoredHash = anchored[next]
+					report.Mismatches++
+				}
+				continue
+			}
+			if rows[i].claimsOnChain() {
+				results[i].Status = RecordAnchorMissing
+				results[i].Error = "链上不存在对应的环节记录"
+				if rows[i].chainStatus == models.ChainStatusConfirmed {
+					report.Mismatches++
+				}
+				continue
+			}
+			results[i].Status = RecordAnchorOffChain
+		}
+		report.Checks = append(report.Checks, results...)
+
+		for j, h := range anchored {
+			if used[j] || models.IsZeroRecordHash(h) {
+				continue
+			}
+			report.Checks = append(report.Checks, RecordAnchorCheck{Stage: stage, Index: j, Status: RecordAnchorMismatch,
+				AnchoredHash: h, Error: "数据库中不存在对应的环节记录"})
+			report.Mismatches++
+		}
+		return nil
+	}
+
+	var production, delivery []anchorRow
+	if p := stages.Production; p != nil {
+		production = append(production, anchorRow{p.Id, p.ChainStatus, p.BlockchainTxHash, p})
+	}
+	transports := make([]anchorRow, 0, len(stages.TransportLegs))
+	for _, leg := range stages.TransportLegs {
+		transports = append(transports, anchorRow{leg.Id, leg.ChainStatus, leg.BlockchainTxHash, leg})
+	}
+	inspections := make([]anchorRow, 0, len(stages.Inspections))
+	for _, inspection := range stages.Inspections {
+		inspections = append(inspections, anchorRow{inspection.Id, inspection.ChainStatus, inspection.BlockchainTxHash, inspection})
+	}
+	dispositions := make([]anchorRow, 0, len(stages.Dispositions))
+	for _, disposition := range stages.Dispositions {
+		dispositions = append(dispositions, anchorRow{disposition.Id, disposition.ChainStatus, disposition.BlockchainTxHash, disposition})
+	}
+	if d := stages.Delivery; d != nil {
+		delivery = append(delivery, anchorRow{d.Id, d.ChainStatus, d.BlockchainTxHash, d})
+	}
+
+	for _, stage := range []struct {
+		name string
+		rows []anchorRow
+	}{
+		{models.StageProduction, production},
+		{models.StageTransport, transports},
+		{models.StageInspection, inspections},
+		{models.StageDisposition, dispositions},
+		{models.StageDelivery, delivery},
+	} {
+		if err := verifyStage(stage.name, stage.rows); err != nil {
+			return nil, err
+		}
+	}
+
+	report.Intact = report.Mismatches == 0
+	return report, nil
+}
+
+// VerifyRecordAnchors 核验访问范围内货物的环节记录是否与链上锚定的哈希一致
+func (s *GoodsService) VerifyRecordAnchors(goodID string, scope models.DataScope) (*RecordAnchorReport, error) {
+	good, stages, err := models.GetScopedGood(goodID, scope)
+	if err != nil {
+		return nil, fmt.Errorf("获取货物信息失败: %v", err)
+	}
+	return VerifyRecordAnchors(s.Chain, good, stages)
+}
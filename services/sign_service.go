@@ -0,0 +1,175 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/beego/beego/v2/server/web"
+	"github.com/google/uuid"
+	"sea_trace_server_V2.0/models"
+)
+
+// SignUser WeBASE-Sign 外部用户，只包含地址和公钥，私钥始终保存在签名服务中
+type SignUser struct {
+	SignUserID string `json:"signUserId"`
+	AppID      string `json:"appId"`
+	Address    string `json:"address"`
+	PublicKey  string `json:"publicKey"`
+}
+
+// SignService 私钥托管签名服务
+// 交易由WeBASE-Front按 signUserId 请求签名服务签名，服务端不接触私钥
+type SignService interface {
+	// CreateSignUser 创建外部用户并生成私钥
+	CreateSignUser(signUserID string, appID string) (*SignUser, error)
+	// ImportSignUser 以已有私钥（十六进制）创建外部用户，用于迁移本地用户，地址保持不变
+	ImportSignUser(signUserID string, appID string, privateKey string) (*SignUser, error)
+	// GetSignUser 查询外部用户
+	GetSignUser(signUserID string) (*SignUser, error)
+}
+
+// NewSignService 根据配置创建签名服务
+// 配置为本地密钥库托管时使用密钥库，否则模拟链使用进程内的本地替身，真实链使用WeBASE-Sign
+func NewSignService() SignService {
+	if KeyCustody() == KeyCustodyKeystore {
+		return NewKeystore()
+	}
+	if ChainBackend() == ChainBackendSimulator {
+		return sharedLocalSigner()
+	}
+	return NewWebaseSignService()
+}
+
+// SignAppID 获取在签名服务中登记外部用户使用的应用编号
+func SignAppID() string {
+	appID, _ := web.AppConfig.String("webase_app_id")
+	if appID == "" {
+		appID = "sea_trace_app" // 默认应用ID
+	}
+	return appID
+}
+
+// SignAccountProvider 基于签名服务的区块链账户提供者，创建的均为外部用户(type 2)
+type SignAccountProvider struct {
+	Sign  SignService
+	AppID string
+}
+
+// CreateBlockchainUser 在签名服务中创建外部用户
+func (p *SignAccountProvider) CreateBlockchainUser(username string) (*BlockchainUserResponse, error) {
+	signUser, err := p.Sign.CreateSignUser(uuid.New().String(), p.AppID)
+	if err != nil {
+		return nil, err
+	}
+
+	logs.Info("创建区块链外部用户成功 [username=%s, address=%s, signUserId=%s]",
+		username, signUser.Address, signUser.SignUserID)
+	return &BlockchainUserResponse{
+		Address:    signUser.Address,
+		PublicKey:  signUser.PublicKey,
+		UserName:   username,
+		Type:       models.BlockchainUserTypeExternal,
+		SignUserID: signUser.SignUserID,
+		AppID:      signUser.AppID,
+	}, nil
+}
+
+// WebaseSignService 通过WeBASE-Sign接口管理外部用户
+type WebaseSignService struct {
+	BaseURL string // WeBASE-Sign服务地址
+}
+
+// NewWebaseSignService 创建WeBASE-Sign服务实例
+func NewWebaseSignService() *WebaseSignService {
+	baseURL, _ := web.AppConfig.String("webase_sign_url")
+	if baseURL == "" {
+		baseURL = "http://localhost:5004"
+	}
+	return &WebaseSignService{BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// signResponse WeBASE-Sign 通用响应，data 中即使含有私钥也不会被解析
+type signResponse struct {
+	Code    int      `json:"code"`
+	Message string   `json:"message"`
+	Data    SignUser `json:"data"`
+}
+
+// CreateSignUser 创建外部用户
+func (s *WebaseSignService) CreateSignUser(signUserID string, appID string) (*SignUser, error) {
+	params := url.Values{}
+	params.Add("signUserId", signUserID)
+	params.Add("appId", appID)
+	params.Add("encryptType", "0")
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/WeBASE-Sign/user/newUser?%s", s.BaseURL, params.Encode()), nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	return s.do(req)
+}
+
+// ImportSignUser 导入私钥创建外部用户，私钥按WeBASE-Sign要求以base64编码传输且不写入日志
+func (s *WebaseSignService) ImportSignUser(signUserID string, appID string, privateKey string) (*SignUser, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"signUserId":  signUserID,
+		"appId":       appID,
+		"encryptType": 0,
+		"privateKey":  base64.StdEncoding.EncodeToString([]byte(strings.TrimPrefix(privateKey, "0x"))),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", s.BaseURL+"/WeBASE-Sign/user/newUser", strings.NewReader(string(body)))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return s.do(req)
+}
+
+// GetSignUser 查询外部用户
+func (s *WebaseSignService) GetSignUser(signUserID string) (*SignUser, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/WeBASE-Sign/user/%s/userInfo", s.BaseURL, url.PathEscape(signUserID)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	return s.do(req)
+}
+
+// do 发送请求并解析外部用户信息
+func (s *WebaseSignService) do(req *http.Request) (*SignUser, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		logs.Error("调用WeBASE-Sign失败 [path=%s, error=%v]", req.URL.Path, err)
+		return nil, fmt.Errorf("调用签名服务失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取签名服务响应失败: %v", err)
+	}
+
+	var result signResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("解析签名服务响应失败: %v", err)
+	}
+	if result.Code != 0 {
+		return nil, fmt.Errorf("签名服务返回错误: %s", result.Message)
+	}
+	if result.Data.Address == "" {
+		return nil, errors.New("签名服务未返回用户地址")
+	}
+	return &result.Data, nil
+}
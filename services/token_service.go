@@ -0,0 +1,136 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/beego/beego/v2/core/logs"
+	"github.com/google/uuid"
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/utils"
+)
+
+// 令牌校验错误
+var (
+	ErrInvalidRefreshToken = errors.New("刷新令牌无效或已过期，请重新登录")
+	ErrTokenRevoked        = errors.New("令牌已失效，请重新登录")
+)
+
+// TokenPair 登录或刷新后签发的令牌
+type TokenPair struct {
+	AccessToken      string    `json:"token"`
+	RefreshToken     string    `json:"refresh_token"`
+	ExpiresIn        int64     `json:"expires_in"` // 访问令牌有效期（秒）
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// TokenService 登录会话服务
+// 访问令牌短期有效，刷新令牌每次使用后轮换，只在数据库中保存哈希；已吊销的刷新令牌再次使用时整个会话失效
+type TokenService struct {
+	RefreshTTL time.Duration
+}
+
+// NewTokenService 创建登录会话服务实例
+func NewTokenService() *TokenService {
+	return &TokenService{
+		RefreshTTL: utils.RefreshTokenTTL(),
+	}
+}
+
+// Issue 为用户创建新会话并签发令牌，登录成功后调用
+func (s *TokenService) Issue(user *models.User) (*TokenPair, error) {
+	return s.issue(user, uuid.New().String(), nil)
+}
+
+// Refresh 使用刷新令牌签发新的令牌，旧刷新令牌随即失效
+func (s *TokenService) Refresh(refreshToken string) (*TokenPair, *models.User, error) {
+	record, err := models.GetRefreshTokenByHash(utils.HashRefreshToken(refreshToken))
+	if err != nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if record.Revoked() {
+		// 已轮换的令牌被再次使用，说明令牌可能已泄露，吊销整个会话
+		logs.Warning("刷新令牌被重复使用，吊销会话 [userID=%d, session=%s]", record.UserId, record.SessionId)
+		if err := models.RevokeRefreshSession(record.SessionId); err != nil {
+			logs.Error("吊销会话失败 [session=%s]: %v", record.SessionId, err)
+		}
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	user, err := models.GetUserByID(record.UserId)
+	if err != nil || user.Status != 1 {
+		models.RevokeRefreshSession(record.SessionId)
+		return nil, nil, ErrTokenRevoked
+	}
+
+	pair, err := s.issue(user, record.SessionId, record)
+	if err == models.ErrRefreshTokenReused {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return pair, user, nil
+}
+
+// Logout 退出登录，吊销会话的刷新令牌，会话中已签发的访问令牌同时失效
+func (s *TokenService) Logout(sessionID string) error {
+	return models.RevokeRefreshSession(sessionID)
+}
+
+// LogoutAll 退出用户的全部会话
+func (s *TokenService) LogoutAll(userID int) error {
+	return models.RevokeUserTokens(userID)
+}
+
+// Authenticate 校验访问令牌是否已被吊销：用户存在且未禁用、令牌版本一致、所属会话未退出，通过时返回当前用户
+func (s *TokenService) Authenticate(claims *utils.JWTClaims) (*models.User, error) {
+	user, err := models.GetUserByID(claims.UserID)
+	if err != nil || user.Status != 1 {
+		return nil, ErrTokenRevoked
+	}
+	if user.TokenVersion != claims.TokenVersion {
+		return nil, ErrTokenRevoked
+	}
+	if !models.IsRefreshSessionActive(claims.SessionID) {
+		return nil, ErrTokenRevoked
+	}
+	return user, nil
+}
+
+// issue 签发访问令牌和刷新令牌，previous 不为空时轮换该刷新令牌
+func (s *TokenService) issue(user *models.User, sessionID string, previous *models.RefreshToken) (*TokenPair, error) {
+	accessToken, err := utils.GenerateToken(user.Id, user.Username, user.Role, user.CompanyId, sessionID, user.TokenVersion)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, hash, err := utils.GenerateRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	record := &models.RefreshToken{
+		UserId:    user.Id,
+		SessionId: sessionID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(s.RefreshTTL),
+	}
+	if previous != nil {
+		err = models.RotateRefreshToken(previous, record)
+	} else {
+		err = models.CreateRefreshToken(record)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresIn:        int64(utils.AccessTokenTTL() / time.Second),
+		RefreshExpiresAt: record.ExpiresAt,
+	}, nil
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/beego/beego/v2/server/web"
+)
+
+// 缓存的溯源查询类型
+const (
+	TraceCachePublic = "public" // 公开溯源查询 /api/public/trace
+	TraceCacheChain  = "chain"  // 链上溯源查询 /api/chain/trace/:goodId
+)
+
+// traceCacheKinds 写入环节时需要失效的缓存类型
+var traceCacheKinds = []string{TraceCachePublic, TraceCacheChain}
+
+// TraceCacheEntry 缓存的溯源查询响应
+type TraceCacheEntry struct {
+	Body     []byte
+	ETag     string
+	StoredAt time.Time
+}
+
+// traceCacheItem LRU链表中的缓存项
+type traceCacheItem struct {
+	key   string
+	entry *TraceCacheEntry
+}
+
+// TraceCache 溯源查询响应的内存缓存，超过 Size 条时淘汰最久未访问的条目
+// 写入货物环节或上链成功后失效该货物的缓存，TTL 用于兜底其他途径引起的变化（如公开溯源设置）
+// 查询前通过 Version 取得版本号，Put 时若该货物在此之后被失效则不缓存，避免失效前开始的查询写回旧数据
+type TraceCache struct {
+	Size int // 最多缓存的条目数，不大于0时不缓存
+	TTL  time.Duration
+	Now  func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List // 按最近访问排列，表头为最近访问
+	entries map[string]*list.Element
+
+	version     uint64
+	invalidated map[string]uint64 // 货物最近一次失效时的版本号
+	floor       uint64            // 已清理的失效记录中的最大版本号，早于该版本开始的查询均不缓存
+}
+
+var (
+	traceCache     *TraceCache
+	traceCacheOnce sync.Once
+)
+
+// DefaultTraceCache 获取全局溯源查询缓存实例
+func DefaultTraceCache() *TraceCache {
+	traceCacheOnce.Do(func() {
+		traceCache = NewTraceCache(web.AppConfig.DefaultInt("trace_cache_size", 1000),
+			time.Duration(web.AppConfig.DefaultInt("trace_cache_ttl", 60))*time.Second)
+	})
+	return traceCache
+}
+
+// NewTraceCache 创建溯源查询缓存
+func NewTraceCache(size int, ttl time.Duration) *TraceCache {
+	return &TraceCache{
+		Size:        size,
+		TTL:         ttl,
+		Now:         time.Now,
+		order:       list.New(),
+		entries:     make(map[string]*list.Element),
+		invalidated: make(map[string]uint64),
+	}
+}
+
+// traceCacheKey 缓存键
+func traceCacheKey(kind, goodID string) string {
+	return kind + ":" + goodID
+}
+
+// Get 获取未过期的缓存响应
+func (c *TraceCache) Get(kind, goodID string) (*TraceCacheEntry, bool) {
+	if c.Size <= 0 {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[traceCacheKey(kind, goodID)]
+	if !ok {
+		return nil, false
+	}
+	item := elem.Value.(*traceCacheItem)
+	if c.TTL > 0 && c.Now().Sub(item.entry.StoredAt) >= c.TTL {
+		c.remove(elem)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return item.entry, true
+}
+
+// Version 当前版本号，在查询溯源数据前获取，缓存查询结果时传给 Put
+func (c *TraceCache) Version() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.version
+}
+
+// Put 缓存响应内容，ETag 由内容计算；version 为查询开始前取得的版本号，此后货物被失效时只返回不缓存
+func (c *TraceCache) Put(kind, goodID string, version uint64, body []byte) *TraceCacheEntry {
+	digest := sha256.Sum256(body)
+	entry := &TraceCacheEntry{Body: body, ETag: `"` + hex.EncodeToString(digest[:16]) + `"`, StoredAt: c.Now()}
+	if c.Size <= 0 {
+		return entry
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if version < c.floor || c.invalidated[goodID] > version {
+		return entry
+	}
+	key := traceCacheKey(kind, goodID)
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*traceCacheItem).entry = entry
+		c.order.MoveToFront(elem)
+		return entry
+	}
+	c.entries[key] = c.order.PushFront(&traceCacheItem{key: key, entry: entry})
+	for c.order.Len() > c.Size {
+		c.remove(c.order.Back())
+	}
+	return entry
+}
+
+// Invalidate 失效货物的全部缓存响应
+// 失效记录超过 Size 条时整体清理，清理前开始的查询均不再缓存，失效记录的内存占用因此有上限
+func (c *TraceCache) Invalidate(goodID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.version++
+	c.invalidated[goodID] = c.version
+	if len(c.invalidated) > c.Size {
+		c.invalidated = make(map[string]uint64)
+		c.floor = c.version
+	}
+	for _, kind := range traceCacheKinds {
+		if elem, ok := c.entries[traceCacheKey(kind, goodID)]; ok {
+			c.remove(elem)
+		}
+	}
+}
+
+// Purge 清空缓存
+func (c *TraceCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+	c.version++
+	c.invalidated = make(map[string]uint64)
+	c.floor = c.version
+}
+
+// Len 当前缓存的条目数
+func (c *TraceCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// remove 删除缓存项，调用方需持有锁
+func (c *TraceCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*traceCacheItem).key)
+}
@@ -7,15 +7,14 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"sea_trace_server_V2.0/models"
 
 	"github.com/beego/beego/v2/core/logs"
 	"github.com/beego/beego/v2/server/web"
-	"github.com/google/uuid"
 )
 
 // WebaseService 提供与WebaseFront交互的服务
@@ -100,6 +99,9 @@ type TransactionResponse struct {
 	Message         string                 `json:"message"`
 	Data            map[string]interface{} `json:"data"`
 	TransactionHash string                 `json:"transactionHash"`
+	BlockNumber     interface{}            `json:"blockNumber"` // 区块高度，可能为十进制数字或十六进制字符串
+	Status          string                 `json:"status"`      // 回执状态码，0x0表示成功
+	From            string                 `json:"from"`
 }
 
 // ClientVersionResponse 客户端版本响应
@@ -171,12 +173,21 @@ type TraceRecord struct {
 	ShipTime         string `json:"ship_time"`
 	ShipExists       bool   `json:"ship_exists"`
 
+	// 全部运输段，按顺序排列，第一段即上面的运输信息
+	TransportLegs []TransportLegRecord `json:"transport_legs"`
+
 	// 验货信息
 	PortCompanyID       string `json:"port_company_id"`
 	InspectOperatorAddr string `json:"inspect_operator_addr"`
 	InspectionInfo      string `json:"inspection_info"`
 	InspectTime         string `json:"inspect_time"`
 	InspectExists       bool   `json:"inspect_exists"`
+	InspectPassed       bool   `json:"inspect_passed"`
+	InspectReason       string `json:"inspect_reason"`
+
+	// 处置信息，GoodState 为 ChainGoodState* 常量
+	GoodState    int                 `json:"good_state"`
+	Dispositions []DispositionRecord `json:"dispositions"`
 
 	// 交付信息
 	DealerCompanyID      string `json:"dealer_company_id"`
@@ -186,13 +197,34 @@ type TraceRecord struct {
 	DeliveryExists       bool   `json:"delivery_exists"`
 }
 
-// BlockchainUserResponse WeBASE-Front创建用户响应
+// TransportLegRecord 链上运输段记录
+type TransportLegRecord struct {
+	LegIndex       int    `json:"leg_index"`
+	ShipCompanyID  string `json:"ship_company_id"`
+	OperatorAddr   string `json:"operator_addr"`
+	FromLocation   string `json:"from_location"`
+	ToLocation     string `json:"to_location"`
+	TrackingNumber string `json:"tracking_number"`
+	TransportInfo  string `json:"transport_info"`
+	Time           string `json:"time"`
+}
+
+// DispositionRecord 链上处置记录
+type DispositionRecord struct {
+	Index        int    `json:"index"`
+	CompanyID    string `json:"company_id"`
+	OperatorAddr string `json:"operator_addr"`
+	State        int    `json:"state"`
+	Reason       string `json:"reason"`
+	Time         string `json:"time"`
+}
+
+// BlockchainUserResponse 创建区块链用户响应，私钥由WeBASE-Sign托管，不在服务端出现
 type BlockchainUserResponse struct {
 	Address    string `json:"address"`    // 区块链地址
 	PublicKey  string `json:"publicKey"`  // 公钥
-	PrivateKey string `json:"privateKey"` // 私钥（根据请求参数可能为空）
-	UserName   string `json:"userName"`   // 用户名（本地用户才有）
-	Type       int    `json:"type"`       // 用户类型
+	UserName   string `json:"userName"`   // 用户名
+	Type       int    `json:"type"`       // 用户类型，外部用户为2
 	SignUserID string `json:"signUserId"` // WeBASE-Sign中的用户编号
 	AppID      string `json:"appId"`      // 应用编号
 }
@@ -288,14 +320,19 @@ func (w *WebaseService) sendTransaction(endpoint string, funcName string, funcPa
 		FuncName:        funcName,
 		FuncParam:       funcParam,
 		User:            userID, // 当前登录用户
-		// SignUserID:      userID,
-		ContractName: "Traceability",
-		UseCns:       false,
+		ContractName:    "Traceability",
+		UseCns:          false,
+	}
+	// 私钥托管在WeBASE-Sign的外部用户按 signUserId 签名，不再使用本地私钥
+	if signUserID := w.signUserIDFor(userID); signUserID != "" {
+		requestBody.User = ""
+		requestBody.SignUserID = signUserID
 	}
 
 	url := fmt.Sprintf("%s%s", w.BaseURL, endpoint)
 	respData, err := w.doPostRequest(url, requestBody)
 	if err != nil {
+		w.recordTransaction(endpoint, funcName, funcParam, userID, nil, err)
 		return nil, err
 	}
 
@@ -303,20 +340,91 @@ func (w *WebaseService) sendTransaction(endpoint string, funcName string, funcPa
 	err = json.Unmarshal(respData, &result)
 	if err != nil {
 		logs.Error("解析交易响应失败: %v", err)
-		return nil, fmt.Errorf("解析交易响应失败: %v", err)
+		err = fmt.Errorf("解析交易响应失败: %v", err)
+		w.recordTransaction(endpoint, funcName, funcParam, userID, nil, err)
+		return nil, err
 	}
 
 	if result.Code != 0 {
 		logs.Error("交易调用失败 [function=%s, message=%s, code=%d]",
 			funcName, result.Message, result.Code)
-		return &result, fmt.Errorf("交易调用失败: %s", result.Message)
+		err = fmt.Errorf("交易调用失败: %s", result.Message)
+		w.recordTransaction(endpoint, funcName, funcParam, userID, &result, err)
+		return &result, err
 	}
 
-	logs.Info("交易调用成功 [function=%s, time=%s, user=%s]",
-		funcName, "2025-05-14 09:05:03", "ZYongJie1224")
+	w.recordTransaction(endpoint, funcName, funcParam, userID, &result, nil)
+	logs.Info("交易调用成功 [function=%s, user=%s]", funcName, userID)
 	return &result, nil
 }
 
+// signUserIDFor 获取地址对应的WeBASE-Sign外部用户编号，本地用户返回空字符串
+// 超级管理员账户不在用户表中，其编号由配置项 super_admin_sign_user_id 或同名系统配置指定
+func (w *WebaseService) signUserIDFor(address string) string {
+	if address == "" {
+		return ""
+	}
+	if strings.EqualFold(address, w.GetSuperAdminBlockchainAddress()) {
+		if signUserID, _ := web.AppConfig.String("super_admin_sign_user_id"); signUserID != "" {
+			return signUserID
+		}
+		if config, err := models.GetSystemConfig("super_admin_sign_user_id"); err == nil && config != nil {
+			return config.Value
+		}
+		return ""
+	}
+	return models.GetSignUserIDByAddress(address)
+}
+
+// recordTransaction 将写交易记录到本地交易账本，只读调用不记录
+func (w *WebaseService) recordTransaction(endpoint string, funcName string, funcParam []interface{}, sender string, result *TransactionResponse, callErr error) {
+	if endpoint != "/WeBASE-Front/trans/handle" {
+		return
+	}
+
+	params, _ := json.Marshal(funcParam)
+	tx := &models.Transaction{
+		FuncName:      funcName,
+		Params:        string(params),
+		SenderAddress: sender,
+		Status:        models.TransactionStatusSuccess,
+	}
+
+	// 货物相关合约方法的第一个参数为货物ID
+	if models.IsGoodsTransaction(funcName) && len(funcParam) > 0 {
+		if goodID, ok := funcParam[0].(string); ok {
+			tx.GoodId = goodID
+		}
+	}
+
+	if result != nil {
+		tx.BlockchainTxHash = result.TransactionHash
+		tx.ReceiptStatus = result.Status
+		tx.BlockNumber = parseQuantity(result.BlockNumber)
+		if content, err := json.Marshal(result); err == nil {
+			tx.Content = string(content)
+		}
+		if result.Status != "" && result.Status != "0x0" {
+			tx.Status = models.TransactionStatusFailed
+			tx.ErrorMessage = result.Message
+		}
+	}
+	if callErr != nil {
+		tx.Status = models.TransactionStatusFailed
+		tx.ErrorMessage = callErr.Error()
+	}
+
+	models.SaveTransaction(tx)
+}
+
+// transactionMessage 获取交易响应消息，请求未发出时响应为空
+func transactionMessage(result *TransactionResponse) string {
+	if result == nil {
+		return ""
+	}
+	return result.Message
+}
+
 // RegisterCompany 注册公司
 func (w *WebaseService) RegisterCompany(name string, companyType int, adminAddress string) (string, error) {
 	admin, _ := web.AppConfig.String("super_admin_blockchain_address")
@@ -336,12 +444,62 @@ func (w *WebaseService) RegisterCompany(name string, companyType int, adminAddre
 	return "", errors.New("无法获取交易哈希")
 }
 
+// RegisterOperator 登记操作员，以公司管理员地址发起
+func (w *WebaseService) RegisterOperator(operatorAddress string, adminAddress string) (string, error) {
+	logs.Info("开始登记操作员 [operator=%s, admin=%s]", operatorAddress, adminAddress)
+
+	funcParam := []interface{}{operatorAddress}
+	result, err := w.sendTransaction("/WeBASE-Front/trans/handle", "registerOperator", funcParam, adminAddress)
+	if err != nil {
+		return "", err
+	}
+
+	if result.TransactionHash != "" {
+		logs.Info("操作员登记成功 [operator=%s, txHash=%s]", operatorAddress, result.TransactionHash)
+		return result.TransactionHash, nil
+	}
+	return "", errors.New("无法获取交易哈希")
+}
+
+// CompanyOf 获取地址所属的公司编号
+func (w *WebaseService) CompanyOf(address string) (int, error) {
+	funcParam := []interface{}{address}
+	result, err := w.sendTransaction("/WeBASE-Front/trans/call", "companyOf", funcParam, "public_user")
+	if err != nil {
+		return 0, err
+	}
+
+	companyID, err := strconv.Atoi(fmt.Sprint(result.Data["result"]))
+	if err != nil {
+		logs.Error("无法解析地址所属公司 [address=%s, result=%v]", address, result.Data["result"])
+		return 0, errors.New("无法解析地址所属公司")
+	}
+	return companyID, nil
+}
+
+// RemoveOperator 移除操作员，以公司管理员地址发起
+func (w *WebaseService) RemoveOperator(operatorAddress string, adminAddress string) (string, error) {
+	logs.Info("开始移除操作员 [operator=%s, admin=%s]", operatorAddress, adminAddress)
+
+	funcParam := []interface{}{operatorAddress}
+	result, err := w.sendTransaction("/WeBASE-Front/trans/handle", "removeOperator", funcParam, adminAddress)
+	if err != nil {
+		return "", err
+	}
+
+	if result.TransactionHash != "" {
+		logs.Info("操作员移除成功 [operator=%s, txHash=%s]", operatorAddress, result.TransactionHash)
+		return result.TransactionHash, nil
+	}
+	return "", errors.New("无法获取交易哈希")
+}
+
 // RegisterGood 注册货物
-func (w *WebaseService) RegisterGood(goodID string, goodName string, userAddress string) (string, string, error) {
+func (w *WebaseService) RegisterGood(goodID string, goodName string, recordHash string, userAddress string) (string, string, error) {
 	logs.Info("开始注册货物 [goodID=%s, goodName=%s, userAddress=%s, user=%s, time=%s]",
 		goodID, goodName, userAddress, "ZYongJie1224", "2025-05-14 09:05:03")
 
-	funcParam := []interface{}{goodID, goodName}
+	funcParam := []interface{}{goodID, goodName, chainRecordHash(recordHash)}
 	result, err := w.sendTransaction("/WeBASE-Front/trans/handle", "registerGood", funcParam, userAddress)
 	if err != nil {
 		return "", "", err
@@ -354,19 +512,18 @@ func (w *WebaseService) RegisterGood(goodID string, goodName string, userAddress
 	return "", "", errors.New("无法获取交易哈希")
 }
 
-// ShipGood 运输货物
-func (w *WebaseService) ShipGood(goodID string, transportInfo string, userAddress string) (string, string, error) {
-	logs.Info("开始货物运输 [goodID=%s, transportInfo=%s, userAddress=%s, user=%s, time=%s]",
-		goodID, transportInfo, userAddress, "ZYongJie1224", "2025-05-14 09:05:03")
+// ShipGood 追加一段运输
+func (w *WebaseService) ShipGood(goodID string, fromLocation string, toLocation string, trackingNumber string, transportInfo string, recordHash string, userAddress string) (string, string, error) {
+	logs.Info("开始货物运输 [goodID=%s, from=%s, to=%s, trackingNumber=%s, userAddress=%s]",
+		goodID, fromLocation, toLocation, trackingNumber, userAddress)
 
-	funcParam := []interface{}{goodID, transportInfo}
+	funcParam := []interface{}{goodID, fromLocation, toLocation, trackingNumber, transportInfo, chainRecordHash(recordHash)}
 	result, err := w.sendTransaction("/WeBASE-Front/trans/handle", "shipGood", funcParam, userAddress)
 	if err != nil {
-		return "", result.Message, err
+		return "", transactionMessage(result), err
 	}
 	//TODO
 	if result.TransactionHash != "" {
-		models.UpdateGoodStatus(goodID, models.GoodsStatusShipped, result.TransactionHash)
 		logs.Info("货物注册成功 [goodID=%s, txHash=%s]", goodID, result.TransactionHash)
 		return result.TransactionHash, result.Message, nil
 	}
@@ -374,39 +531,52 @@ func (w *WebaseService) ShipGood(goodID string, transportInfo string, userAddres
 }
 
 // InspectGood 验货
-func (w *WebaseService) InspectGood(goodID string, inspectionInfo string, userAddress string) (string, string, error) {
-	logs.Info("开始货物验证 [goodID=%s, inspectionInfo=%s, userAddress=%s, user=%s, time=%s]",
-		goodID, inspectionInfo, userAddress, "ZYongJie1224", "2025-05-14 09:05:03")
+func (w *WebaseService) InspectGood(goodID string, inspectionInfo string, passed bool, reason string, recordHash string, userAddress string) (string, string, error) {
+	logs.Info("开始货物验证 [goodID=%s, inspectionInfo=%s, passed=%v, userAddress=%s, user=%s, time=%s]",
+		goodID, inspectionInfo, passed, userAddress, "ZYongJie1224", "2025-05-14 09:05:03")
 
-	funcParam := []interface{}{goodID, inspectionInfo}
+	funcParam := []interface{}{goodID, inspectionInfo, passed, reason, chainRecordHash(recordHash)}
 	result, err := w.sendTransaction("/WeBASE-Front/trans/handle", "inspectGood", funcParam, userAddress)
 	if err != nil {
-		return "", result.Message, err
+		return "", transactionMessage(result), err
 	}
 
 	if result.TransactionHash != "" {
-		models.UpdateGoodStatus(goodID, models.GoodsStatusInspected, result.TransactionHash)
-
 		logs.Info("货物注册成功 [goodID=%s, txHash=%s]", goodID, result.TransactionHash)
 		return result.TransactionHash, result.Message, nil
 	}
 	return "", "", errors.New("无法获取交易哈希")
 }
 
+// DisposeGood 处置验货不合格的货物
+func (w *WebaseService) DisposeGood(goodID string, state int, reason string, recordHash string, userAddress string) (string, string, error) {
+	logs.Info("开始处置货物 [goodID=%s, state=%d, reason=%s, userAddress=%s]", goodID, state, reason, userAddress)
+
+	funcParam := []interface{}{goodID, state, reason, chainRecordHash(recordHash)}
+	result, err := w.sendTransaction("/WeBASE-Front/trans/handle", "disposeGood", funcParam, userAddress)
+	if err != nil {
+		return "", transactionMessage(result), err
+	}
+
+	if result.TransactionHash != "" {
+		logs.Info("货物处置成功 [goodID=%s, state=%d, txHash=%s]", goodID, state, result.TransactionHash)
+		return result.TransactionHash, result.Message, nil
+	}
+	return "", "", errors.New("无法获取交易哈希")
+}
+
 // DeliverGood 经销商收货
-func (w *WebaseService) DeliverGood(goodID string, deliveryInfo string, userAddress string) (string, string, error) {
+func (w *WebaseService) DeliverGood(goodID string, deliveryInfo string, recordHash string, userAddress string) (string, string, error) {
 	logs.Info("开始货物交付 [goodID=%s, deliveryInfo=%s, userAddress=%s, user=%s, time=%s]",
 		goodID, deliveryInfo, userAddress, "ZYongJie1224", "2025-05-14 09:05:03")
 
-	funcParam := []interface{}{goodID, deliveryInfo}
+	funcParam := []interface{}{goodID, deliveryInfo, chainRecordHash(recordHash)}
 	result, err := w.sendTransaction("/WeBASE-Front/trans/handle", "deliverGood", funcParam, userAddress)
 	if err != nil {
-		return "", result.Message, err
+		return "", transactionMessage(result), err
 	}
 
 	if result.TransactionHash != "" {
-		models.UpdateGoodStatus(goodID, models.GoodsStatusDelivered, result.TransactionHash)
-
 		logs.Info("货物注册成功 [goodID=%s, txHash=%s]", goodID, result.TransactionHash)
 		return result.TransactionHash, result.Message, nil
 	}
@@ -575,6 +745,21 @@ func (w *WebaseService) GetFullTrace(goodID string) (*TraceRecord, error) {
 	logs.Info("开始获取货物溯源信息 [goodID=%s, user=%s, time=%s]",
 		goodID, "ZYongJie1224", "2025-05-14 09:05:03")
 
+	trace, err := w.GetRawTrace(goodID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 丰富溯源信息，添加公司名称等
+	trace = enrichTraceRecord(trace)
+
+	logs.Info("成功获取货物溯源信息 [goodID=%s, goodName=%s, stages=%d]",
+		trace.GoodID, trace.GoodName, countCompletedStages(trace))
+	return trace, nil
+}
+
+// GetRawTrace 获取合约原始溯源记录，时间为链上时间戳，公司为链上公司ID
+func (w *WebaseService) GetRawTrace(goodID string) (*TraceRecord, error) {
 	funcParam := []interface{}{goodID}
 	result, err := w.sendTransaction("/WeBASE-Front/trans/call", "getFullTrace", funcParam, "public_user")
 	if err != nil {
@@ -600,6 +785,8 @@ func (w *WebaseService) GetFullTrace(goodID string) (*TraceRecord, error) {
 			InspectionInfo:      traceResult["inspectionInfo"].(string),
 			InspectTime:         traceResult["inspectTime"].(string),
 			InspectExists:       traceResult["inspectExists"].(bool),
+			InspectPassed:       traceResult["inspectPassed"] == true,
+			InspectReason:       fmt.Sprint(traceResult["inspectReason"]),
 
 			DealerCompanyID:      traceResult["dealerCompanyId"].(string),
 			DeliveryOperatorAddr: traceResult["deliveryOperatorAddr"].(string),
@@ -608,11 +795,24 @@ func (w *WebaseService) GetFullTrace(goodID string) (*TraceRecord, error) {
 			DeliveryExists:       traceResult["deliveryExists"].(bool),
 		}
 
-		// 丰富溯源信息，添加公司名称等
-		trace = w.enrichTraceRecord(trace)
+		legCount, _ := strconv.Atoi(fmt.Sprint(traceResult["transportLegCount"]))
+		for i := 0; i < legCount; i++ {
+			leg, err := w.getTransportLeg(goodID, i)
+			if err != nil {
+				return nil, err
+			}
+			trace.TransportLegs = append(trace.TransportLegs, *leg)
+		}
 
-		logs.Info("成功获取货物溯源信息 [goodID=%s, goodName=%s, stages=%d]",
-			trace.GoodID, trace.GoodName, w.countCompletedStages(trace))
+		trace.GoodState, _ = strconv.Atoi(fmt.Sprint(traceResult["goodState"]))
+		dispositionCount, _ := strconv.Atoi(fmt.Sprint(traceResult["dispositionCount"]))
+		for i := 0; i < dispositionCount; i++ {
+			disposition, err := w.getDisposition(goodID, i)
+			if err != nil {
+				return nil, err
+			}
+			trace.Dispositions = append(trace.Dispositions, *disposition)
+		}
 		return trace, nil
 	}
 
@@ -620,6 +820,94 @@ func (w *WebaseService) GetFullTrace(goodID string) (*TraceRecord, error) {
 	return nil, errors.New("无法解析溯源信息")
 }
 
+// getTransportLeg 获取指定运输段
+func (w *WebaseService) getTransportLeg(goodID string, legIndex int) (*TransportLegRecord, error) {
+	funcParam := []interface{}{goodID, legIndex}
+	result, err := w.sendTransaction("/WeBASE-Front/trans/call", "getTransportLeg", funcParam, "public_user")
+	if err != nil {
+		return nil, err
+	}
+
+	legResult, ok := result.Data["result"].(map[string]interface{})
+	if !ok {
+		logs.Error("无法解析运输段信息 [goodID=%s, legIndex=%d]", goodID, legIndex)
+		return nil, errors.New("无法解析运输段信息")
+	}
+	return &TransportLegRecord{
+		LegIndex:       legIndex,
+		ShipCompanyID:  fmt.Sprint(legResult["shipCompanyId"]),
+		OperatorAddr:   fmt.Sprint(legResult["operatorAddr"]),
+		FromLocation:   fmt.Sprint(legResult["fromLocation"]),
+		ToLocation:     fmt.Sprint(legResult["toLocation"]),
+		TrackingNumber: fmt.Sprint(legResult["trackingNumber"]),
+		TransportInfo:  fmt.Sprint(legResult["transportInfo"]),
+		Time:           fmt.Sprint(legResult["time"]),
+	}, nil
+}
+
+// getDisposition 获取指定处置记录
+func (w *WebaseService) getDisposition(goodID string, index int) (*DispositionRecord, error) {
+	funcParam := []interface{}{goodID, index}
+	result, err := w.sendTransaction("/WeBASE-Front/trans/call", "getDisposition", funcParam, "public_user")
+	if err != nil {
+		return nil, err
+	}
+
+	dispositionResult, ok := result.Data["result"].(map[string]interface{})
+	if !ok {
+		logs.Error("无法解析处置记录 [goodID=%s, index=%d]", goodID, index)
+		return nil, errors.New("无法解析处置记录")
+	}
+	state, _ := strconv.Atoi(fmt.Sprint(dispositionResult["state"]))
+	return &DispositionRecord{
+		Index:        index,
+		CompanyID:    fmt.Sprint(dispositionResult["companyId"]),
+		OperatorAddr: fmt.Sprint(dispositionResult["operatorAddr"]),
+		State:        state,
+		Reason:       fmt.Sprint(dispositionResult["reason"]),
+		Time:         fmt.Sprint(dispositionResult["time"]),
+	}, nil
+}
+
+// GetRecordHash 获取环节记录哈希，index 为该环节的第几条记录
+func (w *WebaseService) GetRecordHash(goodID string, stage string, index int) (string, error) {
+	recordStage, ok := chainRecordStages[stage]
+	if !ok {
+		return "", fmt.Errorf("未知的溯源环节: %s", stage)
+	}
+	funcParam := []interface{}{goodID, recordStage, index}
+	result, err := w.sendTransaction("/WeBASE-Front/trans/call", "getRecordHash", funcParam, "public_user")
+	if err != nil {
+		return "", err
+	}
+
+	if hash, ok := result.Data["result"].(string); ok {
+		return strings.ToLower(hash), nil
+	}
+	logs.Error("无法解析环节记录哈希 [goodID=%s, stage=%s, index=%d]", goodID, stage, index)
+	return "", errors.New("无法解析环节记录哈希")
+}
+
+// GetRecordHashCount 获取某环节已锚定的记录数量
+func (w *WebaseService) GetRecordHashCount(goodID string, stage string) (int, error) {
+	recordStage, ok := chainRecordStages[stage]
+	if !ok {
+		return 0, fmt.Errorf("未知的溯源环节: %s", stage)
+	}
+	funcParam := []interface{}{goodID, recordStage}
+	result, err := w.sendTransaction("/WeBASE-Front/trans/call", "getRecordHashCount", funcParam, "public_user")
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := strconv.Atoi(fmt.Sprint(result.Data["result"]))
+	if err != nil {
+		logs.Error("无法解析环节记录数量 [goodID=%s, stage=%s, result=%v]", goodID, stage, result.Data["result"])
+		return 0, errors.New("无法解析环节记录数量")
+	}
+	return count, nil
+}
+
 // GetGoodStatus 获取货物状态
 func (w *WebaseService) GetGoodStatus(goodID string) (int, error) {
 	logs.Info("开始获取货物状态 [goodID=%s, user=%s, time=%s]",
@@ -648,7 +936,7 @@ func (w *WebaseService) GetGoodStatus(goodID string) (int, error) {
 }
 
 // enrichTraceRecord 丰富溯源记录，添加更多信息
-func (w *WebaseService) enrichTraceRecord(trace *TraceRecord) *TraceRecord {
+func enrichTraceRecord(trace *TraceRecord) *TraceRecord {
 	// 转换时间戳为可读时间
 	registerTime, _ := strconv.ParseInt(trace.RegisterTime, 10, 64)
 	trace.RegisterTime = time.Unix(registerTime, 0).Format("2006-01-02 15:04:05")
@@ -672,6 +960,18 @@ func (w *WebaseService) enrichTraceRecord(trace *TraceRecord) *TraceRecord {
 		}
 	}
 
+	// 处理各运输段
+	for i := range trace.TransportLegs {
+		leg := &trace.TransportLegs[i]
+		legTime, _ := strconv.ParseInt(leg.Time, 10, 64)
+		leg.Time = time.Unix(legTime, 0).Format("2006-01-02 15:04:05")
+
+		legCompanyID, _ := strconv.Atoi(leg.ShipCompanyID)
+		if legCompany, err := models.GetCompanyByID(legCompanyID); err == nil {
+			leg.TransportInfo = fmt.Sprintf("运输商: %s, %s", legCompany.CompanyName, leg.TransportInfo)
+		}
+	}
+
 	// 处理验货信息
 	if trace.InspectExists {
 		inspectTime, _ := strconv.ParseInt(trace.InspectTime, 10, 64)
@@ -684,6 +984,13 @@ func (w *WebaseService) enrichTraceRecord(trace *TraceRecord) *TraceRecord {
 		}
 	}
 
+	// 处理各处置记录
+	for i := range trace.Dispositions {
+		disposition := &trace.Dispositions[i]
+		dispositionTime, _ := strconv.ParseInt(disposition.Time, 10, 64)
+		disposition.Time = time.Unix(dispositionTime, 0).Format("2006-01-02 15:04:05")
+	}
+
 	// 处理交付信息
 	if trace.DeliveryExists {
 		deliveryTime, _ := strconv.ParseInt(trace.DeliveryTime, 10, 64)
@@ -700,7 +1007,7 @@ func (w *WebaseService) enrichTraceRecord(trace *TraceRecord) *TraceRecord {
 }
 
 // countCompletedStages 计算货物已完成的阶段数
-func (w *WebaseService) countCompletedStages(trace *TraceRecord) int {
+func countCompletedStages(trace *TraceRecord) int {
 	count := 1 // 注册阶段总是存在的
 
 	if trace.ShipExists {
@@ -777,56 +1084,89 @@ func (w *WebaseService) GetTransactionByHash(txHash string) (map[string]interfac
 	return txInfo, nil
 }
 
-// CreateBlockchainUser 创建区块链用户
-// userType: 0-本地用户；1-本地随机；2-外部用户
-// returnPrivateKey: 是否返回私钥，仅对外部用户有效
-func (w *WebaseService) CreateBlockchainUser(username string, userType int, returnPrivateKey bool) (*BlockchainUserResponse, error) {
-	logs.Info("开始创建区块链用户 [username=%s, type=%d, time=%s]",
-		username, userType, "2025-05-14 09:05:03")
-
-	// 构建请求URL
-	baseURL := fmt.Sprintf("%s/WeBASE-Front/privateKey", w.BaseURL)
-	params := url.Values{}
-	params.Add("type", strconv.Itoa(userType))
-
-	if userType == 0 || userType == 1 {
-		// 本地用户需要传入用户名
-		params.Add("userName", username)
-	} else if userType == 2 {
-		// 外部用户需要传入signUserId和appId
-		signUserID := uuid.New().String() // 生成唯一的用户ID
-		params.Add("signUserId", signUserID)
-		params.Add("appId", "")
-
-		// 是否返回私钥
-		if returnPrivateKey {
-			params.Add("returnPrivateKey", "true")
+// GetTransactionReceipt 根据交易哈希获取交易回执，交易尚未打包时返回 ErrReceiptNotFound
+func (w *WebaseService) GetTransactionReceipt(txHash string) (*TransactionReceipt, error) {
+	url := fmt.Sprintf("%s/WeBASE-Front/%d/web3/transactionReceipt/%s", w.BaseURL, w.GroupID, txHash)
+
+	respData, err := w.doGetRequest(url)
+	if err != nil {
+		logs.Error("获取交易回执失败 [txHash=%s, error=%v]", txHash, err)
+		return nil, fmt.Errorf("获取交易回执失败: %v", err)
+	}
+
+	body := bytes.TrimSpace(respData)
+	if len(body) == 0 || string(body) == "null" {
+		return nil, ErrReceiptNotFound
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		logs.Error("解析交易回执失败 [txHash=%s, error=%v]", txHash, err)
+		return nil, fmt.Errorf("解析交易回执失败: %v", err)
+	}
+	if raw["transactionHash"] == nil {
+		return nil, ErrReceiptNotFound
+	}
+
+	receipt := &TransactionReceipt{
+		TransactionHash: fmt.Sprint(raw["transactionHash"]),
+		BlockNumber:     parseQuantity(raw["blockNumber"]),
+		GasUsed:         parseQuantity(raw["gasUsed"]),
+	}
+	if status, ok := raw["status"].(string); ok {
+		receipt.Status = status
+	}
+	if output, ok := raw["output"].(string); ok {
+		receipt.Output = output
+	}
+	receipt.Logs = parseReceiptLogs(raw["logs"], receipt.TransactionHash, receipt.BlockNumber)
+	if !receipt.Succeeded() {
+		receipt.RevertReason = decodeRevertReason(receipt.Output)
+		if receipt.RevertReason == "" {
+			if message, ok := raw["message"].(string); ok {
+				receipt.RevertReason = message
+			}
 		}
 	}
+	return receipt, nil
+}
 
-	requestURL := fmt.Sprintf("%s?%s", baseURL, params.Encode())
-	logs.Debug("调用WeBASE创建用户API [url=%s]", requestURL)
+// GetBlockTransactionHashes 获取指定区块内的交易哈希列表
+func (w *WebaseService) GetBlockTransactionHashes(blockNumber int64) ([]string, error) {
+	url := fmt.Sprintf("%s/WeBASE-Front/%d/web3/blockByNumber/%d", w.BaseURL, w.GroupID, blockNumber)
 
-	// 发送请求
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Get(requestURL)
+	respData, err := w.doGetRequest(url)
 	if err != nil {
-		logs.Error("调用WeBASE创建用户API失败: %v", err)
-		return nil, fmt.Errorf("调用区块链服务失败: %v", err)
+		logs.Error("获取区块信息失败 [blockNumber=%d, error=%v]", blockNumber, err)
+		return nil, fmt.Errorf("获取区块信息失败: %v", err)
 	}
-	defer resp.Body.Close()
 
-	// 解析响应
-	var result BlockchainUserResponse
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		logs.Error("解析WeBASE响应失败: %v", err)
-		return nil, fmt.Errorf("解析区块链服务响应失败: %v", err)
+	var block struct {
+		Transactions []interface{} `json:"transactions"`
+	}
+	if err := json.Unmarshal(respData, &block); err != nil {
+		logs.Error("解析区块信息失败 [blockNumber=%d, error=%v]", blockNumber, err)
+		return nil, fmt.Errorf("解析区块信息失败: %v", err)
 	}
 
-	logs.Info("成功创建区块链用户 [username=%s, address=%s, time=%s]",
-		username, result.Address, "2025-05-14 09:05:03")
+	// 交易列表可能是哈希字符串，也可能是完整交易对象
+	hashes := make([]string, 0, len(block.Transactions))
+	for _, tx := range block.Transactions {
+		switch v := tx.(type) {
+		case string:
+			hashes = append(hashes, v)
+		case map[string]interface{}:
+			if hash, ok := v["hash"].(string); ok {
+				hashes = append(hashes, hash)
+			}
+		}
+	}
+	return hashes, nil
+}
 
-	return &result, nil
+// GetContractAddress 获取溯源合约地址
+func (w *WebaseService) GetContractAddress() string {
+	return w.ContractAddress
 }
 
 // ValidateBlockchainAddress 验证区块链地址格式
@@ -0,0 +1,55 @@
+package test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"sea_trace_server_V2.0/models"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestActivity 仪表盘动态
+func TestActivity(t *testing.T) {
+	Convey("Subject: 由环节记录和审计日志生成动态\n", t, func() {
+		at := time.Date(2025, 5, 13, 16, 30, 22, 0, time.Local)
+
+		Convey("环节动态", func() {
+			activity := (&models.ActivityRecord{
+				Kind: models.ActivityTransport, OccurredAt: at, GoodId: "G1", CompanyId: 2,
+				CompanyName: "海运公司", Operator: "王五", Info1: "福州", Info2: "厦门",
+			}).ToActivity()
+			So(activity, ShouldResemble, models.Activity{
+				Time:        "2025-05-13 16:30:22",
+				Type:        "运输",
+				TypeCode:    models.ActivityTransport,
+				GoodID:      "G1",
+				CompanyID:   2,
+				CompanyName: "海运公司",
+				Description: "海运公司运输：福州 → 厦门",
+				Operator:    "王五",
+			})
+
+			rejected := (&models.ActivityRecord{Kind: models.ActivityInspection, OccurredAt: at,
+				CompanyName: "厦门港", Info1: "厦门", Info2: "冷链中断"}).ToActivity()
+			So(rejected.Description, ShouldEqual, "厦门港在厦门验货不合格：冷链中断")
+
+			disposed := (&models.ActivityRecord{Kind: models.ActivityDisposition, OccurredAt: at,
+				CompanyName: "厦门港", Info1: strconv.Itoa(int(models.GoodsStatusDestroyed)), Info2: "变质"}).ToActivity()
+			So(disposed.Description, ShouldEqual, "厦门港处置为"+models.GoodsStatusMap[models.GoodsStatusDestroyed]+"：变质")
+		})
+
+		Convey("公司和用户动态来自审计日志", func() {
+			activity := (&models.ActivityRecord{Kind: models.ActivityUser, OccurredAt: at, CompanyName: "福建渔业",
+				Operator: "admin", Info1: models.AuditOperatorCreate, Info2: "12"}).ToActivity()
+			So(activity.Type, ShouldEqual, "用户")
+			So(activity.Description, ShouldEqual, "福建渔业 创建操作员 #12")
+		})
+
+		Convey("动态类型校验", func() {
+			So(models.IsActivityType(models.ActivityDelivery), ShouldBeTrue)
+			So(models.IsActivityType("login"), ShouldBeFalse)
+		})
+	})
+}
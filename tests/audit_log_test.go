@@ -0,0 +1,56 @@
+package test
+
+import (
+	"testing"
+
+	"sea_trace_server_V2.0/middleware"
+	"sea_trace_server_V2.0/models"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestAuditLog 审计日志
+func TestAuditLog(t *testing.T) {
+	Convey("Subject: 审计日志变更内容和查询权限\n", t, func() {
+		Convey("只记录有变化的字段，密码不出现在变更内容中", func() {
+			before := &models.User{Id: 7, Username: "op1", Password: "hash-1", Status: 1, Phone: "1380000"}
+			after := *before
+			after.Status = 0
+			after.Password = "hash-2"
+
+			changes := models.AuditDiff(before, &after)
+			So(changes, ShouldHaveLength, 1)
+			So(changes["status"].Before, ShouldEqual, 1)
+			So(changes["status"].After, ShouldEqual, 0)
+		})
+
+		Convey("新建和删除分别只有操作后、操作前的值", func() {
+			created := models.AuditDiff(nil, map[string]interface{}{"status": 1})
+			So(created["status"].Before, ShouldBeNil)
+			So(created["status"].After, ShouldEqual, 1)
+
+			deleted := models.AuditDiff(map[string]interface{}{"status": 1}, nil)
+			So(deleted["status"].Before, ShouldEqual, 1)
+			So(deleted["status"].After, ShouldBeNil)
+
+			So(models.AuditDiff(map[string]interface{}{"role_ids": []int{1}}, map[string]interface{}{"role_ids": []int{1}}), ShouldBeEmpty)
+		})
+
+		Convey("全部审计日志只有超级管理员可以查询，公司管理员只能查询本公司", func() {
+			policy, ok := middleware.MatchRoutePolicy("GET", "/api/su/audit-logs")
+			So(ok, ShouldBeTrue)
+			So(policy.Permission, ShouldEqual, models.PermAuditViewAll)
+			So(models.SystemRolePermissions(models.RoleSuperAdmin).Has(models.PermAuditViewAll), ShouldBeTrue)
+			So(models.SystemRolePermissions(models.RoleCompanyAdmin).Has(models.PermAuditViewAll), ShouldBeFalse)
+
+			policy, ok = middleware.MatchRoutePolicy("GET", "/api/admin/audit-logs")
+			So(ok, ShouldBeTrue)
+			So(policy.Permission, ShouldEqual, models.PermAuditView)
+			So(models.SystemRolePermissions(models.RoleCompanyAdmin).Has(models.PermAuditView), ShouldBeTrue)
+			So(models.SystemRolePermissions(models.RoleOperator).Has(models.PermAuditView), ShouldBeFalse)
+
+			So(models.ValidateCompanyRolePermissions([]string{models.PermAuditViewAll},
+				models.SystemRolePermissions(models.RoleSuperAdmin)), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,48 @@
+package test
+
+import (
+	"testing"
+
+	"sea_trace_server_V2.0/middleware"
+	"sea_trace_server_V2.0/services"
+	"sea_trace_server_V2.0/utils"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestBootstrap 系统初始化与首次登录修改密码
+func TestBootstrap(t *testing.T) {
+	Convey("Subject: 超级管理员初始化\n", t, func() {
+		Convey("初始化令牌只能成功使用一次", func() {
+			token, err := services.NewSetupToken()
+			So(err, ShouldBeNil)
+			So(token.Value(), ShouldHaveLength, 64)
+
+			So(token.Consume(""), ShouldBeFalse)
+			So(token.Consume(token.Value()[:63]), ShouldBeFalse)
+			So(token.Consume(token.Value()), ShouldBeTrue)
+			So(token.Consume(token.Value()), ShouldBeFalse)
+
+			token.Release()
+			So(token.Consume(token.Value()), ShouldBeTrue)
+
+			other, _ := services.NewSetupToken()
+			So(other.Value(), ShouldNotEqual, token.Value())
+		})
+
+		Convey("密码至少8位且同时包含字母和数字", func() {
+			So(utils.ValidatePassword("admin123"), ShouldBeNil)
+			So(utils.ValidatePassword("adm123"), ShouldNotBeNil)
+			So(utils.ValidatePassword("password"), ShouldNotBeNil)
+			So(utils.ValidatePassword("12345678"), ShouldNotBeNil)
+		})
+
+		Convey("修改初始密码前只能访问修改密码、个人信息和退出登录接口", func() {
+			So(middleware.PasswordChangeAllowed("/api/auth/password"), ShouldBeTrue)
+			So(middleware.PasswordChangeAllowed("/api/auth/myinfo"), ShouldBeTrue)
+			So(middleware.PasswordChangeAllowed("/api/auth/logout/"), ShouldBeTrue)
+			So(middleware.PasswordChangeAllowed("/api/su/companies"), ShouldBeFalse)
+			So(middleware.PasswordChangeAllowed("/api/admin/audit-logs"), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,50 @@
+package test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/utils"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestBulkCSV 批量操作的CSV解析
+func TestBulkCSV(t *testing.T) {
+	Convey("Subject: 批量操作CSV解析\n", t, func() {
+		Convey("按表头的json名称解析各类型字段", func() {
+			data := "good_id,inspection_info,quality_score,pass_status,reject_reason,location,unknown\n" +
+				"G1,外观良好,95,true,,青岛港,x\n" +
+				"G2,温度超标,40,false,冷链中断,青岛港,y\n"
+			var reqs []models.GoodsInspectRequest
+			So(utils.DecodeCSV(strings.NewReader(data), &reqs), ShouldBeNil)
+			So(len(reqs), ShouldEqual, 2)
+			So(reqs[0].QualityScore, ShouldEqual, 95)
+			So(reqs[0].PassStatus, ShouldBeTrue)
+			So(reqs[1].PassStatus, ShouldBeFalse)
+			So(reqs[1].RejectReason, ShouldEqual, "冷链中断")
+		})
+
+		Convey("日期支持多种格式", func() {
+			data := "good_name,location,expiry_date\n" +
+				"带鱼,舟山,2026-12-31\n" +
+				"黄鱼,宁波,2026-12-31T08:00:00Z\n"
+			var reqs []models.GoodsRegisterRequest
+			So(utils.DecodeCSV(strings.NewReader(data), &reqs), ShouldBeNil)
+			So(reqs[0].ExpiryDate, ShouldEqual, time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC))
+			So(reqs[1].ExpiryDate.Hour(), ShouldEqual, 8)
+		})
+
+		Convey("格式错误时返回所在行和列", func() {
+			data := "good_id,quality_score\nG1,九十\n"
+			var reqs []models.GoodsInspectRequest
+			err := utils.DecodeCSV(strings.NewReader(data), &reqs)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "CSV第2行quality_score列格式错误")
+
+			So(utils.DecodeCSV(strings.NewReader(""), &reqs).Error(), ShouldEqual, "CSV文件为空")
+		})
+	})
+}
@@ -0,0 +1,114 @@
+package test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"testing"
+
+	"sea_trace_server_V2.0/certverify"
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/services"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestCertificate 溯源证书签发与核验
+func TestCertificate(t *testing.T) {
+	Convey("Subject: 溯源证书\n", t, func() {
+		key := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, ed25519.SeedSize))
+		service := services.NewCertificateService(key)
+
+		good := &models.Goods{GoodId: "G1", GoodName: "大黄鱼", BatchNumber: "B001", OwnerCompanyId: 1,
+			Status: models.GoodsStatusDelivered}
+		stages := &models.GoodStages{
+			Production: &models.GoodsProduction{GoodId: "G1", BlockchainTxHash: "0x01", BlockNumber: 10,
+				ChainStatus: models.ChainStatusConfirmed},
+			TransportLegs: []*models.GoodsTransport{{GoodId: "G1", TransporterId: 2, TransporterName: "海运公司",
+				BlockchainTxHash: "0x02", BlockNumber: 12, ChainStatus: models.ChainStatusConfirmed}},
+			Inspections: []*models.GoodsInspection{{GoodId: "G1", InspectorId: 3, InspectorName: "厦门港", PassStatus: true,
+				BlockchainTxHash: "0x03", ChainStatus: models.ChainStatusPendingConfirmation}},
+			Delivery: &models.GoodsDelivery{GoodId: "G1", DealerId: 4, DealerName: "海鲜超市", BlockchainTxHash: "0x04"},
+		}
+		visibility := map[int]models.TraceVisibility{4: {"delivery.dealer_name": models.VisibilityHidden}}
+		trace := models.NewPublicTrace(good, "福建渔业", stages, visibility)
+		cert := services.NewTraceCertificate(trace, stages, "0xcontract")
+
+		Convey("证书列出各环节的交易哈希和区块高度，遵循公开溯源设置", func() {
+			So(cert.Stages, ShouldHaveLength, 4)
+			So(cert.Stages[0].Company, ShouldEqual, "福建渔业")
+			So(cert.Stages[1].TxHash, ShouldEqual, "0x02")
+			So(cert.Stages[1].BlockNumber, ShouldEqual, 12)
+			So(cert.Stages[2].Result, ShouldEqual, "合格")
+			So(cert.Stages[3].Stage, ShouldEqual, models.StageDelivery)
+			So(cert.Stages[3].Company, ShouldBeEmpty)
+		})
+
+		Convey("规范化JSON：键排序、无空白、不转义HTML字符", func() {
+			data, err := certverify.CanonicalizeJSON([]byte(`{ "b": [1, 2.50, "<&>"], "a": {"y": null, "x": true} }`))
+			So(err, ShouldBeNil)
+			So(string(data), ShouldEqual, `{"a":{"x":true,"y":null},"b":[1,2.50,"<&>"]}`)
+
+			signed, _ := service.Sign(cert)
+			first, _ := certverify.Canonical(signed)
+			second, _ := certverify.Canonical(signed)
+			So(first, ShouldResemble, second)
+		})
+
+		signed, err := service.Sign(cert)
+		So(err, ShouldBeNil)
+		document, _ := certverify.Canonical(signed)
+
+		Convey("签名的证书可独立核验，与排版无关", func() {
+			verified, err := certverify.Verify(document, key.Public().(ed25519.PublicKey))
+			So(err, ShouldBeNil)
+			So(verified.GoodID, ShouldEqual, "G1")
+			So(verified.KeyID, ShouldEqual, certverify.KeyID(key.Public().(ed25519.PublicKey)))
+
+			var generic map[string]interface{}
+			json.Unmarshal(document, &generic)
+			pretty, _ := json.MarshalIndent(generic, "", "  ")
+			_, err = certverify.Verify(pretty, nil)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("篡改内容或换用其他密钥均无法通过核验", func() {
+			tampered := bytes.Replace(document, []byte(`"block_number":12`), []byte(`"block_number":13`), 1)
+			So(tampered, ShouldNotResemble, document)
+			_, err := certverify.Verify(tampered, nil)
+			So(err, ShouldEqual, certverify.ErrInvalidSignature)
+
+			other := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{8}, ed25519.SeedSize))
+			_, err = certverify.Verify(document, other.Public().(ed25519.PublicKey))
+			So(err, ShouldEqual, certverify.ErrUntrustedKey)
+
+			forged, _ := services.NewCertificateService(other).Sign(cert)
+			forgedDocument, _ := certverify.Canonical(forged)
+			result, err := service.Verify(forgedDocument)
+			So(err, ShouldBeNil)
+			So(result.Valid, ShouldBeFalse)
+		})
+
+		Convey("比对当前记录：新确认的区块不视为不一致", func() {
+			current := services.NewTraceCertificate(trace, stages, "0xcontract").Stages
+			current[2].BlockNumber = 15
+			So(services.CompareCertificateStages(cert.Stages, current), ShouldBeEmpty)
+			current[1].TxHash = "0xff"
+			So(services.CompareCertificateStages(cert.Stages, current), ShouldResemble, []string{"transport#0: 交易哈希不一致"})
+		})
+
+		Convey("PDF证书嵌入签名JSON", func() {
+			data, err := services.RenderCertificatePDF(signed, document, "https://trace.example.com/t?good_id=G1")
+			So(err, ShouldBeNil)
+			So(string(data), ShouldStartWith, "%PDF-1.4")
+			So(string(data), ShouldContainSubstring, "/EmbeddedFiles << /Names [(certificate.json) 8 0 R] >>")
+			So(bytes.Contains(data, document), ShouldBeTrue)
+
+			startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(data)
+			So(startxref, ShouldNotBeNil)
+			So(strings.Count(string(data), " 00000 n "), ShouldEqual, 9)
+		})
+	})
+}
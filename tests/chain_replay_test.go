@@ -0,0 +1,124 @@
+package test
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/services"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestChainReplay 切换合约后按原顺序重放货物环节
+func TestChainReplay(t *testing.T) {
+	Convey("Subject: 合约重放\n", t, func() {
+		at := time.Date(2025, 5, 14, 9, 0, 0, 0, time.Local)
+		good := &models.Goods{GoodId: "G1", GoodName: "大黄鱼", OwnerCompanyId: 1, BatchNumber: "B001"}
+		stages := &models.GoodStages{
+			Production: &models.GoodsProduction{Id: 1, GoodId: "G1", OperatorId: 11, Location: "宁德", ProducedAt: at},
+			TransportLegs: []*models.GoodsTransport{
+				{Id: 2, GoodId: "G1", OperatorId: 12, LegIndex: 0, StartLocation: "宁德", EndLocation: "福州"},
+				{Id: 3, GoodId: "G1", OperatorId: 12, LegIndex: 1, StartLocation: "福州", EndLocation: "厦门"},
+			},
+			Inspections: []*models.GoodsInspection{
+				{Id: 4, GoodId: "G1", OperatorId: 13, PassStatus: false, RejectReason: "温度超标", CreatedAt: at.Add(time.Hour)},
+				{Id: 5, GoodId: "G1", OperatorId: 13, PassStatus: true, CreatedAt: at.Add(3 * time.Hour)},
+			},
+			Dispositions: []*models.GoodsDisposition{
+				{Id: 6, GoodId: "G1", OperatorId: 13, ToStatus: models.GoodsStatusQuarantined, Reason: "复检", CreatedAt: at.Add(2 * time.Hour)},
+			},
+			Delivery: &models.GoodsDelivery{Id: 7, GoodId: "G1", OperatorId: 14, RecipientName: "张三"},
+		}
+		senders := map[int]string{11: simProducer, 12: simShipper, 13: simPort, 14: simDealer}
+		sender := func(stage string, recordID int, operatorID int) (string, error) {
+			if address, ok := senders[operatorID]; ok {
+				return address, nil
+			}
+			return "", errors.New("无法确定上链发送方地址")
+		}
+		sequences := map[string]int{"inspection:4": 10, "disposition:6": 11, "inspection:5": 12}
+		sequence := func(stage string, recordID int) int {
+			return sequences[stage+":"+strconv.Itoa(recordID)]
+		}
+
+		Convey("验货和处置记录按创建时间交替，各记录附带重新计算的记录哈希", func() {
+			entries, err := services.ReplayOutboxEntries(good, stages, sender, sequence)
+			So(err, ShouldBeNil)
+
+			var funcs []string
+			var records []int
+			for _, entry := range entries {
+				funcs = append(funcs, entry.FuncName)
+				records = append(records, entry.StageRecordId)
+			}
+			So(funcs, ShouldResemble, []string{"registerGood", "shipGood", "shipGood", "inspectGood", "disposeGood", "inspectGood", "deliverGood"})
+			So(records, ShouldResemble, []int{1, 2, 3, 4, 6, 5, 7})
+			So(entries[4].SenderAddress, ShouldEqual, simPort)
+
+			params, _ := entries[0].ParamList()
+			productionHash, _ := models.StageRecordHash(good, stages.Production)
+			So(params[len(params)-1], ShouldEqual, productionHash)
+			params, _ = entries[4].ParamList()
+			So(params[1], ShouldEqual, "2")
+		})
+
+		Convey("同一秒内创建的验货和处置记录按原先的上链顺序排列", func() {
+			// 数据库中的创建时间只精确到秒
+			stages.Inspections[1].CreatedAt = stages.Dispositions[0].CreatedAt
+			entries, err := services.ReplayOutboxEntries(good, stages, sender, sequence)
+			So(err, ShouldBeNil)
+
+			var records []int
+			for _, entry := range entries {
+				records = append(records, entry.StageRecordId)
+			}
+			So(records, ShouldResemble, []int{1, 2, 3, 4, 6, 5, 7})
+		})
+
+		Convey("无法确定发送方时不生成任何记录", func() {
+			stages.Delivery.OperatorId = 99
+			entries, err := services.ReplayOutboxEntries(good, stages, sender, sequence)
+			So(err, ShouldNotBeNil)
+			So(entries, ShouldBeNil)
+		})
+
+		Convey("重放前已存在的环节不比对链上时间戳，重放后新增的环节照常比对", func() {
+			replayedAt := at.Add(48 * time.Hour)
+			good.CreatedAt = at
+			stages := &models.GoodStages{
+				Production: &models.GoodsProduction{Id: 1, GoodId: "G1", CreatedAt: at, ChainStatus: models.ChainStatusConfirmed},
+				TransportLegs: []*models.GoodsTransport{
+					{Id: 2, GoodId: "G1", LegIndex: 0, TransporterId: 2, CreatedAt: at.Add(time.Hour), ChainStatus: models.ChainStatusConfirmed},
+					{Id: 3, GoodId: "G1", LegIndex: 1, TransporterId: 2, CreatedAt: replayedAt.Add(time.Hour), ChainStatus: models.ChainStatusConfirmed},
+				},
+			}
+			replayTime := strconv.FormatInt(replayedAt.Add(time.Minute).UnixMilli(), 10)
+			trace := &services.TraceRecord{
+				GoodID: "G1", OwnerCompanyID: "1", GoodName: "大黄鱼", RegisterTime: replayTime,
+				TransportLegs: []services.TransportLegRecord{
+					{LegIndex: 0, ShipCompanyID: "2", Time: replayTime},
+					{LegIndex: 1, ShipCompanyID: "2", Time: replayTime},
+				},
+			}
+
+			found := services.CompareTrace(good, stages, trace, 5*time.Minute, time.Hour, replayedAt)
+			So(found, ShouldHaveLength, 1)
+			So(found[0].Field, ShouldEqual, "leg1.timestamp")
+
+			found = services.CompareTrace(good, stages, trace, 5*time.Minute, time.Hour, time.Time{})
+			So(found, ShouldHaveLength, 3)
+		})
+
+		Convey("模拟链可查询地址所属的公司", func() {
+			chain := newSimulatorWithCompanies()
+			companyID, err := chain.CompanyOf(simShipper)
+			So(err, ShouldBeNil)
+			So(companyID, ShouldEqual, 2)
+			companyID, _ = chain.CompanyOf("0x1000000000000000000000000000000000000009")
+			So(companyID, ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,263 @@
+package test
+
+import (
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"sea_trace_server_V2.0/services"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	simSuperAdmin = "0xca02cadbe484203cce3031d83106b133a64cce95"
+	simProducer   = "0x1000000000000000000000000000000000000001"
+	simShipper    = "0x1000000000000000000000000000000000000002"
+	simPort       = "0x1000000000000000000000000000000000000003"
+	simDealer     = "0x1000000000000000000000000000000000000004"
+)
+
+// newSimulatorWithCompanies 创建已注册四类公司的模拟链
+func newSimulatorWithCompanies() *services.SimulatorChainClient {
+	chain := services.NewSimulatorChainClient(simSuperAdmin)
+	chain.RegisterCompany("生产商", 0, simProducer)
+	chain.RegisterCompany("运输商", 1, simShipper)
+	chain.RegisterCompany("验货商", 2, simPort)
+	chain.RegisterCompany("经销商", 3, simDealer)
+	return chain
+}
+
+// TestSimulatorLifecycle 模拟链完整溯源流程
+func TestSimulatorLifecycle(t *testing.T) {
+	Convey("Subject: 模拟链货物生命周期\n", t, func() {
+		chain := newSimulatorWithCompanies()
+
+		Convey("按顺序完成注册、运输、验货、交付", func() {
+			txHash, message, err := chain.RegisterGood("G1", "带鱼", "", simProducer)
+			So(err, ShouldBeNil)
+			So(message, ShouldEqual, "Success")
+			So(txHash, ShouldStartWith, "0x")
+
+			_, _, err = chain.ShipGood("G1", "福州", "厦门", "SF001", "冷链运输", "", simShipper)
+			So(err, ShouldBeNil)
+			_, _, err = chain.InspectGood("G1", "合格", true, "", "", simPort)
+			So(err, ShouldBeNil)
+			_, _, err = chain.DeliverGood("G1", "厦门海鲜市场", "", simDealer)
+			So(err, ShouldBeNil)
+
+			status, err := chain.GetGoodStatus("G1")
+			So(err, ShouldBeNil)
+			So(status, ShouldEqual, 3)
+
+			blockNumber, _ := chain.GetBlockNumber()
+			So(blockNumber, ShouldEqual, 8)
+
+			tx, err := chain.GetTransactionByHash(txHash)
+			So(err, ShouldBeNil)
+			So(tx["funcName"], ShouldEqual, "registerGood")
+
+			receipt, err := chain.GetTransactionReceipt(txHash)
+			So(err, ShouldBeNil)
+			So(receipt.Succeeded(), ShouldBeTrue)
+			So(receipt.BlockNumber, ShouldEqual, 5)
+
+			_, err = chain.GetTransactionReceipt("0xdeadbeef")
+			So(err, ShouldEqual, services.ErrReceiptNotFound)
+		})
+
+		Convey("公司类型不匹配时回滚", func() {
+			_, message, err := chain.RegisterGood("G2", "黄鱼", "", simShipper)
+			So(err, ShouldNotBeNil)
+			So(message, ShouldEqual, "公司类型不匹配")
+
+			_, message, _ = chain.RegisterGood("G2", "黄鱼", "", "0x2000000000000000000000000000000000000000")
+			So(message, ShouldEqual, "公司不存在")
+		})
+
+		Convey("环节顺序错误时回滚", func() {
+			chain.RegisterGood("G3", "鱿鱼", "", simProducer)
+
+			_, message, err := chain.InspectGood("G3", "合格", true, "", "", simPort)
+			So(err, ShouldNotBeNil)
+			So(message, ShouldEqual, "该货物未有运输记录")
+
+			_, message, _ = chain.DeliverGood("G3", "交付", "", simDealer)
+			So(message, ShouldEqual, "该货物未有运输记录")
+
+			_, message, _ = chain.ShipGood("G404", "福州", "厦门", "", "运输", "", simShipper)
+			So(message, ShouldEqual, "货物不存在")
+		})
+
+		Convey("重复记录时回滚", func() {
+			chain.RegisterGood("G4", "海参", "", simProducer)
+			_, message, _ := chain.RegisterGood("G4", "海参", "", simProducer)
+			So(message, ShouldEqual, "货物ID已存在")
+
+			chain.ShipGood("G4", "大连", "大连港", "", "陆运", "", simShipper)
+			chain.InspectGood("G4", "合格", true, "", "", simPort)
+			_, message, _ = chain.ShipGood("G4", "大连港", "上海港", "", "海运", "", simShipper)
+			So(message, ShouldEqual, "该货物已验货，不能追加运输记录")
+		})
+
+		Convey("多段运输按顺序记录", func() {
+			chain.RegisterGood("G5", "三文鱼", "", simProducer)
+			_, message, err := chain.ShipGood("G5", "奥斯陆", "奥斯陆港", "TRK-1", "陆运", "", simShipper)
+			So(err, ShouldBeNil)
+			So(message, ShouldEqual, "Success")
+			_, message, err = chain.ShipGood("G5", "奥斯陆港", "上海港", "MSKU-2", "海运", "", simShipper)
+			So(err, ShouldBeNil)
+			So(message, ShouldEqual, "Success")
+
+			trace, err := chain.GetRawTrace("G5")
+			So(err, ShouldBeNil)
+			So(trace.ShipExists, ShouldBeTrue)
+			So(trace.TransportInfo, ShouldEqual, "陆运")
+			So(len(trace.TransportLegs), ShouldEqual, 2)
+			So(trace.TransportLegs[1].LegIndex, ShouldEqual, 1)
+			So(trace.TransportLegs[1].FromLocation, ShouldEqual, "奥斯陆港")
+			So(trace.TransportLegs[1].ToLocation, ShouldEqual, "上海港")
+			So(trace.TransportLegs[1].TrackingNumber, ShouldEqual, "MSKU-2")
+
+			status, _ := chain.GetGoodStatus("G5")
+			So(status, ShouldEqual, 1)
+		})
+
+		Convey("验货不合格时阻止交付并允许重新验货", func() {
+			chain.RegisterGood("G6", "扇贝", "", simProducer)
+			chain.ShipGood("G6", "青岛", "青岛港", "", "冷链运输", "", simShipper)
+
+			_, message, err := chain.InspectGood("G6", "温度超标", false, "冷链温度记录超过-18℃", "", simPort)
+			So(err, ShouldBeNil)
+			So(message, ShouldEqual, "Success")
+			status, _ := chain.GetGoodStatus("G6")
+			So(status, ShouldEqual, 4)
+
+			_, message, _ = chain.DeliverGood("G6", "交付", "", simDealer)
+			So(message, ShouldEqual, "该货物未通过验货")
+
+			_, message, err = chain.InspectGood("G6", "复检合格", true, "", "", simPort)
+			So(err, ShouldBeNil)
+			So(message, ShouldEqual, "Success")
+			_, message, _ = chain.InspectGood("G6", "再次验货", true, "", "", simPort)
+			So(message, ShouldEqual, "该货物已有验货记录")
+
+			trace, _ := chain.GetRawTrace("G6")
+			So(trace.InspectPassed, ShouldBeTrue)
+			So(trace.InspectionInfo, ShouldEqual, "复检合格")
+			So(trace.GoodState, ShouldEqual, services.ChainGoodStateNormal)
+
+			_, _, err = chain.DeliverGood("G6", "交付", "", simDealer)
+			So(err, ShouldBeNil)
+		})
+
+		Convey("不合格货物可隔离后退回或销毁", func() {
+			chain.RegisterGood("G7", "龙虾", "", simProducer)
+			chain.ShipGood("G7", "波士顿", "上海港", "", "空运", "", simShipper)
+
+			_, message, _ := chain.DisposeGood("G7", services.ChainGoodStateQuarantined, "待复检", "", simPort)
+			So(message, ShouldEqual, "只有验货不合格的货物可以处置")
+
+			chain.InspectGood("G7", "检出致病菌", false, "检疫不合格", "", simPort)
+			_, message, err := chain.DisposeGood("G7", services.ChainGoodStateQuarantined, "待复检", "", simPort)
+			So(err, ShouldBeNil)
+			So(message, ShouldEqual, "Success")
+			_, message, _ = chain.DisposeGood("G7", services.ChainGoodStateQuarantined, "待复检", "", simPort)
+			So(message, ShouldEqual, "货物已在隔离中")
+			_, message, _ = chain.DisposeGood("G7", services.ChainGoodStateNormal, "放行", "", simPort)
+			So(message, ShouldEqual, "无效的处置类型")
+
+			_, _, err = chain.DisposeGood("G7", services.ChainGoodStateDestroyed, "复检仍不合格", "", simPort)
+			So(err, ShouldBeNil)
+			status, _ := chain.GetGoodStatus("G7")
+			So(status, ShouldEqual, 7)
+
+			_, message, _ = chain.InspectGood("G7", "再次验货", true, "", "", simPort)
+			So(message, ShouldEqual, "货物已退回或销毁")
+
+			trace, _ := chain.GetRawTrace("G7")
+			So(len(trace.Dispositions), ShouldEqual, 2)
+			So(trace.Dispositions[1].State, ShouldEqual, services.ChainGoodStateDestroyed)
+			So(trace.Dispositions[1].Reason, ShouldEqual, "复检仍不合格")
+		})
+
+		Convey("操作员以自己的地址代表所属公司执行环节", func() {
+			operator := "0x3000000000000000000000000000000000000001"
+			_, err := chain.RegisterOperator(operator, simShipper)
+			So(err, ShouldBeNil)
+
+			chain.RegisterGood("G9", "海参", "", simProducer)
+			_, _, err = chain.ShipGood("G9", "大连", "青岛", "SF009", "冷链运输", "", operator)
+			So(err, ShouldBeNil)
+			trace, _ := chain.GetRawTrace("G9")
+			So(trace.ShipOperatorAddr, ShouldEqual, operator)
+
+			_, err = chain.RegisterOperator(operator, simPort)
+			So(err.Error(), ShouldContainSubstring, "该地址已属于其他公司")
+			_, err = chain.RegisterOperator("0x3000000000000000000000000000000000000002", operator)
+			So(err.Error(), ShouldContainSubstring, "只有公司管理员可执行此操作")
+
+			_, err = chain.RemoveOperator(operator, simShipper)
+			So(err, ShouldBeNil)
+			_, message, _ := chain.ShipGood("G9", "青岛", "上海", "SF010", "冷链运输", "", operator)
+			So(message, ShouldEqual, "公司不存在")
+		})
+
+		Convey("查询不存在的货物状态时回滚", func() {
+			_, err := chain.GetGoodStatus("G404")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+// contractABIPath 合约ABI文件的绝对路径，测试运行时的工作目录不固定
+func contractABIPath() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "conf", "contract_abi.json")
+}
+
+// TestSimulatorEventLogs 模拟链产生的事件日志可按合约ABI解码
+func TestSimulatorEventLogs(t *testing.T) {
+	Convey("Subject: 模拟链事件日志\n", t, func() {
+		decoder, err := services.NewEventDecoderFromFile(contractABIPath())
+		So(err, ShouldBeNil)
+
+		chain := newSimulatorWithCompanies()
+		chain.Events = decoder
+		chain.RegisterGood("G1", "带鱼", "", simProducer)
+		shipHash, _, _ := chain.ShipGood("G1", "福州", "厦门", "SF001", "冷链运输", "", simShipper)
+
+		receipt, err := chain.GetTransactionReceipt(shipHash)
+		So(err, ShouldBeNil)
+		So(len(receipt.Logs), ShouldEqual, 1)
+
+		hashes, err := chain.GetBlockTransactionHashes(receipt.BlockNumber)
+		So(err, ShouldBeNil)
+		So(hashes, ShouldResemble, []string{shipHash})
+
+		log := receipt.Logs[0]
+		event, err := decoder.Decode(log.Topics, log.Data)
+		So(err, ShouldBeNil)
+		So(event.Name, ShouldEqual, "Shipped")
+		So(event.Args["legIndex"], ShouldEqual, "0")
+		So(event.Args["shipCompanyId"], ShouldEqual, "2")
+		So(event.Args["operatorAddr"], ShouldEqual, simShipper)
+		So(event.Args["fromLocation"], ShouldEqual, "福州")
+		So(event.Args["toLocation"], ShouldEqual, "厦门")
+		So(event.Args["trackingNumber"], ShouldEqual, "SF001")
+		So(event.Args["info"], ShouldEqual, "冷链运输")
+		// indexed string 只保留哈希
+		So(event.Args["goodId"], ShouldStartWith, "0x")
+		So(len(event.Args["goodId"].(string)), ShouldEqual, 66)
+
+		chain.InspectGood("G1", "温度超标", false, "冷链中断", "", simPort)
+		disposeHash, _, _ := chain.DisposeGood("G1", services.ChainGoodStateReturned, "退回生产商", "", simPort)
+		receipt, err = chain.GetTransactionReceipt(disposeHash)
+		So(err, ShouldBeNil)
+		event, err = decoder.Decode(receipt.Logs[0].Topics, receipt.Logs[0].Data)
+		So(err, ShouldBeNil)
+		So(event.Name, ShouldEqual, "Disposed")
+		So(event.Args["state"], ShouldEqual, "3")
+		So(event.Args["reason"], ShouldEqual, "退回生产商")
+	})
+}
@@ -0,0 +1,57 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/services"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestConfirmationTracker 长时间查不到回执的交易超时后不再保持待确认
+func TestConfirmationTracker(t *testing.T) {
+	Convey("Subject: 交易回执确认超时\n", t, func() {
+		now := time.Date(2025, 5, 14, 8, 0, 0, 0, time.UTC)
+		var applied []string
+		tracker := &services.ConfirmationTracker{
+			Chain:          newSimulatorWithCompanies(),
+			ReceiptTimeout: 10 * time.Minute,
+			Now:            func() time.Time { return now },
+			Apply: func(ref *models.StageConfirmation, chainStatus string, blockNumber int64, revertReason string) error {
+				applied = append(applied, chainStatus+":"+revertReason)
+				return nil
+			},
+		}
+		ref := &models.StageConfirmation{Stage: models.StageTransport, RecordId: 7, GoodId: "G1", TxHash: "0xab"}
+
+		Convey("自首次查询起超过超时时间仍没有回执时标记为上链失败", func() {
+			So(tracker.Check(ref), ShouldBeFalse)
+			now = now.Add(10 * time.Minute)
+			So(tracker.Check(ref), ShouldBeFalse)
+			So(applied, ShouldBeEmpty)
+
+			now = now.Add(time.Second)
+			So(tracker.Check(ref), ShouldBeTrue)
+			So(applied, ShouldResemble, []string{models.ChainStatusFailed + ":超时未查询到交易回执"})
+		})
+
+		Convey("重新提交后交易哈希变化，重新计时", func() {
+			So(tracker.Check(ref), ShouldBeFalse)
+			now = now.Add(11 * time.Minute)
+			resent := *ref
+			resent.TxHash = "0xcd"
+			So(tracker.Check(&resent), ShouldBeFalse)
+			So(applied, ShouldBeEmpty)
+		})
+
+		Convey("缺少交易哈希的记录同样超时失败", func() {
+			ref.TxHash = ""
+			So(tracker.Check(ref), ShouldBeFalse)
+			now = now.Add(11 * time.Minute)
+			So(tracker.Check(ref), ShouldBeTrue)
+			So(applied, ShouldResemble, []string{models.ChainStatusFailed + ":缺少交易哈希，无法查询交易回执"})
+		})
+	})
+}
@@ -0,0 +1,72 @@
+package test
+
+import (
+	"testing"
+
+	"sea_trace_server_V2.0/models"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestDataScope 租户数据访问范围
+func TestDataScope(t *testing.T) {
+	Convey("Subject: 按公司隔离数据访问\n", t, func() {
+		const producer, shipper, port, dealer, other = 1, 2, 3, 4, 9
+
+		good := &models.Goods{GoodId: "G1", OwnerCompanyId: producer, Status: models.GoodsStatusDelivered}
+		stages := &models.GoodStages{
+			TransportLegs: []*models.GoodsTransport{{GoodId: "G1", TransporterId: shipper}},
+			Inspections:   []*models.GoodsInspection{{GoodId: "G1", InspectorId: port}},
+			Delivery:      &models.GoodsDelivery{GoodId: "G1", DealerId: dealer, RecipientContact: "13800000000"},
+		}
+
+		Convey("拥有或经手过货物的公司可以访问", func() {
+			for _, companyID := range []int{producer, shipper, port, dealer} {
+				So(models.CompanyScope(companyID).CanAccessGood(good, stages), ShouldBeTrue)
+			}
+			So(models.AllScope().CanAccessGood(good, stages), ShouldBeTrue)
+		})
+
+		Convey("其他公司不能访问货物", func() {
+			So(models.CompanyScope(other).CanAccessGood(good, stages), ShouldBeFalse)
+			So(models.CompanyScope(0).CanAccessGood(&models.Goods{GoodId: "G2"}, &models.GoodStages{}), ShouldBeFalse)
+			So(models.CompanyScope(shipper).CanAccessGood(good, nil), ShouldBeFalse)
+		})
+
+		Convey("处置记录的公司视为经手", func() {
+			stages.Dispositions = []*models.GoodsDisposition{{GoodId: "G1", CompanyId: other}}
+			So(models.CompanyScope(other).CanAccessGood(good, stages), ShouldBeTrue)
+		})
+
+		Convey("收货人信息只对执行交付的经销商可见", func() {
+			So(models.CompanyScope(dealer).CanViewRecipient(stages.Delivery), ShouldBeTrue)
+			So(models.CompanyScope(producer).CanViewRecipient(stages.Delivery), ShouldBeFalse)
+			So(models.CompanyScope(other).CanViewRecipient(stages.Delivery), ShouldBeFalse)
+			So(models.AllScope().CanViewRecipient(stages.Delivery), ShouldBeTrue)
+		})
+
+		Convey("公司账户不能指定其他公司", func() {
+			companyID, err := models.CompanyScope(producer).ResolveCompany(0)
+			So(err, ShouldBeNil)
+			So(companyID, ShouldEqual, producer)
+
+			_, err = models.CompanyScope(producer).ResolveCompany(other)
+			So(err, ShouldEqual, models.ErrOutOfScope)
+
+			_, err = models.CompanyScope(0).ResolveCompany(other)
+			So(err, ShouldEqual, models.ErrOutOfScope)
+
+			companyID, err = models.AllScope().ResolveCompany(other)
+			So(err, ShouldBeNil)
+			So(companyID, ShouldEqual, other)
+		})
+
+		Convey("不合格货物的处置和复检要求已经手该货物", func() {
+			inspect := models.GetGoodsTransition(models.GoodsActionInspect)
+			So(inspect.RequiresHandler(models.GoodsStatusShipped), ShouldBeFalse)
+			So(inspect.RequiresHandler(models.GoodsStatusRejected), ShouldBeTrue)
+			So(models.GetGoodsTransition(models.GoodsActionDestroy).RequiresHandler(models.GoodsStatusQuarantined), ShouldBeTrue)
+			So(models.GetGoodsTransition(models.GoodsActionShip).RequiresHandler(models.GoodsStatusProduced), ShouldBeFalse)
+		})
+	})
+}
@@ -0,0 +1,96 @@
+package test
+
+import (
+	"testing"
+
+	"sea_trace_server_V2.0/models"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// transitionActions 提取状态转换的操作名称
+func transitionActions(transitions []*models.GoodsTransition) []string {
+	actions := make([]string, 0, len(transitions))
+	for _, t := range transitions {
+		actions = append(actions, t.Action)
+	}
+	return actions
+}
+
+// TestGoodsLifecycle 货物生命周期定义
+func TestGoodsLifecycle(t *testing.T) {
+	Convey("Subject: 货物生命周期状态转换\n", t, func() {
+		Convey("按货物状态列出可执行的操作", func() {
+			So(transitionActions(models.AvailableGoodsTransitions(0)), ShouldResemble,
+				[]string{models.GoodsActionRegister})
+			So(transitionActions(models.AvailableGoodsTransitions(models.GoodsStatusShipped)), ShouldResemble,
+				[]string{models.GoodsActionShip, models.GoodsActionInspect, models.GoodsActionReject})
+			So(transitionActions(models.AvailableGoodsTransitions(models.GoodsStatusQuarantined)), ShouldResemble,
+				[]string{models.GoodsActionInspect, models.GoodsActionReject, models.GoodsActionReturn, models.GoodsActionDestroy})
+			So(models.AvailableGoodsTransitions(models.GoodsStatusDestroyed), ShouldBeEmpty)
+		})
+
+		Convey("校验货物状态、公司类型和必填字段", func() {
+			req := &models.GoodsDeliverRequest{
+				GoodID:           "G1",
+				DeliveryInfo:     "厦门海鲜市场",
+				RecipientName:    "张三",
+				RecipientContact: "13800000000",
+				Location:         "厦门",
+			}
+			transition, err := models.CheckGoodsTransition(models.GoodsActionDeliver, models.GoodsStatusInspected, models.Dealer, req)
+			So(err, ShouldBeNil)
+			So(transition.To, ShouldEqual, models.GoodsStatusDelivered)
+			So(transition.FuncName, ShouldEqual, "deliverGood")
+
+			_, err = models.CheckGoodsTransition(models.GoodsActionDeliver, models.GoodsStatusRejected, models.Dealer, req)
+			So(err.Error(), ShouldEqual, "当前货物状态（验货不合格）不允许执行交付操作")
+
+			_, err = models.CheckGoodsTransition(models.GoodsActionDeliver, models.GoodsStatusInspected, models.Port, req)
+			So(err.Error(), ShouldEqual, "只有经销商才能执行交付操作")
+
+			req.RecipientContact = ""
+			_, err = models.CheckGoodsTransition(models.GoodsActionDeliver, models.GoodsStatusInspected, models.Dealer, req)
+			So(err.Error(), ShouldEqual, "缺少必填字段: recipient_contact")
+
+			_, err = models.CheckGoodsTransition("repair", models.GoodsStatusInspected, models.Dealer, nil)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("验货不合格必须填写原因", func() {
+			req := &models.GoodsInspectRequest{GoodID: "G1", InspectionInfo: "温度超标", Location: "青岛港"}
+			_, err := models.CheckGoodsTransition(models.GoodsActionReject, models.GoodsStatusShipped, models.Port, req)
+			So(err.Error(), ShouldEqual, "缺少必填字段: reject_reason")
+
+			req.RejectReason = "冷链中断"
+			transition, err := models.CheckGoodsTransition(models.GoodsActionReject, models.GoodsStatusShipped, models.Port, req)
+			So(err, ShouldBeNil)
+			So(transition.To, ShouldEqual, models.GoodsStatusRejected)
+		})
+
+		Convey("已运输的货物只能由最后一段的承运方或其指定的接续承运方追加运输段", func() {
+			ship := models.GetGoodsTransition(models.GoodsActionShip)
+			So(ship.RequiresCarrier(models.GoodsStatusProduced), ShouldBeFalse)
+			So(ship.RequiresCarrier(models.GoodsStatusShipped), ShouldBeTrue)
+			So(models.GetGoodsTransition(models.GoodsActionInspect).RequiresCarrier(models.GoodsStatusShipped), ShouldBeFalse)
+
+			const trucking, ocean, other = 2, 5, 6
+			stages := &models.GoodStages{TransportLegs: []*models.GoodsTransport{{GoodId: "G1", TransporterId: trucking}}}
+			So(stages.CanAppendLeg(trucking), ShouldBeTrue)
+			So(stages.CanAppendLeg(ocean), ShouldBeFalse)
+
+			stages.TransportLegs[0].NextTransporterId = ocean
+			So(stages.CanAppendLeg(ocean), ShouldBeTrue)
+			So(stages.CanAppendLeg(other), ShouldBeFalse)
+
+			stages.TransportLegs = append(stages.TransportLegs, &models.GoodsTransport{GoodId: "G1", LegIndex: 1, TransporterId: ocean})
+			So(stages.CanAppendLeg(trucking), ShouldBeFalse)
+			So((&models.GoodStages{}).CanAppendLeg(trucking), ShouldBeFalse)
+		})
+
+		Convey("环节对应的合约方法", func() {
+			So(models.StageFuncName(models.StageDisposition), ShouldEqual, "disposeGood")
+			So(models.StageFuncName("unknown"), ShouldEqual, "")
+		})
+	})
+}
@@ -0,0 +1,125 @@
+package test
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sea_trace_server_V2.0/routers"
+	"sea_trace_server_V2.0/services"
+
+	"github.com/beego/beego/v2/server/web"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// 以太坊 keystore v3 规范中的 pbkdf2 测试向量，密码为 testpassword
+const keystoreV3Vector = `{
+	"crypto": {
+		"cipher": "aes-128-ctr",
+		"cipherparams": {"iv": "6087dab2f9fdbbfaddc31a909735c1e6"},
+		"ciphertext": "5318b4d5bcd28de64ee5559e671353e16f075ecae9f99c7a79a38af5f869aa46",
+		"kdf": "pbkdf2",
+		"kdfparams": {"c": 262144, "dklen": 32, "prf": "hmac-sha256", "salt": "ae3cd4e7013836a3df6bd7241b12db061dbe2c6785853cce422d148a624ce0bd"},
+		"mac": "517ead924a9d0dc3124507e3393d175ce3ff7c1e96529c6c555ce9e51205e9b2"
+	},
+	"id": "3198bc9c-6672-5ab3-d995-4942343ae5b6",
+	"version": 3
+}`
+
+// TestKeystore 本地密钥库加解密
+func TestKeystore(t *testing.T) {
+	Convey("Subject: 本地密钥库\n", t, func() {
+		key, _ := hex.DecodeString(strings.TrimPrefix(testPrivateKey, "0x"))
+
+		Convey("由私钥计算地址", func() {
+			address, publicKey, err := services.ChainKeyAddress(key)
+			So(err, ShouldBeNil)
+			So(address, ShouldEqual, "0x2c7536e3605d9c16a7a3d7b1898e529396a65c23")
+			So(len(publicKey), ShouldEqual, 130)
+		})
+
+		Convey("主密钥AES-GCM加密绑定地址", func() {
+			master, err := services.ParseMasterKey(strings.Repeat("ab", 32))
+			So(err, ShouldBeNil)
+			address := "0x2c7536e3605d9c16a7a3d7b1898e529396a65c23"
+
+			sealed, err := services.SealChainKey(master, address, key)
+			So(err, ShouldBeNil)
+			opened, err := services.OpenChainKey(master, address, sealed)
+			So(err, ShouldBeNil)
+			So(opened, ShouldResemble, key)
+
+			_, err = services.OpenChainKey(master, "0x1000000000000000000000000000000000000001", sealed)
+			So(err, ShouldNotBeNil)
+
+			other, _ := services.ParseMasterKey(strings.Repeat("cd", 32))
+			_, err = services.OpenChainKey(other, address, sealed)
+			So(err, ShouldNotBeNil)
+			So(services.MasterKeyID(master), ShouldNotEqual, services.MasterKeyID(other))
+
+			_, err = services.ParseMasterKey("short")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("keystore v3 导出后可导入", func() {
+			data, err := services.EncryptKeystoreV3(key, "p@ss", services.KeystoreLightScryptN, services.KeystoreLightScryptP)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldContainSubstring, `"address": "2c7536e3605d9c16a7a3d7b1898e529396a65c23"`)
+
+			imported, err := services.DecryptKeystoreV3(data, "p@ss")
+			So(err, ShouldBeNil)
+			So(imported, ShouldResemble, key)
+
+			_, err = services.DecryptKeystoreV3(data, "wrong")
+			So(err.Error(), ShouldEqual, "keystore密码错误")
+		})
+
+		Convey("解密规范测试向量", func() {
+			imported, err := services.DecryptKeystoreV3([]byte(keystoreV3Vector), "testpassword")
+			So(err, ShouldBeNil)
+			So(hex.EncodeToString(imported), ShouldEqual, "7a28b5ba57c53603b0b07b56bba752f7784bf506fa95edc395f5cf6c7514fe9d")
+		})
+
+		Convey("签名为 r||s||v 格式", func() {
+			hash := make([]byte, 32)
+			hash[0] = 1
+			sig, err := services.SignChainHash(key, hash)
+			So(err, ShouldBeNil)
+			So(len(sig), ShouldEqual, 65)
+			So(sig[64] == 27 || sig[64] == 28, ShouldBeTrue)
+
+			_, err = services.SignChainHash(key, []byte("short"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+// TestKeystoreSignAccess 签名接口只按连接对端地址放行，伪造 X-Forwarded-For 无效
+func TestKeystoreSignAccess(t *testing.T) {
+	Convey("Subject: 本地密钥库签名接口访问控制\n", t, func() {
+		custody, _ := web.AppConfig.String("key_custody")
+		web.AppConfig.Set("key_custody", services.KeyCustodyKeystore)
+		defer web.AppConfig.Set("key_custody", custody)
+
+		So(services.KeystoreSignAllowed("127.0.0.1"), ShouldBeTrue)
+		So(services.KeystoreSignAllowed("203.0.113.5"), ShouldBeFalse)
+
+		handler := routers.KeystoreSignHandler()
+		for _, r := range []*http.Request{
+			httptest.NewRequest(http.MethodPost, "/WeBASE-Sign/sign",
+				strings.NewReader(`{"signUserId":"u1","encodedDataStr":"`+strings.Repeat("00", 32)+`"}`)),
+			httptest.NewRequest(http.MethodGet, "/WeBASE-Sign/user/u1/userInfo", nil),
+		} {
+			r.RemoteAddr = "203.0.113.5:40000"
+			r.Header.Set("X-Forwarded-For", "127.0.0.1")
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			So(w.Code, ShouldEqual, http.StatusForbidden)
+			So(w.Body.String(), ShouldContainSubstring, `"forbidden"`)
+		}
+	})
+}
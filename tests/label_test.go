@@ -0,0 +1,111 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"sea_trace_server_V2.0/services"
+	"sea_trace_server_V2.0/utils"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestLabel 溯源二维码与货物标签
+func TestLabel(t *testing.T) {
+	Convey("Subject: 生成二维码和标签\n", t, func() {
+		labels := &services.LabelService{PublicTraceURL: "https://trace.example.com/t", ZPLFont: "0", MaxItems: 100}
+
+		Convey("按内容长度选择最小版本", func() {
+			qr, err := utils.EncodeQR(strings.Repeat("a", 14), utils.QRLevelM)
+			So(err, ShouldBeNil)
+			So(qr.Version, ShouldEqual, 1)
+			So(qr.Size, ShouldEqual, 21)
+
+			qr, _ = utils.EncodeQR(strings.Repeat("a", 15), utils.QRLevelM)
+			So(qr.Version, ShouldEqual, 2)
+
+			qr, _ = utils.EncodeQR(strings.Repeat("a", 2331), utils.QRLevelM)
+			So(qr.Version, ShouldEqual, 40)
+
+			_, err = utils.EncodeQR(strings.Repeat("a", 2332), utils.QRLevelM)
+			So(err, ShouldEqual, utils.ErrQRDataTooLong)
+		})
+
+		Convey("定位图形和定时图形", func() {
+			qr, _ := utils.EncodeQR(labels.TraceURL("G1"), utils.QRLevelM)
+			for _, corner := range [][2]int{{0, 0}, {qr.Size - 7, 0}, {0, qr.Size - 7}} {
+				So(qr.Dark(corner[0], corner[1]), ShouldBeTrue)
+				So(qr.Dark(corner[0]+1, corner[1]+1), ShouldBeFalse)
+				So(qr.Dark(corner[0]+3, corner[1]+3), ShouldBeTrue)
+			}
+			So(qr.Dark(7, 7), ShouldBeFalse)
+			for i := 8; i < qr.Size-8; i++ {
+				So(qr.Dark(i, 6), ShouldEqual, i%2 == 0)
+				So(qr.Dark(6, i), ShouldEqual, i%2 == 0)
+			}
+			So(qr.Dark(8, qr.Size-8), ShouldBeTrue)
+		})
+
+		Convey("二维码指向公开溯源地址", func() {
+			So(labels.TraceURL("G 1&2"), ShouldEqual, "https://trace.example.com/t?good_id=G+1%262")
+			withQuery := &services.LabelService{PublicTraceURL: "https://trace.example.com/t?lang=zh"}
+			So(withQuery.TraceURL("G1"), ShouldEqual, "https://trace.example.com/t?lang=zh&good_id=G1")
+		})
+
+		Convey("PNG和SVG图片", func() {
+			qr, _ := labels.QRCode("G1")
+			data, err := qr.PNG(4)
+			So(err, ShouldBeNil)
+			img, err := png.Decode(bytes.NewReader(data))
+			So(err, ShouldBeNil)
+			So(img.Bounds().Dx(), ShouldEqual, (qr.Size+2*utils.QRQuietZone)*4)
+
+			svg := qr.SVG(4)
+			So(svg, ShouldStartWith, "<?xml")
+			So(svg, ShouldContainSubstring, fmt.Sprintf(`viewBox="0 0 %d %d"`, qr.Size+8, qr.Size+8))
+		})
+
+		items := make([]services.GoodsLabel, 25)
+		for i := range items {
+			goodID := fmt.Sprintf("G2025%04d", i)
+			items[i] = services.GoodsLabel{GoodID: goodID, GoodName: "大黄鱼^特级", BatchNumber: "B001",
+				Producer: "福建渔业", TraceURL: labels.TraceURL(goodID)}
+		}
+
+		Convey("ZPL每个标签一段，控制字符转义", func() {
+			data, err := labels.RenderZPL(items)
+			So(err, ShouldBeNil)
+			zpl := string(data)
+			So(strings.Count(zpl, "^XA"), ShouldEqual, 25)
+			So(strings.Count(zpl, "^XZ"), ShouldEqual, 25)
+			So(zpl, ShouldContainSubstring, "^FH_^FD大黄鱼_5E特级")
+			So(zpl, ShouldContainSubstring, "^FD生产商: 福建渔业")
+			So(zpl, ShouldContainSubstring, "^GFA,")
+		})
+
+		Convey("PDF每页24个标签，交叉引用表指向各对象", func() {
+			data, err := labels.RenderPDF(items)
+			So(err, ShouldBeNil)
+			So(string(data), ShouldStartWith, "%PDF-1.4")
+			So(string(data), ShouldContainSubstring, "/Count 2")
+			So(string(data), ShouldEndWith, "%%EOF\n")
+
+			startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(data)
+			So(startxref, ShouldNotBeNil)
+			xref, _ := strconv.Atoi(string(startxref[1]))
+			So(string(data[xref:]), ShouldStartWith, "xref\n")
+
+			entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data[xref:], -1)
+			So(entries, ShouldHaveLength, 9)
+			for i, entry := range entries {
+				offset, _ := strconv.Atoi(string(entry[1]))
+				So(string(data[offset:]), ShouldStartWith, fmt.Sprintf("%d 0 obj", i+1))
+			}
+		})
+	})
+}
@@ -0,0 +1,173 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/services"
+	"sea_trace_server_V2.0/utils"
+
+	"github.com/beego/beego/v2/server/web"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newTestLoginGuard 创建使用模拟时钟的登录防护实例，锁定事件记录到 events
+func newTestLoginGuard(now *time.Time, events *[]*models.UserSecurityEvent) *services.LoginGuard {
+	guard := services.NewLoginGuard()
+	guard.User = services.LoginPolicy{DelayAfter: 2, MaxFailures: 4, DelayBase: time.Second, DelayMax: 4 * time.Second, Lockout: 10 * time.Minute}
+	guard.IP = services.LoginPolicy{DelayAfter: 5, MaxFailures: 6, DelayBase: time.Second, DelayMax: 4 * time.Second, Lockout: 10 * time.Minute}
+	guard.Now = func() time.Time { return *now }
+	guard.OnEvent = func(event *models.UserSecurityEvent) { *events = append(*events, event) }
+	return guard
+}
+
+// TestLoginGuard 登录失败计数、递增等待与临时锁定
+func TestLoginGuard(t *testing.T) {
+	Convey("Subject: 登录防暴力破解\n", t, func() {
+		now := time.Date(2025, 5, 14, 8, 0, 0, 0, time.UTC)
+		var events []*models.UserSecurityEvent
+		guard := newTestLoginGuard(&now, &events)
+		fail := func(username, ip string) {
+			attempt, err := guard.Begin(nil, username, ip)
+			So(err, ShouldBeNil)
+			guard.Failure(attempt, nil)
+		}
+
+		Convey("失败次数达到阈值后等待时间逐次翻倍，最终锁定账户", func() {
+			fail("alice", "10.0.0.1")
+			So(guard.Check(nil, "alice", "10.0.0.1"), ShouldBeNil)
+
+			fail("alice", "10.0.0.1")
+			err := guard.Check(nil, "alice", "10.0.0.1")
+			So(err, ShouldHaveSameTypeAs, &services.LoginThrottledError{})
+			So(err.(*services.LoginThrottledError).Wait, ShouldEqual, time.Second)
+
+			now = now.Add(time.Second)
+			fail("alice", "10.0.0.1")
+			So(guard.Check(nil, "alice", "10.0.0.1").(*services.LoginThrottledError).Wait, ShouldEqual, 2*time.Second)
+
+			now = now.Add(2 * time.Second)
+			fail("alice", "10.0.0.1")
+			throttled := guard.Check(nil, "alice", "10.0.0.1").(*services.LoginThrottledError)
+			So(throttled.Locked, ShouldBeTrue)
+			So(throttled.Wait, ShouldEqual, 10*time.Minute)
+			So(events, ShouldHaveLength, 1)
+			So(events[0].Event, ShouldEqual, models.SecurityEventAccountLocked)
+			So(events[0].Username, ShouldEqual, "alice")
+
+			// 其他用户名不受影响
+			So(guard.Check(nil, "bob", "10.0.0.2"), ShouldBeNil)
+
+			// 锁定到期后计数重新开始
+			now = now.Add(10*time.Minute + time.Second)
+			fail("alice", "10.0.0.1")
+			So(guard.Check(nil, "alice", "10.0.0.1"), ShouldBeNil)
+		})
+
+		Convey("同一来源地址尝试多个用户名时按地址锁定", func() {
+			for _, name := range []string{"u1", "u2", "u3", "u4", "u5", "u6"} {
+				now = now.Add(5 * time.Second)
+				fail(name, "10.0.0.9")
+			}
+			err := guard.Check(nil, "u7", "10.0.0.9")
+			So(err, ShouldNotBeNil)
+			So(err.(*services.LoginThrottledError).Locked, ShouldBeTrue)
+			So(guard.Check(nil, "u7", "10.0.0.10"), ShouldBeNil)
+			So(events[len(events)-1].Event, ShouldEqual, models.SecurityEventIPBlocked)
+		})
+
+		Convey("用户记录中的锁定在服务重启后仍然有效", func() {
+			user := &models.User{Id: 1, Username: "carol", LockedUntil: now.Add(3 * time.Minute)}
+			err := guard.Check(user, "carol", "10.0.0.3")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "登录失败次数过多，账户已被临时锁定，请3分钟后重试或联系管理员")
+
+			_, err = guard.Begin(user, "carol", "10.0.0.3")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("并发的失败登录依次预占计数，超出阈值的请求在校验密码前即被限制", func() {
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			var attempts []*services.LoginAttempt
+			throttled := 0
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					attempt, err := guard.Begin(nil, "dave", "10.0.0.4")
+					mu.Lock()
+					defer mu.Unlock()
+					if err != nil {
+						throttled++
+						return
+					}
+					attempts = append(attempts, attempt)
+				}()
+			}
+			wg.Wait()
+			So(attempts, ShouldHaveLength, guard.User.DelayAfter)
+			So(throttled, ShouldEqual, 20-guard.User.DelayAfter)
+
+			for _, attempt := range attempts {
+				guard.Failure(attempt, nil)
+			}
+			So(guard.Check(nil, "dave", "10.0.0.4").(*services.LoginThrottledError).Wait, ShouldEqual, time.Second)
+		})
+
+		Convey("登录成功清零用户名计数并退还本次预占的来源地址计数", func() {
+			for _, name := range []string{"u1", "u2", "u3", "u4"} {
+				now = now.Add(5 * time.Second)
+				fail(name, "10.0.0.5")
+			}
+			now = now.Add(5 * time.Second)
+			fail("erin", "10.0.0.5")
+			now = now.Add(5 * time.Second)
+			attempt, err := guard.Begin(nil, "erin", "10.0.0.5")
+			So(err, ShouldBeNil)
+			guard.Success(attempt, &models.User{Id: 5, Username: "erin"})
+
+			// 预占的第6次计数已退还，来源地址未被锁定；此前对其他账户的失败不被抵消
+			now = now.Add(5 * time.Second)
+			So(guard.Check(nil, "erin", "10.0.0.5"), ShouldBeNil)
+			fail("u5", "10.0.0.5")
+			err = guard.Check(nil, "u6", "10.0.0.5")
+			So(err, ShouldNotBeNil)
+			So(err.(*services.LoginThrottledError).Locked, ShouldBeTrue)
+		})
+	})
+}
+
+// TestLoginGuardClientIP 登录防护按来源地址计数时，只有可信代理转发的 X-Forwarded-For 才被采信
+func TestLoginGuardClientIP(t *testing.T) {
+	Convey("Subject: 客户端地址识别\n", t, func() {
+		proxies, _ := web.AppConfig.String("trusted_proxies")
+		defer web.AppConfig.Set("trusted_proxies", proxies)
+		r := httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+		r.RemoteAddr = "203.0.113.5:40000"
+		r.Header.Set("X-Forwarded-For", "198.51.100.1, 127.0.0.1")
+
+		Convey("未配置可信代理时忽略 X-Forwarded-For", func() {
+			web.AppConfig.Set("trusted_proxies", "")
+			So(utils.ClientIP(r), ShouldEqual, "203.0.113.5")
+		})
+
+		Convey("非可信代理发来的请求不采信 X-Forwarded-For", func() {
+			web.AppConfig.Set("trusted_proxies", "10.0.0.0/8")
+			So(utils.ClientIP(r), ShouldEqual, "203.0.113.5")
+		})
+
+		Convey("可信代理转发时取最右侧的非代理地址", func() {
+			web.AppConfig.Set("trusted_proxies", "203.0.113.5, 127.0.0.1")
+			So(utils.ClientIP(r), ShouldEqual, "198.51.100.1")
+
+			r.Header.Set("X-Forwarded-For", "garbage")
+			So(utils.ClientIP(r), ShouldEqual, "203.0.113.5")
+		})
+	})
+}
@@ -0,0 +1,272 @@
+package test
+
+import (
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/services"
+
+	"github.com/beego/beego/v2/client/orm"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// memOutboxStore 内存中的发件箱存储，按数据库实现的条件更新记录
+type memOutboxStore struct {
+	mu          sync.Mutex
+	nextID      int
+	entries     map[int]*models.ChainOutbox
+	stageStatus map[string]string
+}
+
+func newMemOutboxStore() *memOutboxStore {
+	return &memOutboxStore{entries: map[int]*models.ChainOutbox{}, stageStatus: map[string]string{}}
+}
+
+// add 写入一条待发送记录
+func (s *memOutboxStore) add(entry *models.ChainOutbox) *models.ChainOutbox {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	entry.Id = s.nextID
+	if entry.Status == "" {
+		entry.Status = models.OutboxStatusPending
+	}
+	if entry.UpdatedAt.IsZero() {
+		entry.UpdatedAt = time.Now()
+	}
+	stored := *entry
+	s.entries[entry.Id] = &stored
+	return entry
+}
+
+// get 读取记录当前保存的状态
+func (s *memOutboxStore) get(id int) models.ChainOutbox {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return *s.entries[id]
+}
+
+// sorted 按ID顺序返回全部记录
+func (s *memOutboxStore) sorted() []*models.ChainOutbox {
+	var list []*models.ChainOutbox
+	for _, entry := range s.entries {
+		list = append(list, entry)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Id < list[j].Id })
+	return list
+}
+
+func (s *memOutboxStore) GetDueChainOutbox(limit int) ([]*models.ChainOutbox, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []*models.ChainOutbox
+	for _, entry := range s.sorted() {
+		if entry.Status == models.OutboxStatusPending && !entry.NextRetryAt.After(time.Now()) && len(due) < limit {
+			copied := *entry
+			due = append(due, &copied)
+		}
+	}
+	return due, nil
+}
+
+func (s *memOutboxStore) ClaimChainOutbox(id int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry := s.entries[id]
+	if entry == nil || entry.Status != models.OutboxStatusPending {
+		return false, nil
+	}
+	entry.Status = models.OutboxStatusSending
+	entry.UpdatedAt = time.Now()
+	return true, nil
+}
+
+func (s *memOutboxStore) ReleaseStaleChainOutbox(staleBefore time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var num int64
+	for _, entry := range s.entries {
+		if entry.Status == models.OutboxStatusSending && entry.UpdatedAt.Before(staleBefore) {
+			entry.Status = models.OutboxStatusPending
+			entry.UpdatedAt = time.Now()
+			num++
+		}
+	}
+	return num, nil
+}
+
+func (s *memOutboxStore) GetUnsentChainOutboxBefore(goodID string, id int) (*models.ChainOutbox, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.sorted() {
+		if entry.GoodId == goodID && entry.Id < id &&
+			entry.Status != models.OutboxStatusSent && entry.Status != models.OutboxStatusReplaced {
+			copied := *entry
+			return &copied, nil
+		}
+	}
+	return nil, orm.ErrNoRows
+}
+
+func (s *memOutboxStore) DeferChainOutbox(id int, next time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if entry := s.entries[id]; entry != nil && entry.Status == models.OutboxStatusPending {
+		entry.NextRetryAt = next
+		entry.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+func (s *memOutboxStore) BlockChainOutboxAfter(goodID string, id int, reason string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var num int64
+	for _, entry := range s.entries {
+		if entry.GoodId == goodID && entry.Id > id && entry.Status == models.OutboxStatusPending {
+			entry.Status = models.OutboxStatusBlocked
+			entry.LastError = reason
+			num++
+		}
+	}
+	return num, nil
+}
+
+func (s *memOutboxStore) UpdateChainOutbox(entry *models.ChainOutbox, cols ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *entry
+	stored.UpdatedAt = time.Now()
+	s.entries[entry.Id] = &stored
+	return nil
+}
+
+func (s *memOutboxStore) UpdateStageChainStatus(stage string, recordID int, txHash string, chainStatus string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stageStatus[stage] = chainStatus
+	return nil
+}
+
+func (s *memOutboxStore) UpdateGoodChainStatus(goodID string, txHash string, chainStatus string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stageStatus["good:"+goodID] = chainStatus
+	return nil
+}
+
+// TestOutboxDispatcher 发件箱按货物顺序发送、失败退避、阻塞后续记录与重置遗留记录
+func TestOutboxDispatcher(t *testing.T) {
+	Convey("Subject: 上链发件箱调度\n", t, func() {
+		store := newMemOutboxStore()
+		dispatcher := &services.OutboxDispatcher{
+			Chain:          newSimulatorWithCompanies(),
+			Store:          store,
+			BatchSize:      10,
+			MaxAttempts:    3,
+			BaseBackoff:    2 * time.Second,
+			MaxBackoff:     5 * time.Second,
+			PollInterval:   5 * time.Second,
+			SendingTimeout: 2 * time.Minute,
+		}
+		register := func(sender string) *models.ChainOutbox {
+			return store.add(models.NewChainOutbox("G1", models.StageProduction, "registerGood", []string{"G1", "带鱼", ""}, sender))
+		}
+		ship := func() *models.ChainOutbox {
+			return store.add(models.NewChainOutbox("G1", models.StageTransport, "shipGood", []string{"G1", "福州", "厦门", "SF001", "冷链运输", ""}, simShipper))
+		}
+
+		Convey("前序记录尚未上链时推迟后续记录，不计入重试次数", func() {
+			first := register(simProducer)
+			store.entries[first.Id].NextRetryAt = time.Now().Add(time.Minute)
+			second := ship()
+
+			So(dispatcher.DispatchPending(), ShouldEqual, 0)
+			deferred := store.get(second.Id)
+			So(deferred.Status, ShouldEqual, models.OutboxStatusPending)
+			So(deferred.Attempts, ShouldEqual, 0)
+			So(deferred.NextRetryAt, ShouldHappenOnOrAfter, store.get(first.Id).NextRetryAt)
+
+			store.entries[first.Id].NextRetryAt = time.Now()
+			store.entries[second.Id].NextRetryAt = time.Now()
+			So(dispatcher.DispatchPending(), ShouldEqual, 2)
+			So(store.get(first.Id).Status, ShouldEqual, models.OutboxStatusSent)
+			So(store.get(second.Id).Status, ShouldEqual, models.OutboxStatusSent)
+			So(store.get(second.Id).TxHash, ShouldStartWith, "0x")
+			So(store.stageStatus[models.StageTransport], ShouldEqual, models.ChainStatusPendingConfirmation)
+		})
+
+		Convey("失败后按指数退避重试，达到最大次数后标记失败并阻塞后续记录", func() {
+			// 未登记的地址无法注册货物
+			first := register("0x1000000000000000000000000000000000000009")
+			second := ship()
+
+			var waits []time.Duration
+			for i := 0; i < dispatcher.MaxAttempts; i++ {
+				entry := store.get(first.Id)
+				started := time.Now()
+				So(dispatcher.Dispatch(&entry), ShouldNotBeNil)
+				if retried := store.get(first.Id); retried.Status == models.OutboxStatusPending {
+					waits = append(waits, retried.NextRetryAt.Sub(started).Round(time.Second))
+				}
+			}
+			So(waits, ShouldResemble, []time.Duration{2 * time.Second, 4 * time.Second})
+
+			failed := store.get(first.Id)
+			So(failed.Status, ShouldEqual, models.OutboxStatusFailed)
+			So(failed.Attempts, ShouldEqual, 3)
+			So(failed.LastError, ShouldNotBeEmpty)
+			So(store.stageStatus[models.StageProduction], ShouldEqual, models.ChainStatusFailed)
+			So(store.get(second.Id).Status, ShouldEqual, models.OutboxStatusBlocked)
+
+			// 前序记录失败后写入的记录在发送前同样被阻塞
+			third := store.add(models.NewChainOutbox("G1", models.StageInspection, "inspectGood", []string{"G1", "合格", "true", "", ""}, simPort))
+			entry := store.get(third.Id)
+			So(dispatcher.Dispatch(&entry), ShouldNotBeNil)
+			So(store.get(third.Id).Status, ShouldEqual, models.OutboxStatusBlocked)
+		})
+
+		Convey("退避时间不超过最大退避时间", func() {
+			dispatcher.MaxAttempts = 5
+			first := register("0x1000000000000000000000000000000000000009")
+			var last time.Duration
+			for i := 0; i < 4; i++ {
+				entry := store.get(first.Id)
+				started := time.Now()
+				dispatcher.Dispatch(&entry)
+				last = store.get(first.Id).NextRetryAt.Sub(started).Round(time.Second)
+			}
+			So(last, ShouldEqual, 5*time.Second)
+		})
+
+		Convey("已被其他调度器领取的记录不再发送", func() {
+			first := register(simProducer)
+			entry := store.get(first.Id)
+			claimed, _ := store.ClaimChainOutbox(first.Id)
+			So(claimed, ShouldBeTrue)
+
+			So(dispatcher.Dispatch(&entry), ShouldNotBeNil)
+			So(store.get(first.Id).Status, ShouldEqual, models.OutboxStatusSending)
+			So(store.get(first.Id).Attempts, ShouldEqual, 0)
+		})
+
+		Convey("发送中超时的记录重新放回队列，未超时的不受影响", func() {
+			stale := register(simProducer)
+			store.ClaimChainOutbox(stale.Id)
+			store.entries[stale.Id].UpdatedAt = time.Now().Add(-3 * time.Minute)
+			recent := store.add(models.NewChainOutbox("G2", models.StageProduction, "registerGood", []string{"G2", "黄鱼", ""}, simProducer))
+			store.ClaimChainOutbox(recent.Id)
+
+			So(dispatcher.ReleaseStale(), ShouldEqual, 1)
+			So(store.get(stale.Id).Status, ShouldEqual, models.OutboxStatusPending)
+			So(store.get(recent.Id).Status, ShouldEqual, models.OutboxStatusSending)
+
+			So(dispatcher.DispatchPending(), ShouldEqual, 1)
+			So(store.get(stale.Id).Status, ShouldEqual, models.OutboxStatusSent)
+		})
+	})
+}
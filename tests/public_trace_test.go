@@ -0,0 +1,78 @@
+package test
+
+import (
+	"testing"
+
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/utils"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestPublicTrace 公开溯源字段可见性与脱敏
+func TestPublicTrace(t *testing.T) {
+	Convey("Subject: 公开溯源视图\n", t, func() {
+		const producer, shipper, port, dealer = 1, 2, 3, 4
+
+		good := &models.Goods{GoodId: "G1", GoodName: "大黄鱼", BatchNumber: "B001", OwnerCompanyId: producer,
+			Description: "冰鲜", Status: models.GoodsStatusDelivered}
+		stages := &models.GoodStages{
+			Production: &models.GoodsProduction{GoodId: "G1", Location: "宁德", OperatorName: "张三"},
+			TransportLegs: []*models.GoodsTransport{{GoodId: "G1", TransporterId: shipper, TransporterName: "海运公司",
+				StartLocation: "宁德", EndLocation: "厦门", TrackingNumber: "SF123", OperatorName: "李四"}},
+			Inspections: []*models.GoodsInspection{{GoodId: "G1", InspectorId: port, InspectorName: "厦门港",
+				PassStatus: true, Notes: "内部备注", OperatorName: "王五"}},
+			Delivery: &models.GoodsDelivery{GoodId: "G1", DealerId: dealer, DealerName: "海鲜超市",
+				RecipientName: "欧阳娜娜", RecipientContact: "13800001234", Notes: "内部备注", BlockchainTxHash: "0xabc"},
+		}
+
+		Convey("人名和电话默认脱敏", func() {
+			So(utils.MaskName("张三"), ShouldEqual, "张*")
+			So(utils.MaskName("欧阳娜娜"), ShouldEqual, "欧***")
+			So(utils.MaskName("王"), ShouldEqual, "*")
+			So(utils.MaskPhone("13800001234"), ShouldEqual, "138****1234")
+			So(utils.MaskPhone("0591-8765 4321"), ShouldEqual, "059*-**** 4321")
+			So(utils.MaskPhone("12345"), ShouldEqual, "*****")
+			So(utils.MaskPhone("5551234"), ShouldEqual, "*******")
+			So(utils.MaskPhone("87654321"), ShouldEqual, "****4321")
+			So(utils.MaskPhone("0591-87654321"), ShouldEqual, "059*-****4321")
+		})
+
+		Convey("默认设置：备注、运单号等内部字段不公开", func() {
+			trace := models.NewPublicTrace(good, "福建渔业", stages, nil)
+			So(trace.Producer, ShouldEqual, "福建渔业")
+			So(trace.Production["location"], ShouldEqual, "宁德")
+			So(trace.Production["description"], ShouldEqual, "冰鲜")
+			So(trace.Production["operator_name"], ShouldEqual, "张*")
+			So(trace.TransportLegs[0], ShouldNotContainKey, "tracking_number")
+			So(trace.TransportLegs[0]["leg_index"], ShouldEqual, 0)
+			So(trace.Inspections[0], ShouldNotContainKey, "notes")
+			So(trace.Delivery["recipient_name"], ShouldEqual, "欧***")
+			So(trace.Delivery["recipient_contact"], ShouldEqual, "138****1234")
+			So(trace.Delivery["blockchain_hash"], ShouldEqual, "0xabc")
+			So(trace.Delivery, ShouldNotContainKey, "notes")
+			So(trace.Delivery, ShouldNotContainKey, "dealer_id")
+		})
+
+		Convey("各公司的设置只作用于其经手的环节", func() {
+			visibility := map[int]models.TraceVisibility{
+				dealer:  {"delivery.recipient_contact": models.VisibilityHidden, "delivery.operator_name": models.VisibilityPublic},
+				shipper: {"transport.tracking_number": models.VisibilityPublic},
+				port:    {"delivery.recipient_name": models.VisibilityPublic},
+			}
+			trace := models.NewPublicTrace(good, "福建渔业", stages, visibility)
+			So(trace.Delivery, ShouldNotContainKey, "recipient_contact")
+			So(trace.Delivery["recipient_name"], ShouldEqual, "欧***")
+			So(trace.TransportLegs[0]["tracking_number"], ShouldEqual, "SF123")
+			So(trace.TransportLegs[0]["operator_name"], ShouldEqual, "李*")
+		})
+
+		Convey("设置校验", func() {
+			So(models.ValidateTraceVisibility(models.TraceVisibility{"delivery.notes": models.VisibilityPublic}), ShouldBeNil)
+			So(models.ValidateTraceVisibility(models.TraceVisibility{"delivery.notes": models.VisibilityMasked}), ShouldNotBeNil)
+			So(models.ValidateTraceVisibility(models.TraceVisibility{"delivery.dealer_id": models.VisibilityPublic}), ShouldNotBeNil)
+			So(models.ValidateTraceVisibility(models.TraceVisibility{"delivery.recipient_name": "visible"}), ShouldNotBeNil)
+			So(models.TraceCompanyIDs(good, stages), ShouldResemble, []int{producer, shipper, port, dealer})
+		})
+	})
+}
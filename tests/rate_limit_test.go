@@ -0,0 +1,144 @@
+package test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"sea_trace_server_V2.0/middleware"
+	"sea_trace_server_V2.0/services"
+
+	"github.com/beego/beego/v2/server/web/context"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestRateLimiter 公开接口按来源地址限流
+func TestRateLimiter(t *testing.T) {
+	Convey("Subject: 令牌桶限流\n", t, func() {
+		now := time.Date(2025, 5, 14, 9, 0, 0, 0, time.UTC)
+		limiter := services.NewRateLimiter(1, 3)
+		limiter.Now = func() time.Time { return now }
+
+		Convey("连续请求不超过容量，超出后返回需等待的时间", func() {
+			for i := 0; i < 3; i++ {
+				allowed, _ := limiter.Allow("10.0.0.1")
+				So(allowed, ShouldBeTrue)
+			}
+			allowed, wait := limiter.Allow("10.0.0.1")
+			So(allowed, ShouldBeFalse)
+			So(wait, ShouldEqual, time.Second)
+
+			allowed, _ = limiter.Allow("10.0.0.2")
+			So(allowed, ShouldBeTrue)
+
+			now = now.Add(1500 * time.Millisecond)
+			allowed, _ = limiter.Allow("10.0.0.1")
+			So(allowed, ShouldBeTrue)
+			allowed, wait = limiter.Allow("10.0.0.1")
+			So(allowed, ShouldBeFalse)
+			So(wait, ShouldEqual, 500*time.Millisecond)
+		})
+
+		Convey("已补满的令牌桶被定期清理", func() {
+			limiter.Allow("10.0.0.1")
+			limiter.Allow("10.0.0.2")
+			So(limiter.Size(), ShouldEqual, 2)
+			now = now.Add(2 * time.Minute)
+			limiter.Allow("10.0.0.3")
+			So(limiter.Size(), ShouldEqual, 1)
+		})
+
+		Convey("来源地址数量达到上限后，新的来源地址同样被限流", func() {
+			limiter.MaxKeys = 2
+			limiter.Allow("10.0.0.1")
+			limiter.Allow("10.0.0.2")
+			allowed, wait := limiter.Allow("10.0.0.3")
+			So(allowed, ShouldBeFalse)
+			So(wait, ShouldEqual, time.Second)
+
+			now = now.Add(2 * time.Minute)
+			allowed, _ = limiter.Allow("10.0.0.3")
+			So(allowed, ShouldBeTrue)
+		})
+
+		Convey("超出限制的请求返回429和Retry-After", func() {
+			codes := map[int]int{}
+			var retryAfter string
+			for i := 0; i < 30; i++ {
+				w := httptest.NewRecorder()
+				r := httptest.NewRequest(http.MethodGet, "/api/public/trace?good_id=G1", nil)
+				r.RemoteAddr = "192.0.2.10:5000"
+				r.Header.Set("X-Forwarded-For", fmt.Sprintf("198.51.100.%d", i)) // 轮换伪造的地址不能绕过限流
+				ctx := context.NewContext()
+				ctx.Reset(w, r)
+				middleware.PublicRateLimit(ctx)
+				if w.Code == http.StatusTooManyRequests {
+					retryAfter = w.Header().Get("Retry-After")
+				}
+				codes[w.Code]++
+			}
+			So(codes[http.StatusTooManyRequests], ShouldBeGreaterThan, 0)
+			So(retryAfter, ShouldNotBeEmpty)
+		})
+	})
+}
+
+// TestTraceCache 溯源查询响应缓存
+func TestTraceCache(t *testing.T) {
+	Convey("Subject: 溯源查询缓存\n", t, func() {
+		now := time.Date(2025, 5, 14, 9, 0, 0, 0, time.UTC)
+		cache := services.NewTraceCache(2, time.Minute)
+		cache.Now = func() time.Time { return now }
+
+		Convey("相同内容的ETag相同，过期后不再返回", func() {
+			entry := cache.Put(services.TraceCachePublic, "G1", cache.Version(), []byte(`{"code":200}`))
+			cached, ok := cache.Get(services.TraceCachePublic, "G1")
+			So(ok, ShouldBeTrue)
+			So(cached.ETag, ShouldEqual, entry.ETag)
+			So(cache.Put(services.TraceCacheChain, "G9", cache.Version(), []byte(`{"code":200}`)).ETag, ShouldEqual, entry.ETag)
+
+			now = now.Add(time.Minute)
+			_, ok = cache.Get(services.TraceCachePublic, "G1")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("超出容量时淘汰最久未访问的条目", func() {
+			cache.Put(services.TraceCachePublic, "G1", cache.Version(), []byte("1"))
+			cache.Put(services.TraceCachePublic, "G2", cache.Version(), []byte("2"))
+			cache.Get(services.TraceCachePublic, "G1")
+			cache.Put(services.TraceCachePublic, "G3", cache.Version(), []byte("3"))
+			So(cache.Len(), ShouldEqual, 2)
+			_, ok := cache.Get(services.TraceCachePublic, "G2")
+			So(ok, ShouldBeFalse)
+			_, ok = cache.Get(services.TraceCachePublic, "G1")
+			So(ok, ShouldBeTrue)
+		})
+
+		Convey("失效前开始的查询不会写回旧数据", func() {
+			version := cache.Version()
+			cache.Invalidate("G1")
+			cache.Put(services.TraceCachePublic, "G1", version, []byte("stale"))
+			_, ok := cache.Get(services.TraceCachePublic, "G1")
+			So(ok, ShouldBeFalse)
+
+			cache.Put(services.TraceCachePublic, "G2", version, []byte("2"))
+			_, ok = cache.Get(services.TraceCachePublic, "G2")
+			So(ok, ShouldBeTrue)
+
+			cache.Invalidate("G3")
+			cache.Invalidate("G4")
+			cache.Put(services.TraceCachePublic, "G5", version, []byte("5"))
+			_, ok = cache.Get(services.TraceCachePublic, "G5")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("写入环节后失效该货物的全部缓存", func() {
+			cache.Put(services.TraceCachePublic, "G1", cache.Version(), []byte("1"))
+			cache.Put(services.TraceCacheChain, "G1", cache.Version(), []byte("1"))
+			cache.Invalidate("G1")
+			So(cache.Len(), ShouldEqual, 0)
+		})
+	})
+}
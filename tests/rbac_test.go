@@ -0,0 +1,84 @@
+package test
+
+import (
+	"testing"
+
+	"sea_trace_server_V2.0/middleware"
+	"sea_trace_server_V2.0/models"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestRBAC 角色权限与接口访问策略
+func TestRBAC(t *testing.T) {
+	Convey("Subject: 基于权限的访问控制\n", t, func() {
+		Convey("接口按方法和路径匹配所需权限", func() {
+			policy, ok := middleware.MatchRoutePolicy("POST", "/api/operator/goods/ship")
+			So(ok, ShouldBeTrue)
+			So(policy.Permission, ShouldEqual, models.PermGoodsShip)
+
+			policy, ok = middleware.MatchRoutePolicy("PUT", "/api/admin/company/operator/status/12")
+			So(ok, ShouldBeTrue)
+			So(policy.Permission, ShouldEqual, models.PermOperatorManage)
+
+			policy, _ = middleware.MatchRoutePolicy("GET", "/api/admin/company/info")
+			So(policy.Permission, ShouldEqual, models.PermCompanyView)
+			policy, _ = middleware.MatchRoutePolicy("PUT", "/api/admin/company/info")
+			So(policy.Permission, ShouldEqual, models.PermCompanyEdit)
+
+			_, ok = middleware.MatchRoutePolicy("GET", "/api/admin/unknown")
+			So(ok, ShouldBeFalse)
+			So(middleware.IsProtectedPath("/api/admin/unknown"), ShouldBeTrue)
+			So(middleware.IsProtectedPath("/api/public/trace"), ShouldBeFalse)
+		})
+
+		Convey("系统角色的默认权限", func() {
+			operator := models.SystemRolePermissions(models.RoleOperator)
+			So(operator.Has(models.PermGoodsShip), ShouldBeTrue)
+			So(operator.Has(models.PermOperatorManage), ShouldBeFalse)
+
+			admin := models.SystemRolePermissions(models.RoleCompanyAdmin)
+			So(admin.Has(models.PermRoleManage), ShouldBeTrue)
+			So(admin.Has(models.PermCompanyManage), ShouldBeFalse)
+
+			superAdmin := models.SystemRolePermissions(models.RoleSuperAdmin)
+			So(len(superAdmin), ShouldEqual, len(models.Permissions))
+			So(models.SystemRolePermissions("auditor"), ShouldBeEmpty)
+		})
+
+		Convey("公司自定义角色只能包含授予者自身拥有的公司权限", func() {
+			grantor := models.SystemRolePermissions(models.RoleCompanyAdmin)
+			auditor := []string{models.PermGoodsView, models.PermOperatorView, models.PermCompanyView}
+			So(models.ValidateCompanyRolePermissions(auditor, grantor), ShouldBeNil)
+
+			So(models.ValidateCompanyRolePermissions(nil, grantor), ShouldNotBeNil)
+			So(models.ValidateCompanyRolePermissions([]string{"goods.fly"}, grantor).Error(), ShouldEqual, "未知的权限: goods.fly")
+			So(models.ValidateCompanyRolePermissions([]string{models.PermTransactionView}, grantor), ShouldNotBeNil)
+
+			limited := models.NewPermissionSet(models.PermGoodsView, models.PermRoleManage)
+			So(models.ValidateCompanyRolePermissions([]string{models.PermGoodsShip}, limited).Error(),
+				ShouldEqual, "不能授予自己没有的权限: goods.ship")
+		})
+
+		Convey("不能修改公司管理员或权限高于自己的用户的角色", func() {
+			grantor := models.NewPermissionSet(models.PermGoodsView, models.PermRoleManage)
+			viewer := &models.User{Id: 3, Role: models.RoleOperator}
+			So(models.ValidateRoleAssignmentTarget(viewer, models.NewPermissionSet(models.PermGoodsView), grantor, false), ShouldBeNil)
+
+			shipper := models.NewPermissionSet(models.PermGoodsView, models.PermGoodsShip)
+			So(models.ValidateRoleAssignmentTarget(viewer, shipper, grantor, false).Error(),
+				ShouldEqual, "不能修改拥有自己没有的权限的用户: goods.ship")
+
+			admin := &models.User{Id: 2, Role: models.RoleCompanyAdmin}
+			companyAdmin := models.SystemRolePermissions(models.RoleCompanyAdmin)
+			So(models.ValidateRoleAssignmentTarget(admin, grantor, companyAdmin, false), ShouldNotBeNil)
+			So(models.ValidateRoleAssignmentTarget(admin, companyAdmin, models.NewPermissionSet(), true), ShouldBeNil)
+		})
+
+		Convey("权限列表去重排序后保存", func() {
+			joined := models.JoinPermissions([]string{models.PermGoodsView, models.PermCompanyView, models.PermGoodsView})
+			So(joined, ShouldEqual, "company.view,goods.view")
+			So(models.SplitPermissions(joined+", "), ShouldResemble, []string{"company.view", "goods.view"})
+		})
+	})
+}
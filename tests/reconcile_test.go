@@ -0,0 +1,117 @@
+package test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/services"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestCompareTrace 数据库记录与链上溯源记录的比对
+func TestCompareTrace(t *testing.T) {
+	Convey("Subject: 链上数据核对\n", t, func() {
+		now := time.Now().Truncate(time.Second)
+		old := now.Add(-2 * time.Hour)
+		chainAt := func(at time.Time) string { return strconv.FormatInt(at.UnixMilli(), 10) }
+
+		// fixture 生产、一段运输和一条处置记录均已上链且一致
+		fixture := func() (*models.Goods, *models.GoodStages, *services.TraceRecord) {
+			good := &models.Goods{GoodId: "G1", GoodName: "带鱼", OwnerCompanyId: 1, CreatedAt: old}
+			stages := &models.GoodStages{
+				Production: &models.GoodsProduction{Id: 1, GoodId: "G1", CreatedAt: old, ChainStatus: models.ChainStatusConfirmed},
+				TransportLegs: []*models.GoodsTransport{
+					{Id: 2, GoodId: "G1", LegIndex: 0, TransporterId: 2, StartLocation: "宁德", EndLocation: "福州",
+						TrackingNumber: "SF001", TransportInfo: "冷链", CreatedAt: old, ChainStatus: models.ChainStatusConfirmed},
+				},
+				Dispositions: []*models.GoodsDisposition{
+					{Id: 3, GoodId: "G1", CompanyId: 3, Reason: "复检", ToStatus: models.GoodsStatusQuarantined,
+						CreatedAt: old, ChainStatus: models.ChainStatusConfirmed},
+				},
+			}
+			trace := &services.TraceRecord{
+				GoodID: "G1", OwnerCompanyID: "1", GoodName: "带鱼", RegisterTime: chainAt(old),
+				TransportLegs: []services.TransportLegRecord{
+					{LegIndex: 0, ShipCompanyID: "2", FromLocation: "宁德", ToLocation: "福州",
+						TrackingNumber: "SF001", TransportInfo: "冷链", Time: chainAt(old)},
+				},
+				Dispositions: []services.DispositionRecord{
+					{Index: 0, CompanyID: "3", State: services.ChainGoodStateQuarantined, Reason: "复检", Time: chainAt(old)},
+				},
+			}
+			return good, stages, trace
+		}
+
+		cases := []struct {
+			name   string
+			mutate func(good *models.Goods, stages *models.GoodStages, trace *services.TraceRecord)
+			want   []string // 环节|字段|差异类型
+		}{
+			{"记录一致", func(*models.Goods, *models.GoodStages, *services.TraceRecord) {}, nil},
+			{"宽限期内尚未上链的环节不视为差异", func(_ *models.Goods, stages *models.GoodStages, _ *services.TraceRecord) {
+				stages.Delivery = &models.GoodsDelivery{Id: 4, DealerId: 4, DeliveryInfo: "已签收", CreatedAt: now, ChainStatus: models.ChainStatusPendingConfirmation}
+			}, nil},
+			{"超过宽限期仍未上链", func(_ *models.Goods, stages *models.GoodStages, _ *services.TraceRecord) {
+				stages.Delivery = &models.GoodsDelivery{Id: 4, DealerId: 4, DeliveryInfo: "已签收", CreatedAt: old, ChainStatus: models.ChainStatusPending}
+			}, []string{"delivery|exists|missing_on_chain"}},
+			{"发送失败的环节不等待宽限期", func(_ *models.Goods, stages *models.GoodStages, _ *services.TraceRecord) {
+				stages.Delivery = &models.GoodsDelivery{Id: 4, DealerId: 4, DeliveryInfo: "已签收", CreatedAt: now, ChainStatus: models.ChainStatusFailed}
+			}, []string{"delivery|exists|missing_on_chain"}},
+			{"链上有记录但数据库没有", func(_ *models.Goods, _ *models.GoodStages, trace *services.TraceRecord) {
+				trace.InspectExists, trace.PortCompanyID, trace.InspectionInfo, trace.InspectTime = true, "3", "合格", chainAt(old)
+			}, []string{"inspection|exists|missing_in_db"}},
+			{"公司不一致", func(_ *models.Goods, _ *models.GoodStages, trace *services.TraceRecord) {
+				trace.OwnerCompanyID = "9"
+			}, []string{"production|company_id|mismatch"}},
+			{"信息不一致", func(_ *models.Goods, _ *models.GoodStages, trace *services.TraceRecord) {
+				trace.GoodName = "黄鱼"
+			}, []string{"production|info|mismatch"}},
+			{"时间超出误差", func(_ *models.Goods, _ *models.GoodStages, trace *services.TraceRecord) {
+				trace.RegisterTime = chainAt(old.Add(11 * time.Minute))
+			}, []string{"production|timestamp|mismatch"}},
+			{"时间在误差范围内", func(_ *models.Goods, _ *models.GoodStages, trace *services.TraceRecord) {
+				trace.RegisterTime = chainAt(old.Add(9 * time.Minute))
+			}, nil},
+			{"运输段字段不一致", func(_ *models.Goods, _ *models.GoodStages, trace *services.TraceRecord) {
+				trace.TransportLegs[0].ToLocation = "厦门"
+				trace.TransportLegs[0].TrackingNumber = "SF002"
+			}, []string{"transport|leg0.end_location|mismatch", "transport|leg0.tracking_number|mismatch"}},
+			{"后续运输段未上链", func(_ *models.Goods, stages *models.GoodStages, _ *services.TraceRecord) {
+				stages.TransportLegs = append(stages.TransportLegs, &models.GoodsTransport{Id: 5, GoodId: "G1", LegIndex: 1,
+					TransporterId: 2, CreatedAt: old, ChainStatus: models.ChainStatusReverted})
+			}, []string{"transport|leg1.exists|missing_on_chain"}},
+			{"链上多出运输段", func(_ *models.Goods, _ *models.GoodStages, trace *services.TraceRecord) {
+				trace.TransportLegs = append(trace.TransportLegs, services.TransportLegRecord{LegIndex: 1, ShipCompanyID: "2", TransportInfo: "转运", Time: chainAt(old)})
+			}, []string{"transport|leg1.exists|missing_in_db"}},
+			{"处置状态不一致", func(_ *models.Goods, _ *models.GoodStages, trace *services.TraceRecord) {
+				trace.Dispositions[0].State = services.ChainGoodStateDestroyed
+			}, []string{"disposition|disp0.state|mismatch"}},
+			{"处置记录未上链", func(_ *models.Goods, stages *models.GoodStages, _ *services.TraceRecord) {
+				stages.Dispositions = append(stages.Dispositions, &models.GoodsDisposition{Id: 6, GoodId: "G1", CompanyId: 3,
+					Reason: "销毁", ToStatus: models.GoodsStatusDestroyed, CreatedAt: old, ChainStatus: models.ChainStatusFailed})
+			}, []string{"disposition|disp1.exists|missing_on_chain"}},
+			{"链上多出处置记录", func(_ *models.Goods, _ *models.GoodStages, trace *services.TraceRecord) {
+				trace.Dispositions = append(trace.Dispositions, services.DispositionRecord{Index: 1, CompanyID: "3",
+					State: services.ChainGoodStateDestroyed, Reason: "销毁", Time: chainAt(old)})
+			}, []string{"disposition|disp1.exists|missing_in_db"}},
+		}
+
+		for _, c := range cases {
+			c := c
+			Convey(c.name, func() {
+				good, stages, trace := fixture()
+				c.mutate(good, stages, trace)
+
+				var got []string
+				for _, d := range services.CompareTrace(good, stages, trace, 10*time.Minute, time.Hour, time.Time{}) {
+					So(d.GoodId, ShouldEqual, "G1")
+					got = append(got, d.Stage+"|"+d.Field+"|"+d.Kind)
+				}
+				So(got, ShouldResemble, c.want)
+			})
+		}
+	})
+}
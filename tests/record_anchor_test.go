@@ -0,0 +1,129 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"sea_trace_server_V2.0/models"
+	"sea_trace_server_V2.0/services"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestRecordAnchor 环节记录哈希锚定与核验
+func TestRecordAnchor(t *testing.T) {
+	Convey("Subject: 环节记录哈希\n", t, func() {
+		at := time.Date(2025, 5, 14, 9, 5, 3, 0, time.Local)
+		good := &models.Goods{GoodId: "G1", GoodName: "大黄鱼", OwnerCompanyId: 1, BatchNumber: "B001"}
+		production := &models.GoodsProduction{Id: 1, GoodId: "G1", Location: "宁德", ProducedAt: at,
+			ChainStatus: models.ChainStatusConfirmed}
+		inspection := &models.GoodsInspection{Id: 2, GoodId: "G1", InspectorId: 3, QualityScore: 95, PassStatus: true,
+			InspectionTime: at, Location: "厦门港", ChainStatus: models.ChainStatusConfirmed}
+		delivery := &models.GoodsDelivery{Id: 3, GoodId: "G1", DealerId: 4, RecipientName: "张三", DeliveryTime: at,
+			ChainStatus: models.ChainStatusPendingConfirmation}
+
+		Convey("哈希只取决于业务字段，与数据库编号和上链状态无关", func() {
+			first, err := models.StageRecordHash(nil, inspection)
+			So(err, ShouldBeNil)
+			So(first, ShouldHaveLength, 66)
+
+			copied := *inspection
+			copied.Id, copied.ChainStatus, copied.BlockNumber = 99, models.ChainStatusPending, 12
+			second, _ := models.StageRecordHash(nil, &copied)
+			So(second, ShouldEqual, first)
+
+			copied.QualityScore = 60
+			changed, _ := models.StageRecordHash(nil, &copied)
+			So(changed, ShouldNotEqual, first)
+
+			_, err = models.StageRecordHash(nil, production)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("模拟链锚定哈希后，修改数据库记录可被发现", func() {
+			chain := newSimulatorWithCompanies()
+			productionHash, _ := models.StageRecordHash(good, production)
+			inspectionHash, _ := models.StageRecordHash(nil, inspection)
+			deliveryHash, _ := models.StageRecordHash(nil, delivery)
+			chain.RegisterGood("G1", "大黄鱼", productionHash, simProducer)
+			chain.ShipGood("G1", "宁德", "厦门", "", "冷链运输", "", simShipper)
+			chain.InspectGood("G1", "合格", true, "", inspectionHash, simPort)
+			chain.DeliverGood("G1", "交付", deliveryHash, simDealer)
+
+			anchored, err := chain.GetRecordHash("G1", models.StageDelivery, 0)
+			So(err, ShouldBeNil)
+			So(anchored, ShouldEqual, deliveryHash)
+			_, err = chain.GetRecordHash("G1", models.StageInspection, 1)
+			So(err, ShouldNotBeNil)
+
+			stages := &models.GoodStages{
+				Production:    production,
+				TransportLegs: []*models.GoodsTransport{{Id: 4, GoodId: "G1", ChainStatus: models.ChainStatusConfirmed}},
+				Inspections:   []*models.GoodsInspection{inspection},
+				Delivery:      delivery,
+			}
+			report, err := services.VerifyRecordAnchors(chain, good, stages)
+			So(err, ShouldBeNil)
+			So(report.Intact, ShouldBeTrue)
+			So(report.Checks, ShouldHaveLength, 4)
+			So(report.Checks[0].Status, ShouldEqual, services.RecordAnchorMatch)
+			So(report.Checks[1].Status, ShouldEqual, services.RecordAnchorNotAnchored)
+
+			tampered := *delivery
+			tampered.RecipientName = "李四"
+			stages.Delivery = &tampered
+			good.BatchNumber = "B002"
+			report, _ = services.VerifyRecordAnchors(chain, good, stages)
+			So(report.Intact, ShouldBeFalse)
+			So(report.Mismatches, ShouldEqual, 2)
+			So(report.Checks[0].Status, ShouldEqual, services.RecordAnchorMismatch)
+			So(report.Checks[2].Status, ShouldEqual, services.RecordAnchorMatch)
+			So(report.Checks[3].Status, ShouldEqual, services.RecordAnchorMismatch)
+			So(report.Checks[3].AnchoredHash, ShouldEqual, deliveryHash)
+		})
+
+		Convey("尚未上链的记录不占用合约中的序号", func() {
+			chain := newSimulatorWithCompanies()
+			production.ChainStatus = models.ChainStatusFailed
+			report, err := services.VerifyRecordAnchors(chain, good, &models.GoodStages{Production: production})
+			So(err, ShouldBeNil)
+			So(report.Checks[0].Status, ShouldEqual, services.RecordAnchorOffChain)
+			So(report.Checks[0].Index, ShouldEqual, -1)
+			So(report.Intact, ShouldBeTrue)
+		})
+
+		Convey("核验不依赖数据库中的上链状态", func() {
+			chain := newSimulatorWithCompanies()
+			productionHash, _ := models.StageRecordHash(good, production)
+			inspectionHash, _ := models.StageRecordHash(nil, inspection)
+			chain.RegisterGood("G1", "大黄鱼", productionHash, simProducer)
+			chain.ShipGood("G1", "宁德", "厦门", "", "冷链运输", "", simShipper)
+			chain.InspectGood("G1", "合格", true, "", inspectionHash, simPort)
+
+			// 修改已上链的记录后把上链状态改为失败
+			tampered := *inspection
+			tampered.QualityScore, tampered.ChainStatus = 60, models.ChainStatusFailed
+			stages := &models.GoodStages{Production: production, Inspections: []*models.GoodsInspection{&tampered}}
+			report, err := services.VerifyRecordAnchors(chain, good, stages)
+			So(err, ShouldBeNil)
+			So(report.Intact, ShouldBeFalse)
+			So(report.Mismatches, ShouldEqual, 1)
+			So(report.Checks[1].Status, ShouldEqual, services.RecordAnchorMismatch)
+			So(report.Checks[1].AnchoredHash, ShouldEqual, inspectionHash)
+
+			// 删除数据库记录后链上的哈希没有对应的记录
+			report, _ = services.VerifyRecordAnchors(chain, good, &models.GoodStages{Production: production})
+			So(report.Mismatches, ShouldEqual, 1)
+			So(report.Checks[1].RecordID, ShouldEqual, 0)
+			So(report.Checks[1].Error, ShouldNotBeEmpty)
+
+			// 数据库记录已确认上链但链上没有对应的记录
+			delivery.ChainStatus = models.ChainStatusConfirmed
+			stages.Inspections[0] = inspection
+			stages.Delivery = delivery
+			report, _ = services.VerifyRecordAnchors(chain, good, stages)
+			So(report.Mismatches, ShouldEqual, 1)
+			So(report.Checks[2].Status, ShouldEqual, services.RecordAnchorMissing)
+		})
+	})
+}
@@ -0,0 +1,75 @@
+package test
+
+import (
+	"errors"
+	"testing"
+
+	"sea_trace_server_V2.0/services"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testPrivateKey = "0x4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+
+// fakeLocalKeys 模拟WeBASE-Front本地用户
+type fakeLocalKeys struct {
+	keys []services.LocalKeyStore
+}
+
+// ListLocalKeys 返回预置的本地用户
+func (f *fakeLocalKeys) ListLocalKeys() ([]services.LocalKeyStore, error) {
+	return f.keys, nil
+}
+
+// DeleteLocalKey 测试中不删除本地私钥
+func (f *fakeLocalKeys) DeleteLocalKey(address string) error {
+	return errors.New("not implemented")
+}
+
+// TestSignService 私钥托管签名服务
+func TestSignService(t *testing.T) {
+	Convey("Subject: WeBASE-Sign外部用户\n", t, func() {
+		signer := services.NewLocalSignService()
+
+		Convey("创建外部用户只返回地址和签名用户编号", func() {
+			provider := &services.SignAccountProvider{Sign: signer, AppID: "sea_trace_app"}
+			user, err := provider.CreateBlockchainUser("生产商")
+			So(err, ShouldBeNil)
+			So(user.Type, ShouldEqual, 2)
+			So(user.SignUserID, ShouldNotBeEmpty)
+			So(user.AppID, ShouldEqual, "sea_trace_app")
+			So(user.Address, ShouldStartWith, "0x")
+
+			stored, err := signer.GetSignUser(user.SignUserID)
+			So(err, ShouldBeNil)
+			So(stored.Address, ShouldEqual, user.Address)
+		})
+
+		Convey("迁移本地用户后地址保持不变", func() {
+			address, err := services.LocalSignerAddress(testPrivateKey)
+			So(err, ShouldBeNil)
+
+			migration := &services.KeyMigrationService{
+				Local: &fakeLocalKeys{},
+				Sign:  signer,
+				AppID: "sea_trace_app",
+			}
+			signUser, err := migration.MigrateKey(&services.LocalKeyStore{Address: address, PrivateKey: testPrivateKey})
+			So(err, ShouldBeNil)
+			So(signUser.Address, ShouldEqual, address)
+
+			_, err = migration.MigrateKey(&services.LocalKeyStore{Address: "0x1000000000000000000000000000000000000001", PrivateKey: testPrivateKey})
+			So(err.Error(), ShouldStartWith, "导入后地址不一致")
+
+			_, err = migration.MigrateKey(&services.LocalKeyStore{Address: address})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("同一签名用户编号不能重复创建", func() {
+			_, err := signer.CreateSignUser("u1", "sea_trace_app")
+			So(err, ShouldBeNil)
+			_, err = signer.ImportSignUser("u1", "sea_trace_app", testPrivateKey)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
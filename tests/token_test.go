@@ -0,0 +1,52 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/beego/beego/v2/server/web"
+	"github.com/golang-jwt/jwt"
+	"sea_trace_server_V2.0/utils"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// TestToken 访问令牌和刷新令牌
+func TestToken(t *testing.T) {
+	Convey("Subject: 登录令牌\n", t, func() {
+		Convey("访问令牌携带会话和令牌版本，有效期取自配置", func() {
+			token, err := utils.GenerateToken(7, "operator1", "operator", 3, "session-1", 2)
+			So(err, ShouldBeNil)
+
+			claims, err := utils.ParseToken(token)
+			So(err, ShouldBeNil)
+			So(claims.UserID, ShouldEqual, 7)
+			So(claims.CompanyId, ShouldEqual, 3)
+			So(claims.SessionID, ShouldEqual, "session-1")
+			So(claims.TokenVersion, ShouldEqual, 2)
+			So(time.Unix(claims.ExpiresAt, 0), ShouldHappenWithin, time.Minute, time.Now().Add(utils.AccessTokenTTL()))
+		})
+
+		Convey("只接受HS256签名的令牌", func() {
+			secret, _ := web.AppConfig.String("JWTSecretKey")
+			claims := utils.JWTClaims{UserID: 1, Role: "super_admin"}
+			claims.ExpiresAt = time.Now().Add(time.Hour).Unix()
+			token, err := jwt.NewWithClaims(jwt.SigningMethodHS512, claims).SignedString([]byte(secret))
+			So(err, ShouldBeNil)
+
+			_, err = utils.ParseToken(token)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("刷新令牌只保存哈希", func() {
+			token, hash, err := utils.GenerateRefreshToken()
+			So(err, ShouldBeNil)
+			So(hash, ShouldEqual, utils.HashRefreshToken(token))
+			So(hash, ShouldNotContainSubstring, token)
+			So(len(hash), ShouldEqual, 64)
+
+			other, _, _ := utils.GenerateRefreshToken()
+			So(other, ShouldNotEqual, token)
+		})
+	})
+}
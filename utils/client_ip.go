@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/beego/beego/v2/server/web"
+)
+
+// RemoteIP 与本服务直接建立连接的对端地址，不读取 X-Forwarded-For 等可由客户端伪造的请求头
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ClientIP 客户端地址，用于限流、登录防护等按来源地址计数的场景
+// 只有对端地址属于配置项 trusted_proxies（逗号分隔的IP或CIDR）中的反向代理时才采信 X-Forwarded-For，
+// 此时从右向左取第一个不属于可信代理的地址；未配置可信代理时即为对端地址
+func ClientIP(r *http.Request) string {
+	remote := RemoteIP(r)
+	proxies := trustedProxies()
+	if len(proxies) == 0 || !ipInNets(remote, proxies) {
+		return remote
+	}
+
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+		if !ipInNets(hop, proxies) {
+			return hop
+		}
+	}
+	return remote
+}
+
+// trustedProxies 解析配置的可信反向代理地址
+func trustedProxies() []*net.IPNet {
+	value, _ := web.AppConfig.String("trusted_proxies")
+	var nets []*net.IPNet
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if ip := net.ParseIP(item); ip != nil {
+			if v4 := ip.To4(); v4 != nil {
+				ip = v4
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(8*len(ip), 8*len(ip))})
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(item); err == nil {
+			nets = append(nets, ipNet)
+		}
+	}
+	return nets
+}
+
+// ipInNets 地址是否属于任一网段
+func ipInNets(value string, nets []*net.IPNet) bool {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return false
+	}
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package utils
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvTimeLayouts CSV中支持的日期格式
+var csvTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"}
+
+// DecodeCSV 将CSV数据解析到结构体切片中
+// 第一行为表头，列名与结构体字段的json名称对应，未知列忽略；支持字符串、整数、布尔和时间字段
+// out 必须是结构体切片的指针
+func DecodeCSV(r io.Reader, out interface{}) error {
+	slice := reflect.ValueOf(out)
+	if slice.Kind() != reflect.Ptr || slice.Elem().Kind() != reflect.Slice || slice.Elem().Type().Elem().Kind() != reflect.Struct {
+		return errors.New("out 必须是结构体切片的指针")
+	}
+	slice = slice.Elem()
+	elemType := slice.Type().Elem()
+
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return errors.New("CSV文件为空")
+	}
+	if err != nil {
+		return fmt.Errorf("读取CSV表头失败: %v", err)
+	}
+
+	// 按json名称建立列与字段的对应关系，-1 表示忽略该列
+	fieldIndex := make(map[string]int, elemType.NumField())
+	for i := 0; i < elemType.NumField(); i++ {
+		name := strings.Split(elemType.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fieldIndex[name] = i
+		}
+	}
+	columns := make([]int, len(header))
+	for i, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		if idx, ok := fieldIndex[name]; ok {
+			columns[i] = idx
+		} else {
+			columns[i] = -1
+		}
+	}
+
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("读取CSV第%d行失败: %v", line, err)
+		}
+
+		elem := reflect.New(elemType).Elem()
+		for i, value := range record {
+			if i >= len(columns) || columns[i] < 0 {
+				continue
+			}
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			if err := setCSVField(elem.Field(columns[i]), value); err != nil {
+				return fmt.Errorf("CSV第%d行%s列格式错误: %v", line, header[i], err)
+			}
+		}
+		slice.Set(reflect.Append(slice, elem))
+	}
+	return nil
+}
+
+// setCSVField 将CSV单元格的值写入结构体字段
+func setCSVField(field reflect.Value, value string) error {
+	if field.Type() == reflect.TypeOf(time.Time{}) {
+		for _, layout := range csvTimeLayouts {
+			if t, err := time.Parse(layout, value); err == nil {
+				field.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return fmt.Errorf("无法解析日期 '%s'", value)
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("不支持的字段类型 %s", field.Kind())
+	}
+	return nil
+}
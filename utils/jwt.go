@@ -1,6 +1,10 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"time"
 
@@ -10,15 +14,27 @@ import (
 
 // JWTClaims 自定义JWT声明
 type JWTClaims struct {
-	UserID    int    `json:"user_id"`
-	Username  string `json:"username"`
-	Role      string `json:"role"`
-	CompanyId int    `json:"company_id"`
+	UserID       int    `json:"user_id"`
+	Username     string `json:"username"`
+	Role         string `json:"role"`
+	CompanyId    int    `json:"company_id"`
+	SessionID    string `json:"sid"` // 登录会话，对应刷新令牌所属的会话，退出登录后失效
+	TokenVersion int    `json:"tv"`  // 签发时的用户令牌版本，用户被禁用时版本递增，旧令牌随之失效
 	jwt.StandardClaims
 }
 
-// GenerateToken 生成JWT令牌
-func GenerateToken(userID int, username, role string, companyID int) (string, error) {
+// AccessTokenTTL 访问令牌有效期，配置项 jwt_access_ttl（分钟），默认15分钟
+func AccessTokenTTL() time.Duration {
+	return time.Duration(web.AppConfig.DefaultInt("jwt_access_ttl", 15)) * time.Minute
+}
+
+// RefreshTokenTTL 刷新令牌有效期，配置项 jwt_refresh_ttl（小时），默认7天
+func RefreshTokenTTL() time.Duration {
+	return time.Duration(web.AppConfig.DefaultInt("jwt_refresh_ttl", 168)) * time.Hour
+}
+
+// GenerateToken 生成JWT访问令牌
+func GenerateToken(userID int, username, role string, companyID int, sessionID string, tokenVersion int) (string, error) {
 	// 从配置获取密钥
 	secretKey, err := web.AppConfig.String("JWTSecretKey")
 	if err != nil {
@@ -27,12 +43,14 @@ func GenerateToken(userID int, username, role string, companyID int) (string, er
 
 	// 创建Token
 	claims := JWTClaims{
-		UserID:    userID,
-		Username:  username,
-		Role:      role,
-		CompanyId: companyID,
+		UserID:       userID,
+		Username:     username,
+		Role:         role,
+		CompanyId:    companyID,
+		SessionID:    sessionID,
+		TokenVersion: tokenVersion,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 24).Unix(),
+			ExpiresAt: time.Now().Add(AccessTokenTTL()).Unix(),
 			IssuedAt:  time.Now().Unix(),
 			Issuer:    "sea_trace_system",
 		},
@@ -50,8 +68,11 @@ func ParseToken(tokenString string) (*JWTClaims, error) {
 		return nil, err
 	}
 
-	// 解析令牌
+	// 解析令牌，只接受HS256签名
 	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("不支持的签名算法")
+		}
 		return []byte(secretKey), nil
 	})
 
@@ -66,3 +87,19 @@ func ParseToken(tokenString string) (*JWTClaims, error) {
 
 	return nil, errors.New("无效的令牌")
 }
+
+// GenerateRefreshToken 生成随机刷新令牌，返回令牌及其哈希，数据库中只保存哈希
+func GenerateRefreshToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken 计算刷新令牌的哈希
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// MaskName 脱敏人名：保留第一个字，其余以星号代替，如 张三 -> 张*
+func MaskName(name string) string {
+	runes := []rune(strings.TrimSpace(name))
+	switch len(runes) {
+	case 0:
+		return ""
+	case 1:
+		return "*"
+	}
+	return string(runes[0]) + strings.Repeat("*", len(runes)-1)
+}
+
+// MaskPhone 脱敏电话号码：至少隐藏4位数字，如 13800001234 -> 138****1234、87654321 -> ****4321
+// 数字不少于11位时保留前3位和后4位，8至10位只保留后4位，少于8位时全部以星号代替；非数字字符原样保留
+func MaskPhone(phone string) string {
+	phone = strings.TrimSpace(phone)
+	digits := 0
+	for _, r := range phone {
+		if unicode.IsDigit(r) {
+			digits++
+		}
+	}
+
+	head, tail := 0, 0
+	if digits >= 11 {
+		head = 3
+	}
+	if digits >= 8 {
+		tail = 4
+	}
+
+	var masked strings.Builder
+	seen := 0
+	for _, r := range phone {
+		if !unicode.IsDigit(r) {
+			masked.WriteRune(r)
+			continue
+		}
+		if seen < head || seen >= digits-tail {
+			masked.WriteRune(r)
+		} else {
+			masked.WriteByte('*')
+		}
+		seen++
+	}
+	return masked.String()
+}
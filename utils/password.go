@@ -1,6 +1,10 @@
 package utils
 
 import (
+	"errors"
+	"fmt"
+	"unicode"
+
 	"github.com/beego/beego/v2/core/logs"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -18,3 +22,26 @@ func CheckPasswordHash(password, hash string) bool {
 	logs.Emergency(err)
 	return err == nil
 }
+
+// PasswordMinLength 密码最小长度
+const PasswordMinLength = 8
+
+// ValidatePassword 校验密码强度：至少 PasswordMinLength 位，且同时包含字母和数字
+func ValidatePassword(password string) error {
+	if len(password) < PasswordMinLength {
+		return fmt.Errorf("密码长度不能少于%d位", PasswordMinLength)
+	}
+	var letter, digit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			letter = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	if !letter || !digit {
+		return errors.New("密码必须同时包含字母和数字")
+	}
+	return nil
+}
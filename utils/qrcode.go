@@ -0,0 +1,546 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+)
+
+// QRLevel 二维码纠错等级
+type QRLevel int
+
+// 纠错等级，依次可恢复约7%、15%、25%、30%的数据
+const (
+	QRLevelL QRLevel = iota
+	QRLevelM
+	QRLevelQ
+	QRLevelH
+)
+
+// QRQuietZone 二维码四周的空白区，单位为模块
+const QRQuietZone = 4
+
+// ErrQRDataTooLong 内容超出版本40的容量
+var ErrQRDataTooLong = errors.New("二维码内容过长")
+
+// qrFormatBits 纠错等级在格式信息中的编码
+var qrFormatBits = [4]int{1, 0, 3, 2}
+
+// qrECCPerBlock 各纠错等级、各版本每个数据块的纠错码字数，下标0不使用
+var qrECCPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// qrNumBlocks 各纠错等级、各版本的数据块数，下标0不使用
+var qrNumBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// QRCode 二维码矩阵，使用字节模式编码，按容量选择最小版本
+type QRCode struct {
+	Version int
+	Size    int
+	Level   QRLevel
+
+	modules    [][]bool
+	isFunction [][]bool
+}
+
+// EncodeQR 将内容编码为二维码
+func EncodeQR(content string, level QRLevel) (*QRCode, error) {
+	data := []byte(content)
+	version := 0
+	for v := 1; v <= 40; v++ {
+		if qrBitLength(len(data), v) <= qrDataCodewords(v, level)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrQRDataTooLong
+	}
+
+	// 模式指示符、字符数和数据，之后补终止符和填充字节
+	capacity := qrDataCodewords(version, level) * 8
+	bits := &qrBitBuffer{}
+	bits.append(0x4, 4)
+	bits.append(len(data), qrCountBits(version))
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	bits.append(0, min(4, capacity-bits.len()))
+	bits.append(0, (8-bits.len()%8)%8)
+	for pad := 0xEC; bits.len() < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	qr := &QRCode{Version: version, Size: version*4 + 17, Level: level}
+	qr.modules = make([][]bool, qr.Size)
+	qr.isFunction = make([][]bool, qr.Size)
+	for i := range qr.modules {
+		qr.modules[i] = make([]bool, qr.Size)
+		qr.isFunction[i] = make([]bool, qr.Size)
+	}
+	qr.drawFunctionPatterns()
+	qr.drawCodewords(qr.addECCAndInterleave(bits.bytes()))
+
+	// 选择惩罚分最低的掩码
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		qr.applyMask(mask)
+		qr.drawFormatBits(mask)
+		if penalty := qr.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			best, bestPenalty = mask, penalty
+		}
+		qr.applyMask(mask)
+	}
+	qr.applyMask(best)
+	qr.drawFormatBits(best)
+	return qr, nil
+}
+
+// Dark 模块是否为深色，x 为列，y 为行
+func (qr *QRCode) Dark(x, y int) bool {
+	return x >= 0 && y >= 0 && x < qr.Size && y < qr.Size && qr.modules[y][x]
+}
+
+// Image 生成图像，scale 为每个模块的像素数，四周保留 QRQuietZone 个模块的空白
+func (qr *QRCode) Image(scale int) *image.Paletted {
+	if scale < 1 {
+		scale = 1
+	}
+	side := (qr.Size + QRQuietZone*2) * scale
+	img := image.NewPaletted(image.Rect(0, 0, side, side), color.Palette{color.White, color.Black})
+	for y := 0; y < qr.Size; y++ {
+		for x := 0; x < qr.Size; x++ {
+			if !qr.modules[y][x] {
+				continue
+			}
+			top, left := (y+QRQuietZone)*scale, (x+QRQuietZone)*scale
+			for dy := 0; dy < scale; dy++ {
+				row := img.Pix[(top+dy)*img.Stride+left : (top+dy)*img.Stride+left+scale]
+				for i := range row {
+					row[i] = 1
+				}
+			}
+		}
+	}
+	return img
+}
+
+// PNG 生成PNG图片
+func (qr *QRCode) PNG(scale int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, qr.Image(scale)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SVG 生成SVG图片，scale 为每个模块的显示尺寸
+func (qr *QRCode) SVG(scale int) string {
+	if scale < 1 {
+		scale = 1
+	}
+	side := qr.Size + QRQuietZone*2
+	var path strings.Builder
+	for y := 0; y < qr.Size; y++ {
+		for x := 0; x < qr.Size; x++ {
+			if qr.modules[y][x] {
+				fmt.Fprintf(&path, "M%d,%dh1v1h-1z", x+QRQuietZone, y+QRQuietZone)
+			}
+		}
+	}
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">
+<rect width="100%%" height="100%%" fill="#FFFFFF"/>
+<path d="%s" fill="#000000"/>
+</svg>
+`, side*scale, side*scale, side, side, path.String())
+}
+
+// qrCountBits 字节模式字符数字段的位数
+func qrCountBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+// qrBitLength 字节模式数据段的总位数
+func qrBitLength(n, version int) int {
+	return 4 + qrCountBits(version) + n*8
+}
+
+// qrRawDataModules 除功能图形外可放置数据的模块数
+func qrRawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		numAlign := version/7 + 2
+		result -= (25*numAlign-10)*numAlign - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+// qrDataCodewords 可容纳的数据码字数
+func qrDataCodewords(version int, level QRLevel) int {
+	return qrRawDataModules(version)/8 - qrECCPerBlock[level][version]*qrNumBlocks[level][version]
+}
+
+// qrAlignmentPositions 校正图形中心的行列坐标
+func qrAlignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	numAlign := version/7 + 2
+	step := (version*8 + numAlign*3 + 5) / (numAlign*4 - 4) * 2
+	positions := make([]int, numAlign)
+	positions[0] = 6
+	for i, pos := numAlign-1, version*4+10; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// set 设置功能图形模块
+func (qr *QRCode) set(x, y int, dark bool) {
+	qr.modules[y][x] = dark
+	qr.isFunction[y][x] = true
+}
+
+// drawFunctionPatterns 绘制定时图形、定位图形、校正图形，并预留格式信息和版本信息的位置
+func (qr *QRCode) drawFunctionPatterns() {
+	for i := 0; i < qr.Size; i++ {
+		qr.set(6, i, i%2 == 0)
+		qr.set(i, 6, i%2 == 0)
+	}
+
+	qr.drawFinder(3, 3)
+	qr.drawFinder(qr.Size-4, 3)
+	qr.drawFinder(3, qr.Size-4)
+
+	positions := qrAlignmentPositions(qr.Version)
+	last := len(positions) - 1
+	for i, y := range positions {
+		for j, x := range positions {
+			// 与定位图形重叠的三个位置不绘制
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					qr.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	qr.drawFormatBits(0)
+	qr.drawVersion()
+}
+
+// drawFinder 以 (x, y) 为中心绘制定位图形及其分隔符
+func (qr *QRCode) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || yy < 0 || xx >= qr.Size || yy >= qr.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			qr.set(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawFormatBits 绘制纠错等级和掩码的格式信息，两处各一份
+func (qr *QRCode) drawFormatBits(mask int) {
+	data := qrFormatBits[qr.Level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>i)&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		qr.set(8, i, bit(i))
+	}
+	qr.set(8, 7, bit(6))
+	qr.set(8, 8, bit(7))
+	qr.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		qr.set(14-i, 8, bit(i))
+	}
+
+	for i := 0; i < 8; i++ {
+		qr.set(qr.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		qr.set(8, qr.Size-15+i, bit(i))
+	}
+	qr.set(8, qr.Size-8, true)
+}
+
+// drawVersion 版本7及以上绘制版本信息
+func (qr *QRCode) drawVersion() {
+	if qr.Version < 7 {
+		return
+	}
+	rem := qr.Version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := qr.Version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := (bits>>i)&1 != 0
+		a, b := qr.Size-11+i%3, i/3
+		qr.set(a, b, dark)
+		qr.set(b, a, dark)
+	}
+}
+
+// addECCAndInterleave 分块计算纠错码，并按规范交错排列
+func (qr *QRCode) addECCAndInterleave(data []byte) []byte {
+	numBlocks := qrNumBlocks[qr.Level][qr.Version]
+	eccLen := qrECCPerBlock[qr.Level][qr.Version]
+	rawCodewords := qrRawDataModules(qr.Version) / 8
+	numShortBlocks := numBlocks - rawCodewords%numBlocks
+	shortBlockLen := rawCodewords / numBlocks
+
+	divisor := qrReedSolomonDivisor(eccLen)
+	blocks := make([][]byte, 0, numBlocks)
+	for i, k := 0, 0; i < numBlocks; i++ {
+		n := shortBlockLen - eccLen
+		if i >= numShortBlocks {
+			n++
+		}
+		block := append([]byte{}, data[k:k+n]...)
+		k += n
+		ecc := qrReedSolomonRemainder(block, divisor)
+		if i < numShortBlocks {
+			block = append(block, 0)
+		}
+		blocks = append(blocks, append(block, ecc...))
+	}
+
+	result := make([]byte, 0, rawCodewords)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			// 短块在该位置是补位，跳过
+			if i != shortBlockLen-eccLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// drawCodewords 按之字形顺序将码字放入数据区
+func (qr *QRCode) drawCodewords(data []byte) {
+	i := 0
+	for right := qr.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < qr.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = qr.Size - 1 - vert
+				}
+				if !qr.isFunction[y][x] && i < len(data)*8 {
+					qr.modules[y][x] = (data[i>>3]>>(7-uint(i&7)))&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask 对数据区应用掩码，再次应用即可撤销
+func (qr *QRCode) applyMask(mask int) {
+	for y := 0; y < qr.Size; y++ {
+		for x := 0; x < qr.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !qr.isFunction[y][x] {
+				qr.modules[y][x] = !qr.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty 按规范的四条规则计算掩码惩罚分
+func (qr *QRCode) penalty() int {
+	const n1, n2, n3, n4 = 3, 3, 40, 10
+	result := 0
+	finderLike := [][]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+
+	for _, horizontal := range []bool{true, false} {
+		at := func(i, j int) bool {
+			if horizontal {
+				return qr.modules[i][j]
+			}
+			return qr.modules[j][i]
+		}
+		for i := 0; i < qr.Size; i++ {
+			// 规则1：同色连续5个及以上
+			run := 1
+			for j := 1; j <= qr.Size; j++ {
+				if j < qr.Size && at(i, j) == at(i, j-1) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					result += n1 + run - 5
+				}
+				run = 1
+			}
+			// 规则3：类似定位图形的 1:1:3:1:1 序列
+			for j := 0; j+11 <= qr.Size; j++ {
+				for _, pattern := range finderLike {
+					matched := true
+					for k, dark := range pattern {
+						if at(i, j+k) != dark {
+							matched = false
+							break
+						}
+					}
+					if matched {
+						result += n3
+					}
+				}
+			}
+		}
+	}
+
+	// 规则2：同色2x2方块
+	dark := 0
+	for y := 0; y < qr.Size; y++ {
+		for x := 0; x < qr.Size; x++ {
+			if qr.modules[y][x] {
+				dark++
+			}
+			if x > 0 && y > 0 {
+				c := qr.modules[y][x]
+				if c == qr.modules[y][x-1] && c == qr.modules[y-1][x] && c == qr.modules[y-1][x-1] {
+					result += n2
+				}
+			}
+		}
+	}
+
+	// 规则4：深色模块比例偏离50%
+	total := qr.Size * qr.Size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	result += k * n4
+	return result
+}
+
+// qrBitBuffer 按位追加的缓冲区
+type qrBitBuffer struct {
+	bits []bool
+}
+
+func (b *qrBitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		b.bits = append(b.bits, (value>>uint(i))&1 != 0)
+	}
+}
+
+func (b *qrBitBuffer) len() int {
+	return len(b.bits)
+}
+
+func (b *qrBitBuffer) bytes() []byte {
+	result := make([]byte, (len(b.bits)+7)/8)
+	for i, bit := range b.bits {
+		if bit {
+			result[i>>3] |= 1 << (7 - uint(i&7))
+		}
+	}
+	return result
+}
+
+// qrReedSolomonDivisor 生成多项式，最高次项系数省略
+func qrReedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = qrGFMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = qrGFMultiply(root, 0x02)
+	}
+	return result
+}
+
+// qrReedSolomonRemainder 计算数据除以生成多项式的余式，即纠错码字
+func qrReedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= qrGFMultiply(coef, factor)
+		}
+	}
+	return result
+}
+
+// qrGFMultiply GF(2^8) 乘法，本原多项式 0x11D
+func qrGFMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
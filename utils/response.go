@@ -24,6 +24,15 @@ func ErrorResponse(message string) *Response {
 	}
 }
 
+// ErrorResponseWithData 携带数据的错误响应，用于返回出错的明细
+func ErrorResponseWithData(message string, data interface{}) *Response {
+	return &Response{
+		Code:    500,
+		Message: message,
+		Data:    data,
+	}
+}
+
 // UnauthorizedResponse 未授权响应
 func UnauthorizedResponse() *Response {
 	return &Response{